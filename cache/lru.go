@@ -0,0 +1,98 @@
+// Package cache provides an in-memory least recently used cache of byte
+// slices, bounded by the total number of bytes held.
+package cache
+
+import (
+	"container/list"
+	"sync"
+)
+
+// LRU is a size-bounded least recently used cache.  It is safe for
+// concurrent use.
+type LRU struct {
+	mutex    sync.Mutex
+	maxBytes int
+	bytes    int
+	order    *list.List // Most recently used at the front.
+	entries  map[string]*list.Element
+	hits     uint64
+	misses   uint64
+}
+
+type entry struct {
+	key   string
+	value []byte
+}
+
+// New is a factory method that creates an LRU holding at most maxBytes bytes
+// of values.
+func New(maxBytes int) *LRU {
+	return &LRU{
+		maxBytes: maxBytes,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+// Get returns the value stored under key, if there is one, and marks it as
+// recently used.
+func (c *LRU) Get(key string) ([]byte, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+	c.hits++
+	c.order.MoveToFront(element)
+	return element.Value.(*entry).value, true
+}
+
+// Add stores value under key, discarding the least recently used values if
+// necessary to make room.  A value bigger than the whole cache is not stored.
+func (c *LRU) Add(key string, value []byte) {
+	if len(value) > c.maxBytes {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if element, ok := c.entries[key]; ok {
+		c.bytes -= len(element.Value.(*entry).value)
+		element.Value.(*entry).value = value
+		c.bytes += len(value)
+		c.order.MoveToFront(element)
+	} else {
+		c.entries[key] = c.order.PushFront(&entry{key, value})
+		c.bytes += len(value)
+	}
+	for c.bytes > c.maxBytes {
+		oldest := c.order.Back()
+		e := oldest.Value.(*entry)
+		c.order.Remove(oldest)
+		delete(c.entries, e.key)
+		c.bytes -= len(e.value)
+	}
+}
+
+// Len returns the number of values in the cache.
+func (c *LRU) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.order.Len()
+}
+
+// Bytes returns the total size of the values in the cache.
+func (c *LRU) Bytes() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.bytes
+}
+
+// Stats returns the number of calls to Get that found a value and the number
+// that didn't.
+func (c *LRU) Stats() (hits, misses uint64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.hits, c.misses
+}
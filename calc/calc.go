@@ -0,0 +1,506 @@
+// Package calc evaluates arithmetic expressions over Grids cell by cell, for
+// example "(a - b) * 2 > 1.5 ? 1 : nodata".
+//
+// An expression is made of numbers, variables naming Grids, the operators
+// below, function calls and brackets.  From the loosest binding to the
+// tightest, the operators are
+//
+//	c ? x : y      x if c is true, otherwise y
+//	||             or
+//	&&             and
+//	== !=          equal, not equal
+//	< <= > >=      comparisons
+//	+ -            add, subtract
+//	* / %          multiply, divide, remainder
+//	- !            negate, not (prefix)
+//	^              power
+//
+// Comparisons and logical operators give 1 for true and 0 for false, and any
+// value other than 0 counts as true.  The functions are abs, sqrt, exp, log
+// (natural), log10, floor, ceil, round, min and max (of two or more values),
+// and isnodata, which gives 1 if its argument is No Data and 0 otherwise.
+//
+// The word nodata stands for the No Data value.  A cell holding the No Data
+// value in any Grid used in a calculation makes the result No Data, except
+// in the branch of a ?: that isn't taken and in isnodata.  Results that are
+// not finite numbers, such as the square root of a negative number or a
+// division by zero, are No Data too.
+package calc
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/goblimey/tiler/esri"
+)
+
+// Expression is a parsed expression, ready to be evaluated.
+type Expression struct {
+	text      string
+	root      evaluator
+	variables []string
+}
+
+// evaluator works out the value of part of an expression for one cell,
+// given the values of the variables.  NaN stands for No Data.
+type evaluator func(values []float64) float64
+
+// Parse is a factory method that parses an expression.
+func Parse(text string) (*Expression, error) {
+	tokens, err := scan(text)
+	if err != nil {
+		return nil, err
+	}
+	p := parser{text: text, tokens: tokens, index: make(map[string]int)}
+	root, err := p.ternary()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != end {
+		return nil, p.errorf("unexpected %q", p.peek().text)
+	}
+	return &Expression{text: text, root: root, variables: p.variables}, nil
+}
+
+// Variables returns the names of the variables used in the expression, in
+// the order they first appear.
+func (e *Expression) Variables() []string {
+	return append([]string(nil), e.variables...)
+}
+
+// String returns the text of the expression.
+func (e *Expression) String() string {
+	return e.text
+}
+
+// Evaluate works out the expression for every cell, taking the value of
+// each variable from the Grid of the same name.  The Grids must line up as
+// described for esri.Grid.Aligned.  The result has the same header as the
+// Grid of the first variable.
+func (e *Expression) Evaluate(grids map[string]*esri.Grid) (*esri.Grid, error) {
+	if len(e.variables) == 0 {
+		return nil, fmt.Errorf("calc: %q uses no grids", e.text)
+	}
+	bound := make([]*esri.Grid, len(e.variables))
+	for i, name := range e.variables {
+		g, ok := grids[name]
+		if !ok {
+			return nil, fmt.Errorf("calc: no grid called %s", name)
+		}
+		if i > 0 {
+			err := bound[0].Aligned(g)
+			if err != nil {
+				return nil, fmt.Errorf("calc: %s and %s: %w", e.variables[0], name, err)
+			}
+		}
+		bound[i] = g
+	}
+
+	first := bound[0]
+	result := esri.NewGrid(first.Ncols(), first.Nrows())
+	result.SetXllcorner(first.Xllcorner())
+	result.SetYllcorner(first.Yllcorner())
+	result.SetCellSize(first.CellSize())
+	result.SetNoDataValue(first.NoDataValue())
+	noData := float32(first.NoDataValue())
+
+	values := make([]float64, len(bound))
+	for row := 0; row < first.Nrows(); row++ {
+		for col := 0; col < first.Ncols(); col++ {
+			for i, g := range bound {
+				if g.IsNoData(row, col) {
+					values[i] = math.NaN()
+				} else {
+					values[i] = float64(g.Height(row, col))
+				}
+			}
+			v := e.root(values)
+			if math.IsNaN(v) || math.IsInf(v, 0) || math.Abs(v) > math.MaxFloat32 {
+				result.SetHeight(row, col, noData)
+				continue
+			}
+			h := float32(v)
+			if h == noData {
+				// Don't let a real value look like missing data.
+				h = math.Nextafter32(h, 0)
+			}
+			result.SetHeight(row, col, h)
+		}
+	}
+	return result, nil
+}
+
+// The kinds of token.
+const (
+	end = iota
+	number
+	name
+	operator
+)
+
+type token struct {
+	kind  int
+	text  string
+	value float64
+	pos   int
+}
+
+// operators lists the operators, longest first so that "<=" isn't read as
+// "<" then "=".
+var operators = []string{"<=", ">=", "==", "!=", "&&", "||",
+	"+", "-", "*", "/", "%", "^", "(", ")", ",", "?", ":", "<", ">", "!"}
+
+// scan splits the text of an expression into tokens.
+func scan(text string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(text) {
+		c := rune(text[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case unicode.IsDigit(c) || c == '.':
+			start := i
+			for i < len(text) && (unicode.IsDigit(rune(text[i])) || text[i] == '.') {
+				i++
+			}
+			// An exponent, such as 1e-3.
+			if i < len(text) && (text[i] == 'e' || text[i] == 'E') {
+				j := i + 1
+				if j < len(text) && (text[j] == '+' || text[j] == '-') {
+					j++
+				}
+				if j < len(text) && unicode.IsDigit(rune(text[j])) {
+					i = j
+					for i < len(text) && unicode.IsDigit(rune(text[i])) {
+						i++
+					}
+				}
+			}
+			v, err := strconv.ParseFloat(text[start:i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("calc: bad number %q at %d in %q", text[start:i], start+1, text)
+			}
+			tokens = append(tokens, token{kind: number, text: text[start:i], value: v, pos: start})
+		case unicode.IsLetter(c) || c == '_':
+			start := i
+			for i < len(text) && (unicode.IsLetter(rune(text[i])) || unicode.IsDigit(rune(text[i])) || text[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, token{kind: name, text: text[start:i], pos: start})
+		default:
+			found := false
+			for _, op := range operators {
+				if strings.HasPrefix(text[i:], op) {
+					tokens = append(tokens, token{kind: operator, text: op, pos: i})
+					i += len(op)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("calc: unexpected %q at %d in %q", c, i+1, text)
+			}
+		}
+	}
+	return append(tokens, token{kind: end, text: "end of expression", pos: len(text)}), nil
+}
+
+// parser reads tokens by recursive descent, one method for each level of
+// binding, and builds evaluators.
+type parser struct {
+	text      string
+	tokens    []token
+	next      int
+	variables []string
+	index     map[string]int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.next]
+}
+
+// accept consumes the next token and returns true if it's the operator op.
+func (p *parser) accept(op string) bool {
+	t := p.peek()
+	if t.kind == operator && t.text == op {
+		p.next++
+		return true
+	}
+	return false
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("calc: %s at %d in %q", fmt.Sprintf(format, args...), p.peek().pos+1, p.text)
+}
+
+func (p *parser) ternary() (evaluator, error) {
+	condition, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if !p.accept("?") {
+		return condition, nil
+	}
+	yes, err := p.ternary()
+	if err != nil {
+		return nil, err
+	}
+	if !p.accept(":") {
+		return nil, p.errorf("expected \":\"")
+	}
+	no, err := p.ternary()
+	if err != nil {
+		return nil, err
+	}
+	return func(v []float64) float64 {
+		c := condition(v)
+		switch {
+		case math.IsNaN(c):
+			return c
+		case c != 0:
+			return yes(v)
+		default:
+			return no(v)
+		}
+	}, nil
+}
+
+// binary parses a level of left associative binary operators, with
+// operands parsed by next.
+func (p *parser) binary(next func() (evaluator, error), ops map[string]func(a, b float64) float64) (evaluator, error) {
+	left, err := next()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		f, ok := ops[t.text]
+		if t.kind != operator || !ok {
+			return left, nil
+		}
+		p.next++
+		right, err := next()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(v []float64) float64 {
+			a, b := l(v), right(v)
+			if math.IsNaN(a) || math.IsNaN(b) {
+				return math.NaN()
+			}
+			return f(a, b)
+		}
+	}
+}
+
+func truth(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (p *parser) or() (evaluator, error) {
+	return p.binary(p.and, map[string]func(a, b float64) float64{
+		"||": func(a, b float64) float64 { return truth(a != 0 || b != 0) },
+	})
+}
+
+func (p *parser) and() (evaluator, error) {
+	return p.binary(p.equality, map[string]func(a, b float64) float64{
+		"&&": func(a, b float64) float64 { return truth(a != 0 && b != 0) },
+	})
+}
+
+func (p *parser) equality() (evaluator, error) {
+	return p.binary(p.comparison, map[string]func(a, b float64) float64{
+		"==": func(a, b float64) float64 { return truth(a == b) },
+		"!=": func(a, b float64) float64 { return truth(a != b) },
+	})
+}
+
+func (p *parser) comparison() (evaluator, error) {
+	return p.binary(p.sum, map[string]func(a, b float64) float64{
+		"<":  func(a, b float64) float64 { return truth(a < b) },
+		"<=": func(a, b float64) float64 { return truth(a <= b) },
+		">":  func(a, b float64) float64 { return truth(a > b) },
+		">=": func(a, b float64) float64 { return truth(a >= b) },
+	})
+}
+
+func (p *parser) sum() (evaluator, error) {
+	return p.binary(p.product, map[string]func(a, b float64) float64{
+		"+": func(a, b float64) float64 { return a + b },
+		"-": func(a, b float64) float64 { return a - b },
+	})
+}
+
+func (p *parser) product() (evaluator, error) {
+	return p.binary(p.unary, map[string]func(a, b float64) float64{
+		"*": func(a, b float64) float64 { return a * b },
+		"/": func(a, b float64) float64 { return a / b },
+		"%": math.Mod,
+	})
+}
+
+func (p *parser) unary() (evaluator, error) {
+	if p.accept("-") {
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return func(v []float64) float64 { return -operand(v) }, nil
+	}
+	if p.accept("!") {
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return func(v []float64) float64 {
+			a := operand(v)
+			if math.IsNaN(a) {
+				return a
+			}
+			return truth(a == 0)
+		}, nil
+	}
+	return p.power()
+}
+
+// power parses "^", which is right associative and binds tighter than the
+// prefix operators, so -2^2 is -4.
+func (p *parser) power() (evaluator, error) {
+	base, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	if !p.accept("^") {
+		return base, nil
+	}
+	exponent, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	return func(v []float64) float64 {
+		// math.Pow(NaN, 0) is 1, but No Data to any power is No Data.
+		a, b := base(v), exponent(v)
+		if math.IsNaN(a) || math.IsNaN(b) {
+			return math.NaN()
+		}
+		return math.Pow(a, b)
+	}, nil
+}
+
+// functions gives the functions of one argument, all of which give No Data
+// for No Data.
+var functions = map[string]func(float64) float64{
+	"abs":   math.Abs,
+	"sqrt":  math.Sqrt,
+	"exp":   math.Exp,
+	"log":   math.Log,
+	"log10": math.Log10,
+	"floor": math.Floor,
+	"ceil":  math.Ceil,
+	"round": math.Round,
+}
+
+func (p *parser) primary() (evaluator, error) {
+	t := p.peek()
+	switch t.kind {
+	case number:
+		p.next++
+		value := t.value
+		return func([]float64) float64 { return value }, nil
+	case name:
+		p.next++
+		if p.peek().kind == operator && p.peek().text == "(" {
+			return p.call(t)
+		}
+		if t.text == "nodata" {
+			return func([]float64) float64 { return math.NaN() }, nil
+		}
+		i, ok := p.index[t.text]
+		if !ok {
+			i = len(p.variables)
+			p.index[t.text] = i
+			p.variables = append(p.variables, t.text)
+		}
+		return func(v []float64) float64 { return v[i] }, nil
+	}
+	if p.accept("(") {
+		inner, err := p.ternary()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(")") {
+			return nil, p.errorf("expected \")\"")
+		}
+		return inner, nil
+	}
+	return nil, p.errorf("unexpected %q", t.text)
+}
+
+// call parses the arguments of a call to the function named by t.
+func (p *parser) call(t token) (evaluator, error) {
+	p.accept("(")
+	var args []evaluator
+	if !p.accept(")") {
+		for {
+			arg, err := p.ternary()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if p.accept(")") {
+				break
+			}
+			if !p.accept(",") {
+				return nil, p.errorf("expected \",\" or \")\"")
+			}
+		}
+	}
+
+	if f, ok := functions[t.text]; ok {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("calc: %s takes one argument, not %d, in %q", t.text, len(args), p.text)
+		}
+		arg := args[0]
+		return func(v []float64) float64 { return f(arg(v)) }, nil
+	}
+	switch t.text {
+	case "isnodata":
+		if len(args) != 1 {
+			return nil, fmt.Errorf("calc: isnodata takes one argument, not %d, in %q", len(args), p.text)
+		}
+		arg := args[0]
+		return func(v []float64) float64 { return truth(math.IsNaN(arg(v))) }, nil
+	case "min", "max":
+		if len(args) < 2 {
+			return nil, fmt.Errorf("calc: %s takes two or more arguments in %q", t.text, p.text)
+		}
+		pick := math.Min
+		if t.text == "max" {
+			pick = math.Max
+		}
+		return func(v []float64) float64 {
+			result := args[0](v)
+			for _, arg := range args[1:] {
+				result = pick(result, arg(v))
+			}
+			return result
+		}, nil
+	}
+	names := []string{"isnodata", "min", "max"}
+	for name := range functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return nil, fmt.Errorf("calc: unknown function %s in %q - expected one of %s",
+		t.text, p.text, strings.Join(names, ", "))
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// authenticator protects handlers with static API keys, HTTP basic
+// authentication or both.  A request is let through if it carries any of the
+// keys or any of the user names and passwords.
+//
+// An API key can be sent in an X-API-Key header or, since web maps can't set
+// headers on tile requests, as an api_key query parameter.
+type authenticator struct {
+	keys  []string
+	users map[string]string // Name to password or {SHA256} hash.
+}
+
+// loadAuthenticator reads the API keys and users from files and from the
+// TILER_API_KEYS and TILER_BASIC_AUTH environment variables.  The key file
+// has one key per line.  The user file has one "name:password" per line,
+// where the password can be given as {SHA256} followed by the hex digest.
+// In the environment variables the entries are separated by commas.  It
+// returns nil if no keys or users are configured.
+func loadAuthenticator(keyFile, userFile string) (*authenticator, error) {
+	a := authenticator{users: make(map[string]string)}
+
+	var keys []string
+	if keyFile != "" {
+		lines, err := readLines(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, lines...)
+	}
+	keys = append(keys, splitList(os.Getenv("TILER_API_KEYS"))...)
+	a.keys = keys
+
+	var users []string
+	if userFile != "" {
+		lines, err := readLines(userFile)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, lines...)
+	}
+	users = append(users, splitList(os.Getenv("TILER_BASIC_AUTH"))...)
+	for _, user := range users {
+		i := strings.Index(user, ":")
+		if i <= 0 {
+			return nil, fmt.Errorf("basic auth entry %q - expected name:password", user)
+		}
+		a.users[user[:i]] = user[i+1:]
+	}
+
+	if len(a.keys) == 0 && len(a.users) == 0 {
+		return nil, nil
+	}
+	return &a, nil
+}
+
+// wrap returns a handler that passes authorised requests to h and rejects
+// the others.  If a is nil, h is returned unchanged.
+func (a *authenticator) wrap(h http.Handler) http.Handler {
+	if a == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.allowed(r) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if len(a.users) > 0 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="tiler"`)
+		}
+		http.Error(w, "unauthorised", http.StatusUnauthorized)
+	})
+}
+
+func (a *authenticator) allowed(r *http.Request) bool {
+	key := r.Header.Get("X-API-Key")
+	if key == "" {
+		key = r.URL.Query().Get("api_key")
+	}
+	if key != "" {
+		for _, k := range a.keys {
+			if subtle.ConstantTimeCompare([]byte(key), []byte(k)) == 1 {
+				return true
+			}
+		}
+	}
+
+	name, password, ok := r.BasicAuth()
+	if ok {
+		want, found := a.users[name]
+		if !found {
+			return false
+		}
+		if strings.HasPrefix(want, "{SHA256}") {
+			sum := sha256.Sum256([]byte(password))
+			password = "{SHA256}" + hex.EncodeToString(sum[:])
+			want = "{SHA256}" + strings.ToLower(strings.TrimPrefix(want, "{SHA256}"))
+		}
+		return subtle.ConstantTimeCompare([]byte(password), []byte(want)) == 1
+	}
+	return false
+}
+
+// authQuery returns the api_key query parameter of a request, ready to add
+// to a URL, or "" if there isn't one.  It's used to pass the key on in URLs
+// that the server hands out.
+func authQuery(r *http.Request) string {
+	key := r.URL.Query().Get("api_key")
+	if key == "" {
+		return ""
+	}
+	return "?api_key=" + url.QueryEscape(key)
+}
+
+// readLines returns the non-blank lines of a file that don't start with #.
+func readLines(filename string) ([]string, error) {
+	in, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	var lines []string
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// splitList splits a comma separated list, dropping empty entries.
+func splitList(s string) []string {
+	var result []string
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field != "" {
+			result = append(result, field)
+		}
+	}
+	return result
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/goblimey/tiler/esri"
+	"github.com/goblimey/tiler/geojson"
+	"github.com/goblimey/tiler/polygonize"
+)
+
+// bands sets up the bands command, which writes GeoJSON polygons covering
+// the parts of a grid file in each range of heights.  It returns the flags
+// of the command and the function that runs it once they are parsed from the
+// arguments that follow "bands".
+func bands() (*flag.FlagSet, func()) {
+	fs := flag.NewFlagSet("bands", flag.ExitOnError)
+	var input, output string
+	fs.StringVar(&input, "input", "", "data file")
+	fs.StringVar(&input, "i", "", "data file")
+	fs.StringVar(&output, "output", "", "GeoJSON results file - the standard output if not given")
+	fs.StringVar(&output, "o", "", "GeoJSON results file - the standard output if not given")
+	interval := fs.Float64("interval", 10, "height of each band")
+	base := fs.Float64("base", 0, "height of one of the band edges - the others are multiples of -interval above and below it")
+	breaks := fs.String("breaks", "", "comma separated band edges in ascending order, instead of -interval and -base")
+	bbox := fs.String("bbox", "", "area to cover - minX,minY,maxX,maxY in map coordinates")
+	smoothing := addSmoothFlags(fs)
+	transforms := addTransformFlag(fs)
+	overwrite := addOverwriteFlags(fs)
+	logging := addLogFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: tiler bands -i file [flags]\n")
+		fs.PrintDefaults()
+	}
+	return fs, func() {
+		err := logging.setup()
+		if err != nil {
+			fatal(err.Error())
+		}
+		err = smoothing.check()
+		if err != nil {
+			fatal(err.Error())
+		}
+		err = transforms.check()
+		if err != nil {
+			fatal(err.Error())
+		}
+		if input == "" {
+			fs.Usage()
+			os.Exit(2)
+		}
+		err = overwrite.check(output)
+		if err != nil {
+			fatal(err.Error())
+		}
+
+		grid, err := esri.ReadGridFromFile(input)
+		if err != nil {
+			fail(readError(err))
+		}
+		if *bbox != "" {
+			minX, minY, maxX, maxY, err := parseBBox(*bbox)
+			if err != nil {
+				fatal(err.Error())
+			}
+			grid, err = grid.Crop(minX, minY, maxX, maxY)
+			if err != nil {
+				fatal(err.Error())
+			}
+		}
+		grid = smoothing.apply(grid)
+		grid, err = transforms.apply(context.Background(), grid)
+		if err != nil {
+			fatal(err.Error())
+		}
+
+		var edges []float64
+		if *breaks != "" {
+			edges, err = parseBreaks(*breaks)
+		} else {
+			edges, err = intervalBreaks(float64(grid.MinHeight()), float64(grid.MaxHeight()), *interval, *base)
+		}
+		if err != nil {
+			fatal(err.Error())
+		}
+
+		fc := new(geojson.FeatureCollection)
+		for _, band := range polygonize.Bands(grid, edges) {
+			fc.AddMultiPolygon(band.Polygons, map[string]interface{}{"min": band.Min, "max": band.Max})
+		}
+		if output == "" {
+			err = fc.Write(os.Stdout)
+		} else {
+			err = fc.WriteToFile(output)
+		}
+		if err != nil {
+			fail(writeError(err))
+		}
+	}
+}
+
+// parseBreaks parses a comma separated list of band edges, which must be in
+// ascending order.
+func parseBreaks(s string) ([]float64, error) {
+	var result []float64
+	for _, field := range strings.Split(s, ",") {
+		v, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil {
+			return nil, fmt.Errorf("breaks %s - bad value %q", s, field)
+		}
+		if len(result) > 0 && v <= result[len(result)-1] {
+			return nil, fmt.Errorf("breaks %s - not in ascending order", s)
+		}
+		result = append(result, v)
+	}
+	if len(result) < 2 {
+		return nil, fmt.Errorf("breaks %s - need at least two", s)
+	}
+	return result, nil
+}
+
+// intervalBreaks returns the band edges base + n*interval covering the
+// heights from low to high.
+func intervalBreaks(low, high, interval, base float64) ([]float64, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("interval %f must be greater than zero", interval)
+	}
+	first := math.Floor((low - base) / interval)
+	last := math.Floor((high-base)/interval) + 1
+	var result []float64
+	for n := first; n <= last; n++ {
+		result = append(result, base+n*interval)
+	}
+	return result, nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+)
+
+// errUpToDate is returned by renderFile when it skips a result that is
+// newer than its input.
+var errUpToDate = errors.New("up to date")
+
+// The results of one file in a batch.
+const (
+	resultDone    = "done"
+	resultSkipped = "skipped"
+	resultFailed  = "failed"
+)
+
+// reportOptions holds the flags that say where the report of a batch goes.
+type reportOptions struct {
+	name   string
+	format string
+}
+
+// addReportFlags registers -report and -report-format on fs.
+func addReportFlags(fs *flag.FlagSet) *reportOptions {
+	o := new(reportOptions)
+	fs.StringVar(&o.name, "report", "", "file for the report of a batch - the standard error if not given, - for the standard output")
+	fs.StringVar(&o.format, "report-format", "text", "format of the report of a batch - text or json")
+	return o
+}
+
+// check returns an error if the flags are wrong.
+func (o *reportOptions) check() error {
+	if o.format != "text" && o.format != "json" {
+		return fmt.Errorf("-report-format must be text or json, not %q", o.format)
+	}
+	return nil
+}
+
+// fileResult is what happened to one input file of a batch.
+type fileResult struct {
+	File   string `json:"file"`
+	Output string `json:"output,omitempty"`
+	Result string `json:"result"`
+	Error  string `json:"error,omitempty"`
+	Status int    `json:"status,omitempty"`
+	// Line and Column are the place in the grid file that Error is
+	// about, if it's about one.
+	Line   int `json:"line,omitempty"`
+	Column int `json:"column,omitempty"`
+}
+
+// batchReport records what happened to each file of a batch, so that a
+// bad file doesn't stop the rest and the failures can be listed at the end.
+type batchReport struct {
+	Files   []fileResult `json:"files"`
+	Done    int          `json:"done"`
+	Skipped int          `json:"skipped"`
+	Failed  int          `json:"failed"`
+}
+
+// add records the result of processing input to make output.  err is nil
+// for success and errUpToDate for a result that was skipped.
+func (r *batchReport) add(input, output string, err error) {
+	f := fileResult{File: input, Output: output}
+	switch {
+	case err == nil:
+		f.Result = resultDone
+		r.Done++
+	case errors.Is(err, errUpToDate):
+		f.Result = resultSkipped
+		r.Skipped++
+	default:
+		f.Result = resultFailed
+		f.Error = err.Error()
+		f.Status = exitStatus(err)
+		f.Line, f.Column, _ = errorPlace(err)
+		r.Failed++
+	}
+	r.Files = append(r.Files, f)
+}
+
+// status returns the exit status for the batch - 0 if nothing failed,
+// the status of the failures if they all have the same one, or otherwise
+// exitFailure.
+func (r *batchReport) status() int {
+	status := 0
+	for _, f := range r.Files {
+		if f.Result != resultFailed {
+			continue
+		}
+		if status != 0 && status != f.Status {
+			return exitFailure
+		}
+		status = f.Status
+	}
+	return status
+}
+
+// write writes the report as a table of the files and a summary line, or
+// as a JSON object.
+func (r *batchReport) write(w io.Writer, format string) error {
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, f := range r.Files {
+		detail := f.Output
+		if f.Result == resultFailed {
+			detail = f.Error
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", f.Result, f.File, detail)
+	}
+	err := tw.Flush()
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%d files - %d done, %d skipped, %d failed\n", len(r.Files), r.Done, r.Skipped, r.Failed)
+	return err
+}
+
+// writeFile writes the report where the -report flag says.
+func (r *batchReport) writeFile(o *reportOptions) error {
+	switch o.name {
+	case "":
+		return r.write(os.Stderr, o.format)
+	case "-":
+		return r.write(os.Stdout, o.format)
+	}
+	f, err := os.Create(o.name)
+	if err != nil {
+		return writeError(err)
+	}
+	err = r.write(f, o.format)
+	if err == nil {
+		err = f.Close()
+	} else {
+		f.Close()
+	}
+	return writeError(err)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/goblimey/tiler/calc"
+	"github.com/goblimey/tiler/esri"
+)
+
+// calculate sets up the calc command, which works out an expression over one
+// or more grid files cell by cell and writes the result as a grid file.  It
+// returns the flags of the command and the function that runs it once they
+// are parsed from the arguments that follow "calc".
+func calculate() (*flag.FlagSet, func()) {
+	fs := flag.NewFlagSet("calc", flag.ExitOnError)
+	var expression, output string
+	fs.StringVar(&expression, "expression", "", "expression to work out, for example \"(a - b) > 1.5 ? 1 : nodata\"")
+	fs.StringVar(&expression, "e", "", "expression to work out, for example \"(a - b) > 1.5 ? 1 : nodata\"")
+	fs.StringVar(&output, "output", "", "ESRI Grid (.asc) results file - the standard output if not given")
+	fs.StringVar(&output, "o", "", "ESRI Grid (.asc) results file - the standard output if not given")
+	bbox := fs.String("bbox", "", "area to cover - minX,minY,maxX,maxY in map coordinates")
+	overwrite := addOverwriteFlags(fs)
+	logging := addLogFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: tiler calc -e expression [flags] [name=]file.asc ...\n"+
+			"Works out the expression for each cell.  Files given without a name\n"+
+			"are called a, b, c and so on in order.\n")
+		fs.PrintDefaults()
+	}
+	return fs, func() {
+		err := logging.setup()
+		if err != nil {
+			fatal(err.Error())
+		}
+		if expression == "" || fs.NArg() == 0 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		err = overwrite.check(output)
+		if err != nil {
+			fatal(err.Error())
+		}
+
+		e, err := calc.Parse(expression)
+		if err != nil {
+			fatal(err.Error())
+		}
+
+		grids := make(map[string]*esri.Grid)
+		unnamed := 0
+		for _, arg := range fs.Args() {
+			name, filename, found := strings.Cut(arg, "=")
+			if !found {
+				if unnamed >= 26 {
+					fatal("calc: too many unnamed grid files - name them with name=file")
+				}
+				name, filename = string(rune('a'+unnamed)), arg
+				unnamed++
+			}
+			if _, ok := grids[name]; ok {
+				fatal(fmt.Sprintf("calc: more than one grid called %s", name))
+			}
+			g, err := esri.ReadGridFromFile(filename)
+			if err != nil {
+				fail(readError(err))
+			}
+			if *bbox != "" {
+				minX, minY, maxX, maxY, err := parseBBox(*bbox)
+				if err != nil {
+					fatal(err.Error())
+				}
+				g, err = g.Crop(minX, minY, maxX, maxY)
+				if err != nil {
+					fatal(err.Error())
+				}
+			}
+			slog.Debug("read grid", "name", name, "file", filename)
+			grids[name] = g
+		}
+
+		result, err := e.Evaluate(grids)
+		if err != nil {
+			fatal(err.Error())
+		}
+		slog.Info("calculated", "expression", e.String(),
+			"min", result.MinHeight(), "max", result.MaxHeight())
+
+		if output == "" {
+			err = result.Write(os.Stdout)
+		} else {
+			err = result.WriteToFile(output)
+		}
+		if err != nil {
+			fail(writeError(err))
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/goblimey/tiler/internal/safefile"
+)
+
+// addTimeoutFlag registers -timeout on fs.
+func addTimeoutFlag(fs *flag.FlagSet) *time.Duration {
+	return fs.Duration("timeout", 0, "give up after this long, for example 10m - 0 for no limit")
+}
+
+// commandContext returns a context for a command that is cancelled by an
+// interrupt or SIGTERM, or once timeout has passed if it's more than zero,
+// and the function that releases it.  Only the first interrupt is caught,
+// so a second one stops the program at once as usual.
+func commandContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	interrupted, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-interrupted.Done()
+		stop()
+	}()
+	if timeout <= 0 {
+		return interrupted, stop
+	}
+	ctx, cancel := context.WithTimeout(interrupted, timeout)
+	return ctx, func() {
+		cancel()
+		stop()
+	}
+}
+
+// isCancelled returns true if err comes from a context that was cancelled
+// or ran out of time.
+func isCancelled(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// contextWriter is an io.Writer that fails with ctx.Err() once ctx is
+// cancelled, so that encoding a big picture can be stopped part way.
+type contextWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+func (w contextWriter) Write(p []byte) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return w.w.Write(p)
+}
+
+// writeOutput writes a results file with write, or the standard output if
+// output is "-".  The file is written whole or not at all, so that a
+// failed or cancelled picture doesn't leave half a file to be taken as up
+// to date, nor a watcher reading one.
+func writeOutput(ctx context.Context, output string, write func(w io.Writer) error) error {
+	if output == "-" {
+		return write(contextWriter{ctx, os.Stdout})
+	}
+	err := safefile.WriteContext(ctx, output, func(w io.Writer) error {
+		return write(contextWriter{ctx, w})
+	})
+	// Failures of write are already marked with what went wrong.
+	var e *exitError
+	if err != nil && !errors.As(err, &e) {
+		err = writeError(err)
+	}
+	return err
+}
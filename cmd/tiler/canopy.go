@@ -0,0 +1,161 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/goblimey/tiler/esri"
+	"github.com/goblimey/tiler/geojson"
+	"github.com/goblimey/tiler/geom"
+	"github.com/goblimey/tiler/polygonize"
+)
+
+// canopy sets up the canopy command, which finds the trees and buildings
+// standing above the ground in a surface model and writes their outlines as
+// GeoJSON or a mask as a grid file.  It returns the flags of the command and
+// the function that runs it once they are parsed from the arguments that
+// follow "canopy".
+func canopy() (*flag.FlagSet, func()) {
+	fs := flag.NewFlagSet("canopy", flag.ExitOnError)
+	var output string
+	fs.StringVar(&output, "output", "", "GeoJSON or ESRI Grid (.asc) mask results file - GeoJSON on the standard output if not given")
+	fs.StringVar(&output, "o", "", "GeoJSON or ESRI Grid (.asc) mask results file - GeoJSON on the standard output if not given")
+	dsm := fs.String("dsm", "", "surface model data file - the tops of trees and buildings")
+	dtm := fs.String("dtm", "", "terrain model data file - the bare ground")
+	cutoff := fs.Float64("min", 2, "least height above the ground counted")
+	minArea := fs.Float64("min-area", 0, "GeoJSON - smallest outline written, in square map units")
+	bbox := fs.String("bbox", "", "area to cover - minX,minY,maxX,maxY in map coordinates")
+	overwrite := addOverwriteFlags(fs)
+	logging := addLogFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: tiler canopy -dsm file -dtm file [flags]\n")
+		fs.PrintDefaults()
+	}
+	return fs, func() {
+		err := logging.setup()
+		if err != nil {
+			fatal(err.Error())
+		}
+		if *dsm == "" || *dtm == "" {
+			fs.Usage()
+			os.Exit(2)
+		}
+		err = overwrite.check(output)
+		if err != nil {
+			fatal(err.Error())
+		}
+
+		var grids [2]*esri.Grid
+		for i, filename := range []string{*dsm, *dtm} {
+			grids[i], err = esri.ReadGridFromFile(filename)
+			if err != nil {
+				fail(readError(err))
+			}
+			if *bbox != "" {
+				minX, minY, maxX, maxY, err := parseBBox(*bbox)
+				if err != nil {
+					fatal(err.Error())
+				}
+				grids[i], err = grids[i].Crop(minX, minY, maxX, maxY)
+				if err != nil {
+					fatal(err.Error())
+				}
+			}
+		}
+		// The normalised surface model - the height above the ground.
+		ndsm, err := grids[0].Subtract(grids[1])
+		if err != nil {
+			fatal(err.Error())
+		}
+		above := func(row, col int) bool {
+			return !ndsm.IsNoData(row, col) && float64(ndsm.Height(row, col)) >= *cutoff
+		}
+
+		if strings.ToLower(filepath.Ext(output)) == ".asc" {
+			mask := esri.NewGrid(ndsm.Ncols(), ndsm.Nrows())
+			mask.SetXllcorner(ndsm.Xllcorner())
+			mask.SetYllcorner(ndsm.Yllcorner())
+			mask.SetCellSize(ndsm.CellSize())
+			mask.SetNoDataValue(-9999)
+			for row := 0; row < ndsm.Nrows(); row++ {
+				for col := 0; col < ndsm.Ncols(); col++ {
+					switch {
+					case ndsm.IsNoData(row, col):
+						mask.SetHeight(row, col, -9999)
+					case above(row, col):
+						mask.SetHeight(row, col, 1)
+					default:
+						mask.SetHeight(row, col, 0)
+					}
+				}
+			}
+			err = mask.WriteToFile(output)
+			if err != nil {
+				fail(writeError(err))
+			}
+			return
+		}
+
+		fc := new(geojson.FeatureCollection)
+		written := 0
+		for _, polygon := range polygonize.Regions(ndsm, above) {
+			area := polygon.Area()
+			if area < *minArea {
+				continue
+			}
+			maxHeight, meanHeight := heightsWithin(ndsm, polygon)
+			fc.AddMultiPolygon([]geom.Polygon{polygon}, map[string]interface{}{
+				"area": area, "maxHeight": maxHeight, "meanHeight": meanHeight,
+			})
+			written++
+		}
+		slog.Info("canopy", "outlines", written)
+		if output == "" {
+			err = fc.Write(os.Stdout)
+		} else {
+			err = fc.WriteToFile(output)
+		}
+		if err != nil {
+			fail(writeError(err))
+		}
+	}
+}
+
+// heightsWithin returns the largest and mean values of the cells of g whose
+// centres are inside the polygon, ignoring cells holding the No Data value.
+func heightsWithin(g *esri.Grid, polygon geom.Polygon) (maxHeight, meanHeight float64) {
+	minX, _, _, maxY := g.Bounds()
+	cellsize := float64(g.CellSize())
+	_, y0, _, y1 := polygon.Bounds()
+	maxHeight = math.Inf(-1)
+	sum, n := 0.0, 0
+	for row := 0; row < g.Nrows(); row++ {
+		y := maxY - (float64(row)+0.5)*cellsize
+		if y < y0 || y > y1 {
+			continue
+		}
+		crossings := polygon.Crossings(y)
+		for i := 0; i+1 < len(crossings); i += 2 {
+			first := int(math.Ceil((crossings[i]-minX)/cellsize - 0.5))
+			last := int(math.Floor((crossings[i+1]-minX)/cellsize - 0.5))
+			for col := first; col <= last; col++ {
+				if col < 0 || col >= g.Ncols() || g.IsNoData(row, col) {
+					continue
+				}
+				h := float64(g.Height(row, col))
+				maxHeight = math.Max(maxHeight, h)
+				sum += h
+				n++
+			}
+		}
+	}
+	if n == 0 {
+		return 0, 0
+	}
+	return maxHeight, sum / float64(n)
+}
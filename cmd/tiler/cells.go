@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/goblimey/tiler/crs"
+	"github.com/goblimey/tiler/esri"
+	"github.com/goblimey/tiler/geojson"
+	"github.com/goblimey/tiler/geom"
+)
+
+// exportCells sets up the cells command, which writes the position and
+// height of each cell of a grid that holds data, as CSV or as GeoJSON
+// points, for spreadsheets and programs that work with points.  It returns
+// the flags of the command and the function that runs it once they are
+// parsed from the arguments that follow "cells".
+func exportCells() (*flag.FlagSet, func()) {
+	fs := flag.NewFlagSet("cells", flag.ExitOnError)
+	var input, output string
+	fs.StringVar(&input, "input", "", "grid file - - for the standard input")
+	fs.StringVar(&input, "i", "", "grid file - - for the standard input")
+	fs.StringVar(&output, "output", "", "results file - CSV (.csv) or GeoJSON (.geojson or .json), or CSV on the standard output if not given")
+	fs.StringVar(&output, "o", "", "results file - CSV (.csv) or GeoJSON (.geojson or .json), or CSV on the standard output if not given")
+	every := fs.Int("every", 1, "write every nth cell along each row and column - 1 writes them all")
+	places := fs.Int("places", 3, "decimal places in the heights")
+	lonlat := fs.Bool("lonlat", false, "write WGS84 longitude and latitude rather than map coordinates")
+	bbox := fs.String("bbox", "", "area to cover - minX,minY,maxX,maxY in map coordinates")
+	crsName := fs.String("crs", crs.Default, "coordinate reference system of the grid, for -lonlat")
+	transforms := addTransformFlag(fs)
+	overwrite := addOverwriteFlags(fs)
+	logging := addLogFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: tiler cells -i grid.asc [-o cells.csv] [flags]\n"+
+			"       tiler cells -i grid.asc -o cells.geojson [flags]\n")
+		fs.PrintDefaults()
+	}
+	return fs, func() {
+		err := logging.setup()
+		if err != nil {
+			fatal(err.Error())
+		}
+		err = transforms.check()
+		if err != nil {
+			fatal(err.Error())
+		}
+		if input == "" {
+			fs.Usage()
+			os.Exit(2)
+		}
+		format := ".csv"
+		if output != "" {
+			format = strings.ToLower(filepath.Ext(output))
+			if format == ".json" {
+				format = ".geojson"
+			}
+			if format != ".csv" && format != ".geojson" {
+				fatal(fmt.Sprintf("%s: unknown format - expected .csv, .geojson or .json", output))
+			}
+		}
+		if *every < 1 {
+			fatal(fmt.Sprintf("-every %d is less than 1", *every))
+		}
+		c, err := crs.Lookup(*crsName)
+		if err != nil {
+			fatal(err.Error())
+		}
+		err = overwrite.check(output)
+		if err != nil {
+			fatal(err.Error())
+		}
+
+		grid, err := readGridFile(input)
+		if err != nil {
+			fail(readError(err))
+		}
+		if *bbox != "" {
+			minX, minY, maxX, maxY, err := parseBBox(*bbox)
+			if err != nil {
+				fatal(err.Error())
+			}
+			grid, err = grid.Crop(minX, minY, maxX, maxY)
+			if err != nil {
+				fatal(err.Error())
+			}
+		}
+		grid, err = transforms.apply(context.Background(), grid)
+		if err != nil {
+			fatal(err.Error())
+		}
+
+		out := os.Stdout
+		if output != "" {
+			out, err = os.Create(output)
+			if err != nil {
+				fail(writeError(err))
+			}
+		}
+		e := cellExport{every: *every, places: *places}
+		if *lonlat {
+			e.crs = c
+		}
+		var count int
+		if format == ".geojson" {
+			count, err = e.writeGeoJSON(out, grid)
+		} else {
+			count, err = e.writeCSV(out, grid)
+		}
+		if err == nil && output != "" {
+			err = out.Close()
+		}
+		if err != nil {
+			fail(writeError(err))
+		}
+		slog.Info("done", "cells", count)
+	}
+}
+
+// cellExport writes the cells of a grid that hold data.
+type cellExport struct {
+	every  int     // Write every nth cell along each row and column.
+	places int     // Decimal places in the heights.
+	crs    crs.CRS // If not nil, positions are converted to WGS84.
+}
+
+// each calls f with the position and height of each cell of grid that
+// holds data and is written, from the north west corner, and returns the
+// number of cells.  It stops at the first error from f.
+func (e *cellExport) each(grid *esri.Grid, f func(x, y, height float64) error) (int, error) {
+	minX, _, _, maxY := grid.Bounds()
+	cellSize := float64(grid.CellSize())
+	scale := math.Pow(10, float64(e.places))
+	count := 0
+	for row := 0; row < grid.Nrows(); row += e.every {
+		y := maxY - (float64(row)+0.5)*cellSize
+		for col := 0; col < grid.Ncols(); col += e.every {
+			if grid.IsNoData(row, col) {
+				continue
+			}
+			x := minX + (float64(col)+0.5)*cellSize
+			px, py := x, y
+			if e.crs != nil {
+				px, py = e.crs.ToWGS84(x, y)
+			}
+			height := math.Round(float64(grid.Height(row, col))*scale) / scale
+			err := f(px, py, height)
+			if err != nil {
+				return count, err
+			}
+			count++
+		}
+	}
+	return count, nil
+}
+
+// writeCSV writes the cells of grid to w as CSV lines of x, y and height,
+// or longitude, latitude and height, after a header line.
+func (e *cellExport) writeCSV(w io.Writer, grid *esri.Grid) (int, error) {
+	out := bufio.NewWriterSize(w, 1<<20)
+	if e.crs != nil {
+		out.WriteString("lon,lat,z\n")
+	} else {
+		out.WriteString("x,y,z\n")
+	}
+	var line []byte
+	count, err := e.each(grid, func(x, y, height float64) error {
+		line = strconv.AppendFloat(line[:0], x, 'f', -1, 64)
+		line = append(line, ',')
+		line = strconv.AppendFloat(line, y, 'f', -1, 64)
+		line = append(line, ',')
+		line = strconv.AppendFloat(line, height, 'f', -1, 64)
+		line = append(line, '\n')
+		_, err := out.Write(line)
+		return err
+	})
+	if err != nil {
+		return count, err
+	}
+	return count, out.Flush()
+}
+
+// writeGeoJSON writes the cells of grid to w as a FeatureCollection of
+// Points, each with an "elevation" property.
+func (e *cellExport) writeGeoJSON(w io.Writer, grid *esri.Grid) (int, error) {
+	pw := geojson.NewPointWriter(w)
+	count, err := e.each(grid, func(x, y, height float64) error {
+		return pw.Write(geom.Point{X: x, Y: y}, map[string]interface{}{"elevation": height})
+	})
+	if err != nil {
+		return count, err
+	}
+	return count, pw.Close()
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/goblimey/tiler/pipeline"
+)
+
+// command is one of tiler's subcommands.
+type command struct {
+	name    string
+	summary string
+	// flags returns a new flag set for the command and the function that
+	// runs it once the arguments that follow its name have been parsed.
+	// The completion command uses the flags without running the command.
+	flags func() (*flag.FlagSet, func())
+}
+
+// commands lists the subcommands in the order that help shows them.  It's
+// filled in by init because help refers to it.
+var commands []command
+
+func init() {
+	commands = []command{
+		{"render", "draw a grid as a PNG picture", renderImage},
+		{"tile", "draw one z/x/y web map tile", drawTile},
+		{"serve", "serve web map tiles", serve},
+		{"terrain", "make Cesium quantized-mesh terrain tiles", terrainTiles},
+		{"info", "describe grid files", info},
+		{"stats", "summarise the heights in grid files, with a histogram", statistics},
+		{"validate", "check that grid files are well formed", validate},
+		{"repair", "mend a broken ESRI ASCII grid", repair},
+		{"convert", "copy a grid to another file format", convert},
+		{"fetch", "download Environment Agency lidar tiles for a mosaic", fetch},
+		{"watch", "draw the grid files that appear or change in a folder", watch},
+		{"contour", "trace contour lines", contours},
+		{"bands", "make polygons of height bands", bands},
+		{"coverage", "show where a set of grids has data", coverage},
+		{"viewshed", "find what can be seen from a point", viewsheds},
+		{"flow", "compute flow direction and accumulation", flow},
+		{"fill", "fill depressions", fill},
+		{"diff", "subtract one grid from another", diff},
+		{"canopy", "find canopy height from a surface and a terrain model", canopy},
+		{"calc", "combine grids with an expression", calculate},
+		{"reclassify", "map height ranges to classes", reclassify},
+		{"track", "add heights to a GPX track", track},
+		{"profile", "draw a cross section along a line", crossSection},
+		{"map", "draw a map sheet with contours, a legend and a scale bar as a PDF", drawMap},
+		{"mesh", "make a solid 3D model of a grid for printing", makeMesh},
+		{"heightmap", "make a 16 bit RAW heightmap for game engines", makeHeightmap},
+		{"points", "look up heights for a CSV file of points", points},
+		{"cells", "write the cells of a grid as CSV or GeoJSON points", exportCells},
+		{"zonal", "summarise the heights within polygons", zonal},
+		{"volume", "compute cut and fill volumes", volume},
+		{"solar", "compute clear-sky insolation", solar},
+		{"query", "print the height at points", query},
+		{"path", "find the least-cost path between two points", leastCostPath},
+		{"isochrones", "compute travel cost from points", isochrones},
+		{"completion", "write a shell completion script - bash, zsh or fish", completion},
+		{"help", "describe the commands, or one command", help},
+	}
+}
+
+// findCommand returns the command with the given name, or nil if there is
+// none.
+func findCommand(name string) *command {
+	for i := range commands {
+		if commands[i].name == name {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+// usage writes a list of the commands to w.
+func usage(w io.Writer) {
+	fmt.Fprintf(w, "usage: tiler <command> [flags] [arguments]\n\ncommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-12s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintf(w, "\nRun \"tiler help <command>\" for the flags of a command.\n")
+}
+
+// help sets up the help command, which lists the commands or, given the
+// name of one, shows its flags.  "help transforms" lists the transforms
+// that -transform takes.
+func help() (*flag.FlagSet, func()) {
+	fs := flag.NewFlagSet("help", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: tiler help [command]\n")
+	}
+	return fs, func() {
+		showHelp(fs.Args())
+	}
+}
+
+// showHelp runs the help command with args, the arguments that follow
+// "help".
+func showHelp(args []string) {
+	if len(args) == 0 {
+		usage(os.Stdout)
+		return
+	}
+	if args[0] == "transforms" {
+		transformHelp(os.Stdout)
+		return
+	}
+	c := findCommand(args[0])
+	if c == nil || c.name == "help" {
+		fmt.Fprintf(os.Stderr, "tiler: unknown command %q\n", args[0])
+		usage(os.Stderr)
+		os.Exit(2)
+	}
+	c.run([]string{"-h"})
+}
+
+// run parses the flags of c from args, the arguments that follow its name,
+// and runs it.
+func (c *command) run(args []string) {
+	fs, run := c.flags()
+	fs.Parse(args)
+	run()
+}
+
+// transformHelp writes a list of the transforms that -transform takes to w.
+func transformHelp(w io.Writer) {
+	fmt.Fprintf(w, "transforms, chained with commas as in -transform fillnodata,smooth:3,resample:2m:\n")
+	for _, name := range pipeline.TransformNames() {
+		fmt.Fprintf(w, "  %-12s %s\n", name, pipeline.TransformSummary(name))
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// completionShells are the shells that completion writes scripts for.
+var completionShells = []string{"bash", "zsh", "fish"}
+
+// completedCommand is a command and its flags, for a completion script.
+type completedCommand struct {
+	name    string
+	summary string
+	flags   []*flag.Flag
+}
+
+// completion sets up the completion command, which writes a script for
+// bash, zsh or fish that completes tiler's commands and their flags.  It
+// returns the flags of the command and the function that runs it once they
+// are parsed from the arguments that follow "completion".
+func completion() (*flag.FlagSet, func()) {
+	fs := flag.NewFlagSet("completion", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: tiler completion %s\n\n"+
+			"Writes a shell script that completes tiler's commands and flags.  For example\n"+
+			"  source <(tiler completion bash)\n", strings.Join(completionShells, "|"))
+		fs.PrintDefaults()
+	}
+	return fs, func() {
+		writeCompletion(fs)
+	}
+}
+
+// writeCompletion runs the completion command once its flags are parsed
+// into fs.
+func writeCompletion(fs *flag.FlagSet) {
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	var cmds []completedCommand
+	for _, c := range commands {
+		cc := completedCommand{name: c.name, summary: c.summary}
+		if c.name != "help" && c.name != "completion" {
+			fs, _ := c.flags()
+			fs.VisitAll(func(f *flag.Flag) { cc.flags = append(cc.flags, f) })
+		}
+		cmds = append(cmds, cc)
+	}
+
+	switch fs.Arg(0) {
+	case "bash":
+		writeBashCompletion(os.Stdout, cmds)
+	case "zsh":
+		writeZshCompletion(os.Stdout, cmds)
+	case "fish":
+		writeFishCompletion(os.Stdout, cmds)
+	default:
+		fatal("unknown shell - expected "+strings.Join(completionShells, ", "), "shell", fs.Arg(0))
+	}
+}
+
+// isBoolFlag returns true if the flag takes no value.
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// flagNames returns the flags of c as a space separated list of -name.
+func flagNames(c completedCommand) string {
+	var names []string
+	for _, f := range c.flags {
+		names = append(names, "-"+f.Name)
+	}
+	return strings.Join(names, " ")
+}
+
+// commandNames returns the names of the commands, space separated.
+func commandNames(cmds []completedCommand) string {
+	var names []string
+	for _, c := range cmds {
+		names = append(names, c.name)
+	}
+	return strings.Join(names, " ")
+}
+
+// writeBashCompletion writes a bash completion script for the commands.
+// A first argument that is a flag is a render flag, as main takes it.
+func writeBashCompletion(w io.Writer, cmds []completedCommand) {
+	var renderFlags string
+	for _, c := range cmds {
+		if c.name == "render" {
+			renderFlags = flagNames(c)
+		}
+	}
+	fmt.Fprintf(w, "# bash completion for tiler - made by \"tiler completion bash\"\n\n")
+	fmt.Fprintf(w, "_tiler() {\n")
+	fmt.Fprintf(w, "    local cur=${COMP_WORDS[COMP_CWORD]} flags\n")
+	fmt.Fprintf(w, "    if [ \"$COMP_CWORD\" -eq 1 ] && [[ $cur != -* ]]; then\n")
+	fmt.Fprintf(w, "        COMPREPLY=($(compgen -W \"%s\" -- \"$cur\"))\n", commandNames(cmds))
+	fmt.Fprintf(w, "        return\n    fi\n")
+	fmt.Fprintf(w, "    case ${COMP_WORDS[1]} in\n")
+	for _, c := range cmds {
+		switch c.name {
+		case "help":
+			fmt.Fprintf(w, "    help) COMPREPLY=($(compgen -W \"%s\" -- \"$cur\")); return;;\n", commandNames(cmds))
+		case "completion":
+			fmt.Fprintf(w, "    completion) COMPREPLY=($(compgen -W \"%s\" -- \"$cur\")); return;;\n",
+				strings.Join(completionShells, " "))
+		default:
+			fmt.Fprintf(w, "    %s) flags=\"%s\";;\n", c.name, flagNames(c))
+		}
+	}
+	fmt.Fprintf(w, "    -*) flags=\"%s\";;\n", renderFlags)
+	fmt.Fprintf(w, "    esac\n")
+	fmt.Fprintf(w, "    if [[ $cur == -* ]]; then\n")
+	fmt.Fprintf(w, "        COMPREPLY=($(compgen -W \"$flags\" -- \"$cur\"))\n")
+	fmt.Fprintf(w, "    else\n")
+	fmt.Fprintf(w, "        COMPREPLY=($(compgen -f -- \"$cur\"))\n")
+	fmt.Fprintf(w, "    fi\n}\n\n")
+	fmt.Fprintf(w, "complete -o filenames -F _tiler tiler\n")
+}
+
+// zshQuote returns s in single quotes for zsh.
+func zshQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// writeZshCompletion writes a zsh completion script for the commands, which
+// can be sourced or put in a file called _tiler on the fpath.
+func writeZshCompletion(w io.Writer, cmds []completedCommand) {
+	fmt.Fprintf(w, "#compdef tiler\n# zsh completion for tiler - made by \"tiler completion zsh\"\n\n")
+	fmt.Fprintf(w, "_tiler() {\n")
+	fmt.Fprintf(w, "    local -a commands\n    commands=(\n")
+	for _, c := range cmds {
+		fmt.Fprintf(w, "        %s\n", zshQuote(c.name+":"+c.summary))
+	}
+	fmt.Fprintf(w, "    )\n")
+	fmt.Fprintf(w, "    if (( CURRENT == 2 )); then\n")
+	fmt.Fprintf(w, "        _describe -t commands 'tiler command' commands\n")
+	fmt.Fprintf(w, "        return\n    fi\n")
+	fmt.Fprintf(w, "    local cmd=$words[2]\n    shift words\n    (( CURRENT-- ))\n")
+	fmt.Fprintf(w, "    case $cmd in\n")
+	describe := strings.NewReplacer("[", `\[`, "]", `\]`)
+	for _, c := range cmds {
+		switch c.name {
+		case "help":
+			fmt.Fprintf(w, "    help) _describe -t commands 'tiler command' commands;;\n")
+		case "completion":
+			fmt.Fprintf(w, "    completion) _values shell %s;;\n", strings.Join(completionShells, " "))
+		default:
+			fmt.Fprintf(w, "    %s)\n        _arguments \\\n", c.name)
+			for _, f := range c.flags {
+				spec := "-" + f.Name + "[" + describe.Replace(f.Usage) + "]"
+				if !isBoolFlag(f) {
+					spec += ":" + f.Name + ":_files"
+				}
+				fmt.Fprintf(w, "            %s \\\n", zshQuote(spec))
+			}
+			fmt.Fprintf(w, "            '*:file:_files'\n        ;;\n")
+		}
+	}
+	fmt.Fprintf(w, "    esac\n}\n\n")
+	fmt.Fprintf(w, "if [ \"$funcstack[1]\" = \"_tiler\" ]; then\n    _tiler \"$@\"\nelse\n    compdef _tiler tiler\nfi\n")
+}
+
+// fishQuote returns s in single quotes for fish.
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+}
+
+// writeFishCompletion writes a fish completion script for the commands.
+func writeFishCompletion(w io.Writer, cmds []completedCommand) {
+	fmt.Fprintf(w, "# fish completion for tiler - made by \"tiler completion fish\"\n\n")
+	fmt.Fprintf(w, "complete -c tiler -f\n")
+	for _, c := range cmds {
+		fmt.Fprintf(w, "complete -c tiler -n __fish_use_subcommand -a %s -d %s\n", c.name, fishQuote(c.summary))
+	}
+	for _, c := range cmds {
+		seen := fishQuote("__fish_seen_subcommand_from " + c.name)
+		switch c.name {
+		case "help":
+			fmt.Fprintf(w, "complete -c tiler -n %s -a %s\n", seen, fishQuote(commandNames(cmds)))
+			continue
+		case "completion":
+			fmt.Fprintf(w, "complete -c tiler -n %s -a %s\n", seen, fishQuote(strings.Join(completionShells, " ")))
+			continue
+		}
+		fmt.Fprintf(w, "complete -c tiler -n %s -F\n", seen)
+		for _, f := range c.flags {
+			value := ""
+			if !isBoolFlag(f) {
+				value = " -rF"
+			}
+			fmt.Fprintf(w, "complete -c tiler -n %s -o %s%s -d %s\n", seen, f.Name, value, fishQuote(f.Usage))
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goblimey/tiler/contour"
+	"github.com/goblimey/tiler/esri"
+	"github.com/goblimey/tiler/geojson"
+	"github.com/goblimey/tiler/geom"
+	"github.com/goblimey/tiler/render"
+	"github.com/goblimey/tiler/shapefile"
+	"github.com/goblimey/tiler/svg"
+)
+
+// contours sets up the contour command, which writes the contours of a grid
+// file as GeoJSON, as a shapefile or as an SVG drawing.  It returns the
+// flags of the command and the function that runs it once they are parsed
+// from the arguments that follow "contour".
+func contours() (*flag.FlagSet, func()) {
+	fs := flag.NewFlagSet("contour", flag.ExitOnError)
+	var input, output string
+	fs.StringVar(&input, "input", "", "data file")
+	fs.StringVar(&input, "i", "", "data file")
+	fs.StringVar(&output, "output", "", "GeoJSON, shapefile (.shp) or SVG (.svg) results file - GeoJSON on the standard output if not given")
+	fs.StringVar(&output, "o", "", "GeoJSON, shapefile (.shp) or SVG (.svg) results file - GeoJSON on the standard output if not given")
+	interval := fs.Float64("interval", 10, "height between contours")
+	base := fs.Float64("base", 0, "height of one of the contours - the others are multiples of -interval above and below it")
+	bbox := fs.String("bbox", "", "area to contour - minX,minY,maxX,maxY in map coordinates")
+	index := fs.Int("index", 5, "make every nth contour an index contour - 0 for none")
+	labels := fs.Bool("labels", false, "GeoJSON - add points for labels along the index contours")
+	spacing := fs.Float64("label-spacing", 0, "distance between labels in map units - if not given a quarter of the shorter side of the area")
+	hillshade := fs.Bool("hillshade", false, "SVG - draw a faint hillshade under the contours")
+	scale := fs.Float64("scale", 0, "SVG - millimetres per map unit - if not given the longer side is 200 mm")
+	smoothing := addSmoothFlags(fs)
+	transforms := addTransformFlag(fs)
+	overwrite := addOverwriteFlags(fs)
+	logging := addLogFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: tiler contour -i file [flags]\n")
+		fs.PrintDefaults()
+	}
+	return fs, func() {
+		err := logging.setup()
+		if err != nil {
+			fatal(err.Error())
+		}
+		err = smoothing.check()
+		if err != nil {
+			fatal(err.Error())
+		}
+		err = transforms.check()
+		if err != nil {
+			fatal(err.Error())
+		}
+		if input == "" {
+			fs.Usage()
+			os.Exit(2)
+		}
+		err = overwrite.check(output)
+		if err != nil {
+			fatal(err.Error())
+		}
+
+		grid, err := esri.ReadGridFromFile(input)
+		if err != nil {
+			fail(readError(err))
+		}
+		if *bbox != "" {
+			minX, minY, maxX, maxY, err := parseBBox(*bbox)
+			if err != nil {
+				fatal(err.Error())
+			}
+			grid, err = grid.Crop(minX, minY, maxX, maxY)
+			if err != nil {
+				fatal(err.Error())
+			}
+		}
+		grid = smoothing.apply(grid)
+		grid, err = transforms.apply(context.Background(), grid)
+		if err != nil {
+			fatal(err.Error())
+		}
+		result, err := extractContours([]*esri.Grid{grid}, *interval, *base, *index, "")
+		if err != nil {
+			fatal(err.Error())
+		}
+		minX, minY, maxX, maxY := grid.Bounds()
+		if *spacing <= 0 {
+			*spacing = math.Min(maxX-minX, maxY-minY) / 4
+		}
+		labelSpacing := 0.0
+		if *labels {
+			labelSpacing = *spacing
+		}
+		switch {
+		case output == "":
+			err = contourFeatures(result, labelSpacing).Write(os.Stdout)
+		case strings.ToLower(filepath.Ext(output)) == ".svg":
+			options := svg.Options{Scale: *scale, LabelSpacing: *spacing}
+			if *hillshade {
+				options.Background = render.HillshadeImage(grid, 315, 45)
+			}
+			err = svg.WriteContoursToFile(output, result, minX, minY, maxX, maxY, options)
+		case strings.ToLower(filepath.Ext(output)) == ".shp":
+			lines, levels := splitContours(result)
+			err = shapefile.WritePolyLinesToFiles(output, lines, "ELEV", levels)
+		default:
+			err = contourFeatures(result, labelSpacing).WriteToFile(output)
+		}
+		if err != nil {
+			fail(writeError(err))
+		}
+	}
+}
+
+// extractContours returns the contours of the grids, cropped to bbox if it's
+// not empty, with every nth marked as an index contour.
+func extractContours(grids []*esri.Grid, interval, base float64, n int, bbox string) ([]contour.Contour, error) {
+	var contours []contour.Contour
+	for _, grid := range grids {
+		if bbox != "" {
+			minX, minY, maxX, maxY, err := parseBBox(bbox)
+			if err != nil {
+				return nil, err
+			}
+			x0, y0, x1, y1 := grid.Bounds()
+			if float64(maxX) <= x0 || float64(minX) >= x1 || float64(maxY) <= y0 || float64(minY) >= y1 {
+				continue
+			}
+			grid, err = grid.Crop(minX, minY, maxX, maxY)
+			if err != nil {
+				return nil, err
+			}
+		}
+		result, err := contour.Extract(grid, interval, base)
+		if err != nil {
+			return nil, err
+		}
+		contours = append(contours, result...)
+	}
+	contour.Classify(contours, interval, base, n)
+	return contours, nil
+}
+
+// splitContours returns the lines and levels of the contours.
+func splitContours(contours []contour.Contour) ([]geom.Line, []float64) {
+	lines := make([]geom.Line, len(contours))
+	levels := make([]float64, len(contours))
+	for i, c := range contours {
+		lines[i] = c.Line
+		levels[i] = c.Level
+	}
+	return lines, levels
+}
+
+// contourFeatures returns the contours as GeoJSON LineStrings with their
+// "elevation" and whether they are "index" contours.  If labelSpacing is not
+// zero, Points are added along the index contours giving the "label" text
+// and its "angle" in degrees anticlockwise from east.
+func contourFeatures(contours []contour.Contour, labelSpacing float64) *geojson.FeatureCollection {
+	fc := new(geojson.FeatureCollection)
+	for _, c := range contours {
+		fc.AddLineString(c.Line, map[string]interface{}{"elevation": c.Level, "index": c.Index})
+	}
+	if labelSpacing > 0 {
+		for _, c := range contours {
+			if !c.Index {
+				continue
+			}
+			for _, label := range c.Labels(labelSpacing, labelSpacing/4) {
+				fc.AddPoint(label.Point, map[string]interface{}{
+					"elevation": c.Level, "label": label.Text, "angle": label.Angle,
+				})
+			}
+		}
+	}
+	return fc
+}
+
+// contourHandler serves the contours of a tileServer's grids as GeoJSON.
+type contourHandler struct {
+	server *tileServer
+}
+
+// ServeHTTP handles GET /contours?interval=&base=&index=&bbox=.  The
+// bounding box is in the grids' coordinate reference system.  Without it the
+// whole TileSet is contoured.  label_spacing, given in map units, adds label
+// points along the index contours.
+func (h *contourHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		jsonError(w, http.StatusMethodNotAllowed, "method "+r.Method+" not allowed")
+		return
+	}
+	q := r.URL.Query()
+	interval := 10.0
+	base := 0.0
+	var err error
+	if q.Get("interval") != "" {
+		interval, err = strconv.ParseFloat(q.Get("interval"), 64)
+		if err != nil || interval <= 0 {
+			jsonError(w, http.StatusBadRequest, fmt.Sprintf("bad interval %q", q.Get("interval")))
+			return
+		}
+	}
+	if q.Get("base") != "" {
+		base, err = strconv.ParseFloat(q.Get("base"), 64)
+		if err != nil {
+			jsonError(w, http.StatusBadRequest, fmt.Sprintf("bad base %q", q.Get("base")))
+			return
+		}
+	}
+	index := 5
+	if q.Get("index") != "" {
+		index, err = strconv.Atoi(q.Get("index"))
+		if err != nil || index < 0 {
+			jsonError(w, http.StatusBadRequest, fmt.Sprintf("bad index %q", q.Get("index")))
+			return
+		}
+	}
+	labelSpacing := 0.0
+	if q.Get("label_spacing") != "" {
+		labelSpacing, err = strconv.ParseFloat(q.Get("label_spacing"), 64)
+		if err != nil || labelSpacing < 0 {
+			jsonError(w, http.StatusBadRequest, fmt.Sprintf("bad label_spacing %q", q.Get("label_spacing")))
+			return
+		}
+	}
+	bbox := q.Get("bbox")
+	if bbox != "" {
+		_, _, _, _, err = parseBBox(bbox)
+		if err != nil {
+			jsonError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	if !h.server.limit.acquire(r.Context()) {
+		busy(w)
+		return
+	}
+	start := time.Now()
+	result, err := extractContours(h.server.TileSet.Grids(), interval, base, index, bbox)
+	h.server.metrics.observeRender("contours", time.Since(start))
+	h.server.limit.release()
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/geo+json")
+	err = contourFeatures(result, labelSpacing).Write(w)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, err.Error())
+	}
+}
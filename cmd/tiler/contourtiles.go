@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/goblimey/tiler/contour"
+	"github.com/goblimey/tiler/crs"
+	"github.com/goblimey/tiler/geom"
+	"github.com/goblimey/tiler/mvt"
+	"github.com/goblimey/tiler/tile"
+)
+
+// contourLayer is the name of the layer in the contour vector tiles.
+const contourLayer = "contours"
+
+// contourZoomRange is the number of zoom levels below the native zoom level
+// that have contour tiles.  Further out the tiles would cover too many cells
+// to contour on demand, so they are empty.
+const contourZoomRange = 8
+
+// contourThinning gives the multiple of the contour interval used for each
+// two zoom levels below the native level, so that the contours don't crowd
+// together as the map zooms out.
+var contourThinning = []float64{1, 2, 5, 10, 20}
+
+// contourIndex makes every fifth contour in the vector tiles an index
+// contour.
+const contourIndex = 5
+
+// contourTileHandler serves the contours of a tileServer's grids as Mapbox
+// Vector Tiles, plus a TileJSON document describing them.
+type contourTileHandler struct {
+	server *tileServer
+}
+
+// ServeHTTP handles /contours.json and /contours/{z}/{x}/{y}.pbf.
+func (h *contourTileHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/contours.json" {
+		h.tileJSON(w, r)
+		return
+	}
+
+	z, x, y, err := parseTilePath(strings.TrimPrefix(r.URL.Path, "/contours/"), ".pbf")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !tile.Valid(z, x, y) {
+		http.NotFound(w, r)
+		return
+	}
+
+	h.server.writeCached(w, r, "contours", "application/vnd.mapbox-vector-tile", z, x, y, h.encodeTile)
+}
+
+// encodeTile makes the vector tile for tile (z, x, y).  The contours are
+// thinned out below the native zoom level and simplified to half a pixel.
+func (h *contourTileHandler) encodeTile(ctx context.Context, z, x, y int) ([]byte, error) {
+	layer := mvt.Layer{Name: contourLayer, Extent: mvt.DefaultExtent}
+	steps := h.server.NativeZoom() - z
+	if steps < 0 {
+		steps = 0
+	}
+	if !h.server.Covers(z, x, y) || steps > contourZoomRange {
+		return mvt.Encode(layer)
+	}
+	interval := h.server.contourInterval * contourThinning[steps/2]
+
+	// The area of the tile in the grids' coordinates, with a margin so that
+	// lines carry on across the edges of the tile.
+	minX, minY, maxX, maxY := tile.Bounds(z, x, y)
+	margin := (maxX - minX) / 16
+	minX, minY, maxX, maxY = minX-margin, minY-margin, maxX+margin, maxY+margin
+	mercator := crs.WebMercator{}
+	gMinX, gMinY := math.Inf(1), math.Inf(1)
+	gMaxX, gMaxY := math.Inf(-1), math.Inf(-1)
+	for _, corner := range [][2]float64{{minX, minY}, {minX, maxY}, {maxX, minY}, {maxX, maxY}} {
+		gx, gy := h.server.CRS.FromWGS84(mercator.ToWGS84(corner[0], corner[1]))
+		gMinX, gMinY = math.Min(gMinX, gx), math.Min(gMinY, gy)
+		gMaxX, gMaxY = math.Max(gMaxX, gx), math.Max(gMaxY, gy)
+	}
+
+	// Tile coordinates per Web Mercator metre.
+	scale := float64(layer.Extent) / (maxX - minX - 2*margin)
+	tolerance := float64(layer.Extent) / tile.Size / 2
+	lines := make(map[float64][][]mvt.Point)
+	index := make(map[float64]bool)
+	var levels []float64
+	for _, grid := range h.server.TileSet.Grids() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		x0, y0, x1, y1 := grid.Bounds()
+		if gMaxX <= x0 || gMinX >= x1 || gMaxY <= y0 || gMinY >= y1 {
+			continue
+		}
+		cropped, err := grid.Crop(float32(gMinX), float32(gMinY), float32(gMaxX), float32(gMaxY))
+		if err != nil {
+			continue
+		}
+		contours, err := contour.Extract(cropped, interval, 0)
+		if err != nil {
+			return nil, err
+		}
+		contour.Classify(contours, interval, 0, contourIndex)
+		for _, c := range contours {
+			projected := make(geom.Line, len(c.Line))
+			for i, p := range c.Line {
+				mx, my := mercator.FromWGS84(h.server.CRS.ToWGS84(p.X, p.Y))
+				projected[i] = geom.Point{X: (mx - minX - margin) * scale, Y: (maxY - margin - my) * scale}
+			}
+			projected = projected.Simplify(tolerance)
+			line := make([]mvt.Point, len(projected))
+			for i, p := range projected {
+				line[i] = mvt.Point{X: int(math.Round(p.X)), Y: int(math.Round(p.Y))}
+			}
+			if _, ok := lines[c.Level]; !ok {
+				levels = append(levels, c.Level)
+				index[c.Level] = c.Index
+			}
+			lines[c.Level] = append(lines[c.Level], line)
+		}
+	}
+
+	// One feature per level.
+	for _, level := range levels {
+		layer.Features = append(layer.Features, mvt.Feature{
+			Lines:      lines[level],
+			Properties: map[string]interface{}{"elevation": level, "index": index[level]},
+		})
+	}
+	return mvt.Encode(layer)
+}
+
+// tileJSON sends a TileJSON 3.0.0 document describing the vector tiles.
+func (h *contourTileHandler) tileJSON(w http.ResponseWriter, r *http.Request) {
+	west, south, east, north := h.server.WGS84Bounds()
+	maxZoom := h.server.NativeZoom()
+	minZoom := maxZoom - contourZoomRange
+	if minZoom < 0 {
+		minZoom = 0
+	}
+
+	doc := map[string]interface{}{
+		"tilejson": "3.0.0",
+		"name":     contourLayer,
+		"scheme":   "xyz",
+		"tiles":    []string{baseURL(r, h.server.trustProxy) + "/contours/{z}/{x}/{y}.pbf" + authQuery(r)},
+		"minzoom":  minZoom,
+		"maxzoom":  maxZoom,
+		"bounds":   []float64{west, south, east, north},
+		"center":   []float64{(west + east) / 2, (south + north) / 2, float64(maxZoom - 2)},
+		"vector_layers": []map[string]interface{}{{
+			"id":     contourLayer,
+			"fields": map[string]string{"elevation": "Number", "index": "Boolean"},
+		}},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(doc)
+	if err != nil {
+		slog.Error("contours: TileJSON", "error", err)
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/goblimey/tiler/crs"
+	"github.com/goblimey/tiler/esri"
+	"github.com/goblimey/tiler/geotiff"
+	"github.com/goblimey/tiler/heightmap"
+	"github.com/goblimey/tiler/tile"
+)
+
+// gridFormats describes the grid file formats, by file name extension.
+var gridFormats = []string{
+	".asc - ESRI ASCII grid",
+	".flt or .hdr - ESRI GridFloat",
+	".tif or .tiff - GeoTIFF",
+	".tgrid - tiler binary grid, fast to load",
+}
+
+// readGridFile reads a grid in the format given by the file name extension.
+// The name "-" reads the standard input - see readGridStream.
+func readGridFile(filename string) (*esri.Grid, error) {
+	return readGridFileContext(context.Background(), filename)
+}
+
+// readGridFileContext reads a grid like readGridFile, giving up if ctx is
+// cancelled.  Only ESRI ASCII grids, which are slow to read, are given up
+// part way - the other formats are checked once they have been read.
+func readGridFileContext(ctx context.Context, filename string) (*esri.Grid, error) {
+	if filename == "-" {
+		return readGridStream(ctx, os.Stdin)
+	}
+	var g *esri.Grid
+	var err error
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".flt", ".hdr":
+		g, err = esri.ReadFloatGridFromFile(filename)
+	case ".tif", ".tiff":
+		g, err = geotiff.ReadFromFile(filename)
+	case ".tgrid":
+		g, err = esri.ReadBinaryGridFromFile(filename)
+	default:
+		p := newProgress("reading " + filename)
+		defer p.finish()
+		return esri.ReadGridFromFile(filename, esri.WithContext(ctx), esri.WithProgress(p.update))
+	}
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// readGridStream reads a grid from in, recognising GeoTIFF and binary grids
+// by their first few bytes and taking anything else to be an ESRI ASCII
+// grid.  GridFloat grids, which come in two files, and zip files, which
+// can't be read as a stream, can't be read this way.
+func readGridStream(ctx context.Context, in io.Reader) (*esri.Grid, error) {
+	r := bufio.NewReader(in)
+	start, _ := r.Peek(len(esri.BinaryMagic))
+	var g *esri.Grid
+	var err error
+	switch {
+	case bytes.HasPrefix(start, []byte("PK\x03\x04")):
+		return nil, errors.New("a zip file can't be read from the standard input - give its name instead")
+	case isTIFF(start):
+		g, err = geotiff.Read(r)
+	case string(start) == esri.BinaryMagic:
+		g, err = esri.ReadBinaryGrid(r)
+	default:
+		return esri.ReadGrid(r, esri.WithContext(ctx))
+	}
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// isTIFF returns true if start, the first bytes of a file, are those of a
+// TIFF or BigTIFF file.
+func isTIFF(start []byte) bool {
+	for _, magic := range []string{"II*\x00", "MM\x00*", "II+\x00", "MM\x00+"} {
+		if bytes.HasPrefix(start, []byte(magic)) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeGridFile writes a grid in the format given by the file name
+// extension, or as an ESRI ASCII grid on the standard output if the name is
+// "-".  c is the coordinate reference system of the grid, recorded in
+// GeoTIFF files, and compress asks for GeoTIFF heights to be compressed.
+func writeGridFile(filename string, g *esri.Grid, c crs.CRS, compress bool) error {
+	if filename == "-" {
+		return g.Write(os.Stdout)
+	}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".asc":
+		return g.WriteToFile(filename)
+	case ".flt", ".hdr":
+		return g.WriteFloatToFile(filename)
+	case ".tif", ".tiff":
+		epsg, _ := strconv.Atoi(strings.TrimPrefix(c.Code(), "EPSG:"))
+		return geotiff.WriteToFile(filename, g, geotiff.Options{EPSG: epsg, Compress: compress})
+	case ".tgrid":
+		return g.WriteBinaryToFile(filename)
+	}
+	return fmt.Errorf("%s: unknown grid format - expected .asc, .flt, .hdr, .tif, .tiff or .tgrid", filename)
+}
+
+// readImageFile reads a grid from the PNG picture of heights filename.
+// encoding, heights, bounds and tileName are the flags of the convert
+// command that say how the pixels hold heights and where they are.
+func readImageFile(filename, encoding, heights, bounds, tileName string) (*esri.Grid, error) {
+	options := heightmap.ImageOptions{Encoding: encoding}
+	if encoding == "" {
+		return nil, fmt.Errorf("%s: -encoding is needed for a picture - %s", filename, strings.Join(heightmap.Encodings, ", "))
+	}
+	switch {
+	case bounds != "" && tileName != "":
+		return nil, fmt.Errorf("-bounds and -tile both give the position of the picture - use one")
+	case bounds != "":
+		minX, minY, maxX, maxY, err := parseBBox(bounds)
+		if err != nil {
+			return nil, err
+		}
+		options.West, options.South, options.East, options.North = float64(minX), float64(minY), float64(maxX), float64(maxY)
+	case tileName != "":
+		z, x, y, err := parseTilePath(tileName, "")
+		if err != nil {
+			return nil, err
+		}
+		if !tile.Valid(z, x, y) {
+			return nil, fmt.Errorf("-tile %s is not a web map tile", tileName)
+		}
+		options.West, options.South, options.East, options.North = tile.Bounds(z, x, y)
+	default:
+		return nil, fmt.Errorf("%s: -bounds or -tile is needed for the position of the picture", filename)
+	}
+	if strings.ToLower(encoding) == heightmap.Grey {
+		field := strings.Split(heights, ",")
+		if len(field) != 2 {
+			return nil, fmt.Errorf("-heights %q - expected lowest,highest for a grey picture", heights)
+		}
+		for i, h := range []*float64{&options.MinHeight, &options.MaxHeight} {
+			v, err := strconv.ParseFloat(strings.TrimSpace(field[i]), 64)
+			if err != nil {
+				return nil, fmt.Errorf("-heights %q - %s", heights, err.Error())
+			}
+			*h = v
+		}
+	}
+	g, err := heightmap.ReadImageFromFile(filename, options)
+	if err != nil {
+		return nil, readError(err)
+	}
+	return g, nil
+}
+
+// convert sets up the convert command, which copies a grid from one file
+// format to another, optionally cropping it and changing the cell size on
+// the way.  It returns the flags of the command and the function that runs
+// it once they are parsed from the arguments that follow "convert".
+func convert() (*flag.FlagSet, func()) {
+	fs := flag.NewFlagSet("convert", flag.ExitOnError)
+	var input, output string
+	fs.StringVar(&input, "input", "", "grid file to convert - - for the standard input")
+	fs.StringVar(&input, "i", "", "grid file to convert - - for the standard input")
+	fs.StringVar(&output, "output", "", "results file - - for an ESRI ASCII grid on the standard output")
+	fs.StringVar(&output, "o", "", "results file - - for an ESRI ASCII grid on the standard output")
+	bbox := fs.String("bbox", "", "area to keep - minX,minY,maxX,maxY in map coordinates")
+	cellsize := fs.Float64("cellsize", 0, "resample to cells of this size in map units - 0 keeps the cell size")
+	method := fs.String("resample", "bilinear", "how to find the heights when resampling - "+strings.Join(esri.ResampleMethods, ", "))
+	crsName := fs.String("crs", crs.Default, "coordinate reference system of the grid, recorded in GeoTIFF files")
+	compress := fs.Bool("compress", true, "compress the heights in GeoTIFF files")
+	encoding := fs.String("encoding", "", "PNG input - how the pixels hold the heights - "+strings.Join(heightmap.Encodings, ", "))
+	heights := fs.String("heights", "", "PNG input, grey - the heights of black and white, as lowest,highest")
+	bounds := fs.String("bounds", "", "PNG input - map positions of the edges of the picture, as minX,minY,maxX,maxY")
+	tileName := fs.String("tile", "", "PNG input - the z/x/y web map tile that the picture is, in Web Mercator (EPSG:3857) - instead of -bounds")
+	transforms := addTransformFlag(fs)
+	overwrite := addOverwriteFlags(fs)
+	logging := addLogFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: tiler convert -i in -o out [flags]\n\nThe format of each file is given by its name:\n")
+		for _, f := range gridFormats {
+			fmt.Fprintf(fs.Output(), "  %s\n", f)
+		}
+		fmt.Fprintf(fs.Output(), "  .png - picture of heights, input only, with -encoding and -bounds or -tile\n")
+		fmt.Fprintln(fs.Output())
+		fs.PrintDefaults()
+	}
+	return fs, func() {
+		err := logging.setup()
+		if err != nil {
+			fatal(err.Error())
+		}
+		if input == "" || output == "" {
+			fs.Usage()
+			os.Exit(2)
+		}
+		err = overwrite.check(output)
+		if err != nil {
+			fatal(err.Error())
+		}
+		c, err := crs.Lookup(*crsName)
+		if err != nil {
+			fatal(err.Error())
+		}
+		err = transforms.check()
+		if err != nil {
+			fatal(err.Error())
+		}
+
+		var grid *esri.Grid
+		if strings.ToLower(filepath.Ext(input)) == ".png" {
+			grid, err = readImageFile(input, *encoding, *heights, *bounds, *tileName)
+		} else {
+			grid, err = readGridFile(input)
+			err = readError(err)
+		}
+		if err != nil {
+			fail(err)
+		}
+		if *bbox != "" {
+			minX, minY, maxX, maxY, err := parseBBox(*bbox)
+			if err != nil {
+				fatal(err.Error())
+			}
+			grid, err = grid.Crop(minX, minY, maxX, maxY)
+			if err != nil {
+				fatal(err.Error())
+			}
+		}
+		if *cellsize > 0 {
+			grid, err = grid.Resample(float32(*cellsize), *method)
+			if err != nil {
+				fatal(err.Error())
+			}
+		}
+		grid, err = transforms.apply(context.Background(), grid)
+		if err != nil {
+			fatal(err.Error())
+		}
+
+		err = writeGridFile(output, grid, c, *compress)
+		if err != nil {
+			fail(writeError(err))
+		}
+		slog.Info("done", "ncols", grid.Ncols(), "nrows", grid.Nrows(), "cellsize", grid.CellSize())
+	}
+}
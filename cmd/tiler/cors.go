@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// corsPolicy adds Cross-Origin Resource Sharing headers to responses so that
+// web maps served from other sites can use the tiles.
+type corsPolicy struct {
+	origins []string // "*" allows any origin.
+}
+
+// newCORSPolicy takes a comma separated list of allowed origins.  It returns
+// nil if the list is empty.
+func newCORSPolicy(origins string) *corsPolicy {
+	list := splitList(origins)
+	if len(list) == 0 {
+		return nil
+	}
+	return &corsPolicy{list}
+}
+
+// wrap returns a handler that adds the CORS headers and answers preflight
+// requests itself.  If p is nil, h is returned unchanged.
+func (p *corsPolicy) wrap(h http.Handler) http.Handler {
+	if p == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if allowed := p.allow(origin); allowed != "" {
+			w.Header().Set("Access-Control-Allow-Origin", allowed)
+			if allowed != "*" {
+				w.Header().Add("Vary", "Origin")
+			}
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				w.Header().Set("Access-Control-Allow-Methods", "GET, HEAD, POST, OPTIONS")
+				w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-API-Key")
+				w.Header().Set("Access-Control-Max-Age", "86400")
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// allow returns the value for the Access-Control-Allow-Origin header, or ""
+// if the origin is not allowed.
+func (p *corsPolicy) allow(origin string) string {
+	if origin == "" {
+		return ""
+	}
+	for _, o := range p.origins {
+		if o == "*" {
+			return "*"
+		}
+		if strings.EqualFold(o, origin) {
+			return origin
+		}
+	}
+	return ""
+}
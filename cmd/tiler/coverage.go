@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/goblimey/tiler/esri"
+	"github.com/goblimey/tiler/geojson"
+	"github.com/goblimey/tiler/polygonize"
+)
+
+// coverage sets up the coverage command, which writes the outline of the
+// cells holding data in each grid file as GeoJSON.  It returns the flags of
+// the command and the function that runs it once they are parsed from the
+// arguments that follow "coverage".
+func coverage() (*flag.FlagSet, func()) {
+	fs := flag.NewFlagSet("coverage", flag.ExitOnError)
+	var output string
+	fs.StringVar(&output, "output", "", "GeoJSON results file - the standard output if not given")
+	fs.StringVar(&output, "o", "", "GeoJSON results file - the standard output if not given")
+	overwrite := addOverwriteFlags(fs)
+	logging := addLogFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: tiler coverage [flags] file...\n")
+		fs.PrintDefaults()
+	}
+	return fs, func() {
+		err := logging.setup()
+		if err != nil {
+			fatal(err.Error())
+		}
+		if fs.NArg() == 0 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		err = overwrite.check(output)
+		if err != nil {
+			fatal(err.Error())
+		}
+
+		fc := new(geojson.FeatureCollection)
+		for _, filename := range fs.Args() {
+			grid, err := esri.ReadGridFromFile(filename)
+			if err != nil {
+				fail(readError(err))
+			}
+			polygons := polygonize.Regions(grid, func(row, col int) bool {
+				return !grid.IsNoData(row, col)
+			})
+			cells := 0
+			for row := 0; row < grid.Nrows(); row++ {
+				for col := 0; col < grid.Ncols(); col++ {
+					if !grid.IsNoData(row, col) {
+						cells++
+					}
+				}
+			}
+			cellsize := float64(grid.CellSize())
+			fc.AddMultiPolygon(polygons, map[string]interface{}{
+				"file":  filename,
+				"cells": cells,
+				"area":  float64(cells) * cellsize * cellsize,
+			})
+		}
+		if output == "" {
+			err = fc.Write(os.Stdout)
+		} else {
+			err = fc.WriteToFile(output)
+		}
+		if err != nil {
+			fail(writeError(err))
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"image"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/goblimey/tiler/crs"
+	"github.com/goblimey/tiler/tile"
+)
+
+// demHandler serves tiles with the heights packed into the pixel colours,
+// plus a TileJSON document describing them, so that MapLibre GL can use the
+// server as a raster-dem source for 3D terrain and hillshading.  The encoding
+// is either "terrain-rgb" (Mapbox) or "terrarium".
+type demHandler struct {
+	server   *tileServer
+	encoding string
+}
+
+// ServeHTTP handles /{encoding}.json and /{encoding}/{z}/{x}/{y}.png.
+func (h *demHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/"+h.encoding+".json" {
+		h.tileJSON(w, r)
+		return
+	}
+
+	z, x, y, err := parseTilePath(strings.TrimPrefix(r.URL.Path, "/"+h.encoding+"/"), ".png")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !tile.Valid(z, x, y) {
+		http.NotFound(w, r)
+		return
+	}
+
+	h.server.writeTile(w, r, h.encoding, z, x, y, h.renderTile)
+}
+
+// renderTile draws tile (z, x, y) with encoded heights.  Pixels with no data
+// are transparent.
+func (h *demHandler) renderTile(ctx context.Context, z, x, y int) (*image.RGBA, error) {
+	img := image.NewRGBA(image.Rect(0, 0, tile.Size, tile.Size))
+	if !h.server.Covers(z, x, y) {
+		return img, nil
+	}
+	encode := tile.EncodeMapbox
+	if h.encoding == "terrarium" {
+		encode = tile.EncodeTerrarium
+	}
+	minX, minY, maxX, maxY := tile.Bounds(z, x, y)
+	err := h.server.Sample(ctx, crs.WebMercator{}, minX, minY, maxX, maxY, tile.Size, tile.Size,
+		func(px, py int, height float32) {
+			img.SetRGBA(px, py, encode(float64(height)))
+		})
+	if err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+// tileJSON sends a TileJSON 2.2.0 document describing the tiles.
+func (h *demHandler) tileJSON(w http.ResponseWriter, r *http.Request) {
+	west, south, east, north := h.server.WGS84Bounds()
+	maxZoom := h.server.NativeZoom()
+	encoding := "mapbox"
+	if h.encoding == "terrarium" {
+		encoding = "terrarium"
+	}
+
+	doc := map[string]interface{}{
+		"tilejson": "2.2.0",
+		"name":     wmtsLayer + " " + h.encoding,
+		"scheme":   "xyz",
+		"tiles":    []string{baseURL(r, h.server.trustProxy) + "/" + h.encoding + "/{z}/{x}/{y}.png" + authQuery(r)},
+		"minzoom":  0,
+		"maxzoom":  maxZoom,
+		"bounds":   []float64{west, south, east, north},
+		"center":   []float64{(west + east) / 2, (south + north) / 2, float64(maxZoom - 2)},
+		"encoding": encoding,
+		"tileSize": tile.Size,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(doc)
+	if err != nil {
+		slog.Error("TileJSON", "encoding", h.encoding, "error", err)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image/png"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/goblimey/tiler/esri"
+	"github.com/goblimey/tiler/render"
+)
+
+// diff sets up the diff command, which subtracts one grid file from another
+// and writes the differences as a picture or as a grid file.  It returns the
+// flags of the command and the function that runs it once they are parsed
+// from the arguments that follow "diff".
+func diff() (*flag.FlagSet, func()) {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	var output string
+	fs.StringVar(&output, "output", "", "PNG map or ESRI Grid (.asc) results file")
+	fs.StringVar(&output, "o", "", "PNG map or ESRI Grid (.asc) results file")
+	limit := fs.Float64("range", 0, "PNG - difference drawn in full red or blue - the largest difference if not given")
+	bbox := fs.String("bbox", "", "area to cover - minX,minY,maxX,maxY in map coordinates")
+	overwrite := addOverwriteFlags(fs)
+	logging := addLogFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: tiler diff [flags] a.asc b.asc\n"+
+			"Writes the heights in a less the heights in b.\n")
+		fs.PrintDefaults()
+	}
+	return fs, func() {
+		err := logging.setup()
+		if err != nil {
+			fatal(err.Error())
+		}
+		if fs.NArg() != 2 || output == "" {
+			fs.Usage()
+			os.Exit(2)
+		}
+		err = overwrite.check(output)
+		if err != nil {
+			fatal(err.Error())
+		}
+
+		var grids [2]*esri.Grid
+		for i, filename := range fs.Args() {
+			grids[i], err = esri.ReadGridFromFile(filename)
+			if err != nil {
+				fail(readError(err))
+			}
+			if *bbox != "" {
+				minX, minY, maxX, maxY, err := parseBBox(*bbox)
+				if err != nil {
+					fatal(err.Error())
+				}
+				grids[i], err = grids[i].Crop(minX, minY, maxX, maxY)
+				if err != nil {
+					fatal(err.Error())
+				}
+			}
+		}
+		result, err := grids[0].Subtract(grids[1])
+		if err != nil {
+			fatal(err.Error())
+		}
+
+		// Summarise the change.
+		cells := 0
+		sum := 0.0
+		for row := 0; row < result.Nrows(); row++ {
+			for col := 0; col < result.Ncols(); col++ {
+				if !result.IsNoData(row, col) {
+					cells++
+					sum += float64(result.Height(row, col))
+				}
+			}
+		}
+		cellArea := float64(result.CellSize()) * float64(result.CellSize())
+		if cells > 0 {
+			slog.Info("differences", "cells", cells,
+				"min", result.MinHeight(), "max", result.MaxHeight(), "mean", sum/float64(cells),
+				"netVolume", sum*cellArea)
+		} else {
+			slog.Warn("no cells have data in both grids")
+		}
+
+		if strings.ToLower(filepath.Ext(output)) == ".asc" {
+			err = result.WriteToFile(output)
+			if err != nil {
+				fail(writeError(err))
+			}
+			return
+		}
+		if *limit <= 0 {
+			*limit = math.Max(math.Abs(float64(result.MinHeight())), math.Abs(float64(result.MaxHeight())))
+		}
+		out, err := os.Create(output)
+		if err != nil {
+			fail(writeError(err))
+		}
+		err = png.Encode(out, render.DiffImage(result, float32(*limit)))
+		if err != nil {
+			out.Close()
+			fail(writeError(err))
+		}
+		err = out.Close()
+		if err != nil {
+			fail(writeError(err))
+		}
+	}
+}
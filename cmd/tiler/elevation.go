@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/goblimey/tiler/geojson"
+	"github.com/goblimey/tiler/geom"
+)
+
+// elevationHandler answers height queries for a tileServer.
+type elevationHandler struct {
+	server *tileServer
+}
+
+// elevation is the answer to a query for the height at a point.  Lon and Lat
+// are only given if the query used them.  Height is nil where there is no
+// data.
+type elevation struct {
+	X      float64  `json:"x"`
+	Y      float64  `json:"y"`
+	CRS    string   `json:"crs"`
+	Lon    *float64 `json:"lon,omitempty"`
+	Lat    *float64 `json:"lat,omitempty"`
+	Height *float64 `json:"height"`
+}
+
+// maxBatchBytes limits the size of a POST /elevation request body.
+const maxBatchBytes = 16 * 1024 * 1024
+
+// maxBatchPoints limits the number of points in a POST /elevation request.
+const maxBatchPoints = 200000
+
+// ServeHTTP handles GET /elevation?x=&y= with map coordinates in the grids'
+// coordinate reference system, or GET /elevation?lon=&lat= with WGS84
+// longitude and latitude, and POST /elevation with many points.
+func (h *elevationHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		h.batch(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		jsonError(w, http.StatusMethodNotAllowed, "method "+r.Method+" not allowed")
+		return
+	}
+
+	q := r.URL.Query()
+	var result elevation
+	var err error
+	switch {
+	case q.Get("x") != "" || q.Get("y") != "":
+		result.X, result.Y, err = parsePair(q.Get("x"), q.Get("y"), "x", "y")
+		if err != nil {
+			jsonError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	case q.Get("lon") != "" || q.Get("lat") != "":
+		lon, lat, err := parsePair(q.Get("lon"), q.Get("lat"), "lon", "lat")
+		if err != nil {
+			jsonError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		result.Lon, result.Lat = &lon, &lat
+		result.X, result.Y = h.server.CRS.FromWGS84(lon, lat)
+	default:
+		jsonError(w, http.StatusBadRequest, "give x and y, or lon and lat")
+		return
+	}
+
+	status := http.StatusOK
+	if !h.lookup(&result) {
+		status = http.StatusNotFound
+	}
+	writeJSON(w, status, result)
+}
+
+// lookup fills in the CRS and height of e from its x and y.  It returns false
+// if there is no data there.
+func (h *elevationHandler) lookup(e *elevation) bool {
+	e.CRS = h.server.CRS.Code()
+	height, ok := h.server.TileSet.InterpolatedHeightAt(e.X, e.Y)
+	if ok {
+		v := float64(height)
+		e.Height = &v
+	}
+	return ok
+}
+
+// batch handles POST /elevation.  The body is either GeoJSON holding
+// Points, MultiPoints or LineStrings, or CSV text with an x,y pair on each
+// line (an optional header line is skipped).  The coordinates are in the
+// grids' coordinate reference system, or WGS84 longitude and latitude if the
+// query includes lonlat=true.  A CSV request gets a CSV response with the
+// height added to each line, anything else gets JSON.
+func (h *elevationHandler) batch(w http.ResponseWriter, r *http.Request) {
+	lonlat, _ := strconv.ParseBool(r.URL.Query().Get("lonlat"))
+	body := http.MaxBytesReader(w, r.Body, maxBatchBytes)
+
+	contentType := r.Header.Get("Content-Type")
+	isCSV := strings.HasPrefix(contentType, "text/csv") || strings.HasPrefix(contentType, "text/plain")
+	var points []geom.Point
+	var err error
+	if isCSV {
+		points, err = readCSVPoints(body)
+	} else {
+		points, err = geojson.ReadPoints(body)
+	}
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(points) > maxBatchPoints {
+		jsonError(w, http.StatusRequestEntityTooLarge,
+			fmt.Sprintf("%d points - the limit is %d", len(points), maxBatchPoints))
+		return
+	}
+
+	results := make([]elevation, len(points))
+	for i, p := range points {
+		if lonlat {
+			lon, lat := p.X, p.Y
+			results[i].Lon, results[i].Lat = &lon, &lat
+			results[i].X, results[i].Y = h.server.CRS.FromWGS84(lon, lat)
+		} else {
+			results[i].X, results[i].Y = p.X, p.Y
+		}
+		h.lookup(&results[i])
+	}
+
+	if !isCSV {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"crs":    h.server.CRS.Code(),
+			"points": results,
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	out := csv.NewWriter(w)
+	if lonlat {
+		out.Write([]string{"lon", "lat", "height"})
+	} else {
+		out.Write([]string{"x", "y", "height"})
+	}
+	for i, e := range results {
+		height := ""
+		if e.Height != nil {
+			height = strconv.FormatFloat(*e.Height, 'f', 3, 64)
+		}
+		x := strconv.FormatFloat(points[i].X, 'f', -1, 64)
+		y := strconv.FormatFloat(points[i].Y, 'f', -1, 64)
+		out.Write([]string{x, y, height})
+	}
+	out.Flush()
+}
+
+// readCSVPoints reads x,y pairs, one per line.  Any further fields are
+// ignored, and so is a first line that doesn't start with a number.
+func readCSVPoints(r io.Reader) ([]geom.Point, error) {
+	in := csv.NewReader(r)
+	in.FieldsPerRecord = -1
+	in.TrimLeadingSpace = true
+	var points []geom.Point
+	for line := 1; ; line++ {
+		record, err := in.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) < 2 {
+			return nil, fmt.Errorf("line %d: expected x,y", line)
+		}
+		x, y, err := parsePair(record[0], record[1], "x", "y")
+		if err != nil {
+			if line == 1 {
+				// A header.
+				continue
+			}
+			return nil, fmt.Errorf("line %d: %s", line, err.Error())
+		}
+		points = append(points, geom.Point{X: x, Y: y})
+	}
+	if len(points) == 0 {
+		return nil, fmt.Errorf("no points found")
+	}
+	return points, nil
+}
+
+// parsePair parses two numbers, naming them in any error message.
+func parsePair(a, b, nameA, nameB string) (float64, float64, error) {
+	va, err := strconv.ParseFloat(a, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("bad %s %q", nameA, a)
+	}
+	vb, err := strconv.ParseFloat(b, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("bad %s %q", nameB, b)
+	}
+	return va, vb, nil
+}
+
+// writeJSON sends v as a JSON response.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		slog.Error("writeJSON", "error", err)
+	}
+}
+
+// jsonError sends an error message as a JSON response.
+func jsonError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
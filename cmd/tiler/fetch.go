@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/goblimey/tiler/crs"
+	"github.com/goblimey/tiler/lidar"
+)
+
+// fetch sets up the fetch command, which downloads the Environment Agency
+// lidar tiles covering grid squares or an area, unpacks the grid files and
+// writes a mosaic manifest listing them for the other commands.  It returns
+// the flags of the command and the function that runs it once they are
+// parsed from the arguments that follow "fetch".
+func fetch() (*flag.FlagSet, func()) {
+	fs := flag.NewFlagSet("fetch", flag.ExitOnError)
+	var outputDir string
+	fs.StringVar(&outputDir, "output-dir", "lidar", "folder for the downloads, the grid files and the manifest")
+	fs.StringVar(&outputDir, "o", "lidar", "folder for the downloads, the grid files and the manifest")
+	refs := fs.String("ref", "", "Ordnance Survey grid references of the squares to cover, separated by commas - for example TQ1652,TQ15se")
+	bbox := fs.String("bbox", "", "area to cover - minE,minN,maxE,maxN in National Grid metres")
+	template := fs.String("url", lidar.DefaultURL, "address of a tile's zip file, with {tile} where the tile name goes, such as TQ15se - the 2022 1 m composite DTM by default")
+	manifest := fs.String("manifest", "", "mosaic manifest to write - manifest.txt in the output folder if not given")
+	timeout := addTimeoutFlag(fs)
+	overwrite := addOverwriteFlags(fs)
+	logging := addLogFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: tiler fetch -ref TQ15 [flags]\n"+
+			"       tiler fetch -bbox minE,minN,maxE,maxN [flags]\n")
+		fs.PrintDefaults()
+	}
+	return fs, func() {
+		err := logging.setup()
+		if err != nil {
+			fatal(err.Error())
+		}
+		if *template == "" || (*refs == "") == (*bbox == "") {
+			fs.Usage()
+			os.Exit(2)
+		}
+		if !strings.Contains(*template, "{tile}") {
+			fatal(fmt.Sprintf("-url %s has no {tile} for the tile name", *template))
+		}
+		if *manifest == "" {
+			*manifest = filepath.Join(outputDir, "manifest.txt")
+		}
+		err = overwrite.check(*manifest)
+		if err != nil {
+			fatal(err.Error())
+		}
+
+		// The tiles covering the squares or the area, each once.
+		var tiles []string
+		seen := make(map[string]bool)
+		add := func(minE, minN, maxE, maxN float64) {
+			names, err := lidar.Tiles(minE, minN, maxE, maxN)
+			if err != nil {
+				fatal(err.Error())
+			}
+			for _, name := range names {
+				if !seen[name] {
+					seen[name] = true
+					tiles = append(tiles, name)
+				}
+			}
+		}
+		if *bbox != "" {
+			minE, minN, maxE, maxN, err := parseBBox(*bbox)
+			if err != nil {
+				fatal(err.Error())
+			}
+			add(float64(minE), float64(minN), float64(maxE), float64(maxN))
+		}
+		for _, ref := range strings.Split(*refs, ",") {
+			if strings.TrimSpace(ref) == "" {
+				continue
+			}
+			e, n, size, err := crs.ParseGridReference(ref)
+			if err != nil {
+				fatal(err.Error())
+			}
+			add(e, n, e+size, n+size)
+		}
+		slog.Info("fetching", "tiles", len(tiles))
+
+		err = os.MkdirAll(outputDir, 0755)
+		if err != nil {
+			fail(writeError(err))
+		}
+		ctx, cancel := commandContext(*timeout)
+		defer cancel()
+		var grids []string
+		for _, name := range tiles {
+			zipFile, err := lidar.Download(ctx, http.DefaultClient, lidar.URL(*template, name), outputDir, name)
+			if errors.Is(err, lidar.ErrNoTile) {
+				slog.Warn("no lidar for this tile", "tile", name)
+				continue
+			}
+			if err != nil {
+				fail(err)
+			}
+			names, err := lidar.Unpack(zipFile, outputDir)
+			if err != nil {
+				fail(readError(err))
+			}
+			grids = append(grids, names...)
+		}
+		if len(grids) == 0 {
+			fatal("no grid files were found for the tiles")
+		}
+		err = writeManifest(*manifest, grids)
+		if err != nil {
+			fail(writeError(err))
+		}
+		slog.Info("done", "tiles", len(tiles), "grids", len(grids), "manifest", *manifest)
+	}
+}
+
+// writeManifest writes a mosaic manifest listing the grid files, named
+// from the folder holding the manifest where possible - see
+// esri.ReadManifest.
+func writeManifest(filename string, grids []string) error {
+	dir, err := filepath.Abs(filepath.Dir(filename))
+	if err != nil {
+		return err
+	}
+	out, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(out)
+	for _, grid := range grids {
+		name := grid
+		if abs, err := filepath.Abs(grid); err == nil {
+			if rel, err := filepath.Rel(dir, abs); err == nil {
+				name = rel
+			}
+		}
+		fmt.Fprintln(w, filepath.ToSlash(name))
+	}
+	err = w.Flush()
+	if err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/goblimey/tiler/esri"
+	"github.com/goblimey/tiler/hydro"
+)
+
+// fill sets up the fill command, which fills the depressions in a grid file
+// and writes the result as another grid file.  It returns the flags of the
+// command and the function that runs it once they are parsed from the
+// arguments that follow "fill".
+func fill() (*flag.FlagSet, func()) {
+	fs := flag.NewFlagSet("fill", flag.ExitOnError)
+	var input, output string
+	fs.StringVar(&input, "input", "", "data file")
+	fs.StringVar(&input, "i", "", "data file")
+	fs.StringVar(&output, "output", "", "ESRI Grid results file")
+	fs.StringVar(&output, "o", "", "ESRI Grid results file")
+	slope := fs.Bool("slope", false, "give filled areas and flats a tiny slope towards their outlet instead of leaving them level")
+	bbox := fs.String("bbox", "", "area to cover - minX,minY,maxX,maxY in map coordinates")
+	overwrite := addOverwriteFlags(fs)
+	logging := addLogFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: tiler fill -i file -o file [flags]\n")
+		fs.PrintDefaults()
+	}
+	return fs, func() {
+		err := logging.setup()
+		if err != nil {
+			fatal(err.Error())
+		}
+		if input == "" || output == "" {
+			fs.Usage()
+			os.Exit(2)
+		}
+		err = overwrite.check(output)
+		if err != nil {
+			fatal(err.Error())
+		}
+
+		grid, err := esri.ReadGridFromFile(input)
+		if err != nil {
+			fail(readError(err))
+		}
+		if *bbox != "" {
+			minX, minY, maxX, maxY, err := parseBBox(*bbox)
+			if err != nil {
+				fatal(err.Error())
+			}
+			grid, err = grid.Crop(minX, minY, maxX, maxY)
+			if err != nil {
+				fatal(err.Error())
+			}
+		}
+		err = hydro.Fill(grid, *slope).WriteToFile(output)
+		if err != nil {
+			fail(writeError(err))
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/goblimey/tiler/esri"
+	"github.com/goblimey/tiler/hydro"
+)
+
+// flow sets up the flow command, which writes the D8 flow direction and flow
+// accumulation grids of a grid file.  It returns the flags of the command
+// and the function that runs it once they are parsed from the arguments that
+// follow "flow".
+func flow() (*flag.FlagSet, func()) {
+	fs := flag.NewFlagSet("flow", flag.ExitOnError)
+	var input string
+	fs.StringVar(&input, "input", "", "data file")
+	fs.StringVar(&input, "i", "", "data file")
+	directionFile := fs.String("direction", "", "ESRI Grid results file for the flow directions")
+	accumulationFile := fs.String("accumulation", "", "ESRI Grid results file for the flow accumulation")
+	fillFirst := fs.Bool("fill", false, "fill the depressions first, giving the filled areas a tiny slope so that water flows out of them")
+	bbox := fs.String("bbox", "", "area to cover - minX,minY,maxX,maxY in map coordinates")
+	overwrite := addOverwriteFlags(fs)
+	logging := addLogFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: tiler flow -i file [-direction file] [-accumulation file] [flags]\n")
+		fs.PrintDefaults()
+	}
+	return fs, func() {
+		err := logging.setup()
+		if err != nil {
+			fatal(err.Error())
+		}
+		if input == "" || (*directionFile == "" && *accumulationFile == "") {
+			fs.Usage()
+			os.Exit(2)
+		}
+		err = overwrite.check(*directionFile, *accumulationFile)
+		if err != nil {
+			fatal(err.Error())
+		}
+
+		grid, err := esri.ReadGridFromFile(input)
+		if err != nil {
+			fail(readError(err))
+		}
+		if *bbox != "" {
+			minX, minY, maxX, maxY, err := parseBBox(*bbox)
+			if err != nil {
+				fatal(err.Error())
+			}
+			grid, err = grid.Crop(minX, minY, maxX, maxY)
+			if err != nil {
+				fatal(err.Error())
+			}
+		}
+
+		if *fillFirst {
+			grid = hydro.Fill(grid, true)
+		}
+		directions := hydro.FlowDirection(grid)
+		if *directionFile != "" {
+			err = directions.WriteToFile(*directionFile)
+			if err != nil {
+				fail(writeError(err))
+			}
+		}
+		if *accumulationFile != "" {
+			err = hydro.FlowAccumulation(directions).WriteToFile(*accumulationFile)
+			if err != nil {
+				fail(writeError(err))
+			}
+		}
+	}
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goblimey/tiler/tile"
+)
+
+// grpcService is the path prefix of the methods of the Tiler service of
+// proto/tiler.proto.
+const grpcService = "/tiler.v1.Tiler/"
+
+// The gRPC status codes that the handler returns.
+const (
+	grpcOK                = 0
+	grpcCancelled         = 1
+	grpcInvalidArgument   = 3
+	grpcDeadlineExceeded  = 4
+	grpcResourceExhausted = 8
+	grpcUnimplemented     = 12
+	grpcInternal          = 13
+	grpcUnavailable       = 14
+)
+
+// grpcError is a failed call and its gRPC status code.
+type grpcError struct {
+	code int
+	msg  string
+}
+
+func (e *grpcError) Error() string {
+	return e.msg
+}
+
+// grpcHandler answers the gRPC interface of proto/tiler.proto for a
+// tileServer, on the same port as the HTTP interface.  gRPC is HTTP/2, so
+// plain HTTP clients need it without TLS ("h2c") - see allowH2C.
+type grpcHandler struct {
+	server *tileServer
+}
+
+// ServeHTTP handles a unary call to one of the methods of the service.
+func (h *grpcHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		http.Error(w, "gRPC calls are POSTs of application/grpc", http.StatusUnsupportedMediaType)
+		return
+	}
+	if r.ProtoMajor != 2 {
+		http.Error(w, "gRPC needs HTTP/2", http.StatusHTTPVersionNotSupported)
+		return
+	}
+
+	ctx, cancel := h.context(r)
+	defer cancel()
+	method := strings.TrimPrefix(r.URL.Path, grpcService)
+	request, err := readGRPCMessage(r.Body)
+	var response []byte
+	if err == nil {
+		switch method {
+		case "RenderTile":
+			response, err = h.renderTile(ctx, request)
+		case "GetElevation":
+			response, err = h.getElevation(request)
+		case "GetStats":
+			response, err = h.getStats()
+		default:
+			err = &grpcError{grpcUnimplemented, "unknown method " + method}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/grpc")
+	if err != nil {
+		code, msg := grpcStatus(err)
+		if code == grpcInternal {
+			slog.Error("grpc", "method", method, "error", err)
+		}
+		// A failure is sent as headers alone ("Trailers-Only").
+		w.Header().Set("Grpc-Status", strconv.Itoa(code))
+		w.Header().Set("Grpc-Message", grpcEscape(msg))
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	prefix := make([]byte, 5)
+	binary.BigEndian.PutUint32(prefix[1:], uint32(len(response)))
+	w.Write(prefix)
+	w.Write(response)
+	w.Header().Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(grpcOK))
+}
+
+// context returns the context of a call - the context of the request,
+// limited to -render-timeout and to the deadline the client gave in the
+// grpc-timeout header.
+func (h *grpcHandler) context(r *http.Request) (context.Context, context.CancelFunc) {
+	ctx, cancel := h.server.renderContext(r)
+	timeout, ok := parseGRPCTimeout(r.Header.Get("Grpc-Timeout"))
+	if !ok {
+		return ctx, cancel
+	}
+	ctx, cancelTimeout := context.WithTimeout(ctx, timeout)
+	return ctx, func() {
+		cancelTimeout()
+		cancel()
+	}
+}
+
+// grpcUnits are the units of the grpc-timeout header.
+var grpcUnits = map[byte]time.Duration{
+	'H': time.Hour, 'M': time.Minute, 'S': time.Second,
+	'm': time.Millisecond, 'u': time.Microsecond, 'n': time.Nanosecond,
+}
+
+// parseGRPCTimeout parses a grpc-timeout header such as "250m".  ok is
+// false if there's no timeout.
+func parseGRPCTimeout(s string) (timeout time.Duration, ok bool) {
+	if len(s) < 2 || len(s) > 9 {
+		return 0, false
+	}
+	unit, ok := grpcUnits[s[len(s)-1]]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(s[:len(s)-1], 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return time.Duration(n) * unit, true
+}
+
+// readGRPCMessage reads the request message of a unary call.  Each message
+// has a five byte prefix - a flag saying whether it's compressed and its
+// length.
+func readGRPCMessage(in io.Reader) ([]byte, error) {
+	prefix := make([]byte, 5)
+	_, err := io.ReadFull(in, prefix)
+	if err != nil {
+		return nil, &grpcError{grpcInvalidArgument, "reading the request - " + err.Error()}
+	}
+	if prefix[0] != 0 {
+		return nil, &grpcError{grpcUnimplemented, "compressed messages aren't supported"}
+	}
+	size := binary.BigEndian.Uint32(prefix[1:])
+	if size > maxBatchBytes {
+		return nil, &grpcError{grpcResourceExhausted,
+			fmt.Sprintf("the request is %d bytes - the limit is %d", size, maxBatchBytes)}
+	}
+	message := make([]byte, size)
+	_, err = io.ReadFull(in, message)
+	if err != nil {
+		return nil, &grpcError{grpcInvalidArgument, "reading the request - " + err.Error()}
+	}
+	return message, nil
+}
+
+// grpcStatus returns the gRPC status code and message for err.
+func grpcStatus(err error) (int, string) {
+	var ge *grpcError
+	switch {
+	case errors.As(err, &ge):
+		return ge.code, ge.msg
+	case errors.Is(err, errBadMessage):
+		return grpcInvalidArgument, err.Error()
+	case err == errBusy:
+		return grpcUnavailable, err.Error()
+	case errors.Is(err, context.DeadlineExceeded):
+		return grpcDeadlineExceeded, "the call took too long"
+	case errors.Is(err, context.Canceled):
+		return grpcCancelled, err.Error()
+	}
+	return grpcInternal, err.Error()
+}
+
+// grpcEscape percent-encodes a grpc-message header, as the protocol asks.
+func grpcEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < ' ' || c > '~' || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// grpcEncodings are the renderings of a tile, by TileEncoding number.
+var grpcEncodings = []string{"tiles", "terrain-rgb", "terrarium"}
+
+// renderTile answers RenderTile.  The tiles are shared with the HTTP
+// interface's cache.
+func (h *grpcHandler) renderTile(ctx context.Context, request []byte) ([]byte, error) {
+	var z, x, y, encoding int64
+	err := readProto(request, func(f protoField) error {
+		var err error
+		switch f.num {
+		case 1:
+			z, err = f.int()
+		case 2:
+			x, err = f.int()
+		case 3:
+			y, err = f.int()
+		case 4:
+			encoding, err = f.int()
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if encoding < 0 || encoding >= int64(len(grpcEncodings)) {
+		return nil, &grpcError{grpcInvalidArgument, fmt.Sprintf("unknown encoding %d", encoding)}
+	}
+	if !tile.Valid(int(z), int(x), int(y)) {
+		return nil, &grpcError{grpcInvalidArgument, fmt.Sprintf("no tile %d/%d/%d", z, x, y)}
+	}
+
+	kind := grpcEncodings[encoding]
+	render := h.server.Tile
+	if kind != "tiles" {
+		render = (&demHandler{h.server, kind}).renderTile
+	}
+	png, err := h.server.cachedTile(ctx, kind, int(z), int(x), int(y), encodePNG(render))
+	if err != nil {
+		return nil, err
+	}
+	var response protoBuffer
+	response.bytesField(1, png)
+	return response.b, nil
+}
+
+// getElevation answers GetElevation.
+func (h *grpcHandler) getElevation(request []byte) ([]byte, error) {
+	var points []elevation
+	lonlat := false
+	err := readProto(request, func(f protoField) error {
+		switch f.num {
+		case 1:
+			data, err := f.message()
+			if err != nil {
+				return err
+			}
+			var p elevation
+			err = readProto(data, func(f protoField) error {
+				var err error
+				switch f.num {
+				case 1:
+					p.X, err = f.double()
+				case 2:
+					p.Y, err = f.double()
+				}
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			if len(points) == maxBatchPoints {
+				return &grpcError{grpcResourceExhausted, fmt.Sprintf("more than %d points", maxBatchPoints)}
+			}
+			points = append(points, p)
+		case 2:
+			var err error
+			lonlat, err = f.bool()
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ts := h.server.TileSet
+	var response protoBuffer
+	response.stringField(1, h.server.CRS.Code())
+	for _, p := range points {
+		if lonlat {
+			p.X, p.Y = h.server.CRS.FromWGS84(p.X, p.Y)
+		}
+		var e protoBuffer
+		e.doubleField(1, p.X)
+		e.doubleField(2, p.Y)
+		if height, ok := ts.InterpolatedHeightAt(p.X, p.Y); ok {
+			e.boolField(3, true)
+			e.doubleField(4, float64(height))
+		}
+		response.messageField(2, &e)
+	}
+	return response.b, nil
+}
+
+// getStats answers GetStats.
+func (h *grpcHandler) getStats() ([]byte, error) {
+	ts := h.server.TileSet
+	var cells int64
+	for _, g := range ts.Grids() {
+		cells += int64(g.Ncols()) * int64(g.Nrows())
+	}
+	minX, minY, maxX, maxY := ts.Bounds()
+	var response protoBuffer
+	response.stringField(1, h.server.CRS.Code())
+	response.intField(2, int64(len(ts.Grids())))
+	response.intField(3, cells)
+	response.doubleField(4, float64(ts.MinHeight()))
+	response.doubleField(5, float64(ts.MaxHeight()))
+	response.doubleField(6, minX)
+	response.doubleField(7, minY)
+	response.doubleField(8, maxX)
+	response.doubleField(9, maxY)
+	return response.b, nil
+}
@@ -0,0 +1,17 @@
+//go:build go1.24
+
+package main
+
+import "net/http"
+
+// allowH2C lets s take HTTP/2 without TLS as well as HTTP/1, which gRPC
+// clients need to reach a server that isn't given -tls-cert.  It returns
+// false where the Go release can't do that.
+func allowH2C(s *http.Server) bool {
+	var p http.Protocols
+	p.SetHTTP1(true)
+	p.SetHTTP2(true)
+	p.SetUnencryptedHTTP2(true)
+	s.Protocols = &p
+	return true
+}
@@ -0,0 +1,11 @@
+//go:build !go1.24
+
+package main
+
+import "net/http"
+
+// allowH2C reports that releases of Go before 1.24 can't serve HTTP/2
+// without TLS, so gRPC clients need -tls-cert.
+func allowH2C(s *http.Server) bool {
+	return false
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/goblimey/tiler/heightmap"
+)
+
+// makeHeightmap sets up the heightmap command, which resamples a grid to a
+// square 16 bit RAW heightmap for the Unity and Unreal Engine terrain tools,
+// or writes it as a Terragen terrain.  It returns the flags of the command
+// and the function that runs it once they are parsed from the arguments that
+// follow "heightmap".
+func makeHeightmap() (*flag.FlagSet, func()) {
+	fs := flag.NewFlagSet("heightmap", flag.ExitOnError)
+	var input, output string
+	fs.StringVar(&input, "input", "", "grid file - - for the standard input")
+	fs.StringVar(&input, "i", "", "grid file - - for the standard input")
+	fs.StringVar(&output, "output", "", "results file - .raw or .r16, with a .json file describing it, or a Terragen terrain (.ter)")
+	fs.StringVar(&output, "o", "", "results file - .raw or .r16, with a .json file describing it, or a Terragen terrain (.ter)")
+	size := fs.Int("size", 0, fmt.Sprintf("RAW - samples along each side - a power of two plus one from %d to %d, or 0 for the smallest that holds every cell", heightmap.MinSize, heightmap.MaxSize))
+	bbox := fs.String("bbox", "", "area to cover - minX,minY,maxX,maxY in map coordinates")
+	transforms := addTransformFlag(fs)
+	overwrite := addOverwriteFlags(fs)
+	logging := addLogFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: tiler heightmap -i grid.asc -o terrain.raw [flags]\n"+
+			"       tiler heightmap -i grid.asc -o terrain.ter [flags]\n")
+		fs.PrintDefaults()
+	}
+	return fs, func() {
+		err := logging.setup()
+		if err != nil {
+			fatal(err.Error())
+		}
+		err = transforms.check()
+		if err != nil {
+			fatal(err.Error())
+		}
+		if input == "" || output == "" {
+			fs.Usage()
+			os.Exit(2)
+		}
+		format := strings.ToLower(filepath.Ext(output))
+		if format != ".raw" && format != ".r16" && format != ".ter" {
+			fatal(fmt.Sprintf("%s: unknown heightmap format - expected .raw, .r16 or .ter", output))
+		}
+		// A Terragen terrain has a point for each cell, and a RAW heightmap
+		// comes with a file describing it.
+		results := []string{output}
+		if format == ".ter" {
+			if *size != 0 {
+				fatal("-size is for RAW heightmaps - resample a Terragen terrain with -transform")
+			}
+		} else {
+			results = append(results, heightmap.InfoName(output))
+		}
+		if *size != 0 {
+			err = heightmap.ValidSize(*size)
+			if err != nil {
+				fatal(err.Error())
+			}
+		}
+		for _, f := range results {
+			err = overwrite.check(f)
+			if err != nil {
+				fatal(err.Error())
+			}
+		}
+
+		grid, err := readGridFile(input)
+		if err != nil {
+			fail(readError(err))
+		}
+		if *bbox != "" {
+			minX, minY, maxX, maxY, err := parseBBox(*bbox)
+			if err != nil {
+				fatal(err.Error())
+			}
+			grid, err = grid.Crop(minX, minY, maxX, maxY)
+			if err != nil {
+				fatal(err.Error())
+			}
+		}
+		grid, err = transforms.apply(context.Background(), grid)
+		if err != nil {
+			fatal(err.Error())
+		}
+
+		if format == ".ter" {
+			err = heightmap.WriteTerragenToFile(output, grid)
+			if err != nil {
+				fail(writeError(err))
+			}
+			slog.Info("done", "file", output, "ncols", grid.Ncols(), "nrows", grid.Nrows())
+			return
+		}
+		if *size == 0 {
+			n := grid.Ncols()
+			if grid.Nrows() > n {
+				n = grid.Nrows()
+			}
+			*size = heightmap.FitSize(n)
+		}
+		h, err := heightmap.FromGrid(grid, *size)
+		if err != nil {
+			fatal(err.Error())
+		}
+		err = h.WriteRAWToFiles(output)
+		if err != nil {
+			fail(writeError(err))
+		}
+		slog.Info("done", "file", output, "size", h.Size, "min", h.Min, "max", h.Max)
+	}
+}
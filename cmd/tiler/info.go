@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+
+	"github.com/goblimey/tiler/crs"
+	"github.com/goblimey/tiler/esri"
+)
+
+// gridInfo describes a grid file for the info command.
+type gridInfo struct {
+	File      string  `json:"file"`
+	Ncols     int     `json:"ncols"`
+	Nrows     int     `json:"nrows"`
+	Xllcorner float64 `json:"xllcorner"`
+	Yllcorner float64 `json:"yllcorner"`
+	CellSize  float64 `json:"cellsize"`
+	NoData    int     `json:"nodata_value"`
+	Cells     int     `json:"cells"`
+	// NoDataCells is the number of cells with no data and NoDataPercent
+	// the percentage of the grid they make up.
+	NoDataCells   int     `json:"nodata_cells"`
+	NoDataPercent float64 `json:"nodata_percent"`
+	// Bounds is minX, minY, maxX, maxY in map coordinates.
+	Bounds [4]float64 `json:"bounds"`
+	// WGS84 is Bounds as west, south, east, north in degrees.
+	WGS84 [4]float64 `json:"wgs84_bounds"`
+	// Stats is nil if the grid has no data.
+	Stats *heightInfo `json:"stats,omitempty"`
+}
+
+// heightInfo summarises the heights in a grid.
+type heightInfo struct {
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+	Mean   float64 `json:"mean"`
+	StdDev float64 `json:"stddev"`
+}
+
+// info sets up the info command, which describes grid files: the header, the
+// proportion of NODATA cells, the area covered and statistics of the
+// heights.  It returns the flags of the command and the function that runs
+// it once they are parsed from the arguments that follow "info" - flags and
+// then the names of the grid files.
+func info() (*flag.FlagSet, func()) {
+	fs := flag.NewFlagSet("info", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "write a JSON array with an object for each grid")
+	crsName := fs.String("crs", crs.Default, "coordinate reference system of the grids, for the WGS84 bounds")
+	logging := addLogFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: tiler info [flags] grid file ...\n\nThe format of each file is given by its name:\n")
+		for _, f := range gridFormats {
+			fmt.Fprintf(fs.Output(), "  %s\n", f)
+		}
+		fmt.Fprintln(fs.Output())
+		fs.PrintDefaults()
+	}
+	return fs, func() {
+		err := logging.setup()
+		if err != nil {
+			fatal(err.Error())
+		}
+		if fs.NArg() == 0 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		c, err := crs.Lookup(*crsName)
+		if err != nil {
+			fatal(err.Error())
+		}
+
+		var infos []gridInfo
+		for _, name := range fs.Args() {
+			g, err := readGridFile(name)
+			if err != nil {
+				fail(readError(err))
+			}
+			infos = append(infos, describe(name, g, c))
+		}
+
+		if *asJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			err = enc.Encode(infos)
+		} else {
+			for i, in := range infos {
+				if i > 0 {
+					fmt.Println()
+				}
+				err = writeInfo(os.Stdout, in)
+				if err != nil {
+					break
+				}
+			}
+		}
+		if err != nil {
+			fatal(err.Error())
+		}
+	}
+}
+
+// describe gathers the facts about the grid g, read from the named file,
+// whose coordinates are in the reference system c.
+func describe(name string, g *esri.Grid, c crs.CRS) gridInfo {
+	in := gridInfo{
+		File:      name,
+		Ncols:     g.Ncols(),
+		Nrows:     g.Nrows(),
+		Xllcorner: float64(g.Xllcorner()),
+		Yllcorner: float64(g.Yllcorner()),
+		CellSize:  float64(g.CellSize()),
+		NoData:    g.NoDataValue(),
+		Cells:     g.Ncols() * g.Nrows(),
+	}
+	stats := g.Stats()
+	in.NoDataCells = in.Cells - stats.Count
+	if in.Cells > 0 {
+		in.NoDataPercent = math.Round(10000*float64(in.NoDataCells)/float64(in.Cells)) / 100
+	}
+	if stats.Count > 0 {
+		in.Stats = &heightInfo{
+			Min:    roundHeight(stats.Min),
+			Max:    roundHeight(stats.Max),
+			Mean:   roundHeight(stats.Mean),
+			StdDev: roundHeight(stats.StdDev),
+		}
+	}
+
+	minX, minY, maxX, maxY := g.Bounds()
+	in.Bounds = [4]float64{minX, minY, maxX, maxY}
+	west, south := math.Inf(1), math.Inf(1)
+	east, north := math.Inf(-1), math.Inf(-1)
+	for _, corner := range [][2]float64{{minX, minY}, {minX, maxY}, {maxX, minY}, {maxX, maxY}} {
+		lon, lat := c.ToWGS84(corner[0], corner[1])
+		west, east = math.Min(west, lon), math.Max(east, lon)
+		south, north = math.Min(south, lat), math.Max(north, lat)
+	}
+	in.WGS84 = [4]float64{round6(west), round6(south), round6(east), round6(north)}
+	return in
+}
+
+// round6 rounds degrees to six places, about ten centimetres.
+func round6(degrees float64) float64 {
+	return math.Round(degrees*1e6) / 1e6
+}
+
+// writeInfo writes in to w as lines of name and value.
+func writeInfo(w io.Writer, in gridInfo) error {
+	_, err := fmt.Fprintf(w, "file %s\nncols %d\nnrows %d\nxllcorner %g\nyllcorner %g\ncellsize %g\nnodata_value %d\n"+
+		"cells %d\nnodata_cells %d\nnodata_percent %.2f\nbounds %g,%g,%g,%g\nwgs84_bounds %g,%g,%g,%g\n",
+		in.File, in.Ncols, in.Nrows, in.Xllcorner, in.Yllcorner, in.CellSize, in.NoData,
+		in.Cells, in.NoDataCells, in.NoDataPercent,
+		in.Bounds[0], in.Bounds[1], in.Bounds[2], in.Bounds[3],
+		in.WGS84[0], in.WGS84[1], in.WGS84[2], in.WGS84[3])
+	if err != nil || in.Stats == nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "min %g\nmax %g\nmean %g\nstddev %g\n",
+		in.Stats.Min, in.Stats.Max, in.Stats.Mean, in.Stats.StdDev)
+	return err
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/goblimey/tiler/contour"
+	"github.com/goblimey/tiler/cost"
+	"github.com/goblimey/tiler/esri"
+	"github.com/goblimey/tiler/geojson"
+	"github.com/goblimey/tiler/geom"
+	"github.com/goblimey/tiler/polygonize"
+)
+
+// isochrones sets up the isochrones command, which works out the least cost
+// of reaching every cell of a grid file from one or more points and writes
+// the lines or areas of equal cost as GeoJSON, or the costs as a grid file.
+// It returns the flags of the command and the function that runs it once
+// they are parsed from the arguments that follow "isochrones".
+func isochrones() (*flag.FlagSet, func()) {
+	fs := flag.NewFlagSet("isochrones", flag.ExitOnError)
+	var input, output string
+	fs.StringVar(&input, "input", "", "data file")
+	fs.StringVar(&input, "i", "", "data file")
+	fs.StringVar(&output, "output", "", "GeoJSON or ESRI Grid (.asc) results file - GeoJSON on the standard output if not given")
+	fs.StringVar(&output, "o", "", "GeoJSON or ESRI Grid (.asc) results file - GeoJSON on the standard output if not given")
+	fromSpec := fs.String("from", "", "starting points - x,y in map coordinates, with several separated by semicolons")
+	interval := fs.Float64("interval", 300, "cost between the isochrones - with -cost tobler, seconds")
+	polygons := fs.Bool("polygons", false, "GeoJSON - write the areas between the isochrones instead of the lines")
+	bbox := fs.String("bbox", "", "area to cover - minX,minY,maxX,maxY in map coordinates")
+	costFunc := addCostFlags(fs)
+	overwrite := addOverwriteFlags(fs)
+	logging := addLogFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: tiler isochrones -i file -from x,y[;x,y...] [flags]\n")
+		fs.PrintDefaults()
+	}
+	return fs, func() {
+		err := logging.setup()
+		if err != nil {
+			fatal(err.Error())
+		}
+		if input == "" || *fromSpec == "" {
+			fs.Usage()
+			os.Exit(2)
+		}
+		err = overwrite.check(output)
+		if err != nil {
+			fatal(err.Error())
+		}
+		var seeds []geom.Point
+		for _, spec := range strings.Split(*fromSpec, ";") {
+			p, err := parsePoint(spec)
+			if err != nil {
+				fatal(err.Error())
+			}
+			seeds = append(seeds, p)
+		}
+		f, err := costFunc()
+		if err != nil {
+			fatal(err.Error())
+		}
+
+		grid, err := esri.ReadGridFromFile(input)
+		if err != nil {
+			fail(readError(err))
+		}
+		if *bbox != "" {
+			minX, minY, maxX, maxY, err := parseBBox(*bbox)
+			if err != nil {
+				fatal(err.Error())
+			}
+			grid, err = grid.Crop(minX, minY, maxX, maxY)
+			if err != nil {
+				fatal(err.Error())
+			}
+		}
+
+		costs, err := cost.Distance(grid, seeds, f)
+		if err != nil {
+			fatal(err.Error())
+		}
+		slog.Info("isochrones", "seeds", len(seeds), "maxCost", costs.MaxHeight())
+
+		if strings.ToLower(filepath.Ext(output)) == ".asc" {
+			err = costs.WriteToFile(output)
+			if err != nil {
+				fail(writeError(err))
+			}
+			return
+		}
+
+		fc := new(geojson.FeatureCollection)
+		if *polygons {
+			breaks, err := intervalBreaks(0, float64(costs.MaxHeight()), *interval, 0)
+			if err != nil {
+				fatal(err.Error())
+			}
+			for _, band := range polygonize.Bands(costs, breaks) {
+				fc.AddMultiPolygon(band.Polygons, map[string]interface{}{"min": band.Min, "max": band.Max})
+			}
+		} else {
+			lines, err := contour.Extract(costs, *interval, 0)
+			if err != nil {
+				fatal(err.Error())
+			}
+			for _, c := range lines {
+				if c.Level > 0 {
+					fc.AddLineString(c.Line, map[string]interface{}{"cost": c.Level})
+				}
+			}
+		}
+		if output == "" {
+			err = fc.Write(os.Stdout)
+		} else {
+			err = fc.WriteToFile(output)
+		}
+		if err != nil {
+			fail(writeError(err))
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/goblimey/tiler/esri"
+)
+
+// The exit statuses.  The flag package and the usage messages use
+// exitUsage too.
+const (
+	exitFailure      = 1 // anything not listed below
+	exitUsage        = 2 // a bad command line
+	exitMissingInput = 3 // an input file doesn't exist
+	exitParse        = 4 // an input file can't be read or understood
+	exitWrite        = 5 // a results file can't be written
+	exitCancelled    = 6 // interrupted or out of time
+)
+
+// exitKinds names the exit statuses in the -errors-json messages.
+var exitKinds = map[int]string{
+	exitFailure:      "failure",
+	exitUsage:        "usage",
+	exitMissingInput: "missing-input",
+	exitParse:        "parse",
+	exitWrite:        "write",
+	exitCancelled:    "cancelled",
+}
+
+// errorsJSON is set by -errors-json, which makes fatal errors a JSON object
+// on stderr instead of a log message.
+var errorsJSON bool
+
+// logOptions holds the logging flags shared by the subcommands, -jobs and
+// -max-cells.
+type logOptions struct {
+	level       string
+	format      string
+	quiet       bool
+	verbose     bool
+	veryVerbose bool
+	jobs        int
+	maxCells    int64
+}
+
+// addLogFlags registers -log-level, -log-format, -q/-quiet, -v/-verbose,
+// -vv, -errors-json, -jobs and -max-cells on fs.
+func addLogFlags(fs *flag.FlagSet) *logOptions {
+	o := new(logOptions)
+	fs.StringVar(&o.level, "log-level", "info", "least important messages logged - error, warn, info, debug or trace")
+	fs.StringVar(&o.format, "log-format", "text", "log format - text or json")
+	fs.BoolVar(&o.verbose, "verbose", false, "verbose mode - the same as -log-level debug")
+	fs.BoolVar(&o.verbose, "v", false, "verbose mode - the same as -log-level debug")
+	fs.BoolVar(&o.veryVerbose, "vv", false, "very verbose mode, with a message for every line and cell read or drawn - the same as -log-level trace")
+	fs.BoolVar(&o.quiet, "quiet", false, "quiet mode, only warnings and errors - the same as -log-level warn")
+	fs.BoolVar(&o.quiet, "q", false, "quiet mode, only warnings and errors - the same as -log-level warn")
+	fs.BoolVar(&errorsJSON, "errors-json", false, "report a fatal error as a JSON object on stderr, for scripts")
+	fs.IntVar(&o.jobs, "jobs", runtime.NumCPU(), "most CPUs to use for parsing, drawing and serving tiles")
+	fs.Int64Var(&o.maxCells, "max-cells", esri.DefaultLimits.MaxCells, "most cells in a grid that will be read, so that a corrupt header can't use up the memory - 0 for no limit")
+	return o
+}
+
+// setup makes a logger built from the options the default, writing to
+// stderr, limits the CPUs used to -jobs and the size of grids read to
+// -max-cells.  Every command calls it straight after its flags are parsed.
+func (o *logOptions) setup() error {
+	if o.jobs < 1 {
+		return fmt.Errorf("-jobs must be at least 1, not %d", o.jobs)
+	}
+	if o.maxCells < 0 {
+		return fmt.Errorf("-max-cells must not be negative, not %d", o.maxCells)
+	}
+	// GOMAXPROCS limits everything, including the goroutines serving
+	// requests, and SetWorkers the goroutines that share out the work.
+	runtime.GOMAXPROCS(o.jobs)
+	esri.SetWorkers(o.jobs)
+	limits := esri.GetLimits()
+	limits.MaxCells = o.maxCells
+	esri.SetLimits(limits)
+	var level slog.Level
+	switch strings.ToLower(o.level) {
+	case "error":
+		level = slog.LevelError
+	case "warn", "warning":
+		level = slog.LevelWarn
+	case "info":
+		level = slog.LevelInfo
+	case "debug":
+		level = slog.LevelDebug
+	case "trace":
+		level = esri.LevelTrace
+	default:
+		return fmt.Errorf("unknown log level %q", o.level)
+	}
+	switch {
+	case o.veryVerbose:
+		level = esri.LevelTrace
+	case o.verbose:
+		level = slog.LevelDebug
+	case o.quiet:
+		level = slog.LevelWarn
+	}
+
+	handlerOptions := &slog.HandlerOptions{Level: level, ReplaceAttr: nameTrace}
+	var handler slog.Handler
+	switch strings.ToLower(o.format) {
+	case "text":
+		handler = slog.NewTextHandler(os.Stderr, handlerOptions)
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, handlerOptions)
+	default:
+		return fmt.Errorf("unknown log format %q", o.format)
+	}
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// nameTrace is a slog ReplaceAttr function that names esri.LevelTrace TRACE
+// rather than DEBUG-4.
+func nameTrace(groups []string, a slog.Attr) slog.Attr {
+	if a.Key == slog.LevelKey && len(groups) == 0 {
+		if level, ok := a.Value.Any().(slog.Level); ok && level == esri.LevelTrace {
+			a.Value = slog.StringValue("TRACE")
+		}
+	}
+	return a
+}
+
+// traceEnabled returns true if the messages about every line and cell are
+// being logged, so that they can be skipped when they aren't.
+func traceEnabled() bool {
+	return slog.Default().Enabled(context.Background(), esri.LevelTrace)
+}
+
+// fatal logs msg as an error and exits with exitFailure.
+func fatal(msg string, args ...any) {
+	exit(exitFailure, msg, args...)
+}
+
+// exitError is an error marked with the exit status that it should cause.
+type exitError struct {
+	status int
+	err    error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+// readError marks err, from reading an input file, as a missing input if
+// the file doesn't exist, as cancelled if the reading was stopped, or
+// otherwise as a parse failure.
+func readError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if isCancelled(err) {
+		return &exitError{exitCancelled, err}
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return &exitError{exitMissingInput, err}
+	}
+	return &exitError{exitParse, err}
+}
+
+// writeError marks err, from writing a results file, as a write failure,
+// or as cancelled if the writing was stopped.
+func writeError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if isCancelled(err) {
+		return &exitError{exitCancelled, err}
+	}
+	return &exitError{exitWrite, err}
+}
+
+// exitStatus returns the status that readError or writeError marked err
+// with, exitCancelled if the job was stopped, or otherwise exitFailure.
+func exitStatus(err error) int {
+	var e *exitError
+	if errors.As(err, &e) {
+		return e.status
+	}
+	if isCancelled(err) {
+		return exitCancelled
+	}
+	return exitFailure
+}
+
+// fail logs err as an error and exits with the status that readError or
+// writeError marked it with, or exitFailure.  With -errors-json, the place
+// in a grid file that err is about is added to the report.
+func fail(err error, args ...any) {
+	if errorsJSON {
+		line, column, token := errorPlace(err)
+		if line > 0 {
+			args = append(args, "line", line, "column", column, "token", token)
+		}
+	}
+	exit(exitStatus(err), err.Error(), args...)
+}
+
+// errorPlace returns the line, column and token of the esri.HeaderError or
+// esri.DataError in err, or a line of 0 if there is neither.
+func errorPlace(err error) (line, column int, token string) {
+	var he *esri.HeaderError
+	if errors.As(err, &he) {
+		return he.Line, he.Column, he.Token
+	}
+	var de *esri.DataError
+	if errors.As(err, &de) {
+		return de.Line, de.Column, de.Token
+	}
+	return 0, 0, ""
+}
+
+// exit reports msg and the key value pairs in args, as a log message or
+// with -errors-json as a JSON object, and exits with the given status.
+func exit(status int, msg string, args ...any) {
+	if !errorsJSON {
+		slog.Error(msg, args...)
+		os.Exit(status)
+	}
+	report := map[string]interface{}{
+		"status": status,
+		"kind":   exitKinds[status],
+		"error":  msg,
+	}
+	for i := 0; i+1 < len(args); i += 2 {
+		report[fmt.Sprint(args[i])] = args[i+1]
+	}
+	text, err := json.Marshal(report)
+	if err != nil {
+		text, _ = json.Marshal(map[string]interface{}{"status": status, "kind": exitKinds[status], "error": msg})
+	}
+	fmt.Fprintln(os.Stderr, string(text))
+	os.Exit(status)
+}
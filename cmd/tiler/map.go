@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"log/slog"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/goblimey/tiler/crs"
+	"github.com/goblimey/tiler/esri"
+	"github.com/goblimey/tiler/pdf"
+	"github.com/goblimey/tiler/render"
+)
+
+// pageSizes are the paper sizes that the map command knows, by name.
+var pageSizes = map[string][2]float64{
+	"a4": pdf.A4,
+	"a3": pdf.A3,
+}
+
+// drawMap sets up the map command, which draws a grid as a map sheet for
+// printing - shaded relief in the colours of a palette, contours, a legend
+// and a scale bar - as a PDF file.  It returns the flags of the command and
+// the function that runs it once they are parsed from the arguments that
+// follow "map".
+func drawMap() (*flag.FlagSet, func()) {
+	fs := flag.NewFlagSet("map", flag.ExitOnError)
+	var input, output string
+	fs.StringVar(&input, "input", "", "grid file - - for the standard input")
+	fs.StringVar(&input, "i", "", "grid file - - for the standard input")
+	fs.StringVar(&output, "output", "", "PDF results file")
+	fs.StringVar(&output, "o", "", "PDF results file")
+	title := fs.String("title", "", "title written above the map")
+	page := fs.String("page", "a4", "paper size - a4 or a3, turned to landscape if the map fits better")
+	scale := fs.Float64("scale", 0, "scale of the map, for example 10000 for 1:10000 - if not given the map fills the page")
+	interval := fs.Float64("interval", 10, "height between contours - 0 for none")
+	index := fs.Int("index", 5, "make every nth contour an index contour, drawn thicker and labelled - 0 for none")
+	spacing := fs.Float64("label-spacing", 0, "distance between contour labels in map units - if not given a quarter of the shorter side of the area")
+	geoPDF := fs.Bool("geopdf", false, "register the map with the positions of its corners, so that GIS programs can place it")
+	crsName := fs.String("crs", crs.Default, "coordinate reference system of the grid")
+	bbox := fs.String("bbox", "", "area to draw - minX,minY,maxX,maxY in map coordinates")
+	colours := addPaletteFlag(fs)
+	transforms := addTransformFlag(fs)
+	overwrite := addOverwriteFlags(fs)
+	logging := addLogFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: tiler map -i grid.asc -o map.pdf [flags]\n")
+		fs.PrintDefaults()
+	}
+	return fs, func() {
+		err := logging.setup()
+		if err != nil {
+			fatal(err.Error())
+		}
+		err = transforms.check()
+		if err != nil {
+			fatal(err.Error())
+		}
+		err = colours.check()
+		if err != nil {
+			fatal(err.Error())
+		}
+		if input == "" || output == "" {
+			fs.Usage()
+			os.Exit(2)
+		}
+		paper, ok := pageSizes[strings.ToLower(*page)]
+		if !ok {
+			fatal(fmt.Sprintf("-page %q is not a paper size - expected a4 or a3", *page))
+		}
+		if *scale < 0 {
+			fatal(fmt.Sprintf("-scale %g is less than 0", *scale))
+		}
+		c, err := crs.Lookup(*crsName)
+		if err != nil {
+			fatal(err.Error())
+		}
+		err = overwrite.check(output)
+		if err != nil {
+			fatal(err.Error())
+		}
+
+		grid, err := readGridFile(input)
+		if err != nil {
+			fail(readError(err))
+		}
+		if *bbox != "" {
+			minX, minY, maxX, maxY, err := parseBBox(*bbox)
+			if err != nil {
+				fatal(err.Error())
+			}
+			grid, err = grid.Crop(minX, minY, maxX, maxY)
+			if err != nil {
+				fatal(err.Error())
+			}
+		}
+		grid, err = transforms.apply(context.Background(), grid)
+		if err != nil {
+			fatal(err.Error())
+		}
+
+		ramp := colours.ramp
+		if ramp == nil {
+			ramp = render.Terrain
+		}
+		floor, ceiling := grid.MinHeight(), grid.MaxHeight()
+		picture, err := shadedRelief(grid, ramp, floor, ceiling)
+		if err != nil {
+			fatal(err.Error())
+		}
+		minX, minY, maxX, maxY := grid.Bounds()
+		options := pdf.Options{
+			Page:    paper,
+			Scale:   *scale,
+			Title:   *title,
+			Picture: picture,
+			Legend: &pdf.Legend{
+				Title:   "Height",
+				Ramp:    ramp,
+				Floor:   float64(floor),
+				Ceiling: float64(ceiling),
+			},
+		}
+		// A scale bar in degrees would mislead.
+		if c.Code() != "EPSG:4326" {
+			options.Units = "m"
+		}
+		if *geoPDF {
+			options.CRS = c
+		}
+		if *interval > 0 {
+			options.Contours, err = extractContours([]*esri.Grid{grid}, *interval, 0, *index, "")
+			if err != nil {
+				fatal(err.Error())
+			}
+			if *index > 0 {
+				options.LabelSpacing = *spacing
+				if *spacing <= 0 {
+					options.LabelSpacing = math.Min(maxX-minX, maxY-minY) / 4
+				}
+			}
+		}
+		err = pdf.WriteMapToFile(output, minX, minY, maxX, maxY, options)
+		if err != nil {
+			fail(writeError(err))
+		}
+		slog.Info("done", "file", output, "contours", len(options.Contours))
+	}
+}
+
+// shadedRelief draws grid with one pixel per cell in the colours of ramp,
+// from floor to ceiling, darkened by a hillshade lit from the north west.
+// Cells holding the No Data value are left transparent.
+func shadedRelief(grid *esri.Grid, ramp render.ColourRamp, floor, ceiling float32) (*image.RGBA, error) {
+	img, err := render.HeightImage(grid, render.WithPalette(ramp), render.WithRange(floor, ceiling))
+	if err != nil {
+		return nil, err
+	}
+	shade := render.HillshadeImage(grid, 315, 45)
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := img.RGBAAt(x, y)
+			// The shade is lightened so that the colours still show in the
+			// shadows.
+			s := 0.4 + 0.6*float64(shade.RGBAAt(x, y).R)/255
+			img.SetRGBA(x, y, color.RGBA{
+				uint8(float64(c.R) * s),
+				uint8(float64(c.G) * s),
+				uint8(float64(c.B) * s),
+				c.A,
+			})
+		}
+	}
+	return img, nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/goblimey/tiler/esri"
+)
+
+// readTileSet reads the grid files listed in the manifest, or the named
+// grid files if there's no manifest, as a TileSet.  A zip file adds all of
+// the grids in it - see esri.WalkZip.  With a mapDir the grids are mapped
+// into memory rather than read - see mapGridFile and mapZipFile.
+// Cancelling ctx stops the reading.
+func readTileSet(ctx context.Context, manifest string, filenames []string, mapDir string) (*esri.TileSet, error) {
+	var err error
+	if manifest != "" {
+		filenames, err = esri.ReadManifest(manifest)
+		if err != nil {
+			return nil, readError(err)
+		}
+	}
+	if mapDir == "" {
+		ts, err := esri.ReadTileSetFromFilesContext(ctx, filenames)
+		return ts, readError(err)
+	}
+	err = os.MkdirAll(mapDir, 0755)
+	if err != nil {
+		return nil, writeError(err)
+	}
+	ts := esri.NewTileSet()
+	for _, filename := range filenames {
+		if strings.ToLower(filepath.Ext(filename)) == ".zip" {
+			grids, err := mapZipFile(ctx, filename, mapDir)
+			if err != nil {
+				return nil, err
+			}
+			for _, g := range grids {
+				ts.Add(g)
+			}
+			continue
+		}
+		g, err := mapGridFile(ctx, filename, mapDir)
+		if err != nil {
+			return nil, err
+		}
+		ts.Add(g)
+	}
+	return ts, nil
+}
+
+// mapGridFile converts a grid file to a binary grid in dir, unless there's
+// one there already that is newer than it, and maps the binary grid into
+// memory - see esri.MapBinaryGridFromFile.  A binary grid is mapped where
+// it is.  The grids are converted one at a time, so only one has to fit
+// in memory.
+func mapGridFile(ctx context.Context, filename, dir string) (*esri.Grid, error) {
+	if strings.ToLower(filepath.Ext(filename)) == ".tgrid" {
+		g, err := esri.MapBinaryGridFromFile(filename)
+		return g, readError(err)
+	}
+	binary := mappedName(filename, dir)
+	exists, newer := compareTimes(binary, []string{filename})
+	if !exists || newer {
+		slog.Info("converting for mapping", "file", filename, "binary", binary)
+		g, err := readGridFileContext(ctx, filename)
+		if err != nil {
+			return nil, readError(fmt.Errorf("%s: %w", filename, err))
+		}
+		err = writeMapped(g, binary)
+		if err != nil {
+			return nil, writeError(err)
+		}
+	}
+	g, err := esri.MapBinaryGridFromFile(binary)
+	return g, readError(err)
+}
+
+// mapZipFile converts each grid in a zip file to a binary grid in dir, as
+// mapGridFile does, and maps the binary grids into memory.  The zip file is
+// walked each time, but the grids in it are only read again when it
+// changes.
+func mapZipFile(ctx context.Context, filename, dir string) ([]*esri.Grid, error) {
+	var binaries []string
+	var failure error
+	err := esri.WalkZip(ctx, filename, func(name string, in io.Reader) error {
+		binary := mappedName(filename+"/"+name, dir)
+		binaries = append(binaries, binary)
+		exists, newer := compareTimes(binary, []string{filename})
+		if exists && !newer {
+			return nil
+		}
+		slog.Info("converting for mapping", "file", filename, "grid", name, "binary", binary)
+		g, err := esri.ReadGridContext(ctx, in)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		err = writeMapped(g, binary)
+		if err != nil {
+			failure = writeError(err)
+			return failure
+		}
+		return nil
+	})
+	if failure != nil {
+		return nil, failure
+	}
+	if err != nil {
+		return nil, readError(err)
+	}
+	grids := make([]*esri.Grid, len(binaries))
+	for i, binary := range binaries {
+		grids[i], err = esri.MapBinaryGridFromFile(binary)
+		if err != nil {
+			return nil, readError(err)
+		}
+	}
+	return grids, nil
+}
+
+// writeMapped writes g as the binary grid filename.  The grid is written
+// under another name and then renamed, so that a failure can't leave a
+// partial copy that looks up to date.
+func writeMapped(g *esri.Grid, filename string) error {
+	temp := filename + ".tmp"
+	err := g.WriteBinaryToFile(temp)
+	if err == nil {
+		err = os.Rename(temp, filename)
+	}
+	if err != nil {
+		os.Remove(temp)
+	}
+	return err
+}
+
+// mappedName returns the name of the binary copy of a grid file in dir.
+// Grid files in different folders can have the same name, so the name
+// includes a hash of the full path.
+func mappedName(filename, dir string) string {
+	path, err := filepath.Abs(filename)
+	if err != nil {
+		path = filename
+	}
+	h := fnv.New32a()
+	h.Write([]byte(path))
+	base := filepath.Base(filename)
+	return filepath.Join(dir, fmt.Sprintf("%s-%08x.tgrid", strings.TrimSuffix(base, filepath.Ext(base)), h.Sum32()))
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"image"
+	"image/png"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/goblimey/tiler/esri"
+	"github.com/goblimey/tiler/mesh"
+	"github.com/goblimey/tiler/render"
+)
+
+// makeMesh sets up the mesh command, which writes a grid as a solid 3D model
+// for printing, with a picture draped over it for modelling programs, or
+// with its heights and colours for inspection.  It returns the flags of the
+// command and the function that runs it once they are parsed from the
+// arguments that follow "mesh".
+func makeMesh() (*flag.FlagSet, func()) {
+	fs := flag.NewFlagSet("mesh", flag.ExitOnError)
+	var input, output string
+	var drawTexture bool
+	fs.StringVar(&input, "input", "", "grid file - - for the standard input")
+	fs.StringVar(&input, "i", "", "grid file - - for the standard input")
+	fs.StringVar(&output, "output", "", "results file - STL (.stl), Wavefront OBJ (.obj) or PLY (.ply)")
+	fs.StringVar(&output, "o", "", "results file - STL (.stl), Wavefront OBJ (.obj) or PLY (.ply)")
+	base := fs.Float64("base", 2, "thickness of the solid below the lowest height, in map units")
+	exaggeration := fs.Float64("exaggeration", 1, "multiply the heights by this")
+	bbox := fs.String("bbox", "", "area to cover - minX,minY,maxX,maxY in map coordinates")
+	texture := fs.String("texture", "", "OBJ and PLY - PNG picture of the grid with one pixel per cell to drape over the model, instead of drawing one")
+	ascii := fs.Bool("ascii", false, "PLY - write text rather than binary")
+	colours := addPaletteFlag(fs)
+	transforms := addTransformFlag(fs)
+	overwrite := addOverwriteFlags(fs)
+	logging := addLogFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: tiler mesh -i grid.asc -o model.stl [flags]\n"+
+			"       tiler mesh -i grid.asc -o model.obj [flags]\n"+
+			"       tiler mesh -i grid.asc -o model.ply [flags]\n")
+		fs.PrintDefaults()
+	}
+	return fs, func() {
+		err := logging.setup()
+		if err != nil {
+			fatal(err.Error())
+		}
+		err = transforms.check()
+		if err != nil {
+			fatal(err.Error())
+		}
+		err = colours.check()
+		if err != nil {
+			fatal(err.Error())
+		}
+		if input == "" || output == "" {
+			fs.Usage()
+			os.Exit(2)
+		}
+		format := strings.ToLower(filepath.Ext(output))
+		if format != ".stl" && format != ".obj" && format != ".ply" {
+			fatal(fmt.Sprintf("%s: unknown model format - expected .stl, .obj or .ply", output))
+		}
+		if *exaggeration <= 0 {
+			fatal(fmt.Sprintf("-exaggeration %g must be greater than zero", *exaggeration))
+		}
+		// An OBJ model comes with a material file and perhaps a picture.
+		results := []string{output}
+		name := strings.TrimSuffix(output, filepath.Ext(output))
+		if format == ".obj" {
+			results = append(results, name+".mtl")
+			if *texture == "" {
+				*texture = name + ".png"
+				results = append(results, *texture)
+				drawTexture = true
+			}
+		}
+		for _, f := range results {
+			err = overwrite.check(f)
+			if err != nil {
+				fatal(err.Error())
+			}
+		}
+
+		grid, err := readGridFile(input)
+		if err != nil {
+			fail(readError(err))
+		}
+		if *bbox != "" {
+			minX, minY, maxX, maxY, err := parseBBox(*bbox)
+			if err != nil {
+				fatal(err.Error())
+			}
+			grid, err = grid.Crop(minX, minY, maxX, maxY)
+			if err != nil {
+				fatal(err.Error())
+			}
+		}
+		grid, err = transforms.apply(context.Background(), grid)
+		if err != nil {
+			fatal(err.Error())
+		}
+
+		m, err := mesh.FromGrid(grid, mesh.Options{Base: *base, Exaggeration: *exaggeration})
+		if err != nil {
+			fatal(err.Error())
+		}
+		switch format {
+		case ".stl":
+			err = m.WriteSTLToFile(output)
+			if err != nil {
+				fail(writeError(err))
+			}
+		case ".ply":
+			// The vertices are coloured if there's a palette or a picture.
+			options := mesh.PLYOptions{ASCII: *ascii}
+			var img image.Image
+			if *texture != "" {
+				img, err = readTexture(*texture, grid)
+			} else if colours.ramp != nil {
+				img, err = textureImage(grid, colours)
+			}
+			if err != nil {
+				fail(err)
+			}
+			if img != nil {
+				options.Colours = m.Colours(img)
+			}
+			err = m.WritePLYToFile(output, options)
+			if err != nil {
+				fail(writeError(err))
+			}
+		default:
+			if drawTexture {
+				err = writeTexture(*texture, grid, colours)
+			} else {
+				err = checkTexture(*texture, grid)
+			}
+			if err != nil {
+				fail(err)
+			}
+			err = m.WriteOBJToFiles(output, textureName(output, *texture))
+			if err != nil {
+				fail(writeError(err))
+			}
+		}
+		slog.Info("done", "file", output, "vertices", len(m.Vertices), "triangles", len(m.Triangles))
+	}
+}
+
+// textureImage draws the heights of grid in the colours of palette, or grey
+// if it has none.
+func textureImage(grid *esri.Grid, palette *paletteOptions) (image.Image, error) {
+	var opts []render.Option
+	if palette.ramp != nil {
+		opts = append(opts, render.WithPalette(palette.ramp))
+	}
+	return render.HeightImage(grid, opts...)
+}
+
+// writeTexture draws the heights of grid in the colours of palette, or
+// grey if it has none, and writes the picture to the PNG file filename.
+func writeTexture(filename string, grid *esri.Grid, palette *paletteOptions) error {
+	img, err := textureImage(grid, palette)
+	if err != nil {
+		return err
+	}
+	out, err := os.Create(filename)
+	if err != nil {
+		return writeError(err)
+	}
+	err = png.Encode(out, img)
+	if err != nil {
+		out.Close()
+		return writeError(err)
+	}
+	return writeError(out.Close())
+}
+
+// textureName returns the name of the picture texture as the material file
+// of the model output should give it - from the folder holding the model,
+// if possible.
+func textureName(output, texture string) string {
+	dir, err := filepath.Abs(filepath.Dir(output))
+	if err != nil {
+		return texture
+	}
+	abs, err := filepath.Abs(texture)
+	if err != nil {
+		return texture
+	}
+	rel, err := filepath.Rel(dir, abs)
+	if err != nil {
+		return texture
+	}
+	return filepath.ToSlash(rel)
+}
+
+// checkTexture returns an error if the PNG file texture can't be read or
+// hasn't one pixel for each cell of grid.
+func checkTexture(texture string, grid *esri.Grid) error {
+	f, err := os.Open(texture)
+	if err != nil {
+		return readError(err)
+	}
+	defer f.Close()
+	config, err := png.DecodeConfig(f)
+	if err != nil {
+		return readError(fmt.Errorf("%s: %w", texture, err))
+	}
+	if config.Width != grid.Ncols() || config.Height != grid.Nrows() {
+		return fmt.Errorf("%s: the picture is %d by %d pixels - expected one for each of the %d by %d cells of the grid",
+			texture, config.Width, config.Height, grid.Ncols(), grid.Nrows())
+	}
+	return nil
+}
+
+// readTexture reads the PNG file texture, which must have one pixel for
+// each cell of grid.
+func readTexture(texture string, grid *esri.Grid) (image.Image, error) {
+	err := checkTexture(texture, grid)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(texture)
+	if err != nil {
+		return nil, readError(err)
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		return nil, readError(fmt.Errorf("%s: %w", texture, err))
+	}
+	return img, nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// serverMetrics collects the figures exposed on /metrics in the Prometheus
+// text format.
+type serverMetrics struct {
+	mutex sync.Mutex
+	// requests counts requests by handler and status code.
+	requests map[requestKey]uint64
+	// renders holds a latency histogram for each kind of rendering.
+	renders map[string]*histogram
+}
+
+type requestKey struct {
+	handler string
+	code    int
+}
+
+// renderBuckets are the upper bounds, in seconds, of the render latency
+// histogram buckets.
+var renderBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type histogram struct {
+	counts []uint64 // One per bucket, not cumulative.
+	count  uint64
+	sum    float64
+}
+
+func newServerMetrics() *serverMetrics {
+	return &serverMetrics{
+		requests: make(map[requestKey]uint64),
+		renders:  make(map[string]*histogram),
+	}
+}
+
+// instrument wraps a handler so that its requests are counted.
+func (m *serverMetrics) instrument(name string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(sw, r)
+		m.mutex.Lock()
+		m.requests[requestKey{name, sw.status}]++
+		m.mutex.Unlock()
+	})
+}
+
+// observeRender records how long a rendering took.
+func (m *serverMetrics) observeRender(kind string, d time.Duration) {
+	seconds := d.Seconds()
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	h, ok := m.renders[kind]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(renderBuckets))}
+		m.renders[kind] = h
+	}
+	for i, bound := range renderBuckets {
+		if seconds <= bound {
+			h.counts[i]++
+			break
+		}
+	}
+	h.count++
+	h.sum += seconds
+}
+
+// metricsHandler serves /metrics for a tileServer.
+type metricsHandler struct {
+	server *tileServer
+}
+
+func (h *metricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m := h.server.metrics
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	m.mutex.Lock()
+	keys := make([]requestKey, 0, len(m.requests))
+	for k := range m.requests {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].handler != keys[j].handler {
+			return keys[i].handler < keys[j].handler
+		}
+		return keys[i].code < keys[j].code
+	})
+	fmt.Fprintf(w, "# HELP tiler_http_requests_total HTTP requests by handler and status code.\n")
+	fmt.Fprintf(w, "# TYPE tiler_http_requests_total counter\n")
+	for _, k := range keys {
+		fmt.Fprintf(w, "tiler_http_requests_total{handler=%q,code=\"%d\"} %d\n", k.handler, k.code, m.requests[k])
+	}
+
+	kinds := make([]string, 0, len(m.renders))
+	for kind := range m.renders {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	fmt.Fprintf(w, "# HELP tiler_render_duration_seconds Time taken to draw tiles and maps.\n")
+	fmt.Fprintf(w, "# TYPE tiler_render_duration_seconds histogram\n")
+	for _, kind := range kinds {
+		hist := m.renders[kind]
+		var cumulative uint64
+		for i, bound := range renderBuckets {
+			cumulative += hist.counts[i]
+			fmt.Fprintf(w, "tiler_render_duration_seconds_bucket{kind=%q,le=\"%g\"} %d\n", kind, bound, cumulative)
+		}
+		fmt.Fprintf(w, "tiler_render_duration_seconds_bucket{kind=%q,le=\"+Inf\"} %d\n", kind, hist.count)
+		fmt.Fprintf(w, "tiler_render_duration_seconds_sum{kind=%q} %g\n", kind, hist.sum)
+		fmt.Fprintf(w, "tiler_render_duration_seconds_count{kind=%q} %d\n", kind, hist.count)
+	}
+	m.mutex.Unlock()
+
+	if h.server.cache != nil {
+		hits, misses := h.server.cache.Stats()
+		fmt.Fprintf(w, "# HELP tiler_cache_hits_total Tiles found in the cache.\n")
+		fmt.Fprintf(w, "# TYPE tiler_cache_hits_total counter\n")
+		fmt.Fprintf(w, "tiler_cache_hits_total %d\n", hits)
+		fmt.Fprintf(w, "# HELP tiler_cache_misses_total Tiles not found in the cache.\n")
+		fmt.Fprintf(w, "# TYPE tiler_cache_misses_total counter\n")
+		fmt.Fprintf(w, "tiler_cache_misses_total %d\n", misses)
+		fmt.Fprintf(w, "# HELP tiler_cache_bytes Size of the tiles held in the cache.\n")
+		fmt.Fprintf(w, "# TYPE tiler_cache_bytes gauge\n")
+		fmt.Fprintf(w, "tiler_cache_bytes %d\n", h.server.cache.Bytes())
+		fmt.Fprintf(w, "# HELP tiler_cache_tiles Number of tiles held in the cache.\n")
+		fmt.Fprintf(w, "# TYPE tiler_cache_tiles gauge\n")
+		fmt.Fprintf(w, "tiler_cache_tiles %d\n", h.server.cache.Len())
+	}
+
+	var cells int64
+	for _, g := range h.server.TileSet.Grids() {
+		cells += int64(g.Nrows()) * int64(g.Ncols())
+	}
+	fmt.Fprintf(w, "# HELP tiler_grids_loaded Number of grids being served.\n")
+	fmt.Fprintf(w, "# TYPE tiler_grids_loaded gauge\n")
+	fmt.Fprintf(w, "tiler_grids_loaded %d\n", len(h.server.TileSet.Grids()))
+	fmt.Fprintf(w, "# HELP tiler_grid_bytes Memory holding the heights of the loaded grids.\n")
+	fmt.Fprintf(w, "# TYPE tiler_grid_bytes gauge\n")
+	fmt.Fprintf(w, "tiler_grid_bytes %d\n", cells*4)
+}
+
+// statusWriter remembers the status code sent through a ResponseWriter.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// overwriteOptions holds the -force flag shared by the commands that write
+// files.  Without it they refuse to replace a file that already exists, so
+// that a mistyped name can't destroy the results of an earlier long run.
+type overwriteOptions struct {
+	force bool
+}
+
+// addOverwriteFlags registers -force and its other name -overwrite on fs.
+func addOverwriteFlags(fs *flag.FlagSet) *overwriteOptions {
+	o := new(overwriteOptions)
+	fs.BoolVar(&o.force, "force", false, "overwrite results files that already exist")
+	fs.BoolVar(&o.force, "overwrite", false, "the same as -force")
+	return o
+}
+
+// check returns an error if any of the named results files already exists
+// and -force was not given, or is a directory.  Empty names and - (the
+// standard output) are ignored.
+func (o *overwriteOptions) check(names ...string) error {
+	for _, name := range names {
+		if name == "" || name == "-" {
+			continue
+		}
+		fi, err := os.Stat(name)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			return fmt.Errorf("%s is a directory", name)
+		}
+		if !o.force {
+			return fmt.Errorf("%s already exists - give -force to overwrite it", name)
+		}
+	}
+	return nil
+}
+
+// upToDate returns true if the named results file exists and is no older
+// than any of the inputs, so that making it again can be skipped, unless
+// -force was given.  Empty input names are ignored.
+func (o *overwriteOptions) upToDate(name string, inputs ...string) bool {
+	if o.force {
+		return false
+	}
+	exists, newer := compareTimes(name, inputs)
+	return exists && !newer
+}
+
+// outOfDate returns true if the named results file exists and one of the
+// inputs has changed since it was made, so it can be replaced without
+// -force.  Empty input names are ignored.
+func (o *overwriteOptions) outOfDate(name string, inputs ...string) bool {
+	exists, newer := compareTimes(name, inputs)
+	return exists && newer
+}
+
+// compareTimes returns whether the named file exists as an ordinary file
+// and, if so, whether any of the inputs was modified after it.  An input
+// that can't be found counts as newer.
+func compareTimes(name string, inputs []string) (exists, newer bool) {
+	if name == "" || name == "-" {
+		return false, false
+	}
+	fi, err := os.Stat(name)
+	if err != nil || !fi.Mode().IsRegular() {
+		return false, false
+	}
+	for _, input := range inputs {
+		if input == "" {
+			continue
+		}
+		in, err := os.Stat(input)
+		if err != nil || in.ModTime().After(fi.ModTime()) {
+			return true, true
+		}
+	}
+	return true, false
+}
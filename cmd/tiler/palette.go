@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/goblimey/tiler/render"
+)
+
+// paletteOptions holds the -palette flag of the render command.
+type paletteOptions struct {
+	spec string
+	ramp render.ColourRamp
+}
+
+// addPaletteFlag registers -palette on fs.
+func addPaletteFlag(fs *flag.FlagSet) *paletteOptions {
+	o := new(paletteOptions)
+	fs.StringVar(&o.spec, "palette", "", "draw the heights in colour - one of the built in colour ramps "+
+		strings.Join(render.Ramps(), ", ")+", or a gdaldem colour file of percentages - grey if not given")
+	return o
+}
+
+// check loads the colour ramp named by the flag, and returns an error if
+// it's neither a built-in ramp nor a colour file that can be read.
+func (o *paletteOptions) check() error {
+	if o.spec == "" {
+		return nil
+	}
+	var err error
+	for _, name := range render.Ramps() {
+		if o.spec == name {
+			o.ramp, err = render.Ramp(name)
+			return err
+		}
+	}
+	f, err := os.Open(o.spec)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("-palette %q is neither a colour ramp (%s) nor a file", o.spec, strings.Join(render.Ramps(), ", "))
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	o.ramp, err = render.ReadRamp(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", o.spec, err)
+	}
+	return nil
+}
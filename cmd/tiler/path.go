@@ -0,0 +1,148 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/goblimey/tiler/cost"
+	"github.com/goblimey/tiler/esri"
+	"github.com/goblimey/tiler/geojson"
+	"github.com/goblimey/tiler/geom"
+	"github.com/goblimey/tiler/profile"
+)
+
+// costNames lists the choices for the -cost flag.
+var costNames = []string{"tobler", "slope"}
+
+// addCostFlags adds the flags choosing the cost of crossing the ground to a
+// flag set, and returns a function that makes the chosen cost.Func once the
+// flags have been parsed.
+func addCostFlags(fs *flag.FlagSet) func() (cost.Func, error) {
+	name := fs.String("cost", "tobler", "cost of each step - "+strings.Join(costNames, " (walking time in seconds) or ")+" (distance weighted by gradient)")
+	penalty := fs.Float64("penalty", 10, "-cost slope - extra cost per unit of gradient")
+	maxSlope := fs.Float64("max-slope", 0, "steepest gradient that can be crossed, in percent - 0 for no limit")
+	return func() (cost.Func, error) {
+		var f cost.Func
+		switch *name {
+		case "tobler":
+			f = cost.Tobler
+		case "slope":
+			f = cost.SlopeWeighted(*penalty)
+		default:
+			return nil, fmt.Errorf("unknown cost %s - expected one of %s", *name, strings.Join(costNames, ", "))
+		}
+		if *maxSlope > 0 {
+			f = cost.Limit(f, *maxSlope/100)
+		}
+		return f, nil
+	}
+}
+
+// parsePoint parses a map position given as "x,y".
+func parsePoint(s string) (geom.Point, error) {
+	field := strings.Split(s, ",")
+	if len(field) != 2 {
+		return geom.Point{}, fmt.Errorf("point %s - expected x,y", s)
+	}
+	x, y, err := parsePair(strings.TrimSpace(field[0]), strings.TrimSpace(field[1]), "x", "y")
+	if err != nil {
+		return geom.Point{}, fmt.Errorf("point %s - %s", s, err.Error())
+	}
+	return geom.Point{X: x, Y: y}, nil
+}
+
+// leastCostPath sets up the path command, which finds the cheapest route
+// across a grid file between two points and writes it as GeoJSON.  It
+// returns the flags of the command and the function that runs it once they
+// are parsed from the arguments that follow "path".
+func leastCostPath() (*flag.FlagSet, func()) {
+	fs := flag.NewFlagSet("path", flag.ExitOnError)
+	var input, output string
+	fs.StringVar(&input, "input", "", "data file")
+	fs.StringVar(&input, "i", "", "data file")
+	fs.StringVar(&output, "output", "", "GeoJSON results file - the standard output if not given")
+	fs.StringVar(&output, "o", "", "GeoJSON results file - the standard output if not given")
+	fromSpec := fs.String("from", "", "start of the route - x,y in map coordinates")
+	toSpec := fs.String("to", "", "end of the route - x,y in map coordinates")
+	simplify := fs.Float64("simplify", 0, "remove points from the route that are less than this far from it, in map units")
+	bbox := fs.String("bbox", "", "area to search - minX,minY,maxX,maxY in map coordinates")
+	costFunc := addCostFlags(fs)
+	overwrite := addOverwriteFlags(fs)
+	logging := addLogFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: tiler path -i file -from x,y -to x,y [flags]\n")
+		fs.PrintDefaults()
+	}
+	return fs, func() {
+		err := logging.setup()
+		if err != nil {
+			fatal(err.Error())
+		}
+		if input == "" || *fromSpec == "" || *toSpec == "" {
+			fs.Usage()
+			os.Exit(2)
+		}
+		err = overwrite.check(output)
+		if err != nil {
+			fatal(err.Error())
+		}
+		from, err := parsePoint(*fromSpec)
+		if err != nil {
+			fatal(err.Error())
+		}
+		to, err := parsePoint(*toSpec)
+		if err != nil {
+			fatal(err.Error())
+		}
+		f, err := costFunc()
+		if err != nil {
+			fatal(err.Error())
+		}
+
+		grid, err := esri.ReadGridFromFile(input)
+		if err != nil {
+			fail(readError(err))
+		}
+		if *bbox != "" {
+			minX, minY, maxX, maxY, err := parseBBox(*bbox)
+			if err != nil {
+				fatal(err.Error())
+			}
+			grid, err = grid.Crop(minX, minY, maxX, maxY)
+			if err != nil {
+				fatal(err.Error())
+			}
+		}
+
+		line, total, err := cost.Path(grid, from, to, f)
+		if err != nil {
+			fatal(err.Error())
+		}
+		samples := profile.Points(grid, line)
+		ascent, descent := profile.Climb(samples)
+		length := samples[len(samples)-1].Distance
+		slog.Info("path", "cost", total, "length", length, "ascent", ascent, "descent", descent)
+		if *simplify > 0 {
+			line = line.Simplify(*simplify)
+		}
+
+		fc := new(geojson.FeatureCollection)
+		fc.AddLineString(line, map[string]interface{}{
+			"cost":    total,
+			"length":  length,
+			"ascent":  ascent,
+			"descent": descent,
+		})
+		if output == "" {
+			err = fc.Write(os.Stdout)
+		} else {
+			err = fc.WriteToFile(output)
+		}
+		if err != nil {
+			fail(writeError(err))
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/goblimey/tiler/crs"
+	"github.com/goblimey/tiler/esri"
+)
+
+// points sets up the points command, which reads a CSV file of positions and
+// writes it out again with the height at each position added to the end of
+// each line.  The file is processed a line at a time, so it can be as long
+// as needed.  It returns the flags of the command and the function that runs
+// it once they are parsed from the arguments that follow "points" - flags
+// and then the names of the grid files.
+func points() (*flag.FlagSet, func()) {
+	fs := flag.NewFlagSet("points", flag.ExitOnError)
+	var input, output string
+	fs.StringVar(&input, "input", "", "CSV file of positions - the standard input if not given")
+	fs.StringVar(&input, "i", "", "CSV file of positions - the standard input if not given")
+	fs.StringVar(&output, "output", "", "CSV results file - the standard output if not given")
+	fs.StringVar(&output, "o", "", "CSV results file - the standard output if not given")
+	xColumn := fs.String("x", "1", "column holding x or longitude - a name from the header line or a number counting from 1")
+	yColumn := fs.String("y", "2", "column holding y or latitude - a name from the header line or a number counting from 1")
+	lonlat := fs.Bool("lonlat", false, "the positions are WGS84 longitude and latitude, not map coordinates")
+	column := fs.String("column", "height", "name of the added column in the header line")
+	places := fs.Int("places", 3, "decimal places in the heights")
+	manifest := fs.String("manifest", "", "mosaic manifest listing the grid files")
+	crsName := fs.String("crs", crs.Default, "coordinate reference system of the grids")
+	overwrite := addOverwriteFlags(fs)
+	logging := addLogFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: tiler points [flags] [grid file ...]\n")
+		fs.PrintDefaults()
+	}
+	return fs, func() {
+		err := logging.setup()
+		if err != nil {
+			fatal(err.Error())
+		}
+
+		c, err := crs.Lookup(*crsName)
+		if err != nil {
+			fatal(err.Error())
+		}
+		var ts *esri.TileSet
+		if *manifest != "" {
+			ts, err = esri.ReadTileSetFromManifest(*manifest)
+		} else {
+			ts, err = esri.ReadTileSetFromFiles(fs.Args())
+		}
+		if err != nil {
+			fail(readError(err))
+		}
+		if len(ts.Grids()) == 0 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		err = overwrite.check(output)
+		if err != nil {
+			fatal(err.Error())
+		}
+
+		in := os.Stdin
+		if input != "" {
+			in, err = os.Open(input)
+			if err != nil {
+				fail(readError(err))
+			}
+			defer in.Close()
+		}
+		out := os.Stdout
+		if output != "" {
+			out, err = os.Create(output)
+			if err != nil {
+				fail(writeError(err))
+			}
+		}
+		p := pointLookup{
+			sampler: esri.NewSampler(ts),
+			xColumn: *xColumn,
+			yColumn: *yColumn,
+			column:  *column,
+			places:  *places,
+		}
+		if *lonlat {
+			p.crs = c
+		}
+		err = p.run(in, out)
+		if err == nil && output != "" {
+			err = out.Close()
+		}
+		if err != nil {
+			fatal(err.Error())
+		}
+	}
+}
+
+// pointLookup adds heights to the lines of a CSV file.
+type pointLookup struct {
+	sampler          *esri.Sampler
+	crs              crs.CRS // If not nil, positions are converted from WGS84.
+	xColumn, yColumn string
+	column           string
+	places           int
+}
+
+// run copies CSV text from r to w, adding the height at the position given
+// on each line.  The first line is taken as a header if its position isn't
+// a pair of numbers.  Lines with a bad position or no data there get an
+// empty height.
+func (p *pointLookup) run(r io.Reader, w io.Writer) error {
+	in := csv.NewReader(bufio.NewReaderSize(r, 1<<20))
+	in.FieldsPerRecord = -1
+	in.ReuseRecord = true
+	buffered := bufio.NewWriterSize(w, 1<<20)
+	out := csv.NewWriter(buffered)
+
+	xIndex, xNamed := columnIndex(p.xColumn)
+	yIndex, yNamed := columnIndex(p.yColumn)
+	lines, found, bad := 0, 0, 0
+	for line := 1; ; line++ {
+		record, err := in.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if line == 1 {
+			header := xNamed || yNamed
+			if !header {
+				_, _, err := p.position(record, xIndex, yIndex)
+				header = err != nil
+			}
+			if header {
+				if xNamed {
+					xIndex, err = findColumn(record, p.xColumn)
+				}
+				if err == nil && yNamed {
+					yIndex, err = findColumn(record, p.yColumn)
+				}
+				if err != nil {
+					return err
+				}
+				err = out.Write(append(record, p.column))
+				if err != nil {
+					return err
+				}
+				continue
+			}
+		}
+
+		lines++
+		height := ""
+		x, y, err := p.position(record, xIndex, yIndex)
+		if err != nil {
+			bad++
+			slog.Debug("points", "line", line, "error", err)
+		} else if h, ok := p.sampler.InterpolatedHeightAt(x, y); ok {
+			found++
+			height = strconv.FormatFloat(float64(h), 'f', p.places, 64)
+		}
+		err = out.Write(append(record, height))
+		if err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	err := out.Error()
+	if err != nil {
+		return err
+	}
+	err = buffered.Flush()
+	if err != nil {
+		return err
+	}
+
+	slog.Info("points", "lines", lines, "heights", found, "noData", lines-found-bad)
+	if bad > 0 {
+		slog.Warn("points", "badPositions", bad)
+	}
+	return nil
+}
+
+// position returns the map position given in the x and y columns of a
+// record.
+func (p *pointLookup) position(record []string, xIndex, yIndex int) (x, y float64, err error) {
+	if xIndex >= len(record) || yIndex >= len(record) {
+		return 0, 0, fmt.Errorf("only %d fields", len(record))
+	}
+	x, y, err = parsePair(strings.TrimSpace(record[xIndex]), strings.TrimSpace(record[yIndex]), "x", "y")
+	if err != nil {
+		return 0, 0, err
+	}
+	if p.crs != nil {
+		x, y = p.crs.FromWGS84(x, y)
+	}
+	return x, y, nil
+}
+
+// columnIndex returns the index counting from 0 of a column given as a
+// number counting from 1.  named is true if the column is given by name
+// instead.
+func columnIndex(column string) (index int, named bool) {
+	n, err := strconv.Atoi(column)
+	if err != nil || n < 1 {
+		return 0, true
+	}
+	return n - 1, false
+}
+
+// findColumn returns the index of the named column in a header line.
+func findColumn(header []string, name string) (int, error) {
+	for i, field := range header {
+		if strings.EqualFold(strings.TrimSpace(field), name) {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("no column called %s in the header line", name)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+)
+
+// progressBar is the length in characters of the progress bar.
+const progressBar = 30
+
+// progressDelay is how long a job runs before its progress is shown, so
+// that quick jobs don't show any.
+const progressDelay = time.Second
+
+// progress shows how a long job is going, so that a user with a big grid
+// can see that the tiler hasn't hung.  If stderr is a terminal it draws a
+// bar there, otherwise it logs a message every tenth of the way.  Nothing is
+// shown if info messages aren't being logged.
+type progress struct {
+	label string
+	tty   bool
+	quiet bool
+	start time.Time
+	shown int  // The percentage last shown.
+	drawn bool // The bar is on the screen.
+}
+
+// newProgress is a factory method that makes a progress for the job
+// described by label.
+func newProgress(label string) *progress {
+	p := &progress{label: label, start: time.Now(), shown: -1}
+	p.quiet = !slog.Default().Enabled(context.Background(), slog.LevelInfo)
+	if fi, err := os.Stderr.Stat(); err == nil {
+		p.tty = fi.Mode()&os.ModeCharDevice != 0
+	}
+	return p
+}
+
+// update records that done out of total has been done.  It's an
+// esri.ProgressFunc.
+func (p *progress) update(done, total int64) {
+	if p.quiet || total <= 0 || time.Since(p.start) < progressDelay {
+		return
+	}
+	percent := int(done * 100 / total)
+	if percent > 100 {
+		percent = 100
+	}
+	if p.tty {
+		if percent == p.shown {
+			return
+		}
+		p.shown = percent
+		p.drawn = true
+		filled := percent * progressBar / 100
+		fmt.Fprintf(os.Stderr, "\r%s [%s%s] %3d%%", p.label,
+			strings.Repeat("#", filled), strings.Repeat(".", progressBar-filled), percent)
+		if done >= total {
+			fmt.Fprintln(os.Stderr)
+			p.drawn = false
+		}
+		return
+	}
+	if percent/10 > p.shown/10 && percent < 100 {
+		p.shown = percent
+		slog.Info(p.label, "percent", percent)
+	}
+}
+
+// finish ends the bar, if one was drawn, when the job stops before the end.
+func (p *progress) finish() {
+	if p.drawn {
+		fmt.Fprintln(os.Stderr)
+		p.drawn = false
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// The messages of proto/tiler.proto are few and small, so the gRPC handler
+// encodes and decodes them by hand in the protocol buffers wire format
+// rather than with generated code, which would need the protobuf libraries.
+
+// The wire types of protocol buffers fields.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// errBadMessage is returned for data that isn't a protocol buffers message.
+var errBadMessage = errors.New("badly formed message")
+
+// protoBuffer builds a protocol buffers message.  As in proto3, fields
+// holding zero values are left out, except for embedded messages.
+type protoBuffer struct {
+	b []byte
+}
+
+func (p *protoBuffer) tag(field, wire int) {
+	p.varint(uint64(field<<3 | wire))
+}
+
+func (p *protoBuffer) varint(v uint64) {
+	p.b = binary.AppendUvarint(p.b, v)
+}
+
+// intField writes an int32 or int64 field.  Negative numbers take ten
+// bytes, as the format requires.
+func (p *protoBuffer) intField(field int, v int64) {
+	if v != 0 {
+		p.tag(field, wireVarint)
+		p.varint(uint64(v))
+	}
+}
+
+func (p *protoBuffer) boolField(field int, v bool) {
+	if v {
+		p.tag(field, wireVarint)
+		p.varint(1)
+	}
+}
+
+func (p *protoBuffer) doubleField(field int, v float64) {
+	if v != 0 {
+		p.tag(field, wireFixed64)
+		p.b = binary.LittleEndian.AppendUint64(p.b, math.Float64bits(v))
+	}
+}
+
+func (p *protoBuffer) bytesField(field int, v []byte) {
+	if len(v) > 0 {
+		p.tag(field, wireBytes)
+		p.varint(uint64(len(v)))
+		p.b = append(p.b, v...)
+	}
+}
+
+func (p *protoBuffer) stringField(field int, v string) {
+	p.bytesField(field, []byte(v))
+}
+
+// messageField writes an embedded message, such as an element of a
+// repeated field, even if it's empty.
+func (p *protoBuffer) messageField(field int, m *protoBuffer) {
+	p.tag(field, wireBytes)
+	p.varint(uint64(len(m.b)))
+	p.b = append(p.b, m.b...)
+}
+
+// protoField is a field of a protocol buffers message being decoded.
+type protoField struct {
+	num  int
+	wire int
+	v    uint64 // the value of a varint or fixed size field
+	data []byte // the value of a length-delimited field
+}
+
+// int returns the value of an integer field.
+func (f protoField) int() (int64, error) {
+	if f.wire != wireVarint {
+		return 0, f.wrongType()
+	}
+	return int64(f.v), nil
+}
+
+// bool returns the value of a bool field.
+func (f protoField) bool() (bool, error) {
+	if f.wire != wireVarint {
+		return false, f.wrongType()
+	}
+	return f.v != 0, nil
+}
+
+// double returns the value of a double field.
+func (f protoField) double() (float64, error) {
+	if f.wire != wireFixed64 {
+		return 0, f.wrongType()
+	}
+	return math.Float64frombits(f.v), nil
+}
+
+// message returns the contents of an embedded message field.
+func (f protoField) message() ([]byte, error) {
+	if f.wire != wireBytes {
+		return nil, f.wrongType()
+	}
+	return f.data, nil
+}
+
+func (f protoField) wrongType() error {
+	return fmt.Errorf("%w - field %d has the wrong wire type %d", errBadMessage, f.num, f.wire)
+}
+
+// readProto calls fn with each field of the message in data, in order.
+// Fields that fn doesn't know should be ignored, so that older servers can
+// take newer messages.
+func readProto(data []byte, fn func(f protoField) error) error {
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 || key>>3 == 0 {
+			return errBadMessage
+		}
+		data = data[n:]
+		f := protoField{num: int(key >> 3), wire: int(key & 7)}
+		switch f.wire {
+		case wireVarint:
+			f.v, n = binary.Uvarint(data)
+			if n <= 0 {
+				return errBadMessage
+			}
+			data = data[n:]
+		case wireFixed64:
+			if len(data) < 8 {
+				return errBadMessage
+			}
+			f.v = binary.LittleEndian.Uint64(data)
+			data = data[8:]
+		case wireBytes:
+			size, n := binary.Uvarint(data)
+			if n <= 0 || size > uint64(len(data)-n) {
+				return errBadMessage
+			}
+			f.data = data[n : n+int(size)]
+			data = data[n+int(size):]
+		case wireFixed32:
+			if len(data) < 4 {
+				return errBadMessage
+			}
+			f.v = uint64(binary.LittleEndian.Uint32(data))
+			data = data[4:]
+		default:
+			return fmt.Errorf("%w - wire type %d", errBadMessage, f.wire)
+		}
+		err := fn(f)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
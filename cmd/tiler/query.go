@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/goblimey/tiler/crs"
+	"github.com/goblimey/tiler/esri"
+)
+
+// query sets up the query command, which prints the height at one or more
+// points, interpolated between the cells of the grids.  It returns the flags
+// of the command and the function that runs it once they are parsed from the
+// arguments that follow "query" - flags and then the names of the grid
+// files.
+func query() (*flag.FlagSet, func()) {
+	fs := flag.NewFlagSet("query", flag.ExitOnError)
+	at := fs.String("at", "", "points to look up - x,y in map coordinates, with several separated by semicolons")
+	lonlat := fs.Bool("lonlat", false, "the -at points are WGS84 longitude,latitude, not map coordinates")
+	places := fs.Int("places", 3, "decimal places in the heights")
+	asJSON := fs.Bool("json", false, "write a JSON array with an object for each point")
+	manifest := fs.String("manifest", "", "mosaic manifest listing the grid files")
+	crsName := fs.String("crs", crs.Default, "coordinate reference system of the grids")
+	logging := addLogFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: tiler query -at x,y[;x,y...] [flags] [grid file ...]\n")
+		fs.PrintDefaults()
+	}
+	return fs, func() {
+		err := logging.setup()
+		if err != nil {
+			fatal(err.Error())
+		}
+		if *at == "" {
+			fs.Usage()
+			os.Exit(2)
+		}
+		c, err := crs.Lookup(*crsName)
+		if err != nil {
+			fatal(err.Error())
+		}
+		var results []elevation
+		for _, spec := range strings.Split(*at, ";") {
+			p, err := parsePoint(spec)
+			if err != nil {
+				fatal(err.Error())
+			}
+			var e elevation
+			if *lonlat {
+				lon, lat := p.X, p.Y
+				e.Lon, e.Lat = &lon, &lat
+				e.X, e.Y = c.FromWGS84(lon, lat)
+			} else {
+				e.X, e.Y = p.X, p.Y
+			}
+			results = append(results, e)
+		}
+
+		var ts *esri.TileSet
+		if *manifest != "" {
+			ts, err = esri.ReadTileSetFromManifest(*manifest)
+		} else {
+			ts, err = esri.ReadTileSetFromFiles(fs.Args())
+		}
+		if err != nil {
+			fail(readError(err))
+		}
+		if len(ts.Grids()) == 0 {
+			fs.Usage()
+			os.Exit(2)
+		}
+
+		for i := range results {
+			e := &results[i]
+			e.CRS = c.Code()
+			if h, ok := ts.InterpolatedHeightAt(e.X, e.Y); ok {
+				v, _ := strconv.ParseFloat(strconv.FormatFloat(float64(h), 'f', *places, 64), 64)
+				e.Height = &v
+			}
+		}
+
+		if *asJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			err = enc.Encode(results)
+			if err != nil {
+				fatal(err.Error())
+			}
+			return
+		}
+		for _, e := range results {
+			height := "nodata"
+			if e.Height != nil {
+				height = strconv.FormatFloat(*e.Height, 'f', *places, 64)
+			}
+			if e.Lon != nil {
+				fmt.Printf("%g %g %.3f %.3f %s\n", *e.Lon, *e.Lat, e.X, e.Y, height)
+			} else {
+				fmt.Printf("%g %g %s\n", e.X, e.Y, height)
+			}
+		}
+	}
+}
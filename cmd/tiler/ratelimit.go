@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// renderLimit caps the number of renders running at once.  A render that
+// can't start within the wait time is refused.  A nil renderLimit allows any
+// number.
+type renderLimit struct {
+	slots chan struct{}
+	wait  time.Duration
+}
+
+// newRenderLimit returns a renderLimit allowing max renders at once, or nil
+// if max is not positive.
+func newRenderLimit(max int, wait time.Duration) *renderLimit {
+	if max <= 0 {
+		return nil
+	}
+	return &renderLimit{slots: make(chan struct{}, max), wait: wait}
+}
+
+// acquire waits for a free slot.  It returns false if none became free in
+// time or ctx was cancelled first, for example because the client went
+// away.  Each successful acquire must be followed by a release.
+func (l *renderLimit) acquire(ctx context.Context) bool {
+	if l == nil {
+		return true
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+	}
+	timer := time.NewTimer(l.wait)
+	defer timer.Stop()
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// acquireQueued waits for a free slot for as long as it takes, with no
+// timer, for work that no client is waiting on, such as an asynchronous
+// render.  It must be followed by a release.
+func (l *renderLimit) acquireQueued() {
+	if l != nil {
+		l.slots <- struct{}{}
+	}
+}
+
+// release frees a slot taken by acquire or acquireQueued.
+func (l *renderLimit) release() {
+	if l != nil {
+		<-l.slots
+	}
+}
+
+// busy sends the response for a render refused by a renderLimit.
+func busy(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", "1")
+	http.Error(w, "server busy", http.StatusServiceUnavailable)
+}
+
+// rateLimiter limits the rate of requests from each client with a token
+// bucket per client address.
+type rateLimiter struct {
+	rate      float64 // Tokens added per second.
+	burst     float64 // Size of the bucket.
+	proxyHops int     // Trusted proxies appending to X-Forwarded-For - 0 to ignore it.
+	mutex     sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter returns a rateLimiter allowing rate requests per second
+// from each client with bursts of up to burst requests, or nil if rate is not
+// positive.  proxyHops is the number of trusted proxies in front of the
+// server that append to X-Forwarded-For, or 0 if it's not to be trusted.
+func newRateLimiter(rate float64, burst int, proxyHops int) *rateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{
+		rate:      rate,
+		burst:     float64(burst),
+		proxyHops: proxyHops,
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// wrap returns a handler that refuses requests from clients over their rate
+// with status 429.  If l is nil, h is returned unchanged.
+func (l *rateLimiter) wrap(h http.Handler) http.Handler {
+	if l == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ok, retry := l.allow(l.client(r), time.Now())
+		if !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+			http.Error(w, "too many requests", http.StatusTooManyRequests)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// allow takes a token from the client's bucket.  If there isn't one it
+// returns false and how long until there will be.
+func (l *rateLimiter) allow(client string, now time.Time) (bool, time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	// Now and then forget clients whose buckets have refilled.
+	full := time.Duration(l.burst / l.rate * float64(time.Second))
+	if now.Sub(l.lastSweep) > full && now.Sub(l.lastSweep) > time.Minute {
+		for c, b := range l.buckets {
+			if now.Sub(b.last) > full {
+				delete(l.buckets, c)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[client] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// client returns the address of the client that sent a request.  Behind
+// proxies it's the entry in X-Forwarded-For added by the outermost trusted
+// proxy, counting proxyHops from the right.  The entries to the left of it
+// were written by the client, which could put anything there.
+func (l *rateLimiter) client(r *http.Request) string {
+	if l.proxyHops > 0 {
+		var addrs []string
+		for _, header := range r.Header.Values("X-Forwarded-For") {
+			for _, addr := range strings.Split(header, ",") {
+				if addr = strings.TrimSpace(addr); addr != "" {
+					addrs = append(addrs, addr)
+				}
+			}
+		}
+		if len(addrs) > 0 {
+			i := len(addrs) - l.proxyHops
+			if i < 0 {
+				// Every entry was added by a trusted proxy.
+				i = 0
+			}
+			return addrs[i]
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"image/color"
+	"image/png"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/goblimey/tiler/esri"
+	"github.com/goblimey/tiler/geojson"
+	"github.com/goblimey/tiler/polygonize"
+	"github.com/goblimey/tiler/render"
+)
+
+// reclassify sets up the reclassify command, which sorts the heights in a
+// grid file into classes and writes the result as a grid file, a picture or
+// GeoJSON polygons.  It returns the flags of the command and the function
+// that runs it once they are parsed from the arguments that follow
+// "reclassify".
+func reclassify() (*flag.FlagSet, func()) {
+	fs := flag.NewFlagSet("reclassify", flag.ExitOnError)
+	var input, output string
+	fs.StringVar(&input, "input", "", "data file")
+	fs.StringVar(&input, "i", "", "data file")
+	fs.StringVar(&output, "output", "", "ESRI Grid (.asc), PNG map or GeoJSON (.geojson or .json) results file")
+	fs.StringVar(&output, "o", "", "ESRI Grid (.asc), PNG map or GeoJSON (.geojson or .json) results file")
+	spec := fs.String("classes", "", "comma separated classes min:max=value - leave out min or max for an open-ended range")
+	table := fs.String("table", "", "file of classes, one per line - min max value and optionally a colour #rrggbb")
+	bbox := fs.String("bbox", "", "area to cover - minX,minY,maxX,maxY in map coordinates")
+	overwrite := addOverwriteFlags(fs)
+	logging := addLogFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: tiler reclassify -i file -o file -classes spec | -table file [flags]\n")
+		fs.PrintDefaults()
+	}
+	return fs, func() {
+		err := logging.setup()
+		if err != nil {
+			fatal(err.Error())
+		}
+		if input == "" || output == "" || (*spec == "") == (*table == "") {
+			fs.Usage()
+			os.Exit(2)
+		}
+		err = overwrite.check(output)
+		if err != nil {
+			fatal(err.Error())
+		}
+
+		var classes []esri.Class
+		var colours map[float32]color.RGBA
+		if *spec != "" {
+			classes, err = parseClasses(*spec)
+		} else {
+			classes, colours, err = readClassTable(*table)
+		}
+		if err != nil {
+			fail(readError(err))
+		}
+
+		grid, err := esri.ReadGridFromFile(input)
+		if err != nil {
+			fail(readError(err))
+		}
+		if *bbox != "" {
+			minX, minY, maxX, maxY, err := parseBBox(*bbox)
+			if err != nil {
+				fatal(err.Error())
+			}
+			grid, err = grid.Crop(minX, minY, maxX, maxY)
+			if err != nil {
+				fatal(err.Error())
+			}
+		}
+		result, err := grid.Reclassify(classes)
+		if err != nil {
+			fatal(err.Error())
+		}
+		slog.Info("reclassified", "classes", len(classes))
+
+		switch strings.ToLower(filepath.Ext(output)) {
+		case ".asc":
+			err = result.WriteToFile(output)
+		case ".geojson", ".json":
+			fc := new(geojson.FeatureCollection)
+			for _, class := range polygonize.Classes(result) {
+				fc.AddMultiPolygon(class.Polygons, map[string]interface{}{"value": class.Value})
+			}
+			err = fc.WriteToFile(output)
+		default:
+			var out *os.File
+			out, err = os.Create(output)
+			if err != nil {
+				break
+			}
+			err = png.Encode(out, render.ClassImage(result, colours))
+			if err != nil {
+				out.Close()
+				break
+			}
+			err = out.Close()
+		}
+		if err != nil {
+			fail(writeError(err))
+		}
+	}
+}
+
+// parseClasses parses a comma separated list of classes, each
+// "min:max=value".  A missing min or max stands for minus or plus infinity.
+func parseClasses(s string) ([]esri.Class, error) {
+	var result []esri.Class
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		bounds, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return nil, fmt.Errorf("classes %s - expected min:max=value, not %q", s, field)
+		}
+		low, high, ok := strings.Cut(bounds, ":")
+		if !ok {
+			return nil, fmt.Errorf("classes %s - expected min:max=value, not %q", s, field)
+		}
+		c, err := makeClass(strings.TrimSpace(low), strings.TrimSpace(high), strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("classes %s - %s", s, err.Error())
+		}
+		result = append(result, c)
+	}
+	return result, nil
+}
+
+// readClassTable reads classes from a file with one class per line, each
+// "min max value", optionally followed by a colour "#rrggbb".  min and max
+// can be -inf and inf.  Blank lines and lines starting with # are skipped.
+func readClassTable(filename string) ([]esri.Class, map[float32]color.RGBA, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	var classes []esri.Class
+	colours := make(map[float32]color.RGBA)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		field := strings.Fields(text)
+		if len(field) != 3 && len(field) != 4 {
+			return nil, nil, fmt.Errorf("%s line %d - expected min max value [#rrggbb]", filename, line)
+		}
+		c, err := makeClass(field[0], field[1], field[2])
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s line %d - %s", filename, line, err.Error())
+		}
+		if len(field) == 4 {
+			colour, err := parseColour(field[3])
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s line %d - %s", filename, line, err.Error())
+			}
+			colours[c.Value] = colour
+		}
+		classes = append(classes, c)
+	}
+	err = scanner.Err()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(classes) == 0 {
+		return nil, nil, fmt.Errorf("%s - no classes", filename)
+	}
+	return classes, colours, nil
+}
+
+// makeClass makes a class from the text of its range and value.  An empty
+// low or high stands for minus or plus infinity.
+func makeClass(low, high, value string) (esri.Class, error) {
+	c := esri.Class{Min: math.Inf(-1), Max: math.Inf(1)}
+	var err error
+	if low != "" {
+		c.Min, err = strconv.ParseFloat(low, 64)
+		if err != nil {
+			return c, fmt.Errorf("bad minimum %q", low)
+		}
+	}
+	if high != "" {
+		c.Max, err = strconv.ParseFloat(high, 64)
+		if err != nil {
+			return c, fmt.Errorf("bad maximum %q", high)
+		}
+	}
+	v, err := strconv.ParseFloat(value, 32)
+	if err != nil {
+		return c, fmt.Errorf("bad value %q", value)
+	}
+	c.Value = float32(v)
+	return c, nil
+}
+
+// parseColour parses a colour given as "#rrggbb".
+func parseColour(s string) (color.RGBA, error) {
+	if len(s) != 7 || s[0] != '#' {
+		return color.RGBA{}, fmt.Errorf("colour %q - expected #rrggbb", s)
+	}
+	v, err := strconv.ParseUint(s[1:], 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("colour %q - expected #rrggbb", s)
+	}
+	return color.RGBA{uint8(v >> 16), uint8(v >> 8), uint8(v), 255}, nil
+}
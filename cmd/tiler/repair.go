@@ -0,0 +1,114 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/goblimey/tiler/esri"
+)
+
+// repair sets up the repair command, which writes a mended copy of a broken
+// ESRI ASCII grid and lists each change made, as file:line:column: change.
+// It returns the flags of the command and the function that runs it once
+// they are parsed from the arguments that follow "repair".
+func repair() (*flag.FlagSet, func()) {
+	fs := flag.NewFlagSet("repair", flag.ExitOnError)
+	var input, output string
+	fs.StringVar(&input, "input", "", "ESRI ASCII grid file to mend - - for the standard input")
+	fs.StringVar(&input, "i", "", "ESRI ASCII grid file to mend - - for the standard input")
+	fs.StringVar(&output, "output", "", "results file, which can be the input file - - for the standard output")
+	fs.StringVar(&output, "o", "", "results file, which can be the input file - - for the standard output")
+	overwrite := addOverwriteFlags(fs)
+	logging := addLogFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: tiler repair -i in.asc -o out.asc [flags]\n")
+		fs.PrintDefaults()
+	}
+	return fs, func() {
+		err := logging.setup()
+		if err != nil {
+			fatal(err.Error())
+		}
+		if input == "" || output == "" {
+			fs.Usage()
+			os.Exit(2)
+		}
+		if strings.ToLower(filepath.Ext(input)) == ".zip" {
+			fatal(fmt.Sprintf("%s is a zip file - unpack it and mend the grid file in it", input))
+		}
+		// Mending a file in place is what -o is for, so it needs no -force.
+		if output != input {
+			err = overwrite.check(output)
+			if err != nil {
+				fatal(err.Error())
+			}
+		}
+
+		in := os.Stdin
+		if input != "-" {
+			in, err = os.Open(input)
+			if err != nil {
+				fail(readError(err))
+			}
+			defer in.Close()
+		}
+
+		// The results go to a temporary file that replaces the output at the
+		// end, so that a failure leaves the output as it was and the input can
+		// be mended in place.
+		var out io.Writer = os.Stdout
+		var temp *os.File
+		if output != "-" {
+			temp, err = os.CreateTemp(filepath.Dir(output), filepath.Base(output)+".*.tmp")
+			if err == nil {
+				// CreateTemp makes files only the owner can read.
+				err = temp.Chmod(0644)
+			}
+			if err != nil {
+				fail(writeError(err))
+			}
+			out = temp
+		}
+		// discard removes the temporary file after a failure.
+		discard := func() {
+			if temp != nil {
+				temp.Close()
+				os.Remove(temp.Name())
+			}
+		}
+		changes, err := esri.Repair(in, out)
+		if err != nil {
+			discard()
+			fail(readError(fmt.Errorf("%s: %w", input, err)))
+		}
+		if temp != nil {
+			err = temp.Close()
+			if err == nil {
+				err = os.Rename(temp.Name(), output)
+			}
+			if err != nil {
+				discard()
+				fail(writeError(err))
+			}
+		}
+
+		// The list of changes can't go to the standard output with the grid.
+		report := os.Stdout
+		if output == "-" {
+			report = os.Stderr
+		}
+		for _, c := range changes {
+			if c.Line == 0 {
+				fmt.Fprintf(report, "%s: %s\n", input, c.String())
+			} else {
+				fmt.Fprintf(report, "%s:%s\n", input, c.String())
+			}
+		}
+		slog.Info("repaired", "file", input, "output", output, "changes", len(changes))
+	}
+}
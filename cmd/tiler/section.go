@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"image/png"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/goblimey/tiler/crs"
+	"github.com/goblimey/tiler/esri"
+	"github.com/goblimey/tiler/geojson"
+	"github.com/goblimey/tiler/geom"
+	"github.com/goblimey/tiler/gpx"
+	"github.com/goblimey/tiler/profile"
+	"github.com/goblimey/tiler/render"
+	"github.com/goblimey/tiler/svg"
+)
+
+// crossSection sets up the profile command, which samples the heights along
+// a line and draws them as a cross-section chart or writes them as CSV.  It
+// returns the flags of the command and the function that runs it once they
+// are parsed from the arguments that follow "profile" - flags and then the
+// names of the grid files.
+func crossSection() (*flag.FlagSet, func()) {
+	fs := flag.NewFlagSet("profile", flag.ExitOnError)
+	var output string
+	fs.StringVar(&output, "output", "", "PNG chart, SVG chart (.svg) or CSV (.csv) results file")
+	fs.StringVar(&output, "o", "", "PNG chart, SVG chart (.svg) or CSV (.csv) results file")
+	lineSpec := fs.String("line", "", "the line to follow - x1,y1,x2,y2,... in map coordinates")
+	gpxFile := fs.String("gpx", "", "GPX file - follow its first track or route instead of -line")
+	geojsonFile := fs.String("geojson", "", "GeoJSON file - follow its LineStrings instead of -line")
+	spacing := fs.Float64("spacing", 0, "distance between samples in map units - the cell size if not given")
+	exaggeration := fs.Float64("exaggeration", 0, "charts - how many times the heights are stretched - 0 makes the chart a third as high as it is long")
+	width := fs.Int("width", 1000, "PNG - width in pixels")
+	title := fs.String("title", "", "SVG - title written above the chart")
+	manifest := fs.String("manifest", "", "mosaic manifest listing the grid files")
+	crsName := fs.String("crs", crs.Default, "coordinate reference system of the grids")
+	overwrite := addOverwriteFlags(fs)
+	logging := addLogFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: tiler profile -o file -line x1,y1,x2,y2,... | -gpx file | -geojson file [flags] [grid file ...]\n")
+		fs.PrintDefaults()
+	}
+	return fs, func() {
+		err := logging.setup()
+		if err != nil {
+			fatal(err.Error())
+		}
+		given := 0
+		for _, s := range []string{*lineSpec, *gpxFile, *geojsonFile} {
+			if s != "" {
+				given++
+			}
+		}
+		if output == "" || given != 1 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		err = overwrite.check(output)
+		if err != nil {
+			fatal(err.Error())
+		}
+
+		var line geom.Line
+		switch {
+		case *lineSpec != "":
+			line, err = parseLine(*lineSpec)
+		case *gpxFile != "":
+			line, err = readGPXLine(*gpxFile, *crsName)
+		default:
+			line, err = readGeoJSONLine(*geojsonFile)
+		}
+		if err != nil {
+			fatal(err.Error())
+		}
+
+		var ts *esri.TileSet
+		if *manifest != "" {
+			ts, err = esri.ReadTileSetFromManifest(*manifest)
+		} else {
+			ts, err = esri.ReadTileSetFromFiles(fs.Args())
+		}
+		if err != nil {
+			fail(readError(err))
+		}
+		if len(ts.Grids()) == 0 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		if *spacing <= 0 {
+			*spacing = float64(ts.Grids()[0].CellSize())
+		}
+
+		samples := profile.Along(ts, line, *spacing)
+		ascent, descent := profile.Climb(samples)
+		length, low, high, ok := profile.Extent(samples)
+		if !ok {
+			fatal("the line doesn't cross any data")
+		}
+		if *exaggeration <= 0 {
+			*exaggeration = profile.AutoExaggeration(length, low, high)
+		}
+		slog.Info("profile", "samples", len(samples), "length", length,
+			"low", low, "high", high, "ascent", ascent, "descent", descent,
+			"exaggeration", *exaggeration)
+
+		switch strings.ToLower(filepath.Ext(output)) {
+		case ".csv":
+			var out *os.File
+			out, err = os.Create(output)
+			if err != nil {
+				break
+			}
+			err = writeProfileCSV(out, samples)
+			if err != nil {
+				out.Close()
+				break
+			}
+			err = out.Close()
+		case ".svg":
+			err = svg.WriteProfileToFile(output, samples,
+				svg.ProfileOptions{Exaggeration: *exaggeration, Title: *title})
+		default:
+			err = writeProfilePNG(output, samples, *width, *exaggeration)
+		}
+		if err != nil {
+			fail(writeError(err))
+		}
+	}
+}
+
+// parseLine parses a line given as "x1,y1,x2,y2,...".
+func parseLine(s string) (geom.Line, error) {
+	field := strings.Split(s, ",")
+	if len(field) < 4 || len(field)%2 != 0 {
+		return nil, fmt.Errorf("line %s - expected x1,y1,x2,y2,...", s)
+	}
+	var line geom.Line
+	for i := 0; i < len(field); i += 2 {
+		x, y, err := parsePair(strings.TrimSpace(field[i]), strings.TrimSpace(field[i+1]), "x", "y")
+		if err != nil {
+			return nil, fmt.Errorf("line %s - %s", s, err.Error())
+		}
+		line = append(line, geom.Point{X: x, Y: y})
+	}
+	return line, nil
+}
+
+// readGPXLine returns the points of the first track, or if there is none the
+// first route, in a GPX file, in the map coordinates of the given
+// coordinate reference system.
+func readGPXLine(filename, crsName string) (geom.Line, error) {
+	c, err := crs.Lookup(crsName)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := gpx.ReadFromFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var points []gpx.Point
+	if len(doc.Tracks) > 0 {
+		for _, segment := range doc.Tracks[0].Segments {
+			points = append(points, segment.Points...)
+		}
+	} else if len(doc.Routes) > 0 {
+		points = doc.Routes[0].Points
+	}
+	if len(points) < 2 {
+		return nil, fmt.Errorf("%s: no track or route with two or more points", filename)
+	}
+	line := make(geom.Line, len(points))
+	for i, p := range points {
+		line[i].X, line[i].Y = c.FromWGS84(p.Lon, p.Lat)
+	}
+	return line, nil
+}
+
+// readGeoJSONLine returns the positions of the LineStrings in a GeoJSON
+// file, joined in order.
+func readGeoJSONLine(filename string) (geom.Line, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	points, err := geojson.ReadPoints(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	if len(points) < 2 {
+		return nil, fmt.Errorf("%s: need two or more points", filename)
+	}
+	return geom.Line(points), nil
+}
+
+// writeProfileCSV writes a line for each sample giving its position, the
+// distance along the profile and the height, which is empty where there is
+// no data.
+func writeProfileCSV(w io.Writer, samples []profile.Sample) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"distance", "x", "y", "height"})
+	for _, s := range samples {
+		height := ""
+		if s.OK {
+			height = strconv.FormatFloat(s.Height, 'f', 3, 64)
+		}
+		out.Write([]string{strconv.FormatFloat(s.Distance, 'f', 3, 64),
+			strconv.FormatFloat(s.X, 'f', 3, 64), strconv.FormatFloat(s.Y, 'f', 3, 64), height})
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// writeProfilePNG draws a cross-section chart as a PNG file.
+func writeProfilePNG(filename string, samples []profile.Sample, width int, exaggeration float64) error {
+	img, err := render.ProfileImage(samples, width, exaggeration)
+	if err != nil {
+		return err
+	}
+	out, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	err = png.Encode(out, img)
+	if err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,453 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/goblimey/tiler/cache"
+	"github.com/goblimey/tiler/crs"
+	"github.com/goblimey/tiler/esri"
+	"github.com/goblimey/tiler/tile"
+)
+
+// serve sets up the serve command, which runs the tile server.  It returns
+// the flags of the command and the function that runs it once they are
+// parsed from the arguments that follow "serve" - flags and then the names
+// of the grid files.
+func serve() (*flag.FlagSet, func()) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("addr", ":8080", "address to listen on")
+	manifest := fs.String("manifest", "", "mosaic manifest listing the grid files")
+	mapDir := fs.String("mmap", "", "folder for binary copies of the grids, which are mapped into memory rather than read - for mosaics bigger than memory")
+	crsName := fs.String("crs", crs.Default, "coordinate reference system of the grids")
+	floor := fs.Float64("floor", 0.0, "minimum height expected")
+	ceiling := fs.Float64("ceiling", 0.0, "maximum height expected")
+	cacheSize := fs.Int("cache", 64, "size of the tile cache in megabytes - 0 turns it off")
+	drain := fs.Duration("drain", 5*time.Second, "time to keep serving after SIGTERM while reporting not ready")
+	apiKeyFile := fs.String("api-keys", "", "file of API keys, one per line, that may use the tiles")
+	basicAuthFile := fs.String("basic-auth", "", "file of name:password lines for basic authentication")
+	maxRenders := fs.Int("max-renders", 0, "most renders to run at once - 0 for no limit")
+	renderWait := fs.Duration("render-wait", 10*time.Second, "how long a render waits for a free slot under -max-renders")
+	renderTimeout := fs.Duration("render-timeout", 0, "longest a tile may take to draw, including waiting for a slot - 0 for no limit")
+	rate := fs.Float64("rate", 0, "requests per second allowed from each client - 0 for no limit")
+	burst := fs.Int("burst", 50, "requests a client can make in a burst under -rate")
+	trustProxy := fs.Bool("trust-proxy", false, "behind a proxy that appends to X-Forwarded-For - identify clients by it for -rate and take the scheme of the addresses sent to them from X-Forwarded-Proto")
+	proxyHops := fs.Int("proxy-hops", 1, "number of proxies in front of the server that append to X-Forwarded-For, under -trust-proxy")
+	maxUpload := fs.Int("max-upload", 64, "largest grid file accepted by /render in megabytes")
+	maxJobs := fs.Int("max-jobs", 8, "most asynchronous /render jobs waiting or running at once")
+	maxResults := fs.Int("max-results", 100, "most asynchronous /render jobs kept, finished or not - the oldest results are dropped first")
+	resultsSize := fs.Int("results-size", 256, "most megabytes of finished asynchronous /render results kept")
+	corsOrigins := fs.String("cors", "", "comma separated origins allowed to use the tiles from other sites - * for any")
+	cacheControl := fs.String("cache-control", "public, max-age=3600", "Cache-Control header sent with tiles")
+	tlsCert := fs.String("tls-cert", "", "certificate file - serve HTTPS with -tls-key")
+	tlsKey := fs.String("tls-key", "", "private key file for -tls-cert")
+	fillGaps := fs.Float64("fill-gaps", 0, "fill NODATA cells from the data up to this many map units away - 0 leaves them empty")
+	contourInterval := fs.Float64("contour-interval", 10, "height between contours in the vector tiles at full detail")
+	profile := fs.Bool("pprof", false, "serve profiling data under /debug/pprof/")
+	dryRun := fs.Bool("dry-run", false, "load the grids and say which tiles there would be at each zoom level, without serving them")
+	shutdownTimeout := fs.Duration("shutdown-timeout", 30*time.Second, "time allowed for requests in progress to finish")
+	smoothing := addSmoothFlags(fs)
+	transforms := addTransformFlag(fs)
+	logging := addLogFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: tiler serve [flags] [grid file ...]\n")
+		fs.PrintDefaults()
+	}
+	return fs, func() {
+		err := logging.setup()
+		if err != nil {
+			fatal(err.Error())
+		}
+		err = smoothing.check()
+		if err != nil {
+			fatal(err.Error())
+		}
+		err = transforms.check()
+		if err != nil {
+			fatal(err.Error())
+		}
+
+		flagset := make(map[string]bool)
+		fs.Visit(func(f *flag.Flag) { flagset[f.Name] = true })
+
+		c, err := crs.Lookup(*crsName)
+		if err != nil {
+			fatal(err.Error())
+		}
+
+		// An interrupt while the grids are loading stops the loading.  Once
+		// serving, the signals are handled as below.
+		ctx, cancel := commandContext(0)
+		ts, err := readTileSet(ctx, *manifest, fs.Args(), *mapDir)
+		cancel()
+		if err != nil {
+			fail(err)
+		}
+		if len(ts.Grids()) == 0 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		if *fillGaps > 0 || smoothing.filter != "" || len(transforms.transforms) > 0 {
+			var prepared []*esri.Grid
+			for _, g := range ts.Grids() {
+				if *fillGaps > 0 {
+					g = g.FillGaps(*fillGaps)
+				}
+				g, err = transforms.apply(context.Background(), smoothing.apply(g))
+				if err != nil {
+					fatal(err.Error())
+				}
+				prepared = append(prepared, g)
+			}
+			ts = esri.NewTileSet(prepared...)
+		}
+
+		server := newTileServer(ts, c)
+		if flagset["floor"] {
+			server.Floor = float32(*floor)
+		}
+		if flagset["ceiling"] {
+			server.Ceiling = float32(*ceiling)
+		}
+		if *dryRun {
+			server.plan(os.Stdout)
+			return
+		}
+		server.cacheControl = *cacheControl
+		if *contourInterval <= 0 {
+			fatal("-contour-interval must be greater than zero")
+		}
+		server.contourInterval = *contourInterval
+		server.limit = newRenderLimit(*maxRenders, *renderWait)
+		server.renderTimeout = *renderTimeout
+		server.trustProxy = *trustProxy
+		if *cacheSize > 0 {
+			server.cache = cache.New(*cacheSize * 1024 * 1024)
+		}
+
+		auth, err := loadAuthenticator(*apiKeyFile, *basicAuthFile)
+		if err != nil {
+			fail(readError(err))
+		}
+
+		cors := newCORSPolicy(*corsOrigins)
+		if *proxyHops < 1 {
+			fatal("-proxy-hops must be at least 1")
+		}
+		hops := 0
+		if *trustProxy {
+			hops = *proxyHops
+		}
+		limiter := newRateLimiter(*rate, *burst, hops)
+
+		m := server.metrics
+		mux := http.NewServeMux()
+		mux.Handle("/", m.instrument("viewer", viewerHandler{}))
+		mux.Handle("/tiles/", m.instrument("tiles", cors.wrap(limiter.wrap(auth.wrap(server)))))
+		wmts := m.instrument("wmts", cors.wrap(limiter.wrap(auth.wrap(&wmtsHandler{server}))))
+		mux.Handle("/wmts", wmts)
+		mux.Handle("/wmts/", wmts)
+		mux.Handle("/wms", m.instrument("wms", cors.wrap(limiter.wrap(auth.wrap(&wmsHandler{server})))))
+		for _, encoding := range []string{"terrain-rgb", "terrarium"} {
+			h := m.instrument(encoding, cors.wrap(limiter.wrap(auth.wrap(&demHandler{server, encoding}))))
+			mux.Handle("/"+encoding+"/", h)
+			mux.Handle("/"+encoding+".json", h)
+		}
+		utfgrid := m.instrument("utfgrid", cors.wrap(limiter.wrap(auth.wrap(&utfgridHandler{server}))))
+		mux.Handle("/utfgrid/", utfgrid)
+		mux.Handle("/utfgrid.json", utfgrid)
+		mux.Handle("/contours", m.instrument("contours", cors.wrap(limiter.wrap(auth.wrap(&contourHandler{server})))))
+		contourTiles := m.instrument("contour-tiles", cors.wrap(limiter.wrap(auth.wrap(&contourTileHandler{server}))))
+		mux.Handle("/contours/", contourTiles)
+		mux.Handle("/contours.json", contourTiles)
+		mux.Handle("/elevation", m.instrument("elevation", cors.wrap(limiter.wrap(auth.wrap(&elevationHandler{server})))))
+		renders := m.instrument("render", cors.wrap(limiter.wrap(auth.wrap(newRenderHandler(int64(*maxUpload)*1024*1024, server.limit, *renderTimeout, *maxJobs, *maxResults, int64(*resultsSize)*1024*1024, *trustProxy)))))
+		mux.Handle("/render", renders)
+		mux.Handle("/render/", renders)
+		mux.Handle(grpcService, m.instrument("grpc", limiter.wrap(auth.wrap(&grpcHandler{server}))))
+		mux.Handle("/metrics", &metricsHandler{server})
+		if *profile {
+			mux.Handle("/debug/pprof/", auth.wrap(http.HandlerFunc(pprof.Index)))
+			mux.Handle("/debug/pprof/cmdline", auth.wrap(http.HandlerFunc(pprof.Cmdline)))
+			mux.Handle("/debug/pprof/profile", auth.wrap(http.HandlerFunc(pprof.Profile)))
+			mux.Handle("/debug/pprof/symbol", auth.wrap(http.HandlerFunc(pprof.Symbol)))
+			mux.Handle("/debug/pprof/trace", auth.wrap(http.HandlerFunc(pprof.Trace)))
+		}
+		health := &healthHandler{}
+		mux.Handle("/healthz", health)
+		mux.Handle("/readyz", health)
+
+		httpServer := &http.Server{Addr: *addr, Handler: mux}
+		if *tlsCert == "" && *tlsKey == "" && !allowH2C(httpServer) {
+			slog.Warn("gRPC needs -tls-cert when built with this release of Go")
+		}
+
+		// On SIGTERM or an interrupt, report not ready so that load balancers
+		// stop sending requests, wait for the drain period, then finish the
+		// requests in progress and stop.
+		done := make(chan struct{})
+		go func() {
+			signals := make(chan os.Signal, 1)
+			signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+			sig := <-signals
+			slog.Info("draining", "signal", sig.String(), "drain", *drain)
+			health.setReady(false)
+			time.Sleep(*drain)
+			ctx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+			defer cancel()
+			err := httpServer.Shutdown(ctx)
+			if err != nil {
+				slog.Error("shutdown", "error", err)
+			}
+			close(done)
+		}()
+
+		slog.Info("serving", "grids", len(ts.Grids()), "addr", *addr,
+			"floor", server.Floor, "ceiling", server.Ceiling)
+		health.setReady(true)
+		if *tlsCert != "" || *tlsKey != "" {
+			err = httpServer.ListenAndServeTLS(*tlsCert, *tlsKey)
+		} else {
+			err = httpServer.ListenAndServe()
+		}
+		if err != http.ErrServerClosed {
+			fatal(err.Error())
+		}
+		<-done
+		slog.Info("stopped")
+	}
+}
+
+// healthHandler serves /healthz, which reports that the process is alive,
+// and /readyz, which reports whether it is willing to take requests.
+type healthHandler struct {
+	mutex sync.Mutex
+	ready bool
+}
+
+func (h *healthHandler) setReady(ready bool) {
+	h.mutex.Lock()
+	h.ready = ready
+	h.mutex.Unlock()
+}
+
+func (h *healthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	if r.URL.Path == "/readyz" {
+		h.mutex.Lock()
+		ready := h.ready
+		h.mutex.Unlock()
+		if !ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintln(w, "not ready")
+			return
+		}
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+// tileServer renders z/x/y PNG tiles on demand from a TileSet.
+type tileServer struct {
+	*tile.Renderer
+	cache   *cache.LRU // nil if caching is off.
+	metrics *serverMetrics
+	limit   *renderLimit // nil if renders are not limited.
+	// renderTimeout is the longest a tile may take to draw, or 0 for no
+	// limit.
+	renderTimeout time.Duration
+	// cacheControl is the Cache-Control header sent with tiles.
+	cacheControl string
+	// contourInterval is the height between contours in the vector tiles
+	// at the native zoom level.
+	contourInterval float64
+	// trustProxy says that X-Forwarded-Proto, from a proxy in front of
+	// the server, gives the scheme of the addresses sent to clients.
+	trustProxy bool
+}
+
+func newTileServer(ts *esri.TileSet, c crs.CRS) *tileServer {
+	s := tileServer{Renderer: tile.NewRenderer(ts, c), metrics: newServerMetrics(), contourInterval: 10}
+	return &s
+}
+
+// ServeHTTP handles requests of the form /tiles/{z}/{x}/{y}.png.
+func (s *tileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	z, x, y, err := parseTilePath(strings.TrimPrefix(r.URL.Path, "/tiles/"), ".png")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !tile.Valid(z, x, y) {
+		http.NotFound(w, r)
+		return
+	}
+	slog.Debug("tile", "z", z, "x", x, "y", y)
+
+	s.writeTile(w, r, "tiles", z, x, y, s.Tile)
+}
+
+// writeTile sends tile (z, x, y) as a PNG, taking it from the cache if it's
+// there and otherwise drawing it with render.  kind distinguishes the
+// different renderings of the same tile.
+func (s *tileServer) writeTile(w http.ResponseWriter, r *http.Request, kind string, z, x, y int,
+	render func(ctx context.Context, z, x, y int) (*image.RGBA, error)) {
+
+	s.writeCached(w, r, kind, "image/png", z, x, y, encodePNG(render))
+}
+
+// encodePNG returns a function that draws a tile with render and encodes
+// it as a PNG, for writeCached and cachedTile.
+func encodePNG(render func(ctx context.Context, z, x, y int) (*image.RGBA, error)) func(ctx context.Context, z, x, y int) ([]byte, error) {
+	return func(ctx context.Context, z, x, y int) ([]byte, error) {
+		img, err := render(ctx, z, x, y)
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		err = png.Encode(&buf, img)
+		return buf.Bytes(), err
+	}
+}
+
+// errBusy is returned by cachedTile when no render slot came free in time.
+var errBusy = errors.New("server busy")
+
+// writeCached sends tile (z, x, y), taking it from the cache if it's there
+// and otherwise making it with encode.  encode is given the context of the
+// request, limited to -render-timeout, so that it gives up if the client
+// goes away or the tile takes too long.
+func (s *tileServer) writeCached(w http.ResponseWriter, r *http.Request, kind, contentType string, z, x, y int,
+	encode func(ctx context.Context, z, x, y int) ([]byte, error)) {
+
+	ctx, cancel := s.renderContext(r)
+	defer cancel()
+	data, err := s.cachedTile(ctx, kind, z, x, y, encode)
+	if err == errBusy {
+		busy(w)
+		return
+	}
+	if r.Context().Err() != nil {
+		// The client has gone away, so there's no one to tell.
+		slog.Debug("tile abandoned", "tile", tileKey(kind, z, x, y), "error", r.Context().Err())
+		return
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		http.Error(w, "tile took too long to draw", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	if s.cacheControl != "" {
+		w.Header().Set("Cache-Control", s.cacheControl)
+	}
+	w.Write(data)
+}
+
+// cachedTile returns tile (z, x, y), taking it from the cache if it's
+// there and otherwise making it with encode, under the render limit, and
+// adding it to the cache.  It returns errBusy if no render slot came free
+// in time.
+func (s *tileServer) cachedTile(ctx context.Context, kind string, z, x, y int,
+	encode func(ctx context.Context, z, x, y int) ([]byte, error)) ([]byte, error) {
+
+	key := tileKey(kind, z, x, y)
+	if s.cache != nil {
+		if data, ok := s.cache.Get(key); ok {
+			return data, nil
+		}
+	}
+	if !s.limit.acquire(ctx) {
+		return nil, errBusy
+	}
+	start := time.Now()
+	data, err := encode(ctx, z, x, y)
+	s.metrics.observeRender(kind, time.Since(start))
+	s.limit.release()
+	if errors.Is(err, context.DeadlineExceeded) {
+		slog.Warn("tile timed out", "tile", key, "timeout", s.renderTimeout)
+		return nil, err
+	}
+	if err != nil {
+		if ctx.Err() == nil {
+			slog.Error("encoding tile", "tile", key, "error", err)
+		}
+		return nil, err
+	}
+	if s.cache != nil {
+		s.cache.Add(key, data)
+	}
+	return data, nil
+}
+
+// tileKey returns the cache key of a tile.
+func tileKey(kind string, z, x, y int) string {
+	return fmt.Sprintf("%s/%d/%d/%d", kind, z, x, y)
+}
+
+// renderContext returns the context for drawing the response to r - the
+// context of the request, limited to -render-timeout - and the function
+// that releases it.
+func (s *tileServer) renderContext(r *http.Request) (context.Context, context.CancelFunc) {
+	if s.renderTimeout > 0 {
+		return context.WithTimeout(r.Context(), s.renderTimeout)
+	}
+	return context.WithCancel(r.Context())
+}
+
+// plan writes the area covered by the grids and the tiles that cover it at
+// each zoom level up to the native zoom, which is what a client could ask
+// for and what seeding a cache would draw.
+func (s *tileServer) plan(w io.Writer) {
+	minX, minY, maxX, maxY := s.TileSet.Bounds()
+	west, south, east, north := s.WGS84Bounds()
+	native := s.NativeZoom()
+	fmt.Fprintf(w, "grids %d\nbounds %g,%g,%g,%g\nwgs84_bounds %.6f,%.6f,%.6f,%.6f\nfloor %g\nceiling %g\nnative_zoom %d\n",
+		len(s.TileSet.Grids()), minX, minY, maxX, maxY, west, south, east, north, s.Floor, s.Ceiling, native)
+	total := 0
+	for z := 0; z <= native; z++ {
+		x0, y0 := tile.Containing(z, west, north)
+		x1, y1 := tile.Containing(z, east, south)
+		n := (x1 - x0 + 1) * (y1 - y0 + 1)
+		total += n
+		fmt.Fprintf(w, "zoom %d tiles %d x %d-%d y %d-%d\n", z, n, x0, x1, y0, y1)
+	}
+	fmt.Fprintf(w, "tiles %d\n", total)
+}
+
+// parseTilePath parses "{z}/{x}/{y}" followed by the given suffix.
+func parseTilePath(path, suffix string) (z, x, y int, err error) {
+	if !strings.HasSuffix(path, suffix) {
+		return 0, 0, 0, fmt.Errorf("tile path %s - expected z/x/y%s", path, suffix)
+	}
+	field := strings.Split(strings.TrimSuffix(path, suffix), "/")
+	if len(field) != 3 {
+		return 0, 0, 0, fmt.Errorf("tile path %s - expected z/x/y%s", path, suffix)
+	}
+	var n [3]int
+	for i := range field {
+		n[i], err = strconv.Atoi(field[i])
+		if err != nil {
+			return 0, 0, 0, fmt.Errorf("tile path %s - %s", path, err.Error())
+		}
+	}
+	return n[0], n[1], n[2], nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/goblimey/tiler/esri"
+)
+
+// smoothOptions holds the smoothing flags shared by the commands that
+// render or contour grids.
+type smoothOptions struct {
+	filter string
+	size   float64
+}
+
+// addSmoothFlags registers -smooth and -smooth-size on fs.
+func addSmoothFlags(fs *flag.FlagSet) *smoothOptions {
+	o := new(smoothOptions)
+	fs.StringVar(&o.filter, "smooth", "", "smooth the heights first - gaussian or median")
+	fs.Float64Var(&o.size, "smooth-size", 2, "gaussian - standard deviation, median - radius, in map units")
+	return o
+}
+
+// check returns an error if the options are not valid.
+func (o *smoothOptions) check() error {
+	switch strings.ToLower(o.filter) {
+	case "", "gaussian", "median":
+	default:
+		return fmt.Errorf("unknown smoothing filter %q - expected gaussian or median", o.filter)
+	}
+	if o.size <= 0 {
+		return fmt.Errorf("-smooth-size %g must be greater than zero", o.size)
+	}
+	return nil
+}
+
+// apply returns g smoothed as the options say, or g itself if they don't
+// ask for smoothing.
+func (o *smoothOptions) apply(g *esri.Grid) *esri.Grid {
+	switch strings.ToLower(o.filter) {
+	case "gaussian":
+		return g.GaussianSmooth(o.size)
+	case "median":
+		return g.MedianSmooth(int(math.Round(o.size / float64(g.CellSize()))))
+	}
+	return g
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image/png"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/goblimey/tiler/crs"
+	"github.com/goblimey/tiler/esri"
+	"github.com/goblimey/tiler/render"
+	"github.com/goblimey/tiler/terrain"
+)
+
+// solar sets up the solar command, which works out how much sunlight falls
+// on each cell of a grid file over a day or a longer period and writes the
+// result as a picture or a grid file.  It returns the flags of the command
+// and the function that runs it once they are parsed from the arguments that
+// follow "solar".
+func solar() (*flag.FlagSet, func()) {
+	fs := flag.NewFlagSet("solar", flag.ExitOnError)
+	var input, output string
+	fs.StringVar(&input, "input", "", "data file")
+	fs.StringVar(&input, "i", "", "data file")
+	fs.StringVar(&output, "output", "", "PNG map or ESRI Grid (.asc) results file")
+	fs.StringVar(&output, "o", "", "PNG map or ESRI Grid (.asc) results file")
+	day := fs.Int("day", 172, "first day of the period - 1 is 1 January, 172 midsummer")
+	days := fs.Int("days", 1, "length of the period in days - 365 for a year")
+	step := fs.Float64("step", 30, "minutes between the positions of the sun worked out")
+	transmittance := fs.Float64("transmittance", 0.7, "fraction of the sunlight passing through the air with the sun overhead")
+	horizon := fs.Float64("horizon", 500, "how far in map units to look for hills casting shadows - 0 for none")
+	latitude := fs.Float64("latitude", 0, "latitude in degrees - found from the middle of the grid if not given")
+	crsName := fs.String("crs", crs.Default, "coordinate reference system of the grid")
+	bbox := fs.String("bbox", "", "area to cover - minX,minY,maxX,maxY in map coordinates")
+	overwrite := addOverwriteFlags(fs)
+	logging := addLogFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: tiler solar -i file -o file [flags]\n")
+		fs.PrintDefaults()
+	}
+	return fs, func() {
+		err := logging.setup()
+		if err != nil {
+			fatal(err.Error())
+		}
+		if input == "" || output == "" {
+			fs.Usage()
+			os.Exit(2)
+		}
+		err = overwrite.check(output)
+		if err != nil {
+			fatal(err.Error())
+		}
+		flagset := make(map[string]bool)
+		fs.Visit(func(f *flag.Flag) { flagset[f.Name] = true })
+
+		grid, err := esri.ReadGridFromFile(input)
+		if err != nil {
+			fail(readError(err))
+		}
+		if *bbox != "" {
+			minX, minY, maxX, maxY, err := parseBBox(*bbox)
+			if err != nil {
+				fatal(err.Error())
+			}
+			grid, err = grid.Crop(minX, minY, maxX, maxY)
+			if err != nil {
+				fatal(err.Error())
+			}
+		}
+		if !flagset["latitude"] {
+			c, err := crs.Lookup(*crsName)
+			if err != nil {
+				fatal(err.Error())
+			}
+			minX, minY, maxX, maxY := grid.Bounds()
+			_, *latitude = c.ToWGS84((minX+maxX)/2, (minY+maxY)/2)
+		}
+		slog.Info("working out sunlight", "latitude", *latitude, "day", *day, "days", *days)
+
+		result, err := terrain.Insolation(grid, terrain.SolarOptions{
+			Latitude:        *latitude,
+			Day:             *day,
+			Days:            *days,
+			Step:            *step,
+			Transmittance:   *transmittance,
+			HorizonDistance: *horizon,
+		})
+		if err != nil {
+			fatal(err.Error())
+		}
+		slog.Info("sunlight in kWh per square metre", "min", result.MinHeight(), "max", result.MaxHeight())
+
+		if strings.ToLower(filepath.Ext(output)) == ".asc" {
+			err = result.WriteToFile(output)
+			if err != nil {
+				fail(writeError(err))
+			}
+			return
+		}
+		out, err := os.Create(output)
+		if err != nil {
+			fail(writeError(err))
+		}
+		err = png.Encode(out, render.SolarImage(result))
+		if err != nil {
+			out.Close()
+			fail(writeError(err))
+		}
+		err = out.Close()
+		if err != nil {
+			fail(writeError(err))
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image/png"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/goblimey/tiler/esri"
+	"github.com/goblimey/tiler/render"
+)
+
+// histogramBar is the length in characters of the longest bar of a text
+// histogram.
+const histogramBar = 40
+
+// statistics sets up the stats command, which summarises the heights in grid
+// files, leaving out NODATA cells: the count, range, mean, standard
+// deviation, chosen percentiles and a histogram.  It returns the flags of
+// the command and the function that runs it once they are parsed from the
+// arguments that follow "stats" - flags and then the names of the grid
+// files.
+func statistics() (*flag.FlagSet, func()) {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	percentiles := fs.String("percentiles", "5,25,50,75,95", "comma separated percentiles to give - empty for none")
+	bins := fs.Int("bins", 10, "number of bars in the histogram - 0 for none")
+	combine := fs.Bool("combine", false, "summarise the heights of all the files together instead of each file")
+	pngFile := fs.String("png", "", "draw the histogram as a PNG picture in this file - needs one grid or -combine")
+	width := fs.Int("width", 800, "width of the -png picture in pixels - it's half as high")
+	overwrite := addOverwriteFlags(fs)
+	logging := addLogFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: tiler stats [flags] grid file ...\n")
+		fs.PrintDefaults()
+	}
+	return fs, func() {
+		err := logging.setup()
+		if err != nil {
+			fatal(err.Error())
+		}
+		if fs.NArg() == 0 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		err = overwrite.check(*pngFile)
+		if err != nil {
+			fatal(err.Error())
+		}
+		ps, err := parsePercentiles(*percentiles)
+		if err != nil {
+			fatal(err.Error())
+		}
+		if *pngFile != "" && fs.NArg() > 1 && !*combine {
+			fatal("-png draws one histogram - give one grid file or -combine")
+		}
+		if *pngFile != "" && *bins < 1 {
+			fatal("-png needs -bins greater than zero")
+		}
+
+		var names []string
+		var summaries []esri.Stats
+		var pooled []float32
+		for _, name := range fs.Args() {
+			g, err := readGridFile(name)
+			if err != nil {
+				fail(readError(err))
+			}
+			if *combine {
+				pooled = append(pooled, g.Heights()...)
+				continue
+			}
+			names = append(names, name)
+			summaries = append(summaries, g.Stats())
+		}
+		if *combine {
+			names = []string{strings.Join(fs.Args(), " ")}
+			summaries = []esri.Stats{esri.NewStats(pooled)}
+		}
+
+		for i, s := range summaries {
+			if i > 0 {
+				fmt.Println()
+			}
+			writeStats(os.Stdout, names[i], s, ps, *bins)
+		}
+
+		if *pngFile != "" {
+			s := summaries[0]
+			img, err := render.HistogramImage(s.Histogram(*bins), s.Min, s.Max, *width, *width/2)
+			if err != nil {
+				fatal(err.Error())
+			}
+			out, err := os.Create(*pngFile)
+			if err != nil {
+				fail(writeError(err))
+			}
+			err = png.Encode(out, img)
+			if err != nil {
+				fail(writeError(err))
+			}
+			err = out.Close()
+			if err != nil {
+				fail(writeError(err))
+			}
+			slog.Info("drawn histogram", "file", *pngFile)
+		}
+	}
+}
+
+// writeStats writes the summary s of the heights in the named file as lines
+// of name and value, followed by the given percentiles and a text
+// histogram with the given number of bars.
+func writeStats(w io.Writer, name string, s esri.Stats, percentiles []float64, bins int) {
+	fmt.Fprintf(w, "file %s\ncount %d\n", name, s.Count)
+	if s.Count == 0 {
+		return
+	}
+	fmt.Fprintf(w, "min %g\nmax %g\nmean %g\nstddev %g\n",
+		roundHeight(s.Min), roundHeight(s.Max), roundHeight(s.Mean), roundHeight(s.StdDev))
+	for _, p := range percentiles {
+		fmt.Fprintf(w, "%s %g\n", percentileName(p), roundHeight(s.Percentile(p)))
+	}
+
+	counts := s.Histogram(bins)
+	if counts == nil {
+		return
+	}
+	most := 0
+	for _, n := range counts {
+		if n > most {
+			most = n
+		}
+	}
+	// Line up the ranges and the bars.
+	binWidth := (s.Max - s.Min) / float64(len(counts))
+	lows := make([]string, len(counts))
+	highs := make([]string, len(counts))
+	lowWidth, highWidth := 0, 0
+	for i := range counts {
+		lows[i] = strconv.FormatFloat(s.Min+float64(i)*binWidth, 'f', 3, 64)
+		highs[i] = strconv.FormatFloat(s.Min+float64(i+1)*binWidth, 'f', 3, 64)
+		if len(lows[i]) > lowWidth {
+			lowWidth = len(lows[i])
+		}
+		if len(highs[i]) > highWidth {
+			highWidth = len(highs[i])
+		}
+	}
+	fmt.Fprintln(w, "histogram")
+	for i, n := range counts {
+		bar := strings.Repeat("#", n*histogramBar/most)
+		fmt.Fprintf(w, "%*s to %*s | %-*s %d\n", lowWidth, lows[i], highWidth, highs[i], histogramBar, bar, n)
+	}
+}
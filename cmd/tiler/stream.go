@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/goblimey/tiler/esri"
+	"github.com/goblimey/tiler/render"
+)
+
+// streamable returns true if rendering the input file to the output can be
+// done a row at a time by renderStream - a grey picture of the whole of an
+// ESRI ASCII grid file, with nothing done to the heights first.
+func streamable(input, output string) bool {
+	if input == "-" || strings.ToLower(filepath.Ext(input)) != ".asc" || isTemplate(output) {
+		return false
+	}
+	if strings.ToLower(filepath.Ext(output)) == ".asc" || (output == "-" && outputFormat == "asc") {
+		return false
+	}
+	if m := strings.ToLower(mode); m != "" && m != "grey" {
+		return false
+	}
+	if palette.ramp != nil {
+		return false
+	}
+	return bbox == "" && mask == "" && fillGaps == 0 && smoothing.filter == "" && len(transforms.transforms) == 0
+}
+
+// renderStream draws an ESRI ASCII grid file as a grey picture a row at a
+// time, reading a row of the grid as the PNG encoder asks for the row of
+// the picture, so that neither the whole grid nor the whole picture has to
+// be held in memory.  Unless -floor and -ceiling are both given, the file
+// is read twice - first to find the lowest and highest heights.  The
+// picture is the same as renderFile draws.  Cancelling ctx stops it.
+func renderStream(ctx context.Context, input, output string, t *stageTimer) error {
+	var scan heightScan
+	if !minHeightSet || !maxHeightSet {
+		t.stage("scan")
+		err := scan.read(ctx, input)
+		if err != nil {
+			return err
+		}
+		if !minHeightSet {
+			floor = scan.min - 0.1
+		}
+		if !maxHeightSet {
+			ceiling = scan.max + 0.1
+		}
+	}
+
+	t.stage("stream")
+	in, err := os.Open(input)
+	if err != nil {
+		return readError(err)
+	}
+	defer in.Close()
+	fi, err := in.Stat()
+	if err != nil {
+		return readError(err)
+	}
+	p := newProgress("drawing " + output)
+	defer p.finish()
+	rows, err := esri.NewRowReaderContext(ctx, esri.NewProgressReader(in, fi.Size(), p.update), input)
+	if err != nil {
+		return readError(err)
+	}
+	h := rows.Header()
+
+	slog.Info("creating image", "floor", floor, "ceiling", ceiling, "streaming", true)
+	img := &rowImage{
+		rows:   rows,
+		ncols:  h.Ncols,
+		nrows:  h.Nrows,
+		noData: float32(h.NoDataValue),
+		// Without the scan there's no knowing whether there are cells
+		// with no data, so the picture has an alpha channel anyway.
+		opaque: scan.done && !scan.noData,
+		trace:  traceEnabled(),
+		row:    -1,
+		pix:    make([]color.RGBA, h.Ncols),
+	}
+	err = writeOutput(ctx, output, func(out io.Writer) error {
+		err := png.Encode(out, img)
+		if img.err == nil {
+			// Check for lines after the last row.
+			rows.Next()
+		}
+		if img.err != nil {
+			return readError(fmt.Errorf("%s: %w", input, img.err))
+		}
+		return writeError(err)
+	})
+	if err != nil {
+		return err
+	}
+
+	slog.Info("done", "file", input, "nrows", h.Nrows, "ncols", h.Ncols,
+		"minHeight", img.heights.min, "maxHeight", img.heights.max,
+		"minShade", minShade, "maxShade", maxShade)
+	return nil
+}
+
+// heightScan is the lowest and highest heights of a grid, leaving out the
+// No Data value, and whether any cell holds No Data.
+type heightScan struct {
+	min, max float32
+	found    bool // min and max are set
+	noData   bool
+	done     bool // the whole grid was scanned
+}
+
+// add counts a row of heights in the scan.  A nil row, which is missing
+// from the grid, isn't counted, as it isn't in the heights of a Grid.
+func (s *heightScan) add(heights []float32, noData float32) {
+	for _, h := range heights {
+		if h == noData {
+			s.noData = true
+			continue
+		}
+		if !s.found || h < s.min {
+			s.min = h
+		}
+		if !s.found || h > s.max {
+			s.max = h
+		}
+		s.found = true
+	}
+}
+
+// read scans the heights of an ESRI ASCII grid file, stopping if ctx is
+// cancelled.
+func (s *heightScan) read(ctx context.Context, input string) error {
+	p := newProgress("scanning " + input)
+	defer p.finish()
+	var noData float32
+	err := esri.ReadGridFromFileFunc(input, func(row int, heights []float32) error {
+		s.add(heights, noData)
+		return nil
+	}, esri.WithContext(ctx), esri.WithProgress(p.update), esri.WithHeaderFunc(func(h esri.Header) error {
+		noData = float32(h.NoDataValue)
+		return nil
+	}))
+	if err != nil {
+		return readError(err)
+	}
+	s.done = true
+	return nil
+}
+
+// rowImage is a grey picture of a grid that is drawn a row at a time as
+// png.Encode asks for it.  The encoder asks for the pixels of a picture
+// that isn't interlaced a row at a time from the top, so only one row of
+// the grid and of the picture is held.  A failure to read the grid is
+// recorded in err, because At can't return it, and the rest of the picture
+// is left transparent.
+type rowImage struct {
+	rows         *esri.RowReader
+	ncols, nrows int
+	noData       float32
+	opaque       bool
+	trace        bool
+	row          int // the row in pix, -1 before the first
+	pix          []color.RGBA
+	heights      heightScan
+	err          error
+}
+
+func (m *rowImage) ColorModel() color.Model {
+	return color.RGBAModel
+}
+
+func (m *rowImage) Bounds() image.Rectangle {
+	return image.Rect(0, 0, m.ncols, m.nrows)
+}
+
+// Opaque saves png.Encode from looking at every pixel to find out.
+func (m *rowImage) Opaque() bool {
+	return m.opaque
+}
+
+func (m *rowImage) At(x, y int) color.Color {
+	for m.row < y && m.err == nil {
+		m.next()
+	}
+	if m.err != nil || y != m.row {
+		return color.RGBA{}
+	}
+	return m.pix[x]
+}
+
+// next reads the next row of the grid and draws it in pix.
+func (m *rowImage) next() {
+	heights, err := m.rows.Next()
+	if err == io.EOF {
+		err = fmt.Errorf("the grid ends after %d rows", m.row+1)
+	}
+	if err != nil {
+		m.err = err
+		return
+	}
+	m.row++
+	m.heights.add(heights, m.noData)
+	lo, hi := uint8(255), uint8(0)
+	shaded := false
+	for col := range m.pix {
+		// A missing row is zeros, as in the Grid that ReadGrid makes.
+		var height float32
+		if heights != nil {
+			height = heights[col]
+		}
+		if height == m.noData {
+			// Leave the pixel transparent.
+			m.pix[col] = color.RGBA{}
+			continue
+		}
+		c := render.Grey(floor, ceiling, height)
+		if c.Y < lo {
+			lo = c.Y
+		}
+		if c.Y > hi {
+			hi = c.Y
+		}
+		shaded = true
+		if m.trace {
+			slog.Log(context.Background(), esri.LevelTrace, "colouring cell", "row", m.row, "col", col, "colour", c)
+		}
+		m.pix[col] = color.RGBA{c.Y, c.Y, c.Y, 255}
+	}
+	if shaded {
+		recordShade(lo)
+		recordShade(hi)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/goblimey/tiler/crs"
+	"github.com/goblimey/tiler/esri"
+)
+
+// heightFields are the output template fields that need the heights in the
+// grid, not just its header.
+var heightFields = []string{"floor", "ceiling", "min", "max"}
+
+// isTemplate returns true if the name of a results file is a template, with
+// fields in braces such as {basename} to fill in.
+func isTemplate(name string) bool {
+	return strings.Contains(name, "{")
+}
+
+// templateUses returns true if the template has any of the named fields.
+func templateUses(template string, names ...string) bool {
+	for _, name := range names {
+		if strings.Contains(template, "{"+name+"}") {
+			return true
+		}
+	}
+	return false
+}
+
+// expandTemplate returns the template with each field in braces replaced by
+// its value from fields.  It's an error to use a field that has no value.
+func expandTemplate(template string, fields map[string]string) (string, error) {
+	var b strings.Builder
+	rest := template
+	for {
+		open := strings.IndexByte(rest, '{')
+		if open < 0 {
+			b.WriteString(rest)
+			return b.String(), nil
+		}
+		length := strings.IndexByte(rest[open:], '}')
+		if length < 0 {
+			return "", fmt.Errorf("template %s: { without }", template)
+		}
+		name := rest[open+1 : open+length]
+		value, ok := fields[name]
+		if !ok {
+			return "", fmt.Errorf("template %s: no value for {%s} - expected one of %s",
+				template, name, fieldNames(fields))
+		}
+		b.WriteString(rest[:open])
+		b.WriteString(value)
+		rest = rest[open+length+1:]
+	}
+}
+
+// fieldNames returns the names of the fields in braces, in order, for
+// messages.
+func fieldNames(fields map[string]string) string {
+	var names []string
+	for name := range fields {
+		names = append(names, "{"+name+"}")
+	}
+	sort.Strings(names)
+	return strings.Join(names, " ")
+}
+
+// gridFields returns the template fields that describe the input file and
+// the header h of the grid read from it: {basename}, the name of the file
+// without its folder or extension, the header values {ncols}, {nrows},
+// {xllcorner}, {yllcorner} and {cellsize}, and if the grid is on the
+// National Grid, {osgrid}, the grid reference of the 1 km square at its
+// bottom left corner, such as TQ1652.
+func gridFields(input string, h esri.Header) map[string]string {
+	base := filepath.Base(input)
+	fields := map[string]string{
+		"basename":  strings.TrimSuffix(base, filepath.Ext(base)),
+		"ncols":     strconv.Itoa(h.Ncols),
+		"nrows":     strconv.Itoa(h.Nrows),
+		"xllcorner": strconv.FormatFloat(float64(h.Xllcorner), 'f', -1, 32),
+		"yllcorner": strconv.FormatFloat(float64(h.Yllcorner), 'f', -1, 32),
+		"cellsize":  strconv.FormatFloat(float64(h.CellSize), 'f', -1, 32),
+	}
+	ref, err := crs.GridReference(float64(h.Xllcorner), float64(h.Yllcorner), 2)
+	if err == nil {
+		fields["osgrid"] = ref
+	}
+	return fields
+}
+
+// heightField formats a height for a template field.
+func heightField(h float32) string {
+	return strconv.FormatFloat(roundHeight(float64(h)), 'f', -1, 64)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/goblimey/tiler/crs"
+	"github.com/goblimey/tiler/esri"
+	"github.com/goblimey/tiler/pipeline"
+	"github.com/goblimey/tiler/qmesh"
+)
+
+// terrainTiles sets up the terrain command, which makes a tile set of Cesium
+// quantized-mesh terrain tiles, with layer.json describing them and
+// manifest.json recording how they were made - see pipeline.Manifest.  It
+// returns the flags of the command and the function that runs it once they
+// are parsed from the arguments that follow "terrain" - flags and then the
+// names of the grid files.
+func terrainTiles() (*flag.FlagSet, func()) {
+	fs := flag.NewFlagSet("terrain", flag.ExitOnError)
+	var outputDir string
+	fs.StringVar(&outputDir, "output-dir", "", "folder for the tiles and layer.json")
+	fs.StringVar(&outputDir, "o", "", "folder for the tiles and layer.json")
+	maxZoom := fs.Int("max-zoom", -1, "deepest zoom level to make tiles for - the native zoom of the grids if not given")
+	name := fs.String("name", "terrain", "name of the tile set, recorded in layer.json")
+	manifest := fs.String("manifest", "", "mosaic manifest listing the grid files")
+	mapDir := fs.String("mmap", "", "folder for binary copies of the grids, which are mapped into memory rather than read - for mosaics bigger than memory")
+	crsName := fs.String("crs", crs.Default, "coordinate reference system of the grids")
+	timeout := addTimeoutFlag(fs)
+	overwrite := addOverwriteFlags(fs)
+	logging := addLogFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: tiler terrain -o folder [flags] [grid file ...]\n")
+		fs.PrintDefaults()
+	}
+	return fs, func() {
+		err := logging.setup()
+		if err != nil {
+			fatal(err.Error())
+		}
+		if outputDir == "" {
+			fs.Usage()
+			os.Exit(2)
+		}
+		for _, name := range []string{"layer.json", "manifest.json"} {
+			err = overwrite.check(filepath.Join(outputDir, name))
+			if err != nil {
+				fatal(err.Error())
+			}
+		}
+		c, err := crs.Lookup(*crsName)
+		if err != nil {
+			fatal(err.Error())
+		}
+		ctx, cancel := commandContext(*timeout)
+		defer cancel()
+		m := pipeline.NewManifest()
+		inputs := fs.Args()
+		if *manifest != "" {
+			inputs, err = esri.ReadManifest(*manifest)
+			if err != nil {
+				fail(readError(err))
+			}
+		}
+		ts, err := readTileSet(ctx, *manifest, fs.Args(), *mapDir)
+		if err != nil {
+			fail(err)
+		}
+		if len(ts.Grids()) == 0 {
+			fs.Usage()
+			os.Exit(2)
+		}
+
+		if *maxZoom < 0 {
+			cellsize := math.Inf(1)
+			for _, g := range ts.Grids() {
+				cellsize = math.Min(cellsize, float64(g.CellSize()))
+			}
+			if c.Code() == "EPSG:4326" {
+				// Degrees to metres at the equator.
+				cellsize *= 2 * crs.MercatorExtent / 360
+			}
+			*maxZoom = qmesh.NativeZoom(cellsize)
+		}
+		if *maxZoom > qmesh.MaxZoom {
+			fatal(fmt.Sprintf("-max-zoom %d is more than %d", *maxZoom, qmesh.MaxZoom))
+		}
+		err = os.MkdirAll(outputDir, 0755)
+		if err != nil {
+			fail(writeError(err))
+		}
+		for _, filename := range inputs {
+			err = m.AddInput(filename)
+			if err != nil {
+				fail(readError(err))
+			}
+		}
+		m.Options = make(map[string]string)
+		fs.Visit(func(f *flag.Flag) { m.Options[f.Name] = f.Value.String() })
+		m.Options["max-zoom"] = strconv.Itoa(*maxZoom)
+		counts, err := qmesh.WriteTileset(ctx, outputDir, *name, ts, c, *maxZoom)
+		if err != nil {
+			fail(writeError(err))
+		}
+		for z, n := range counts {
+			m.AddTiles(z, n)
+		}
+		m.Finish()
+		err = m.WriteFile(filepath.Join(outputDir, "manifest.json"))
+		if err != nil {
+			fail(writeError(err))
+		}
+		slog.Info("done", "folder", outputDir, "maxZoom", *maxZoom, "tiles", m.Tiles)
+	}
+}
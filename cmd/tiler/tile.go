@@ -0,0 +1,145 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/png"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/goblimey/tiler/crs"
+	"github.com/goblimey/tiler/tile"
+)
+
+// drawTile sets up the tile command, which draws one web map tile as a PNG,
+// the same picture that serve would send for it.  It returns the flags of
+// the command and the function that runs it once they are parsed from the
+// arguments that follow "tile" - flags and then the names of the grid files.
+func drawTile() (*flag.FlagSet, func()) {
+	fs := flag.NewFlagSet("tile", flag.ExitOnError)
+	var output string
+	fs.StringVar(&output, "output", "", "PNG results file - {z}, {x} and {y} in the name are replaced by the tile's")
+	fs.StringVar(&output, "o", "", "PNG results file - {z}, {x} and {y} in the name are replaced by the tile's")
+	position := fs.String("tile", "", "the tile to draw - z/x/y")
+	at := fs.String("at", "", "draw the tile containing this point - lon,lat in WGS84 degrees - with -zoom")
+	zoom := fs.Int("zoom", -1, "zoom level for -at - the native zoom of the grids if not given")
+	encoding := fs.String("encoding", "grey", "how to draw the heights - grey, terrain-rgb or terrarium")
+	manifest := fs.String("manifest", "", "mosaic manifest listing the grid files")
+	mapDir := fs.String("mmap", "", "folder for binary copies of the grids, which are mapped into memory rather than read - for mosaics bigger than memory")
+	crsName := fs.String("crs", crs.Default, "coordinate reference system of the grids")
+	floor := fs.Float64("floor", 0.0, "minimum height expected")
+	ceiling := fs.Float64("ceiling", 0.0, "maximum height expected")
+	timeout := addTimeoutFlag(fs)
+	overwrite := addOverwriteFlags(fs)
+	logging := addLogFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: tiler tile -tile z/x/y -o tile.png [flags] [grid file ...]\n")
+		fs.PrintDefaults()
+	}
+	return fs, func() {
+		err := logging.setup()
+		if err != nil {
+			fatal(err.Error())
+		}
+		if output == "" || (*position == "") == (*at == "") {
+			fs.Usage()
+			os.Exit(2)
+		}
+		if !isTemplate(output) {
+			err = overwrite.check(output)
+			if err != nil {
+				fatal(err.Error())
+			}
+		}
+		if *encoding != "grey" && *encoding != "terrain-rgb" && *encoding != "terrarium" {
+			fatal("-encoding must be grey, terrain-rgb or terrarium", "encoding", *encoding)
+		}
+
+		flagset := make(map[string]bool)
+		fs.Visit(func(f *flag.Flag) { flagset[f.Name] = true })
+
+		c, err := crs.Lookup(*crsName)
+		if err != nil {
+			fatal(err.Error())
+		}
+		ctx, cancel := commandContext(*timeout)
+		defer cancel()
+		ts, err := readTileSet(ctx, *manifest, fs.Args(), *mapDir)
+		if err != nil {
+			fail(err)
+		}
+		if len(ts.Grids()) == 0 {
+			fs.Usage()
+			os.Exit(2)
+		}
+
+		server := newTileServer(ts, c)
+		if flagset["floor"] {
+			server.Floor = float32(*floor)
+		}
+		if flagset["ceiling"] {
+			server.Ceiling = float32(*ceiling)
+		}
+
+		var z, x, y int
+		if *position != "" {
+			z, x, y, err = parseTilePath(*position, "")
+			if err != nil {
+				fatal(err.Error())
+			}
+		} else {
+			p, err := parsePoint(*at)
+			if err != nil {
+				fatal(err.Error())
+			}
+			z = *zoom
+			if z < 0 {
+				z = server.NativeZoom()
+			}
+			x, y = tile.Containing(z, p.X, p.Y)
+		}
+		if !tile.Valid(z, x, y) {
+			fatal("no such tile", "z", z, "x", x, "y", y)
+		}
+		if isTemplate(output) {
+			output, err = expandTemplate(output, map[string]string{
+				"z": strconv.Itoa(z), "x": strconv.Itoa(x), "y": strconv.Itoa(y),
+			})
+			if err != nil {
+				fatal(err.Error())
+			}
+			err = overwrite.check(output)
+			if err != nil {
+				fatal(err.Error())
+			}
+			err = os.MkdirAll(filepath.Dir(output), 0755)
+			if err != nil {
+				fail(writeError(err))
+			}
+		}
+
+		var img *image.RGBA
+		if *encoding == "grey" {
+			img, err = server.Tile(ctx, z, x, y)
+		} else {
+			img, err = (&demHandler{server, *encoding}).renderTile(ctx, z, x, y)
+		}
+		if err != nil {
+			fail(err)
+		}
+
+		out, err := os.Create(output)
+		if err != nil {
+			fail(writeError(err))
+		}
+		defer out.Close()
+		err = png.Encode(out, img)
+		if err != nil {
+			fail(writeError(err))
+		}
+		slog.Info("done", "z", z, "x", x, "y", y, "covered", server.Covers(z, x, y))
+	}
+}
@@ -0,0 +1,647 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"github.com/goblimey/tiler/esri"
+	"github.com/goblimey/tiler/geojson"
+	"github.com/goblimey/tiler/geom"
+	"github.com/goblimey/tiler/render"
+	"github.com/goblimey/tiler/shapefile"
+)
+
+var filename string // The file to display.
+var output string   // The .png results file.
+var outputDir string // parameter - folder for the results of several input files.
+var dryRun bool // parameter - say what would be done without doing it.
+var timings bool // parameter - report the time and memory taken by each stage.
+var outputFormat string // parameter - png or asc, for the results in outputDir or on the standard output.
+var ceiling64 float64 // parameter - the maximum height expected.
+var ceiling float32	// ceiling as a float32
+var floor64 float64   // parameter - the minimum height expected.
+var floor float32	// floor as a float32
+var bbox string     // parameter - area to render, "minX,minY,maxX,maxY".
+var mask string     // parameter - GeoJSON or shapefile of polygons to clip to.
+var fillGaps float64 // parameter - how far to look for data to fill NODATA cells.
+var mode string     // parameter - what to draw, the heights or something derived from them.
+var radius float64  // parameter - neighbourhood size for -mode tpi and landform.
+var logging *logOptions // parameters - log level and format.
+var smoothing *smoothOptions // parameters - smoothing filter.
+var transforms *transformOptions // parameter - chain of named transforms.
+var palette *paletteOptions // parameter - colour ramp for the heights.
+var overwrite *overwriteOptions // parameters - whether to replace existing results files.
+var resume bool // a batch - skip results that are newer than their inputs.
+var report *reportOptions // parameters - where the report of a batch goes.
+var timeout *time.Duration // parameter - how long to allow before giving up.
+
+var maxHeight float64 = 0
+var maxHeightSet = false
+var minHeight float64 = 0
+var minHeightSet = false
+var maxShade uint8 = 0
+var maxShadeSet = false
+var minShade uint8 = 0
+var minShadeSet = false
+
+// addRenderFlags adds the flags of the render command to fs.
+func addRenderFlags(fs *flag.FlagSet) {
+	fs.StringVar(&filename, "input", "", "data file, a pattern such as 'data/*.asc' matching several, or - for the standard input")
+	fs.StringVar(&filename, "i", "", "data file, a pattern such as 'data/*.asc' matching several, or - for the standard input")
+	fs.StringVar(&output, "output", "", ".png results file, .asc for the grid that would be drawn, or - for the standard output")
+	fs.StringVar(&output, "o", "", ".png results file, .asc for the grid that would be drawn, or - for the standard output")
+	fs.StringVar(&outputDir, "output-dir", "", "folder for the results, named after the input files - for several input files")
+	fs.BoolVar(&dryRun, "dry-run", false, "say what would be read and written, reading only the grid headers, without drawing anything")
+	fs.BoolVar(&timings, "timings", false, "report the wall time and memory of the parse, transform, shade and encode stages of each file")
+	fs.StringVar(&outputFormat, "format", "png", "type of the results in -output-dir or on the standard output - png or asc")
+	addDrawFlags(fs)
+	logging = addLogFlags(fs)
+	overwrite = addOverwriteFlags(fs)
+	report = addReportFlags(fs)
+	timeout = addTimeoutFlag(fs)
+}
+
+// addDrawFlags adds the flags that say how to draw a grid, which the render
+// and watch commands share, to fs.
+func addDrawFlags(fs *flag.FlagSet) {
+	fs.Float64Var(&ceiling64, "ceiling", 0.0, "maximum height expected")
+	fs.Float64Var(&ceiling64, "c", 0.0, "maximum height expected")
+	fs.Float64Var(&floor64, "floor", 0.0, "mimimum height expected")
+	fs.Float64Var(&floor64, "f", 0.0, "minimum height expected")
+	fs.StringVar(&bbox, "bbox", "", "area to render - minX,minY,maxX,maxY in map coordinates")
+	fs.Float64Var(&fillGaps, "fill-gaps", 0, "fill NODATA cells from the data up to this many map units away - 0 leaves them empty")
+	fs.StringVar(&mode, "mode", "grey", "what to draw - "+strings.Join(render.Modes, ", "))
+	fs.Float64Var(&radius, "radius", 25, "size of the neighbourhood in map units for -mode tpi and landform")
+	fs.StringVar(&mask, "mask", "", "GeoJSON file or shapefile (.shp) of polygons - cells outside them are not drawn")
+	smoothing = addSmoothFlags(fs)
+	transforms = addTransformFlag(fs)
+	palette = addPaletteFlag(fs)
+}
+
+// checkDrawFlags checks the flags added by addDrawFlags once fs is parsed,
+// and notes whether the floor and ceiling were given.
+func checkDrawFlags(fs *flag.FlagSet) error {
+	err := smoothing.check()
+	if err != nil {
+		return err
+	}
+	err = transforms.check()
+	if err != nil {
+		return err
+	}
+	err = palette.check()
+	if err != nil {
+		return err
+	}
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "floor", "f":
+			floor = float32(floor64)
+			minHeightSet = true
+		case "ceiling", "c":
+			ceiling = float32(ceiling64)
+			maxHeightSet = true
+		}
+	})
+	return nil
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage(os.Stderr)
+		os.Exit(2)
+	}
+	// Before there were subcommands tiler only rendered, so a command line
+	// that starts with a flag is a render.
+	if strings.HasPrefix(os.Args[1], "-") {
+		findCommand("render").run(os.Args[1:])
+		return
+	}
+	c := findCommand(os.Args[1])
+	if c == nil {
+		fmt.Fprintf(os.Stderr, "tiler: unknown command %q\n", os.Args[1])
+		usage(os.Stderr)
+		os.Exit(2)
+	}
+	c.run(os.Args[2:])
+}
+
+// renderImage sets up the render command, which draws a grid as a greyscale
+// PNG, or as one of the derived pictures chosen by -mode.  It returns the
+// flags of the command and the function that runs it once they are parsed
+// from the arguments that follow "render".
+func renderImage() (*flag.FlagSet, func()) {
+	fs := flag.NewFlagSet("render", flag.ExitOnError)
+	addRenderFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: tiler render -i grid.asc -o picture.png [flags]\n"+
+			"       tiler render -output-dir folder [flags] grid file or pattern ...\n")
+		fs.PrintDefaults()
+	}
+	return fs, func() {
+		err := logging.setup()
+		if err != nil {
+			fatal(err.Error())
+		}
+		err = checkDrawFlags(fs)
+		if err != nil {
+			fatal(err.Error())
+		}
+		err = report.check()
+		if err != nil {
+			fatal(err.Error())
+		}
+
+		// filename = "TT"
+		// output := "tile.png"
+
+		inputs := fs.Args()
+		if filename != "" {
+			inputs = append([]string{filename}, inputs...)
+		}
+		inputs, err = expandInputs(inputs)
+		if err != nil {
+			fail(err)
+		}
+		if len(inputs) == 0 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		if outputFormat != "png" && outputFormat != "asc" {
+			fatal("-format must be png or asc", "format", outputFormat)
+		}
+		var outputs []string
+		if outputDir == "" {
+			if len(inputs) > 1 && !isTemplate(output) {
+				fatal("several input files need -output-dir, or -o with a template such as {basename}.png", "files", len(inputs))
+			}
+			for range inputs {
+				outputs = append(outputs, output)
+			}
+		} else {
+			if output != "" {
+				fatal("give -o or -output-dir, not both")
+			}
+			for _, input := range inputs {
+				if input == "-" {
+					fatal("the standard input can't be used with -output-dir")
+				}
+				outputs = append(outputs, derivedName(input, outputDir, "."+outputFormat))
+			}
+		}
+
+		// In a batch, results that are newer than their inputs are skipped and
+		// older ones are made again, so that running a batch again only does
+		// what's left.  Templates are checked when they are filled in.
+		resume = len(inputs) > 1 || outputDir != ""
+		for i, name := range outputs {
+			if isTemplate(name) {
+				continue
+			}
+			if resume && (overwrite.upToDate(name, inputs[i], mask) || overwrite.outOfDate(name, inputs[i], mask)) {
+				continue
+			}
+			err = overwrite.check(name)
+			if err != nil {
+				fatal(err.Error())
+			}
+		}
+
+		if dryRun {
+			err = planRender(os.Stdout, inputs, outputs)
+			if err != nil {
+				fatal(err.Error())
+			}
+			return
+		}
+		// An interrupt or -timeout stops the file being drawn.  In a batch the
+		// files not yet drawn are reported as failed.
+		ctx, cancel := commandContext(*timeout)
+		defer cancel()
+		if !resume {
+			err = renderFile(ctx, inputs[0], outputs[0])
+			if err != nil {
+				fail(err, "file", inputs[0])
+			}
+			return
+		}
+
+		// A bad file doesn't stop a batch.  The report at the end says which
+		// files failed and why.
+		var r batchReport
+		for i, input := range inputs {
+			err = renderFile(ctx, input, outputs[i])
+			if err != nil && !errors.Is(err, errUpToDate) {
+				slog.Error(err.Error(), "file", input)
+			}
+			r.add(input, outputs[i], err)
+		}
+		err = r.writeFile(report)
+		if err != nil {
+			fail(err)
+		}
+		if status := r.status(); status != 0 {
+			os.Exit(status)
+		}
+	}
+}
+
+// planRender writes what rendering each of the inputs to the matching
+// output would do, reading only the grid headers where it can, and the
+// totals.  PNG pictures are at most four bytes a pixel and usually much
+// less, and ESRI ASCII grids about eight bytes a cell.
+func planRender(w io.Writer, inputs, outputs []string) error {
+	var minX, minY, maxX, maxY float32
+	if bbox != "" {
+		var err error
+		minX, minY, maxX, maxY, err = parseBBox(bbox)
+		if err != nil {
+			return err
+		}
+	}
+	files := 0
+	var bytes int64
+	for i, input := range inputs {
+		if input == "-" {
+			fmt.Fprintf(w, "would read a grid from the standard input and write %s\n", outputs[i])
+			files++
+			continue
+		}
+		h, err := readGridHeader(input)
+		if err != nil {
+			return err
+		}
+		ncols, nrows := h.Ncols, h.Nrows
+		if bbox != "" {
+			ncols, nrows = h.CropSize(minX, minY, maxX, maxY)
+			if ncols == 0 {
+				fmt.Fprintf(w, "would fail on %s - the bounding box doesn't overlap it\n", input)
+				continue
+			}
+		}
+		name := outputs[i]
+		if isTemplate(name) {
+			name, err = outputName(name, input, h, nil)
+			if err != nil {
+				return err
+			}
+		}
+		if resume && overwrite.upToDate(name, input, mask) {
+			fmt.Fprintf(w, "would skip %s - %s is up to date\n", input, name)
+			continue
+		}
+		asc := strings.ToLower(filepath.Ext(name)) == ".asc" || (name == "-" && outputFormat == "asc")
+		size := int64(ncols) * int64(nrows) * 4
+		estimate := "at most"
+		if asc {
+			size = int64(ncols) * int64(nrows) * 8
+			estimate = "about"
+		}
+		fmt.Fprintf(w, "would read %s (%d x %d cells of %g) and write %s (%d x %d, %s %s)\n",
+			input, h.Ncols, h.Nrows, h.CellSize, name, ncols, nrows, estimate, byteCount(size))
+		files++
+		bytes += size
+	}
+	plural := "s"
+	if files == 1 {
+		plural = ""
+	}
+	fmt.Fprintf(w, "would write %d file%s, %s in all\n", files, plural, byteCount(bytes))
+	return nil
+}
+
+// outputName fills in the template for the name of the results of rendering
+// the input file.  h is the header of the grid to be drawn and g the grid
+// itself, with the floor and ceiling set, or nil for a dry run.  Without the
+// grid, the fields that need its heights are left in the name unless the
+// floor and ceiling flags give them.
+func outputName(template, input string, h esri.Header, g *esri.Grid) (string, error) {
+	fields := gridFields(input, h)
+	fields["mode"] = mode
+	if g != nil {
+		fields["min"] = heightField(g.MinHeight())
+		fields["max"] = heightField(g.MaxHeight())
+		fields["floor"] = heightField(floor)
+		fields["ceiling"] = heightField(ceiling)
+	} else {
+		for _, name := range heightFields {
+			fields[name] = "{" + name + "}"
+		}
+		if minHeightSet {
+			fields["floor"] = heightField(floor)
+		}
+		if maxHeightSet {
+			fields["ceiling"] = heightField(ceiling)
+		}
+	}
+	return expandTemplate(template, fields)
+}
+
+// readGridHeader returns the header of a grid file.  Only the header of an
+// ESRI ASCII grid is read, but the other formats are read whole.
+func readGridHeader(filename string) (esri.Header, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".flt", ".hdr", ".tif", ".tiff", ".tgrid":
+		g, err := readGridFile(filename)
+		if err != nil {
+			return esri.Header{}, err
+		}
+		return g.Header(), nil
+	}
+	return esri.ReadHeaderFromFile(filename)
+}
+
+// byteCount returns n as a number of bytes for people to read, such as
+// "4.0 MB".
+func byteCount(n int64) string {
+	const unit = 1000
+	if n < unit {
+		return fmt.Sprintf("%d bytes", n)
+	}
+	value := float64(n) / unit
+	for _, prefix := range []string{"kB", "MB", "GB", "TB"} {
+		if value < unit || prefix == "TB" {
+			return fmt.Sprintf("%.1f %s", value, prefix)
+		}
+		value /= unit
+	}
+	return ""
+}
+
+// renderFile draws the grid in the input file as configured by the render
+// flags and writes the picture, or with a .asc output the grid that would
+// be drawn, to the output file.  In a batch it returns errUpToDate if the
+// output is newer than the input.  If ctx is cancelled it gives up, leaving
+// the output as it was, so that a half written file isn't taken to be up
+// to date.
+func renderFile(ctx context.Context, input, output string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if resume && overwrite.upToDate(output, input, mask) {
+		slog.Info("up to date - skipping", "file", input, "output", output)
+		return errUpToDate
+	}
+	t := newStageTimer(input)
+	defer t.finish()
+	if streamable(input, output) {
+		return renderStream(ctx, input, output, t)
+	}
+	grid, err := prepareGrid(ctx, input, t)
+	if err != nil {
+		return err
+	}
+
+	if isTemplate(output) {
+		output, err = outputName(output, input, grid.Header(), grid)
+		if err != nil {
+			return err
+		}
+		if resume && overwrite.upToDate(output, input, mask) {
+			slog.Info("up to date - skipping", "file", input, "output", output)
+			return errUpToDate
+		}
+		if !resume || !overwrite.outOfDate(output, input, mask) {
+			err = overwrite.check(output)
+		}
+		if err != nil {
+			return err
+		}
+		err = os.MkdirAll(filepath.Dir(output), 0755)
+		if err != nil {
+			return writeError(err)
+		}
+	}
+
+	if strings.ToLower(filepath.Ext(output)) == ".asc" || (output == "-" && outputFormat == "asc") {
+		t.stage("encode")
+		return writeOutput(ctx, output, func(out io.Writer) error {
+			return writeError(grid.Write(out))
+		})
+	}
+
+	t.stage("shade")
+	img, err := drawPicture(ctx, grid, output)
+	if err != nil {
+		return err
+	}
+	slog.Info("encoding image")
+	t.stage("encode")
+	err = writeOutput(ctx, output, func(out io.Writer) error {
+		return writeError(png.Encode(out, img))
+	})
+	if err != nil {
+		return err
+	}
+
+	slog.Info("done", "file", input, "nrows", grid.Nrows(), "ncols", grid.Ncols(),
+		"minHeight", grid.MinHeight(), "maxHeight", grid.MaxHeight(),
+		"minShade", minShade, "maxShade", maxShade)
+	return nil
+}
+
+// prepareGrid reads the grid in the input file and does to it what the
+// draw flags ask for - cropping, filling, smoothing, transforming, masking
+// and deriving what -mode draws.  Unless they were given, it sets the floor
+// and ceiling from the heights.
+func prepareGrid(ctx context.Context, input string, t *stageTimer) (*esri.Grid, error) {
+	t.stage("parse")
+	grid, err := readGridFileContext(ctx, input)
+	if err != nil {
+		return nil, readError(err)
+	}
+
+	t.stage("transform")
+
+	if bbox != "" {
+		minX, minY, maxX, maxY, err := parseBBox(bbox)
+		if err != nil {
+			return nil, err
+		}
+		grid, err = grid.Crop(minX, minY, maxX, maxY)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if fillGaps > 0 {
+		grid = grid.FillGaps(fillGaps)
+	}
+	grid = smoothing.apply(grid)
+	grid, err = transforms.apply(ctx, grid)
+	if err != nil {
+		return nil, err
+	}
+
+	if mask != "" {
+		polygons, err := readPolygons(mask)
+		if err != nil {
+			return nil, readError(err)
+		}
+		grid, err = grid.Mask(polygons)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	grid, err = render.Derive(mode, grid, radius)
+	if err != nil {
+		return nil, err
+	}
+
+	// If floor or ceiling not already set, set them from the data.
+	if !minHeightSet {
+		floor = grid.MinHeight() - 0.1
+	}
+
+	if !maxHeightSet {
+		ceiling = grid.MaxHeight() + 0.1
+	}
+	return grid, nil
+}
+
+// drawPicture draws a grid made by prepareGrid as the draw flags ask for -
+// the picture of -mode, the heights coloured with -palette or, failing
+// those, the heights in grey.  output names the picture in the progress
+// reports.
+func drawPicture(ctx context.Context, grid *esri.Grid, output string) (*image.RGBA, error) {
+	if img := render.ModeImage(mode, grid); img != nil {
+		slog.Info("creating image", "mode", mode)
+		return img, nil
+	}
+
+	if palette.ramp != nil {
+		slog.Info("creating image", "floor", floor, "ceiling", ceiling, "palette", palette.spec)
+		return render.HeightImage(grid, render.WithContext(ctx), render.WithRange(floor, ceiling),
+			render.WithPalette(palette.ramp))
+	}
+
+	slog.Info("creating image", "floor", floor, "ceiling", ceiling)
+	trace := traceEnabled()
+	img := image.NewRGBA(image.Rect(0, 0, grid.Ncols(), grid.Nrows()))
+	p := newProgress("drawing " + output)
+	// The rows are shaded at the same time, so the progress and the
+	// lightest and darkest shades are recorded under mu once a row is done.
+	var mu sync.Mutex
+	var rowsDone int64
+	err := render.RowsContext(ctx, grid.Nrows(), func(row int) {
+		pix := render.RowPix(img, row)
+		lo, hi := uint8(255), uint8(0)
+		shaded := false
+		for col := 0; col < grid.Ncols(); col++ {
+			if grid.IsNoData(row, col) {
+				// Leave the pixel transparent.
+				continue
+			}
+			c := render.Grey(floor, ceiling, grid.Height(row, col))
+			if c.Y < lo {
+				lo = c.Y
+			}
+			if c.Y > hi {
+				hi = c.Y
+			}
+			shaded = true
+			if trace {
+				slog.Log(context.Background(), esri.LevelTrace, "colouring cell", "row", row, "col", col, "colour", c)
+			}
+			render.SetPixel(pix, col, color.RGBA{c.Y, c.Y, c.Y, 255})
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if shaded {
+			recordShade(lo)
+			recordShade(hi)
+		}
+		rowsDone++
+		p.update(rowsDone, int64(grid.Nrows()))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+// recordShade counts shade in the lightest and darkest shades drawn.
+func recordShade(shade uint8) {
+	if maxShadeSet {
+		if shade > maxShade {
+			maxShade = shade
+		}
+	} else {
+		maxShade = shade
+		maxShadeSet = true
+	}
+	if minShadeSet {
+		if shade < minShade {
+			minShade = shade
+		}
+	} else {
+		minShade = shade
+		minShadeSet = true
+	}
+}
+
+// parseBBox parses a bounding box given as "minX,minY,maxX,maxY".
+func parseBBox(s string) (minX, minY, maxX, maxY float32, err error) {
+	field := strings.Split(s, ",")
+	if len(field) != 4 {
+		return 0, 0, 0, 0, fmt.Errorf("bbox %s - expected minX,minY,maxX,maxY", s)
+	}
+	var v [4]float32
+	for i := range field {
+		_, err = fmt.Sscanf(strings.TrimSpace(field[i]), "%f", &v[i])
+		if err != nil {
+			return 0, 0, 0, 0, fmt.Errorf("bbox %s - %s", s, err.Error())
+		}
+	}
+	return v[0], v[1], v[2], v[3], nil
+}
+
+// readPolygons reads polygons from a shapefile if the name ends in .shp,
+// otherwise from a GeoJSON file.
+func readPolygons(filename string) ([]geom.Polygon, error) {
+	if strings.ToLower(filepath.Ext(filename)) == ".shp" {
+		return shapefile.ReadPolygonsFromFile(filename)
+	}
+	return geojson.ReadPolygonsFromFile(filename)
+}
+
+// expandInputs replaces the patterns among the names of input files, such
+// as data/*.asc, by the names of the files they match, in order.  It's an
+// error for a pattern to match nothing.
+func expandInputs(names []string) ([]string, error) {
+	var result []string
+	for _, name := range names {
+		if !strings.ContainsAny(name, "*?[") {
+			result = append(result, name)
+			continue
+		}
+		matches, err := filepath.Glob(name)
+		if err != nil {
+			return nil, fmt.Errorf("pattern %s: %w", name, err)
+		}
+		if len(matches) == 0 {
+			return nil, &exitError{exitMissingInput, fmt.Errorf("pattern %s matches no files", name)}
+		}
+		result = append(result, matches...)
+	}
+	return result, nil
+}
+
+// derivedName returns the name of the file in dir for the results from the
+// input file - the input's name with its extension replaced by ext.
+func derivedName(input, dir, ext string) string {
+	base := filepath.Base(input)
+	return filepath.Join(dir, strings.TrimSuffix(base, filepath.Ext(base))+ext)
+}
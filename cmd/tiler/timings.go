@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"time"
+)
+
+// stageTime is the wall time and memory used by one stage of rendering a
+// file.
+type stageTime struct {
+	name      string
+	wall      time.Duration
+	allocated uint64 // bytes allocated during the stage
+	heap      uint64 // bytes of live heap at the end of the stage
+}
+
+// stageTimer measures the stages of rendering a file - parse, transform,
+// shade and encode - for -timings.  A nil stageTimer measures nothing, so
+// the calls can be made whether or not -timings was given.
+type stageTimer struct {
+	file   string
+	w      io.Writer
+	stages []stageTime
+	name   string // the stage being measured
+	start  time.Time
+	mem    runtime.MemStats // at the start of the stage
+}
+
+// newStageTimer is a factory method that returns a stageTimer for the
+// input file that writes its report on the standard error, or nil if
+// -timings was not given.
+func newStageTimer(file string) *stageTimer {
+	if !timings {
+		return nil
+	}
+	return &stageTimer{file: file, w: os.Stderr}
+}
+
+// stage ends the stage being measured, if any, and starts the named one.
+func (t *stageTimer) stage(name string) {
+	if t == nil {
+		return
+	}
+	t.end()
+	t.name = name
+	runtime.ReadMemStats(&t.mem)
+	t.start = time.Now()
+}
+
+// end records the stage being measured.
+func (t *stageTimer) end() {
+	if t.name == "" {
+		return
+	}
+	wall := time.Since(t.start)
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	t.stages = append(t.stages, stageTime{t.name, wall, mem.TotalAlloc - t.mem.TotalAlloc, mem.HeapAlloc})
+	t.name = ""
+}
+
+// finish ends the last stage and writes the report - a line for each stage
+// and the total.
+func (t *stageTimer) finish() {
+	if t == nil {
+		return
+	}
+	t.end()
+	var total time.Duration
+	var allocated uint64
+	fmt.Fprintf(t.w, "timings for %s:\n", t.file)
+	fmt.Fprintf(t.w, "  %-10s %12s %12s %12s\n", "stage", "wall time", "allocated", "heap")
+	for _, s := range t.stages {
+		fmt.Fprintf(t.w, "  %-10s %12s %12s %12s\n", s.name, s.wall.Round(time.Microsecond),
+			byteCount(int64(s.allocated)), byteCount(int64(s.heap)))
+		total += s.wall
+		allocated += s.allocated
+	}
+	fmt.Fprintf(t.w, "  %-10s %12s %12s\n", "total", total.Round(time.Microsecond), byteCount(int64(allocated)))
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/goblimey/tiler/crs"
+	"github.com/goblimey/tiler/esri"
+	"github.com/goblimey/tiler/geom"
+	"github.com/goblimey/tiler/gpx"
+	"github.com/goblimey/tiler/profile"
+)
+
+// path is a track or route from a GPX file, with the segment each point
+// belongs to.
+type path struct {
+	name     string
+	points   []*gpx.Point
+	segments []int
+}
+
+// track sets up the track command, which looks up the height of the ground
+// under each point of the tracks and routes in a GPX file and writes them
+// out again as GPX or CSV.  It returns the flags of the command and the
+// function that runs it once they are parsed from the arguments that follow
+// "track" - flags and then the names of the grid files.
+func track() (*flag.FlagSet, func()) {
+	fs := flag.NewFlagSet("track", flag.ExitOnError)
+	var input, output string
+	fs.StringVar(&input, "gpx", "", "GPX file holding the tracks")
+	fs.StringVar(&output, "output", "", "GPX or CSV (.csv) results file - the standard output if not given")
+	fs.StringVar(&output, "o", "", "GPX or CSV (.csv) results file - the standard output if not given")
+	manifest := fs.String("manifest", "", "mosaic manifest listing the grid files")
+	crsName := fs.String("crs", crs.Default, "coordinate reference system of the grids")
+	overwrite := addOverwriteFlags(fs)
+	logging := addLogFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: tiler track -gpx file [flags] [grid file ...]\n")
+		fs.PrintDefaults()
+	}
+	return fs, func() {
+		err := logging.setup()
+		if err != nil {
+			fatal(err.Error())
+		}
+		if input == "" {
+			fs.Usage()
+			os.Exit(2)
+		}
+		err = overwrite.check(output)
+		if err != nil {
+			fatal(err.Error())
+		}
+
+		c, err := crs.Lookup(*crsName)
+		if err != nil {
+			fatal(err.Error())
+		}
+		doc, err := gpx.ReadFromFile(input)
+		if err != nil {
+			fail(readError(err))
+		}
+		var ts *esri.TileSet
+		if *manifest != "" {
+			ts, err = esri.ReadTileSetFromManifest(*manifest)
+		} else {
+			ts, err = esri.ReadTileSetFromFiles(fs.Args())
+		}
+		if err != nil {
+			fail(readError(err))
+		}
+		if len(ts.Grids()) == 0 {
+			fs.Usage()
+			os.Exit(2)
+		}
+
+		var paths []path
+		for i := range doc.Tracks {
+			t := &doc.Tracks[i]
+			p := path{name: t.Name}
+			for s := range t.Segments {
+				for j := range t.Segments[s].Points {
+					p.points = append(p.points, &t.Segments[s].Points[j])
+					p.segments = append(p.segments, s+1)
+				}
+			}
+			paths = append(paths, p)
+		}
+		for i := range doc.Routes {
+			r := &doc.Routes[i]
+			p := path{name: r.Name}
+			for j := range r.Points {
+				p.points = append(p.points, &r.Points[j])
+				p.segments = append(p.segments, 1)
+			}
+			paths = append(paths, p)
+		}
+		if len(paths) == 0 {
+			fatal(input + ": no tracks or routes")
+		}
+
+		heights := make([][]profile.Sample, len(paths))
+		for i, p := range paths {
+			line := make(geom.Line, len(p.points))
+			for j, pt := range p.points {
+				line[j].X, line[j].Y = c.FromWGS84(pt.Lon, pt.Lat)
+			}
+			heights[i] = profile.Points(ts, line)
+			summarise(p, heights[i])
+		}
+
+		if strings.ToLower(filepath.Ext(output)) == ".csv" {
+			out, err := os.Create(output)
+			if err != nil {
+				fail(writeError(err))
+			}
+			err = writeTrackCSV(out, paths, heights)
+			if err != nil {
+				out.Close()
+				fail(writeError(err))
+			}
+			err = out.Close()
+			if err != nil {
+				fail(writeError(err))
+			}
+			return
+		}
+
+		// Replace the GPS elevations with the ground heights, where known.
+		for i, p := range paths {
+			for j, pt := range p.points {
+				if heights[i][j].OK {
+					h := roundHeight(heights[i][j].Height)
+					pt.Ele = &h
+				}
+			}
+		}
+		for i := range doc.Waypoints {
+			wpt := &doc.Waypoints[i]
+			x, y := c.FromWGS84(wpt.Lon, wpt.Lat)
+			h, ok := ts.InterpolatedHeightAt(x, y)
+			if ok {
+				v := roundHeight(float64(h))
+				wpt.Ele = &v
+			}
+		}
+		if output == "" {
+			err = doc.Write(os.Stdout)
+		} else {
+			err = doc.WriteToFile(output)
+		}
+		if err != nil {
+			fail(writeError(err))
+		}
+	}
+}
+
+// roundHeight rounds a height to the nearest millimetre, so that it doesn't
+// carry the noise of the conversion from float32.
+func roundHeight(h float64) float64 {
+	return math.Round(h*1000) / 1000
+}
+
+// summarise logs the length of p, the ascent and descent over the ground
+// and, if the GPX file gave elevations, by the GPS.
+func summarise(p path, heights []profile.Sample) {
+	if len(heights) == 0 {
+		return
+	}
+	gps := make([]profile.Sample, len(heights))
+	missing := 0
+	differences := 0
+	sum := 0.0
+	for i, pt := range p.points {
+		if !heights[i].OK {
+			missing++
+		}
+		if pt.Ele != nil {
+			gps[i] = profile.Sample{Height: *pt.Ele, OK: true}
+			if heights[i].OK {
+				differences++
+				sum += *pt.Ele - heights[i].Height
+			}
+		}
+	}
+	ascent, descent := profile.Climb(heights)
+	attrs := []interface{}{"name", p.name, "points", len(p.points), "noData", missing,
+		"distance", heights[len(heights)-1].Distance, "ascent", ascent, "descent", descent}
+	if differences > 0 {
+		gpsAscent, gpsDescent := profile.Climb(gps)
+		attrs = append(attrs, "gpsAscent", gpsAscent, "gpsDescent", gpsDescent,
+			"meanGPSError", sum/float64(differences))
+	}
+	slog.Info("track", attrs...)
+}
+
+// writeTrackCSV writes a line for each point of the paths, giving its
+// position, the distance along the path, the GPS elevation, the height of
+// the ground and the difference between them.  Unknown values are left
+// empty.
+func writeTrackCSV(w io.Writer, paths []path, heights [][]profile.Sample) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"track", "segment", "lat", "lon", "x", "y", "distance", "time",
+		"gps_ele", "ground_ele", "difference"})
+	format := func(v float64, precision int) string {
+		return strconv.FormatFloat(v, 'f', precision, 64)
+	}
+	for i, p := range paths {
+		name := p.name
+		if name == "" {
+			name = strconv.Itoa(i + 1)
+		}
+		for j, pt := range p.points {
+			h := heights[i][j]
+			var gpsEle, groundEle, difference string
+			if pt.Ele != nil {
+				gpsEle = format(*pt.Ele, -1)
+			}
+			if h.OK {
+				groundEle = format(h.Height, 3)
+				if pt.Ele != nil {
+					difference = format(*pt.Ele-h.Height, 3)
+				}
+			}
+			out.Write([]string{name, strconv.Itoa(p.segments[j]),
+				format(pt.Lat, -1), format(pt.Lon, -1), format(h.X, 3), format(h.Y, 3),
+				format(h.Distance, 3), pt.Time, gpsEle, groundEle, difference})
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"flag"
+
+	"github.com/goblimey/tiler/esri"
+	"github.com/goblimey/tiler/pipeline"
+)
+
+// transformOptions holds the -transform flag shared by the commands that
+// read grids to draw or convert them.
+type transformOptions struct {
+	spec       string
+	transforms []pipeline.Transform
+}
+
+// addTransformFlag registers -transform on fs.
+func addTransformFlag(fs *flag.FlagSet) *transformOptions {
+	o := new(transformOptions)
+	fs.StringVar(&o.spec, "transform", "", "change the heights first with a comma separated chain of transforms, for example fillnodata,smooth:3,resample:2m - see \"tiler help transforms\"")
+	return o
+}
+
+// check makes the transforms named by the flag, and returns an error if
+// any of them is unknown or has a bad argument.
+func (o *transformOptions) check() error {
+	var err error
+	o.transforms, err = pipeline.ParseTransforms(o.spec)
+	return err
+}
+
+// apply returns g changed by the transforms in turn, or g itself if there
+// are none.
+func (o *transformOptions) apply(ctx context.Context, g *esri.Grid) (*esri.Grid, error) {
+	return pipeline.Apply(ctx, g, o.transforms)
+}
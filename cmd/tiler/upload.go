@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"image/png"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goblimey/tiler/esri"
+	"github.com/goblimey/tiler/render"
+)
+
+// jobLifetime is how long the result of an asynchronous render is kept.
+const jobLifetime = time.Hour
+
+// renderHandler draws pictures of uploaded grid files.
+type renderHandler struct {
+	maxBytes    int64
+	limit       *renderLimit
+	timeout     time.Duration // the longest a render may take, or 0 for no limit
+	maxJobs     int           // the most asynchronous jobs waiting or running
+	maxResults  int           // the most asynchronous jobs kept, finished or not
+	resultLimit int64         // the most bytes of finished results kept
+	trustProxy  bool          // see tileServer.trustProxy
+	mutex       sync.Mutex
+	jobs        map[string]*renderJob
+	resultBytes int64 // the bytes of the finished results kept
+}
+
+// renderJob is an asynchronous render.
+type renderJob struct {
+	done     bool
+	err      error
+	png      []byte
+	finished time.Time
+}
+
+func newRenderHandler(maxBytes int64, limit *renderLimit, timeout time.Duration, maxJobs, maxResults int, resultLimit int64, trustProxy bool) *renderHandler {
+	return &renderHandler{maxBytes: maxBytes, limit: limit, timeout: timeout, maxJobs: maxJobs,
+		maxResults: maxResults, resultLimit: resultLimit, trustProxy: trustProxy, jobs: make(map[string]*renderJob)}
+}
+
+// ServeHTTP handles POST /render and GET /render/{job}.
+//
+// The grid file is sent either as the body of the POST or as the "grid" part
+// of a multipart form.  The options floor, ceiling and bbox work as on the
+// command line and can be given in the query or the form.  The response is
+// the PNG, unless async=true is given, in which case it is a job id and the
+// PNG is fetched later from /render/{job}.
+func (h *renderHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/render" {
+		h.job(w, r, strings.TrimPrefix(r.URL.Path, "/render/"))
+		return
+	}
+	if r.Method != http.MethodPost {
+		jsonError(w, http.StatusMethodNotAllowed, "method "+r.Method+" not allowed")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, h.maxBytes)
+	var in io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, err := r.FormFile("grid")
+		if err != nil {
+			jsonError(w, http.StatusBadRequest, "grid: "+err.Error())
+			return
+		}
+		defer file.Close()
+		in = file
+	}
+	data, err := io.ReadAll(in)
+	if err != nil {
+		jsonError(w, http.StatusRequestEntityTooLarge, err.Error())
+		return
+	}
+
+	options := renderOptions{
+		floor:   r.FormValue("floor"),
+		ceiling: r.FormValue("ceiling"),
+		bbox:    r.FormValue("bbox"),
+	}
+
+	async, _ := strconv.ParseBool(r.FormValue("async"))
+	if !async {
+		ctx, cancel := h.renderContext(r.Context())
+		defer cancel()
+		if !h.limit.acquire(ctx) {
+			busy(w)
+			return
+		}
+		result, err := options.render(ctx, data)
+		h.limit.release()
+		if r.Context().Err() != nil {
+			// The client has gone away.
+			slog.Debug("render", "error", err)
+			return
+		}
+		if isCancelled(err) {
+			jsonError(w, http.StatusServiceUnavailable, "the picture took too long to draw")
+			return
+		}
+		if err != nil {
+			jsonError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(result)
+		return
+	}
+
+	// Each job holds its upload until it's done, so only so many may be
+	// waiting or running, and its result until it expires, so only so many
+	// are kept - the oldest results are dropped to make room.
+	id := newJobID()
+	job := &renderJob{}
+	h.mutex.Lock()
+	h.expire()
+	for len(h.jobs) >= h.maxResults && h.dropOldest() {
+	}
+	if h.pending() >= h.maxJobs || len(h.jobs) >= h.maxResults {
+		h.mutex.Unlock()
+		busy(w)
+		return
+	}
+	h.jobs[id] = job
+	h.mutex.Unlock()
+
+	go func() {
+		// An asynchronous job waits as long as it takes for a slot.
+		h.limit.acquireQueued()
+		ctx, cancel := h.renderContext(context.Background())
+		result, err := options.render(ctx, data)
+		cancel()
+		h.limit.release()
+		if err == nil && int64(len(result)) > h.resultLimit {
+			result, err = nil, fmt.Errorf("the picture is %d bytes - more than the server keeps", len(result))
+		}
+		h.mutex.Lock()
+		job.png, job.err, job.done, job.finished = result, err, true, time.Now()
+		h.resultBytes += int64(len(result))
+		for h.resultBytes > h.resultLimit && h.dropOldest() {
+		}
+		h.mutex.Unlock()
+		if err != nil {
+			slog.Error("render job", "id", id, "error", err)
+		}
+	}()
+
+	writeJSON(w, http.StatusAccepted, map[string]string{
+		"job":    id,
+		"status": baseURL(r, h.trustProxy) + "/render/" + id,
+	})
+}
+
+// job reports on an asynchronous render, sending the PNG once it's done.
+func (h *renderHandler) job(w http.ResponseWriter, r *http.Request, id string) {
+	h.mutex.Lock()
+	job, ok := h.jobs[id]
+	var done bool
+	var err error
+	var result []byte
+	if ok {
+		done, err, result = job.done, job.err, job.png
+	}
+	h.mutex.Unlock()
+
+	switch {
+	case !ok:
+		jsonError(w, http.StatusNotFound, "no job "+id)
+	case !done:
+		writeJSON(w, http.StatusOK, map[string]string{"job": id, "state": "running"})
+	case err != nil:
+		writeJSON(w, http.StatusOK, map[string]string{"job": id, "state": "failed", "error": err.Error()})
+	default:
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(result)
+	}
+}
+
+// renderContext returns a context for a render, which ends after the
+// render timeout if there is one.
+func (h *renderHandler) renderContext(parent context.Context) (context.Context, context.CancelFunc) {
+	if h.timeout > 0 {
+		return context.WithTimeout(parent, h.timeout)
+	}
+	return context.WithCancel(parent)
+}
+
+// pending returns the number of jobs waiting or running.  The caller holds
+// the mutex.
+func (h *renderHandler) pending() int {
+	n := 0
+	for _, job := range h.jobs {
+		if !job.done {
+			n++
+		}
+	}
+	return n
+}
+
+// expire forgets jobs that finished long ago.  The caller holds the mutex.
+func (h *renderHandler) expire() {
+	for id, job := range h.jobs {
+		if job.done && time.Since(job.finished) > jobLifetime {
+			h.drop(id)
+		}
+	}
+}
+
+// dropOldest forgets the job that finished first, returning false if none
+// has finished.  The caller holds the mutex.
+func (h *renderHandler) dropOldest() bool {
+	oldest := ""
+	for id, job := range h.jobs {
+		if job.done && (oldest == "" || job.finished.Before(h.jobs[oldest].finished)) {
+			oldest = id
+		}
+	}
+	if oldest == "" {
+		return false
+	}
+	h.drop(oldest)
+	return true
+}
+
+// drop forgets the job id and its result.  The caller holds the mutex.
+func (h *renderHandler) drop(id string) {
+	h.resultBytes -= int64(len(h.jobs[id].png))
+	delete(h.jobs, id)
+}
+
+// renderOptions are the options of a render request, as given.
+type renderOptions struct {
+	floor, ceiling, bbox string
+}
+
+// render reads the grid data and draws it as a PNG, giving up if ctx is
+// cancelled.
+func (o renderOptions) render(ctx context.Context, data []byte) ([]byte, error) {
+	grid, err := esri.ReadGridContext(ctx, bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("reading grid - %w", err)
+	}
+	if o.bbox != "" {
+		minX, minY, maxX, maxY, err := parseBBox(o.bbox)
+		if err != nil {
+			return nil, err
+		}
+		grid, err = grid.Crop(minX, minY, maxX, maxY)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	floor := grid.MinHeight() - 0.1
+	if o.floor != "" {
+		v, err := strconv.ParseFloat(o.floor, 32)
+		if err != nil {
+			return nil, fmt.Errorf("bad floor %q", o.floor)
+		}
+		floor = float32(v)
+	}
+	ceiling := grid.MaxHeight() + 0.1
+	if o.ceiling != "" {
+		v, err := strconv.ParseFloat(o.ceiling, 32)
+		if err != nil {
+			return nil, fmt.Errorf("bad ceiling %q", o.ceiling)
+		}
+		ceiling = float32(v)
+	}
+
+	img, err := render.GreyImageContext(ctx, grid, floor, ceiling)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	err = png.Encode(&buf, img)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// newJobID returns a random job id.
+func newJobID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/goblimey/tiler/crs"
+	"github.com/goblimey/tiler/tile"
+)
+
+// utfgridResolution is the number of tile pixels along each side of a
+// UTFGrid cell, giving a 64 by 64 grid for a 256 pixel tile.
+const utfgridResolution = 4
+
+// utfgridHandler serves UTFGrid 1.3 interaction tiles matching the image
+// tiles.  Each UTFGrid cell is keyed by the height at its centre, rounded
+// to 0.1 m, so that a web map can show the height under the cursor from the
+// tile it already has instead of asking /elevation.  Cells with no data have
+// the empty key.
+type utfgridHandler struct {
+	server *tileServer
+}
+
+// utfgrid is the JSON form of a UTFGrid tile.
+type utfgrid struct {
+	Grid []string                      `json:"grid"`
+	Keys []string                      `json:"keys"`
+	Data map[string]map[string]float64 `json:"data"`
+}
+
+// ServeHTTP handles /utfgrid.json and /utfgrid/{z}/{x}/{y}.json.
+func (h *utfgridHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/utfgrid.json" {
+		h.tileJSON(w, r)
+		return
+	}
+
+	z, x, y, err := parseTilePath(strings.TrimPrefix(r.URL.Path, "/utfgrid/"), ".json")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !tile.Valid(z, x, y) {
+		http.NotFound(w, r)
+		return
+	}
+
+	h.server.writeCached(w, r, "utfgrid", "application/json", z, x, y, h.encodeTile)
+}
+
+// encodeTile makes the UTFGrid for tile (z, x, y).
+func (h *utfgridHandler) encodeTile(ctx context.Context, z, x, y int) ([]byte, error) {
+	const size = tile.Size / utfgridResolution
+	ids := make([][]int, size)
+	for i := range ids {
+		ids[i] = make([]int, size)
+	}
+	grid := utfgrid{Keys: []string{""}, Data: make(map[string]map[string]float64)}
+	if h.server.Covers(z, x, y) {
+		index := make(map[string]int)
+		minX, minY, maxX, maxY := tile.Bounds(z, x, y)
+		err := h.server.Sample(ctx, crs.WebMercator{}, minX, minY, maxX, maxY, size, size,
+			func(px, py int, height float32) {
+				key := fmt.Sprintf("%.1f", height)
+				id, ok := index[key]
+				if !ok {
+					id = len(grid.Keys)
+					index[key] = id
+					grid.Keys = append(grid.Keys, key)
+					grid.Data[key] = map[string]float64{"elevation": float64(height)}
+				}
+				ids[py][px] = id
+			})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, row := range ids {
+		var line strings.Builder
+		for _, id := range row {
+			line.WriteRune(utfgridChar(id))
+		}
+		grid.Grid = append(grid.Grid, line.String())
+	}
+	return json.Marshal(grid)
+}
+
+// utfgridChar encodes a key index as a UTFGrid character, skipping the
+// characters that would need escaping in JSON.
+func utfgridChar(id int) rune {
+	c := id + 32
+	if c >= 34 {
+		c++
+	}
+	if c >= 92 {
+		c++
+	}
+	return rune(c)
+}
+
+// tileJSON sends a TileJSON 2.2.0 document describing the image tiles and
+// their UTFGrids.
+func (h *utfgridHandler) tileJSON(w http.ResponseWriter, r *http.Request) {
+	west, south, east, north := h.server.WGS84Bounds()
+	maxZoom := h.server.NativeZoom()
+
+	doc := map[string]interface{}{
+		"tilejson": "2.2.0",
+		"name":     wmtsLayer,
+		"scheme":   "xyz",
+		"tiles":    []string{baseURL(r, h.server.trustProxy) + "/tiles/{z}/{x}/{y}.png" + authQuery(r)},
+		"grids":    []string{baseURL(r, h.server.trustProxy) + "/utfgrid/{z}/{x}/{y}.json" + authQuery(r)},
+		"minzoom":  0,
+		"maxzoom":  maxZoom,
+		"bounds":   []float64{west, south, east, north},
+		"center":   []float64{(west + east) / 2, (south + north) / 2, float64(maxZoom - 2)},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(doc)
+	if err != nil {
+		slog.Error("utfgrid: TileJSON", "error", err)
+	}
+}
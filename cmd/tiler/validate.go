@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/goblimey/tiler/esri"
+)
+
+// validate sets up the validate command, which checks that grid files are
+// well formed and lists the problems, one per line, as file:line:column:
+// message.  It exits with status 1 if any file has a problem.  It returns
+// the flags of the command and the function that runs it once they are
+// parsed from the arguments that follow "validate" - flags and then the
+// names of the grid files.
+func validate() (*flag.FlagSet, func()) {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	maxProblems := fs.Int("max-problems", 100, "most problems to list for each file - 0 for all")
+	logging := addLogFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: tiler validate [flags] grid file ...\n")
+		fs.PrintDefaults()
+	}
+	return fs, func() {
+		err := logging.setup()
+		if err != nil {
+			fatal(err.Error())
+		}
+		if fs.NArg() == 0 {
+			fs.Usage()
+			os.Exit(2)
+		}
+
+		failed := 0
+		for _, name := range fs.Args() {
+			problems, err := esri.ValidateFile(name)
+			if err != nil {
+				fmt.Printf("%s: %s\n", name, err.Error())
+				failed++
+				continue
+			}
+			if len(problems) == 0 {
+				slog.Info("valid", "file", name)
+				continue
+			}
+			failed++
+			for i, p := range problems {
+				if *maxProblems > 0 && i == *maxProblems {
+					fmt.Printf("%s: %d more problems\n", name, len(problems)-i)
+					break
+				}
+				if p.Line == 0 {
+					fmt.Printf("%s: %s\n", name, p.String())
+				} else {
+					fmt.Printf("%s:%s\n", name, p.String())
+				}
+			}
+		}
+		if failed > 0 {
+			slog.Info("invalid", "files", failed, "of", fs.NArg())
+			os.Exit(1)
+		}
+	}
+}
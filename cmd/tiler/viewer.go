@@ -0,0 +1,36 @@
+package main
+
+import (
+	_ "embed"
+	"io"
+	"net/http"
+)
+
+// viewerPage and viewerScript are the web page and its script, built into
+// the program so that the server needs no files of its own.
+//
+//go:embed viewer/index.html
+var viewerPage string
+
+//go:embed viewer/viewer.js
+var viewerScript string
+
+// viewerHandler serves a web page at / that displays the served tiles on a
+// MapLibre GL map.  The map has layers for the grey shading, a hillshade and
+// a colour relief computed in the browser from the Terrain-RGB tiles, and the
+// contour vector tiles.  It shows the height under the cursor using the
+// UTFGrid tiles.  The script of the page is at /viewer.js.
+type viewerHandler struct{}
+
+func (viewerHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, viewerPage)
+	case "/viewer.js":
+		w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+		io.WriteString(w, viewerScript)
+	default:
+		http.NotFound(w, r)
+	}
+}
@@ -0,0 +1,67 @@
+// Pass any api_key given to this page on to the server.
+const query = location.search;
+fetch("terrain-rgb.json" + query).then(r => r.json()).then(dem => {
+  const map = new maplibregl.Map({
+    container: "map",
+    bounds: [[dem.bounds[0], dem.bounds[1]], [dem.bounds[2], dem.bounds[3]]],
+    fitBoundsOptions: { padding: 40 },
+    style: {
+      version: 8,
+      sources: {
+        osm: { type: "raster", tileSize: 256, maxzoom: 19,
+          tiles: ["https://tile.openstreetmap.org/{z}/{x}/{y}.png"],
+          attribution: "&copy; OpenStreetMap contributors" },
+        grey: { type: "raster", tileSize: 256, tiles: [location.origin + "/tiles/{z}/{x}/{y}.png" + query],
+          bounds: dem.bounds, maxzoom: dem.maxzoom },
+        dem: { type: "raster-dem", url: location.origin + "/terrain-rgb.json" + query },
+        contours: { type: "vector", url: location.origin + "/contours.json" + query }
+      },
+      layers: [
+        { id: "osm", type: "raster", source: "osm" },
+        { id: "grey", type: "raster", source: "grey" },
+        { id: "hillshade", type: "hillshade", source: "dem", layout: { visibility: "none" } },
+        { id: "relief", type: "color-relief", source: "dem", layout: { visibility: "none" },
+          paint: { "color-relief-opacity": 0.7, "color-relief-color": ["interpolate", ["linear"], ["elevation"],
+            0, "#2b83ba", 25, "#abdda4", 50, "#ffffbf", 100, "#fdae61", 200, "#d7191c", 500, "#ffffff"] } },
+        { id: "contours", type: "line", source: "contours", "source-layer": "contours",
+          layout: { visibility: "none" }, paint: { "line-color": "#8b4513", "line-width": ["case", ["get", "index"], 2, 0.8] } }
+      ]
+    }
+  });
+  map.addControl(new maplibregl.NavigationControl());
+
+  for (const id of ["grey", "hillshade", "relief", "contours"]) {
+    document.getElementById(id).addEventListener("change", e =>
+      map.setLayoutProperty(id, "visibility", e.target.checked ? "visible" : "none"));
+  }
+  document.getElementById("terrain").addEventListener("change", e =>
+    map.setTerrain(e.target.checked ? { source: "dem", exaggeration: 1.5 } : null));
+
+  // Show the height under the cursor from the UTFGrid tile covering it.
+  // The tiles are kept so that each is fetched once.
+  const grids = new Map();
+  map.on("mousemove", e => {
+    const z = Math.min(Math.max(Math.floor(map.getZoom()), 0), dem.maxzoom), n = Math.pow(2, z);
+    const lat = e.lngLat.lat * Math.PI / 180;
+    const fx = (e.lngLat.lng + 180) / 360 * n;
+    const fy = (1 - Math.log(Math.tan(lat) + 1 / Math.cos(lat)) / Math.PI) / 2 * n;
+    const x = Math.floor(fx), y = Math.floor(fy);
+    const key = z + "/" + x + "/" + y;
+    if (!grids.has(key)) {
+      grids.set(key, fetch(location.origin + "/utfgrid/" + key + ".json" + query)
+        .then(r => r.ok ? r.json() : null).catch(() => null));
+    }
+    grids.get(key).then(grid => {
+      if (!grid) {
+        return;
+      }
+      const size = grid.grid.length;
+      let c = grid.grid[Math.floor((fy - y) * size)].codePointAt(Math.floor((fx - x) * size));
+      if (c >= 93) c--;
+      if (c >= 35) c--;
+      const k = grid.keys[c - 32];
+      document.getElementById("height").textContent = k ?
+        "Height " + grid.data[k].elevation.toFixed(1) + " m" : "No data here.";
+    });
+  });
+});
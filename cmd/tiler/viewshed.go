@@ -0,0 +1,96 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/goblimey/tiler/esri"
+	"github.com/goblimey/tiler/render"
+	"github.com/goblimey/tiler/viewshed"
+)
+
+// viewsheds sets up the viewshed command, which works out what can be seen
+// from a point and writes it as a picture or as a grid file.  It returns the
+// flags of the command and the function that runs it once they are parsed
+// from the arguments that follow "viewshed".
+func viewsheds() (*flag.FlagSet, func()) {
+	fs := flag.NewFlagSet("viewshed", flag.ExitOnError)
+	var input, output string
+	fs.StringVar(&input, "input", "", "data file")
+	fs.StringVar(&input, "i", "", "data file")
+	fs.StringVar(&output, "output", "", "PNG overlay or ESRI Grid (.asc) results file")
+	fs.StringVar(&output, "o", "", "PNG overlay or ESRI Grid (.asc) results file")
+	x := fs.Float64("x", 0, "x map coordinate of the observer")
+	y := fs.Float64("y", 0, "y map coordinate of the observer")
+	observer := fs.Float64("observer", 1.7, "height of the observer's eye above the ground")
+	target := fs.Float64("target", 0, "height above the ground of the things looked for")
+	radius := fs.Float64("radius", 0, "furthest distance looked at in map units - the whole grid if not given")
+	bbox := fs.String("bbox", "", "area to cover - minX,minY,maxX,maxY in map coordinates")
+	overwrite := addOverwriteFlags(fs)
+	logging := addLogFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: tiler viewshed -i file -x x -y y -o file [flags]\n")
+		fs.PrintDefaults()
+	}
+	return fs, func() {
+		err := logging.setup()
+		if err != nil {
+			fatal(err.Error())
+		}
+		if input == "" || output == "" {
+			fs.Usage()
+			os.Exit(2)
+		}
+		err = overwrite.check(output)
+		if err != nil {
+			fatal(err.Error())
+		}
+
+		grid, err := esri.ReadGridFromFile(input)
+		if err != nil {
+			fail(readError(err))
+		}
+		if *bbox != "" {
+			minX, minY, maxX, maxY, err := parseBBox(*bbox)
+			if err != nil {
+				fatal(err.Error())
+			}
+			grid, err = grid.Crop(minX, minY, maxX, maxY)
+			if err != nil {
+				fatal(err.Error())
+			}
+		}
+
+		result, err := viewshed.Compute(grid, *x, *y, viewshed.Options{
+			ObserverHeight: *observer, TargetHeight: *target, Radius: *radius,
+		})
+		if err != nil {
+			fatal(err.Error())
+		}
+
+		if strings.ToLower(filepath.Ext(output)) == ".asc" {
+			err = result.WriteToFile(output)
+			if err != nil {
+				fail(writeError(err))
+			}
+			return
+		}
+		out, err := os.Create(output)
+		if err != nil {
+			fail(writeError(err))
+		}
+		err = png.Encode(out, render.ViewshedImage(result))
+		if err != nil {
+			out.Close()
+			fail(writeError(err))
+		}
+		err = out.Close()
+		if err != nil {
+			fail(writeError(err))
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/goblimey/tiler/esri"
+)
+
+// volume sets up the volume command, which works out the volume of earth to
+// be cut and filled to bring the ground to a level or to a design surface
+// and writes it on the standard output.  It returns the flags of the command
+// and the function that runs it once they are parsed from the arguments that
+// follow "volume".
+func volume() (*flag.FlagSet, func()) {
+	fs := flag.NewFlagSet("volume", flag.ExitOnError)
+	var input string
+	fs.StringVar(&input, "input", "", "data file - the ground as it is")
+	fs.StringVar(&input, "i", "", "data file - the ground as it is")
+	design := fs.String("design", "", "data file of the surface wanted, instead of -level")
+	level := fs.Float64("level", 0, "height of the level surface wanted")
+	bbox := fs.String("bbox", "", "area to cover - minX,minY,maxX,maxY in map coordinates")
+	mask := fs.String("mask", "", "GeoJSON file or shapefile (.shp) of polygons - only cells inside them are counted")
+	logging := addLogFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: tiler volume -i file -level height | -design file [flags]\n")
+		fs.PrintDefaults()
+	}
+	return fs, func() {
+		err := logging.setup()
+		if err != nil {
+			fatal(err.Error())
+		}
+		flagset := make(map[string]bool)
+		fs.Visit(func(f *flag.Flag) { flagset[f.Name] = true })
+		if input == "" || flagset["level"] == (*design != "") {
+			fs.Usage()
+			os.Exit(2)
+		}
+
+		// prepare crops and masks a grid as the flags ask.
+		prepare := func(filename string) *esri.Grid {
+			g, err := esri.ReadGridFromFile(filename)
+			if err != nil {
+				fail(readError(err))
+			}
+			if *bbox != "" {
+				minX, minY, maxX, maxY, err := parseBBox(*bbox)
+				if err != nil {
+					fatal(err.Error())
+				}
+				g, err = g.Crop(minX, minY, maxX, maxY)
+				if err != nil {
+					fatal(err.Error())
+				}
+			}
+			if *mask != "" {
+				polygons, err := readPolygons(*mask)
+				if err != nil {
+					fatal(err.Error())
+				}
+				g, err = g.Mask(polygons)
+				if err != nil {
+					fatal(err.Error())
+				}
+			}
+			return g
+		}
+
+		ground := prepare(input)
+		var result esri.CutFill
+		if *design != "" {
+			result, err = ground.CutFillTo(prepare(*design))
+			if err != nil {
+				fatal(err.Error())
+			}
+		} else {
+			result = ground.CutFill(*level)
+		}
+		if result.Cells == 0 {
+			slog.Warn("no cells with data")
+		}
+
+		fmt.Printf("cut %.3f\n", result.Cut)
+		fmt.Printf("fill %.3f\n", result.Fill)
+		fmt.Printf("net %.3f\n", result.Net())
+		fmt.Printf("cut_area %.3f\n", result.CutArea)
+		fmt.Printf("fill_area %.3f\n", result.FillArea)
+		fmt.Printf("cells %d\n", result.Cells)
+	}
+}
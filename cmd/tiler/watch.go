@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/goblimey/tiler/crs"
+	"github.com/goblimey/tiler/pipeline"
+	"github.com/goblimey/tiler/tile"
+)
+
+// watch sets up the watch command, which runs the watch-folder daemon.  It
+// polls an input folder and draws each new or changed grid file in an
+// output folder, as a picture or as web map tiles, with the options of the
+// render command.  It returns the flags of the command and the function
+// that runs it once they are parsed from the arguments that follow
+// "watch".
+func watch() (*flag.FlagSet, func()) {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	inDir := fs.String("in", "", "directory to watch for grid files")
+	outDir := fs.String("out", "", "directory to write the pictures to")
+	pattern := fs.String("pattern", "*.asc", "names of the grid files to look for")
+	interval := fs.Duration("interval", 30*time.Second, "time between scans of the input directory")
+	settle := fs.Duration("settle", 10*time.Second, "how long a file must be unchanged before it is read")
+	tiles := fs.Bool("tiles", false, "cut each picture into z/x/y web map tiles in a folder named after the grid file, rather than writing one PNG")
+	minZoom := fs.Int("min-zoom", 0, "shallowest zoom level to make tiles for, under -tiles")
+	maxZoom := fs.Int("max-zoom", -1, "deepest zoom level to make tiles for, under -tiles - the native zoom of each grid if not given")
+	crsName := fs.String("crs", crs.Default, "coordinate reference system of the grids, under -tiles")
+	addDrawFlags(fs)
+	logging := addLogFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: tiler watch -in dir -out dir [flags]\n")
+		fs.PrintDefaults()
+	}
+	return fs, func() {
+		err := logging.setup()
+		if err != nil {
+			fatal(err.Error())
+		}
+		err = checkDrawFlags(fs)
+		if err != nil {
+			fatal(err.Error())
+		}
+
+		if *inDir == "" || *outDir == "" {
+			fs.Usage()
+			os.Exit(2)
+		}
+		c, err := crs.Lookup(*crsName)
+		if err != nil {
+			fatal(err.Error())
+		}
+		if *maxZoom > tile.MaxZoom || *minZoom < 0 || (*maxZoom >= 0 && *minZoom > *maxZoom) {
+			fatal(fmt.Sprintf("-min-zoom and -max-zoom must be in the range 0 to %d", tile.MaxZoom))
+		}
+
+		err = os.MkdirAll(*outDir, 0755)
+		if err != nil {
+			fatal(err.Error())
+		}
+
+		w := watcher{
+			inDir:   *inDir,
+			outDir:  *outDir,
+			pattern: *pattern,
+			settle:  *settle,
+			tiles:   *tiles,
+			minZoom: *minZoom,
+			maxZoom: *maxZoom,
+			crs:     c,
+			seen:    make(map[string]time.Time),
+		}
+
+		// SIGTERM or an interrupt stops the file being drawn as well as the
+		// scans.
+		ctx, cancel := commandContext(0)
+		defer cancel()
+		ticker := time.NewTicker(*interval)
+		defer ticker.Stop()
+
+		slog.Info("watching", "dir", *inDir, "pattern", *pattern, "interval", *interval)
+		for {
+			w.scan(ctx)
+			select {
+			case <-ctx.Done():
+				slog.Info("stopping")
+				return
+			case <-ticker.C:
+			}
+		}
+	}
+}
+
+// watcher remembers which files it has processed.
+type watcher struct {
+	inDir, outDir string
+	pattern       string
+	settle        time.Duration
+	tiles         bool // cut the pictures into tiles
+	minZoom       int
+	maxZoom       int // -1 for the native zoom of each grid
+	crs           crs.CRS
+	// seen maps each input file processed to its modification time then.
+	seen map[string]time.Time
+}
+
+// scan processes the files that are new or changed since the last scan,
+// until ctx is cancelled.
+func (w *watcher) scan(ctx context.Context) {
+	names, err := filepath.Glob(filepath.Join(w.inDir, w.pattern))
+	if err != nil {
+		slog.Error("watch", "error", err)
+		return
+	}
+	// Forget files that have gone, so that one put back is drawn again.
+	present := make(map[string]bool, len(names))
+	for _, name := range names {
+		present[name] = true
+	}
+	for name := range w.seen {
+		if !present[name] {
+			delete(w.seen, name)
+		}
+	}
+
+	for _, name := range names {
+		if ctx.Err() != nil {
+			return
+		}
+		info, err := os.Stat(name)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		modTime := info.ModTime()
+		if last, ok := w.seen[name]; ok && !modTime.After(last) {
+			continue
+		}
+		// Leave files that are still being written.
+		if time.Since(modTime) < w.settle {
+			continue
+		}
+		var output string
+		if w.tiles {
+			output = derivedName(name, w.outDir, "")
+			err = w.drawTiles(ctx, name, output)
+		} else {
+			output = derivedName(name, w.outDir, ".png")
+			err = renderFile(ctx, name, output)
+		}
+		if isCancelled(err) {
+			// Draw it again next time.
+			return
+		}
+		if err != nil {
+			slog.Error("watch", "file", name, "error", err)
+		} else {
+			slog.Info("watch: rendered", "file", name, "output", output)
+		}
+		// Don't retry a broken file until it changes.
+		w.seen[name] = modTime
+	}
+}
+
+// drawTiles draws a grid file as the render flags ask for and cuts the
+// picture into web map tiles in the folder dir.
+func (w *watcher) drawTiles(ctx context.Context, input, dir string) error {
+	t := newStageTimer(input)
+	defer t.finish()
+	grid, err := prepareGrid(ctx, input, t)
+	if err != nil {
+		return err
+	}
+	t.stage("shade")
+	img, err := drawPicture(ctx, grid, dir)
+	if err != nil {
+		return err
+	}
+	maxZoom := w.maxZoom
+	if maxZoom < 0 {
+		cellsize := float64(grid.CellSize())
+		if w.crs.Code() == "EPSG:4326" {
+			// Degrees to metres at the equator.
+			cellsize *= 2 * crs.MercatorExtent / 360
+		}
+		maxZoom = tile.ZoomForResolution(cellsize)
+	}
+	if maxZoom < w.minZoom {
+		maxZoom = w.minZoom
+	}
+	t.stage("encode")
+	return writeError(pipeline.Tiles(w.crs, w.minZoom, maxZoom, pipeline.Dir(dir)).Write(ctx, grid, img))
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"image/png"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/goblimey/tiler/crs"
+)
+
+// The WMS interface draws an arbitrary area at an arbitrary size on demand,
+// following the OGC Web Map Service standard (versions 1.1.1 and 1.3.0).
+// Only GetCapabilities and GetMap are supported.
+
+// wmsMaxSize is the largest width or height that GetMap will draw.
+const wmsMaxSize = 4096
+
+// wmsCRSs are the coordinate reference systems offered.
+var wmsCRSs = []string{"EPSG:3857", "EPSG:4326", "EPSG:27700"}
+
+// wmsHandler serves WMS requests for a tileServer.
+type wmsHandler struct {
+	server *tileServer
+}
+
+var wmsCapabilitiesTemplate = template.Must(template.New("capabilities").Funcs(xmlFuncs).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<WMS_Capabilities version="1.3.0" xmlns="http://www.opengis.net/wms"
+  xmlns:xlink="http://www.w3.org/1999/xlink">
+  <Service>
+    <Name>WMS</Name>
+    <Title>tiler</Title>
+    <OnlineResource xlink:href="{{xml .URL}}"/>
+    <MaxWidth>{{.MaxSize}}</MaxWidth>
+    <MaxHeight>{{.MaxSize}}</MaxHeight>
+  </Service>
+  <Capability>
+    <Request>
+      <GetCapabilities>
+        <Format>text/xml</Format>
+        <DCPType><HTTP><Get><OnlineResource xlink:href="{{xml .URL}}?"/></Get></HTTP></DCPType>
+      </GetCapabilities>
+      <GetMap>
+        <Format>image/png</Format>
+        <DCPType><HTTP><Get><OnlineResource xlink:href="{{xml .URL}}?"/></Get></HTTP></DCPType>
+      </GetMap>
+    </Request>
+    <Exception><Format>XML</Format></Exception>
+    <Layer queryable="0">
+      <Name>{{xml .Layer}}</Name>
+      <Title>{{xml .Layer}}</Title>
+{{- range .CRSs}}
+      <CRS>{{xml .}}</CRS>
+{{- end}}
+      <EX_GeographicBoundingBox>
+        <westBoundLongitude>{{.West}}</westBoundLongitude>
+        <eastBoundLongitude>{{.East}}</eastBoundLongitude>
+        <southBoundLatitude>{{.South}}</southBoundLatitude>
+        <northBoundLatitude>{{.North}}</northBoundLatitude>
+      </EX_GeographicBoundingBox>
+    </Layer>
+  </Capability>
+</WMS_Capabilities>
+`))
+
+var wmsExceptionTemplate = template.Must(template.New("exception").Funcs(xmlFuncs).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<ServiceExceptionReport version="1.3.0" xmlns="http://www.opengis.net/ogc">
+  <ServiceException{{if .Code}} code="{{xml .Code}}"{{end}}>{{xml .Text}}</ServiceException>
+</ServiceExceptionReport>
+`))
+
+// ServeHTTP handles requests to /wms.
+func (h *wmsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	params := kvp(r)
+	if params["service"] != "" && !strings.EqualFold(params["service"], "WMS") {
+		wmsException(w, "", "SERVICE must be WMS")
+		return
+	}
+	switch strings.ToLower(params["request"]) {
+	case "getcapabilities":
+		h.capabilities(w, r)
+	case "getmap":
+		h.getMap(w, r, params)
+	default:
+		wmsException(w, "OperationNotSupported", "unsupported request "+params["request"])
+	}
+}
+
+func (h *wmsHandler) capabilities(w http.ResponseWriter, r *http.Request) {
+	west, south, east, north := h.server.WGS84Bounds()
+	data := struct {
+		URL                      string
+		Layer                    string
+		MaxSize                  int
+		CRSs                     []string
+		West, South, East, North float64
+	}{baseURL(r, h.server.trustProxy) + "/wms", wmtsLayer, wmsMaxSize, wmsCRSs, west, south, east, north}
+
+	w.Header().Set("Content-Type", "text/xml")
+	err := wmsCapabilitiesTemplate.Execute(w, data)
+	if err != nil {
+		slog.Error("wms: GetCapabilities", "error", err)
+	}
+}
+
+func (h *wmsHandler) getMap(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	for _, name := range []string{"layers", "bbox", "width", "height"} {
+		if params[name] == "" {
+			wmsException(w, "MissingParameterValue", strings.ToUpper(name)+" is missing")
+			return
+		}
+	}
+	for _, layer := range strings.Split(params["layers"], ",") {
+		if layer != wmtsLayer {
+			wmsException(w, "LayerNotDefined", "unknown layer "+layer)
+			return
+		}
+	}
+	if params["format"] != "" && params["format"] != "image/png" {
+		wmsException(w, "InvalidFormat", "only image/png is supported")
+		return
+	}
+
+	// Version 1.3.0 calls it CRS, earlier versions SRS.
+	code := params["crs"]
+	if code == "" {
+		code = params["srs"]
+	}
+	c, err := crs.Lookup(code)
+	if err != nil {
+		wmsException(w, "InvalidCRS", err.Error())
+		return
+	}
+
+	var box [4]float64
+	field := strings.Split(params["bbox"], ",")
+	if len(field) != 4 {
+		wmsException(w, "", "BBOX must be minx,miny,maxx,maxy")
+		return
+	}
+	for i := range field {
+		box[i], err = strconv.ParseFloat(field[i], 64)
+		if err != nil {
+			wmsException(w, "", "bad BBOX "+params["bbox"])
+			return
+		}
+	}
+	minX, minY, maxX, maxY := box[0], box[1], box[2], box[3]
+	// In version 1.3.0, EPSG:4326 has latitude first.
+	if c.Code() == "EPSG:4326" && params["version"] != "1.1.1" && params["version"] != "1.1.0" {
+		minX, minY, maxX, maxY = box[1], box[0], box[3], box[2]
+	}
+	if minX >= maxX || minY >= maxY {
+		wmsException(w, "", "empty BBOX "+params["bbox"])
+		return
+	}
+
+	width, err := strconv.Atoi(params["width"])
+	if err != nil || width <= 0 || width > wmsMaxSize {
+		wmsException(w, "", fmt.Sprintf("WIDTH must be between 1 and %d", wmsMaxSize))
+		return
+	}
+	height, err := strconv.Atoi(params["height"])
+	if err != nil || height <= 0 || height > wmsMaxSize {
+		wmsException(w, "", fmt.Sprintf("HEIGHT must be between 1 and %d", wmsMaxSize))
+		return
+	}
+
+	ctx, cancel := h.server.renderContext(r)
+	defer cancel()
+	if !h.server.limit.acquire(ctx) {
+		busy(w)
+		return
+	}
+	start := time.Now()
+	img, err := h.server.Area(ctx, c, minX, minY, maxX, maxY, width, height)
+	h.server.metrics.observeRender("wms", time.Since(start))
+	h.server.limit.release()
+	if r.Context().Err() != nil {
+		// The client has gone away.
+		return
+	}
+	if err != nil {
+		wmsException(w, "", "the map took too long to draw")
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	err = png.Encode(w, img)
+	if err != nil {
+		slog.Error("wms: GetMap", "error", err)
+	}
+}
+
+// wmsException sends a WMS service exception report.  As the standard
+// requires, the status is 200.
+func wmsException(w http.ResponseWriter, code, text string) {
+	w.Header().Set("Content-Type", "text/xml")
+	wmsExceptionTemplate.Execute(w, struct{ Code, Text string }{code, text})
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/goblimey/tiler/crs"
+	"github.com/goblimey/tiler/tile"
+)
+
+// The WMTS interface offers the same tiles as /tiles/ through the OGC Web Map
+// Tile Service 1.0.0 standard, using the GoogleMapsCompatible tile matrix set
+// so that zoom level, column and row are the same as z, x and y.
+
+// wmtsLayer is the name of the single layer offered.
+const wmtsLayer = "terrain"
+
+// wmtsMatrixSet is the name of the tile matrix set.
+const wmtsMatrixSet = "GoogleMapsCompatible"
+
+// wmtsMaxZoom is the highest tile matrix in the capabilities document.
+const wmtsMaxZoom = 22
+
+// wmtsScale0 is the scale denominator of the GoogleMapsCompatible matrix at
+// zoom level 0.
+const wmtsScale0 = 559082264.0287178
+
+// wmtsHandler serves WMTS requests for a tileServer.
+type wmtsHandler struct {
+	server *tileServer
+}
+
+type wmtsMatrix struct {
+	Zoom  int
+	Scale float64
+	Width int
+}
+
+type wmtsCapabilities struct {
+	URL       string
+	Query     string
+	Layer     string
+	MatrixSet string
+	West      float64
+	South     float64
+	East      float64
+	North     float64
+	Extent    float64
+	Matrices  []wmtsMatrix
+}
+
+// xmlFuncs gives the templates of XML documents xml, which escapes a value
+// for XML text or an attribute.  Every string put into a document goes
+// through it, since most come from the request.
+var xmlFuncs = template.FuncMap{"xml": xmlText}
+
+// xmlText returns s escaped for XML text or an attribute value.
+func xmlText(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+var wmtsCapabilitiesTemplate = template.Must(template.New("capabilities").Funcs(xmlFuncs).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<Capabilities xmlns="http://www.opengis.net/wmts/1.0" xmlns:ows="http://www.opengis.net/ows/1.1"
+  xmlns:xlink="http://www.w3.org/1999/xlink" version="1.0.0">
+  <ows:ServiceIdentification>
+    <ows:Title>tiler</ows:Title>
+    <ows:ServiceType>OGC WMTS</ows:ServiceType>
+    <ows:ServiceTypeVersion>1.0.0</ows:ServiceTypeVersion>
+  </ows:ServiceIdentification>
+  <ows:OperationsMetadata>
+    <ows:Operation name="GetCapabilities">
+      <ows:DCP><ows:HTTP><ows:Get xlink:href="{{xml .URL}}?">
+        <ows:Constraint name="GetEncoding"><ows:AllowedValues><ows:Value>KVP</ows:Value></ows:AllowedValues></ows:Constraint>
+      </ows:Get></ows:HTTP></ows:DCP>
+    </ows:Operation>
+    <ows:Operation name="GetTile">
+      <ows:DCP><ows:HTTP><ows:Get xlink:href="{{xml .URL}}?">
+        <ows:Constraint name="GetEncoding"><ows:AllowedValues><ows:Value>KVP</ows:Value></ows:AllowedValues></ows:Constraint>
+      </ows:Get></ows:HTTP></ows:DCP>
+    </ows:Operation>
+  </ows:OperationsMetadata>
+  <Contents>
+    <Layer>
+      <ows:Title>{{xml .Layer}}</ows:Title>
+      <ows:WGS84BoundingBox>
+        <ows:LowerCorner>{{.West}} {{.South}}</ows:LowerCorner>
+        <ows:UpperCorner>{{.East}} {{.North}}</ows:UpperCorner>
+      </ows:WGS84BoundingBox>
+      <ows:Identifier>{{xml .Layer}}</ows:Identifier>
+      <Style isDefault="true"><ows:Identifier>default</ows:Identifier></Style>
+      <Format>image/png</Format>
+      <TileMatrixSetLink><TileMatrixSet>{{xml .MatrixSet}}</TileMatrixSet></TileMatrixSetLink>
+      <ResourceURL format="image/png" resourceType="tile"
+        template="{{xml .URL}}/1.0.0/{{xml .Layer}}/default/{{xml .MatrixSet}}/{TileMatrix}/{TileRow}/{TileCol}.png{{xml .Query}}"/>
+    </Layer>
+    <TileMatrixSet>
+      <ows:Identifier>{{xml .MatrixSet}}</ows:Identifier>
+      <ows:SupportedCRS>urn:ogc:def:crs:EPSG::3857</ows:SupportedCRS>
+      <WellKnownScaleSet>urn:ogc:def:wkss:OGC:1.0:GoogleMapsCompatible</WellKnownScaleSet>
+{{- range .Matrices}}
+      <TileMatrix>
+        <ows:Identifier>{{.Zoom}}</ows:Identifier>
+        <ScaleDenominator>{{printf "%.10f" .Scale}}</ScaleDenominator>
+        <TopLeftCorner>-{{printf "%.8f" $.Extent}} {{printf "%.8f" $.Extent}}</TopLeftCorner>
+        <TileWidth>256</TileWidth>
+        <TileHeight>256</TileHeight>
+        <MatrixWidth>{{.Width}}</MatrixWidth>
+        <MatrixHeight>{{.Width}}</MatrixHeight>
+      </TileMatrix>
+{{- end}}
+    </TileMatrixSet>
+  </Contents>
+  <ServiceMetadataURL xlink:href="{{xml .URL}}/1.0.0/WMTSCapabilities.xml"/>
+</Capabilities>
+`))
+
+var owsExceptionTemplate = template.Must(template.New("exception").Funcs(xmlFuncs).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<ows:ExceptionReport xmlns:ows="http://www.opengis.net/ows/1.1" version="1.0.0">
+  <ows:Exception exceptionCode="{{xml .Code}}"{{if .Locator}} locator="{{xml .Locator}}"{{end}}>
+    <ows:ExceptionText>{{xml .Text}}</ows:ExceptionText>
+  </ows:Exception>
+</ows:ExceptionReport>
+`))
+
+// ServeHTTP handles KVP requests to /wmts and RESTful requests below
+// /wmts/1.0.0/.
+func (h *wmtsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/wmts")
+	if rest == "/1.0.0/WMTSCapabilities.xml" {
+		h.capabilities(w, r)
+		return
+	}
+	if strings.HasPrefix(rest, "/1.0.0/") {
+		h.restTile(w, r, strings.TrimPrefix(rest, "/1.0.0/"))
+		return
+	}
+
+	params := kvp(r)
+	if !strings.EqualFold(params["service"], "WMTS") {
+		owsException(w, http.StatusBadRequest, "InvalidParameterValue", "service",
+			"SERVICE must be WMTS")
+		return
+	}
+	switch strings.ToLower(params["request"]) {
+	case "getcapabilities":
+		h.capabilities(w, r)
+	case "gettile":
+		h.kvpTile(w, r, params)
+	case "":
+		owsException(w, http.StatusBadRequest, "MissingParameterValue", "request",
+			"REQUEST is missing")
+	default:
+		owsException(w, http.StatusBadRequest, "OperationNotSupported", "request",
+			"unsupported request "+params["request"])
+	}
+}
+
+func (h *wmtsHandler) capabilities(w http.ResponseWriter, r *http.Request) {
+	c := wmtsCapabilities{
+		URL:       baseURL(r, h.server.trustProxy) + "/wmts",
+		Query:     authQuery(r),
+		Layer:     wmtsLayer,
+		MatrixSet: wmtsMatrixSet,
+		Extent:    crs.MercatorExtent,
+	}
+	c.West, c.South, c.East, c.North = h.server.WGS84Bounds()
+	for z := 0; z <= wmtsMaxZoom; z++ {
+		c.Matrices = append(c.Matrices,
+			wmtsMatrix{Zoom: z, Scale: wmtsScale0 / float64(int(1)<<uint(z)), Width: 1 << uint(z)})
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	err := wmtsCapabilitiesTemplate.Execute(w, c)
+	if err != nil {
+		slog.Error("wmts: GetCapabilities", "error", err)
+	}
+}
+
+func (h *wmtsHandler) kvpTile(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	for _, name := range []string{"layer", "tilematrixset", "tilematrix", "tilerow", "tilecol"} {
+		if params[name] == "" {
+			owsException(w, http.StatusBadRequest, "MissingParameterValue", name,
+				strings.ToUpper(name)+" is missing")
+			return
+		}
+	}
+	if params["format"] != "" && params["format"] != "image/png" {
+		owsException(w, http.StatusBadRequest, "InvalidParameterValue", "format",
+			"only image/png is supported")
+		return
+	}
+	h.tile(w, r, params["layer"], params["tilematrixset"],
+		params["tilematrix"], params["tilerow"], params["tilecol"])
+}
+
+// restTile handles {layer}/{style}/{matrixset}/{matrix}/{row}/{col}.png.
+func (h *wmtsHandler) restTile(w http.ResponseWriter, r *http.Request, path string) {
+	field := strings.Split(strings.TrimSuffix(path, ".png"), "/")
+	if len(field) != 6 || !strings.HasSuffix(path, ".png") {
+		http.NotFound(w, r)
+		return
+	}
+	h.tile(w, r, field[0], field[2], field[3], field[4], field[5])
+}
+
+func (h *wmtsHandler) tile(w http.ResponseWriter, r *http.Request, layer, matrixSet, matrix, row, col string) {
+	if layer != wmtsLayer {
+		owsException(w, http.StatusBadRequest, "InvalidParameterValue", "layer",
+			"unknown layer "+layer)
+		return
+	}
+	if matrixSet != wmtsMatrixSet {
+		owsException(w, http.StatusBadRequest, "InvalidParameterValue", "tilematrixset",
+			"unknown tile matrix set "+matrixSet)
+		return
+	}
+	z, err := strconv.Atoi(matrix)
+	if err != nil || z < 0 || z > wmtsMaxZoom {
+		owsException(w, http.StatusBadRequest, "InvalidParameterValue", "tilematrix",
+			"unknown tile matrix "+matrix)
+		return
+	}
+	y, err := strconv.Atoi(row)
+	if err != nil {
+		owsException(w, http.StatusBadRequest, "InvalidParameterValue", "tilerow",
+			"bad tile row "+row)
+		return
+	}
+	x, err := strconv.Atoi(col)
+	if err != nil {
+		owsException(w, http.StatusBadRequest, "InvalidParameterValue", "tilecol",
+			"bad tile column "+col)
+		return
+	}
+	if !tile.Valid(z, x, y) {
+		owsException(w, http.StatusBadRequest, "TileOutOfRange", "tilerow",
+			fmt.Sprintf("tile %d/%d/%d is out of range", z, y, x))
+		return
+	}
+
+	h.server.writeTile(w, r, "tiles", z, x, y, h.server.Tile)
+}
+
+// kvp returns the query parameters of a request with the names folded to
+// lower case, since OGC parameter names are case insensitive.
+func kvp(r *http.Request) map[string]string {
+	result := make(map[string]string)
+	for name, values := range r.URL.Query() {
+		if len(values) > 0 {
+			result[strings.ToLower(name)] = values[0]
+		}
+	}
+	return result
+}
+
+// owsException sends an OGC exception report.
+func owsException(w http.ResponseWriter, status int, code, locator, text string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	owsExceptionTemplate.Execute(w, struct{ Code, Locator, Text string }{code, locator, text})
+}
+
+// baseURL returns the scheme and host that the client used to reach the
+// server.  The scheme is taken from the X-Forwarded-Proto header only if
+// trustProxy is set, since otherwise any client could choose it.
+func baseURL(r *http.Request, trustProxy bool) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if trustProxy {
+		switch forwarded := strings.ToLower(r.Header.Get("X-Forwarded-Proto")); forwarded {
+		case "http", "https":
+			scheme = forwarded
+		}
+	}
+	return scheme + "://" + r.Host
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/goblimey/tiler/esri"
+	"github.com/goblimey/tiler/geojson"
+	"github.com/goblimey/tiler/geom"
+)
+
+// zonal sets up the zonal command, which summarises the heights of a grid
+// file inside each of a set of polygons.  It returns the flags of the
+// command and the function that runs it once they are parsed from the
+// arguments that follow "zonal".
+func zonal() (*flag.FlagSet, func()) {
+	fs := flag.NewFlagSet("zonal", flag.ExitOnError)
+	var input, output string
+	fs.StringVar(&input, "input", "", "data file")
+	fs.StringVar(&input, "i", "", "data file")
+	fs.StringVar(&output, "output", "", "CSV or GeoJSON (.geojson or .json) results file - CSV on the standard output if not given")
+	fs.StringVar(&output, "o", "", "CSV or GeoJSON (.geojson or .json) results file - CSV on the standard output if not given")
+	zones := fs.String("zones", "", "GeoJSON file or shapefile (.shp) of polygons")
+	percentiles := fs.String("percentiles", "25,50,75", "comma separated percentiles to give for each polygon - empty for none")
+	overwrite := addOverwriteFlags(fs)
+	logging := addLogFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: tiler zonal -i file -zones file [flags]\n")
+		fs.PrintDefaults()
+	}
+	return fs, func() {
+		err := logging.setup()
+		if err != nil {
+			fatal(err.Error())
+		}
+		if input == "" || *zones == "" {
+			fs.Usage()
+			os.Exit(2)
+		}
+		err = overwrite.check(output)
+		if err != nil {
+			fatal(err.Error())
+		}
+		ps, err := parsePercentiles(*percentiles)
+		if err != nil {
+			fatal(err.Error())
+		}
+
+		grid, err := esri.ReadGridFromFile(input)
+		if err != nil {
+			fail(readError(err))
+		}
+		polygons, err := readPolygons(*zones)
+		if err != nil {
+			fatal(err.Error())
+		}
+		stats := make([]esri.Stats, len(polygons))
+		for i, polygon := range polygons {
+			stats[i] = grid.ZonalStats(polygon)
+		}
+		slog.Info("zonal", "polygons", len(polygons))
+
+		if ext := strings.ToLower(filepath.Ext(output)); ext == ".geojson" || ext == ".json" {
+			err = writeZonalGeoJSON(output, polygons, stats, ps, float64(grid.CellSize()))
+		} else {
+			out := os.Stdout
+			if output != "" {
+				out, err = os.Create(output)
+				if err != nil {
+					fail(writeError(err))
+				}
+			}
+			err = writeZonalCSV(out, stats, ps, float64(grid.CellSize()))
+			if err == nil && output != "" {
+				err = out.Close()
+			}
+		}
+		if err != nil {
+			fail(writeError(err))
+		}
+	}
+}
+
+// parsePercentiles parses a comma separated list of percentiles such as
+// "25,50,75".  An empty string gives none.
+func parsePercentiles(s string) ([]float64, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var ps []float64
+	for _, field := range strings.Split(s, ",") {
+		p, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil || p < 0 || p > 100 {
+			return nil, fmt.Errorf("percentiles %s - bad percentile %q", s, field)
+		}
+		ps = append(ps, p)
+	}
+	return ps, nil
+}
+
+// percentileName returns the name of the column or property holding the
+// p'th percentile, for example "p50".
+func percentileName(p float64) string {
+	return "p" + strings.ReplaceAll(strconv.FormatFloat(p, 'f', -1, 64), ".", "_")
+}
+
+// writeZonalCSV writes a line of statistics for each polygon, numbered from
+// 1 in the order they were read.  Polygons covering no data have only their
+// number and a cell count of 0.
+func writeZonalCSV(w io.Writer, stats []esri.Stats, percentiles []float64, cellsize float64) error {
+	out := csv.NewWriter(w)
+	header := []string{"zone", "cells", "area", "min", "max", "mean", "stddev"}
+	for _, p := range percentiles {
+		header = append(header, percentileName(p))
+	}
+	out.Write(header)
+	format := func(v float64) string { return strconv.FormatFloat(v, 'f', 3, 64) }
+	for i, s := range stats {
+		record := []string{strconv.Itoa(i + 1), strconv.Itoa(s.Count)}
+		if s.Count > 0 {
+			record = append(record, format(float64(s.Count)*cellsize*cellsize),
+				format(s.Min), format(s.Max), format(s.Mean), format(s.StdDev))
+			for _, p := range percentiles {
+				record = append(record, format(s.Percentile(p)))
+			}
+		} else {
+			record = append(record, "0", "", "", "", "")
+			for range percentiles {
+				record = append(record, "")
+			}
+		}
+		out.Write(record)
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// writeZonalGeoJSON writes the polygons with their statistics as
+// properties.
+func writeZonalGeoJSON(filename string, polygons []geom.Polygon, stats []esri.Stats, percentiles []float64, cellsize float64) error {
+	fc := new(geojson.FeatureCollection)
+	for i, s := range stats {
+		properties := map[string]interface{}{
+			"zone":  i + 1,
+			"cells": s.Count,
+			"area":  float64(s.Count) * cellsize * cellsize,
+		}
+		if s.Count > 0 {
+			properties["min"] = s.Min
+			properties["max"] = s.Max
+			properties["mean"] = s.Mean
+			properties["stddev"] = s.StdDev
+			for _, p := range percentiles {
+				properties[percentileName(p)] = s.Percentile(p)
+			}
+		}
+		fc.AddMultiPolygon([]geom.Polygon{polygons[i]}, properties)
+	}
+	return fc.WriteToFile(filename)
+}
@@ -0,0 +1,292 @@
+// Package contour draws contour lines through the heights in a Grid using the
+// marching squares algorithm.
+package contour
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/goblimey/tiler/esri"
+	"github.com/goblimey/tiler/geom"
+)
+
+// Contour is a line joining points at the same height.  The points are in
+// the map coordinates of the Grid.  A contour that closes on itself ends
+// with its first point.  Index is set by Classify.
+type Contour struct {
+	Level float64
+	Line  geom.Line
+	Index bool
+}
+
+// edge identifies the side of a square between two cell centres.  Vertical
+// is false for the side from (row, col) to (row, col+1) and true for the
+// side from (row, col) to (row+1, col).
+type edge struct {
+	row, col int
+	vertical bool
+}
+
+// segment is a piece of contour crossing one square.
+type segment struct {
+	a, b edge
+}
+
+// sides of a square, used in the segments table.
+const (
+	top = iota
+	right
+	bottom
+	left
+)
+
+// segments gives the sides of a square joined by the contour for each
+// arrangement of corners at or above the level: top left 8, top right 4,
+// bottom right 2 and bottom left 1.  The saddles 5 and 10 are resolved
+// separately.
+var segments = [16][][2]int{
+	1:  {{left, bottom}},
+	2:  {{bottom, right}},
+	3:  {{left, right}},
+	4:  {{top, right}},
+	6:  {{top, bottom}},
+	7:  {{left, top}},
+	8:  {{left, top}},
+	9:  {{top, bottom}},
+	11: {{top, right}},
+	12: {{left, right}},
+	13: {{bottom, right}},
+	14: {{left, bottom}},
+}
+
+// Extract returns the contours of g at the heights base + n*interval for
+// whole numbers n.  The contours run between the centres of the cells.
+// Squares with a No Data cell at any corner are left out, so contours stop
+// at the edge of the data.
+func Extract(g *esri.Grid, interval, base float64) ([]Contour, error) {
+	if interval <= 0 || math.IsNaN(interval) || math.IsInf(interval, 0) {
+		return nil, fmt.Errorf("Extract: interval %f must be greater than zero", interval)
+	}
+
+	// The segments at each level, and the points where they cross the edges.
+	levels := make(map[int][]segment)
+	points := make(map[int]map[edge]geom.Point)
+
+	minX, _, _, maxY := g.Bounds()
+	cellsize := float64(g.CellSize())
+	centre := func(row, col int) geom.Point {
+		return geom.Point{
+			X: minX + (float64(col)+0.5)*cellsize,
+			Y: maxY - (float64(row)+0.5)*cellsize,
+		}
+	}
+
+	for row := 0; row+1 < g.Nrows(); row++ {
+		for col := 0; col+1 < g.Ncols(); col++ {
+			if g.IsNoData(row, col) || g.IsNoData(row, col+1) ||
+				g.IsNoData(row+1, col) || g.IsNoData(row+1, col+1) {
+				continue
+			}
+			// Corners clockwise from the top left.
+			h := [4]float64{
+				float64(g.Height(row, col)),
+				float64(g.Height(row, col+1)),
+				float64(g.Height(row+1, col+1)),
+				float64(g.Height(row+1, col)),
+			}
+			low := math.Min(math.Min(h[0], h[1]), math.Min(h[2], h[3]))
+			high := math.Max(math.Max(h[0], h[1]), math.Max(h[2], h[3]))
+			first := int(math.Ceil((low - base) / interval))
+			last := int(math.Floor((high - base) / interval))
+			for n := first; n <= last; n++ {
+				level := base + float64(n)*interval
+				index := 0
+				for i, bit := range []int{8, 4, 2, 1} {
+					if h[i] >= level {
+						index |= bit
+					}
+				}
+				pairs := segments[index]
+				if index == 5 || index == 10 {
+					// A saddle.  The average of the corners decides whether
+					// the high corners are joined across the middle.
+					middleHigh := (h[0]+h[1]+h[2]+h[3])/4 >= level
+					if (index == 5) == middleHigh {
+						pairs = [][2]int{{left, top}, {bottom, right}}
+					} else {
+						pairs = [][2]int{{top, right}, {left, bottom}}
+					}
+				}
+				if len(pairs) == 0 {
+					continue
+				}
+				if points[n] == nil {
+					points[n] = make(map[edge]geom.Point)
+				}
+				sides := [4]edge{
+					{row, col, false},
+					{row, col + 1, true},
+					{row + 1, col, false},
+					{row, col, true},
+				}
+				corners := [4]geom.Point{
+					centre(row, col), centre(row, col+1), centre(row+1, col+1), centre(row+1, col),
+				}
+				// The corners at each end of each side.
+				ends := [4][2]int{{0, 1}, {1, 2}, {3, 2}, {0, 3}}
+				for _, pair := range pairs {
+					for _, side := range pair {
+						e := sides[side]
+						if _, ok := points[n][e]; ok {
+							continue
+						}
+						i, j := ends[side][0], ends[side][1]
+						t := (level - h[i]) / (h[j] - h[i])
+						p, q := corners[i], corners[j]
+						points[n][e] = geom.Point{X: p.X + t*(q.X-p.X), Y: p.Y + t*(q.Y-p.Y)}
+					}
+					levels[n] = append(levels[n], segment{sides[pair[0]], sides[pair[1]]})
+				}
+			}
+		}
+	}
+
+	order := make([]int, 0, len(levels))
+	for n := range levels {
+		order = append(order, n)
+	}
+	sort.Ints(order)
+
+	var result []Contour
+	for _, n := range order {
+		level := base + float64(n)*interval
+		for _, edges := range join(levels[n]) {
+			line := make(geom.Line, len(edges))
+			for i, e := range edges {
+				line[i] = points[n][e]
+			}
+			result = append(result, Contour{Level: level, Line: line})
+		}
+	}
+	return result, nil
+}
+
+// join links segments that share an edge into chains of edges.  Open chains
+// come first; a closed chain ends with its first edge.
+func join(segs []segment) [][]edge {
+	at := make(map[edge][]int)
+	for i, s := range segs {
+		at[s.a] = append(at[s.a], i)
+		at[s.b] = append(at[s.b], i)
+	}
+	used := make([]bool, len(segs))
+
+	follow := func(start edge) []edge {
+		chain := []edge{start}
+		current := start
+		for {
+			next := -1
+			for _, i := range at[current] {
+				if !used[i] {
+					next = i
+					break
+				}
+			}
+			if next < 0 {
+				return chain
+			}
+			used[next] = true
+			if segs[next].a == current {
+				current = segs[next].b
+			} else {
+				current = segs[next].a
+			}
+			chain = append(chain, current)
+		}
+	}
+
+	var result [][]edge
+	// Open chains start at an edge used by only one segment.
+	for i, s := range segs {
+		if used[i] {
+			continue
+		}
+		for _, e := range []edge{s.a, s.b} {
+			if len(at[e]) == 1 {
+				result = append(result, follow(e))
+				break
+			}
+		}
+	}
+	for i, s := range segs {
+		if !used[i] {
+			result = append(result, follow(s.a))
+		}
+	}
+	return result
+}
+
+// Label is a place to write the height of a contour.
+type Label struct {
+	Point geom.Point
+	// Angle is the direction of the contour at the label in degrees
+	// anticlockwise from the x axis, between -90 and 90 so that text at
+	// that angle is the right way up.
+	Angle float64
+	Text  string
+}
+
+// Classify marks every nth contour level, counting from base in steps of
+// interval, as an index contour.  Index contours are usually drawn thicker
+// and labelled.
+func Classify(contours []Contour, interval, base float64, n int) {
+	for i := range contours {
+		step := int(math.Round((contours[i].Level - base) / interval))
+		contours[i].Index = n > 0 && step%n == 0
+	}
+}
+
+// Labels returns places along the contour for labels, spacing apart in map
+// units and starting half that distance from the start of the line.  A
+// contour shorter than spacing but at least minLength long gets one label
+// in the middle.
+func (c Contour) Labels(spacing, minLength float64) []Label {
+	length := 0.0
+	for i := 1; i < len(c.Line); i++ {
+		length += math.Hypot(c.Line[i].X-c.Line[i-1].X, c.Line[i].Y-c.Line[i-1].Y)
+	}
+	if length < minLength || length == 0 || spacing <= 0 {
+		return nil
+	}
+	next := spacing / 2
+	if length < spacing {
+		next = length / 2
+	}
+
+	text := strconv.FormatFloat(c.Level, 'f', -1, 64)
+	var result []Label
+	travelled := 0.0
+	for i := 1; i < len(c.Line); i++ {
+		a, b := c.Line[i-1], c.Line[i]
+		d := math.Hypot(b.X-a.X, b.Y-a.Y)
+		for d > 0 && next <= travelled+d {
+			t := (next - travelled) / d
+			angle := math.Atan2(b.Y-a.Y, b.X-a.X) * 180 / math.Pi
+			if angle > 90 {
+				angle -= 180
+			} else if angle < -90 {
+				angle += 180
+			}
+			result = append(result, Label{
+				Point: geom.Point{X: a.X + t*(b.X-a.X), Y: a.Y + t*(b.Y-a.Y)},
+				Angle: angle,
+				Text:  text,
+			})
+			next += spacing
+		}
+		travelled += d
+	}
+	return result
+}
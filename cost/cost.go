@@ -0,0 +1,212 @@
+// Package cost finds the cheapest ways across the ground, where the cost of
+// each step between neighbouring cells depends on how far it goes and how
+// steeply it climbs - for example the quickest walking route between two
+// points.
+package cost
+
+import (
+	"container/heap"
+	"fmt"
+	"math"
+
+	"github.com/goblimey/tiler/esri"
+	"github.com/goblimey/tiler/geom"
+)
+
+// Func returns the cost of a step covering distance map units across the
+// ground while climbing rise map units, which is negative going downhill.
+// It returns +Inf for a step that can't be taken.
+type Func func(distance, rise float64) float64
+
+// Tobler returns the time in seconds needed to walk a step, using Tobler's
+// hiking function: 6 km/h on a gentle downhill slope of 5%, slowing
+// exponentially as the ground gets steeper either way.  Distances must be
+// in metres.
+func Tobler(distance, rise float64) float64 {
+	kmh := 6 * math.Exp(-3.5*math.Abs(rise/distance+0.05))
+	return distance / (kmh / 3.6)
+}
+
+// SlopeWeighted returns a Func giving the distance travelled, increased by
+// penalty times the gradient - with a penalty of 10, a step up or down a
+// 1 in 10 slope costs twice as much as one on the level.
+func SlopeWeighted(penalty float64) Func {
+	return func(distance, rise float64) float64 {
+		return distance * (1 + penalty*math.Abs(rise/distance))
+	}
+}
+
+// Limit returns a Func like f except that steps steeper than maxGradient
+// (rise over distance, uphill or down) can't be taken.
+func Limit(f Func, maxGradient float64) Func {
+	return func(distance, rise float64) float64 {
+		if math.Abs(rise/distance) > maxGradient {
+			return math.Inf(1)
+		}
+		return f(distance, rise)
+	}
+}
+
+// neighbours gives the row and column offsets of the eight cells around a
+// cell and the distance to them in cells.
+var neighbours = []struct {
+	dRow, dCol int
+	distance   float64
+}{
+	{0, 1, 1}, {1, 1, math.Sqrt2}, {1, 0, 1}, {1, -1, math.Sqrt2},
+	{0, -1, 1}, {-1, -1, math.Sqrt2}, {-1, 0, 1}, {-1, 1, math.Sqrt2},
+}
+
+// Path returns the cheapest route across g from the map position from to
+// the map position to, moving between the centres of neighbouring cells,
+// and its cost.  Cells holding the No Data value can't be crossed.  It
+// returns an error if either end is off the Grid or on No Data, or if there
+// is no way through.
+func Path(g *esri.Grid, from, to geom.Point, f Func) (geom.Line, float64, error) {
+	startRow, startCol, err := dataCell(g, from)
+	if err != nil {
+		return nil, 0, fmt.Errorf("Path: start %w", err)
+	}
+	endRow, endCol, err := dataCell(g, to)
+	if err != nil {
+		return nil, 0, fmt.Errorf("Path: end %w", err)
+	}
+	ncols := g.Ncols()
+	end := endRow*ncols + endCol
+	s := search(g, []int{startRow*ncols + startCol}, f, end)
+	if math.IsInf(s.costs[end], 1) {
+		return nil, 0, fmt.Errorf("Path: no way from (%g,%g) to (%g,%g)", from.X, from.Y, to.X, to.Y)
+	}
+
+	// Follow the steps back from the end.
+	var cells []int
+	for i := end; i >= 0; i = s.previous[i] {
+		cells = append(cells, i)
+	}
+	minX, _, _, maxY := g.Bounds()
+	cellsize := float64(g.CellSize())
+	line := make(geom.Line, len(cells))
+	for i, c := range cells {
+		row, col := c/ncols, c%ncols
+		line[len(cells)-1-i] = geom.Point{
+			X: minX + (float64(col)+0.5)*cellsize,
+			Y: maxY - (float64(row)+0.5)*cellsize,
+		}
+	}
+	return line, s.costs[end], nil
+}
+
+// dataCell returns the cell of g holding the map position p, or an error if
+// there's no data there.
+func dataCell(g *esri.Grid, p geom.Point) (row, col int, err error) {
+	row, col, ok := g.Cell(p.X, p.Y)
+	if !ok {
+		return 0, 0, fmt.Errorf("(%g,%g) is off the grid", p.X, p.Y)
+	}
+	if g.IsNoData(row, col) {
+		return 0, 0, fmt.Errorf("(%g,%g) has no data", p.X, p.Y)
+	}
+	return row, col, nil
+}
+
+// searched holds the results of search for the cells of a Grid in row
+// order: the least cost of reaching each cell and the cell the cheapest way
+// there came from, -1 for a start cell or one not reached.
+type searched struct {
+	costs    []float64
+	previous []int
+}
+
+// search finds the cheapest ways from the start cells, given by their
+// indexes in row order, to the other cells of g using Dijkstra's method.
+// It stops early once the cell stop is reached, if stop isn't negative.
+// Cells not reached cost +Inf.
+func search(g *esri.Grid, starts []int, f Func, stop int) searched {
+	nrows, ncols := g.Nrows(), g.Ncols()
+	cellsize := float64(g.CellSize())
+	s := searched{costs: make([]float64, nrows*ncols), previous: make([]int, nrows*ncols)}
+	for i := range s.costs {
+		s.costs[i] = math.Inf(1)
+		s.previous[i] = -1
+	}
+	done := make([]bool, nrows*ncols)
+
+	q := new(cellQueue)
+	for _, i := range starts {
+		s.costs[i] = 0
+		heap.Push(q, cell{0, q.next(), i})
+	}
+	for q.Len() > 0 {
+		c := heap.Pop(q).(cell)
+		if done[c.index] {
+			// Reached more cheaply already.
+			continue
+		}
+		done[c.index] = true
+		if c.index == stop {
+			break
+		}
+		row, col := c.index/ncols, c.index%ncols
+		h := float64(g.Height(row, col))
+		for _, n := range neighbours {
+			r, cl := row+n.dRow, col+n.dCol
+			if r < 0 || r >= nrows || cl < 0 || cl >= ncols || g.IsNoData(r, cl) {
+				continue
+			}
+			i := r*ncols + cl
+			if done[i] {
+				continue
+			}
+			step := f(n.distance*cellsize, float64(g.Height(r, cl))-h)
+			if math.IsInf(step, 1) || math.IsNaN(step) {
+				continue
+			}
+			total := c.cost + step
+			if total < s.costs[i] {
+				s.costs[i] = total
+				s.previous[i] = c.index
+				heap.Push(q, cell{total, q.next(), i})
+			}
+		}
+	}
+	return s
+}
+
+// cell is a cell waiting to be visited by search, given by its index in row
+// order.  order breaks ties between cells of the same cost, first come first
+// served.
+type cell struct {
+	cost  float64
+	order int
+	index int
+}
+
+// cellQueue is a priority queue of cells, cheapest first.
+type cellQueue struct {
+	cells []cell
+	count int
+}
+
+func (q *cellQueue) next() int {
+	q.count++
+	return q.count
+}
+
+func (q cellQueue) Len() int { return len(q.cells) }
+
+func (q cellQueue) Less(i, j int) bool {
+	if q.cells[i].cost != q.cells[j].cost {
+		return q.cells[i].cost < q.cells[j].cost
+	}
+	return q.cells[i].order < q.cells[j].order
+}
+
+func (q cellQueue) Swap(i, j int) { q.cells[i], q.cells[j] = q.cells[j], q.cells[i] }
+
+func (q *cellQueue) Push(x interface{}) { q.cells = append(q.cells, x.(cell)) }
+
+func (q *cellQueue) Pop() interface{} {
+	last := q.cells[len(q.cells)-1]
+	q.cells = q.cells[:len(q.cells)-1]
+	return last
+}
@@ -0,0 +1,52 @@
+package cost
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/goblimey/tiler/esri"
+	"github.com/goblimey/tiler/geom"
+)
+
+// Distance returns a Grid covering the same area as g that gives the least
+// cost of reaching each cell from the nearest of the seed points, in map
+// coordinates - with Tobler, the walking time in seconds.  Contours of the
+// result are isochrones, joining the places that take the same time to
+// reach.  Cells that can't be reached, and cells holding the No Data value,
+// are No Data in the result.  It returns an error if a seed is off the Grid
+// or on No Data.
+func Distance(g *esri.Grid, seeds []geom.Point, f Func) (*esri.Grid, error) {
+	if len(seeds) == 0 {
+		return nil, fmt.Errorf("Distance: no seeds")
+	}
+	ncols := g.Ncols()
+	starts := make([]int, len(seeds))
+	for i, p := range seeds {
+		row, col, err := dataCell(g, p)
+		if err != nil {
+			return nil, fmt.Errorf("Distance: seed %w", err)
+		}
+		starts[i] = row*ncols + col
+	}
+	s := search(g, starts, f, -1)
+
+	result := esri.NewGrid(ncols, g.Nrows())
+	result.SetXllcorner(g.Xllcorner())
+	result.SetYllcorner(g.Yllcorner())
+	result.SetCellSize(g.CellSize())
+	result.SetNoDataValue(g.NoDataValue())
+	if result.NoDataValue() >= 0 {
+		// Costs are never negative, so a negative value can't clash.
+		result.SetNoDataValue(-9999)
+	}
+	noData := float32(result.NoDataValue())
+	for i, c := range s.costs {
+		row, col := i/ncols, i%ncols
+		if math.IsInf(c, 1) {
+			result.SetHeight(row, col, noData)
+		} else {
+			result.SetHeight(row, col, float32(c))
+		}
+	}
+	return result, nil
+}
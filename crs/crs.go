@@ -0,0 +1,54 @@
+// Package crs converts between the map coordinates used by grids and
+// longitude and latitude.  ESRI grid files don't say which coordinate
+// reference system they use, so the caller has to supply it.  UK Environment
+// Agency data uses the Ordnance Survey National Grid (EPSG:27700), which is
+// the default.
+package crs
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CRS is a coordinate reference system.
+type CRS interface {
+	// Code returns the EPSG code, for example "EPSG:27700".
+	Code() string
+	// ToWGS84 converts map coordinates to WGS84 longitude and latitude in
+	// degrees.
+	ToWGS84(x, y float64) (lon, lat float64)
+	// FromWGS84 converts WGS84 longitude and latitude in degrees to map
+	// coordinates.
+	FromWGS84(lon, lat float64) (x, y float64)
+}
+
+// Default is the coordinate reference system assumed if none is given.
+const Default = "EPSG:27700"
+
+// Lookup returns the CRS with the given EPSG code.  The "EPSG:" prefix is
+// optional.
+func Lookup(code string) (CRS, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	code = strings.TrimPrefix(code, "EPSG:")
+	switch code {
+	case "27700":
+		return OSGB{}, nil
+	case "4326":
+		return WGS84{}, nil
+	case "3857", "900913":
+		return WebMercator{}, nil
+	}
+	return nil, fmt.Errorf("unsupported coordinate reference system %s", code)
+}
+
+// WGS84 is plain longitude and latitude (EPSG:4326), with x as longitude.
+type WGS84 struct{}
+
+// Code returns "EPSG:4326".
+func (WGS84) Code() string { return "EPSG:4326" }
+
+// ToWGS84 returns x and y unchanged.
+func (WGS84) ToWGS84(x, y float64) (lon, lat float64) { return x, y }
+
+// FromWGS84 returns lon and lat unchanged.
+func (WGS84) FromWGS84(lon, lat float64) (x, y float64) { return lon, lat }
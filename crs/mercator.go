@@ -0,0 +1,31 @@
+package crs
+
+import "math"
+
+// EarthRadius is the radius of the sphere used by Web Mercator, in metres.
+const EarthRadius = 6378137.0
+
+// MercatorExtent is the distance in metres from the origin to the edge of the
+// Web Mercator world square.
+const MercatorExtent = math.Pi * EarthRadius
+
+// WebMercator is the spherical Mercator projection used by web maps
+// (EPSG:3857).
+type WebMercator struct{}
+
+// Code returns "EPSG:3857".
+func (WebMercator) Code() string { return "EPSG:3857" }
+
+// ToWGS84 converts Web Mercator metres to longitude and latitude.
+func (WebMercator) ToWGS84(x, y float64) (lon, lat float64) {
+	lon = x / EarthRadius * 180 / math.Pi
+	lat = math.Atan(math.Sinh(y/EarthRadius)) * 180 / math.Pi
+	return lon, lat
+}
+
+// FromWGS84 converts longitude and latitude to Web Mercator metres.
+func (WebMercator) FromWGS84(lon, lat float64) (x, y float64) {
+	x = lon * math.Pi / 180 * EarthRadius
+	y = math.Log(math.Tan(math.Pi/4+lat*math.Pi/360)) * EarthRadius
+	return x, y
+}
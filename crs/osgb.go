@@ -0,0 +1,281 @@
+package crs
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// OSGB is the Ordnance Survey National Grid (EPSG:27700) - a transverse
+// Mercator projection of the OSGB36 datum.  The conversion to WGS84 uses the
+// seven parameter Helmert transformation published by the Ordnance Survey,
+// which is good to a few metres.  The formulae are from "A Guide to
+// Coordinate Systems in Great Britain".
+type OSGB struct{}
+
+// Airy 1830 ellipsoid and the National Grid projection constants.
+const (
+	airyA     = 6377563.396
+	airyB     = 6356256.909
+	osgbF0    = 0.9996012717
+	osgbLat0  = 49 * math.Pi / 180
+	osgbLon0  = -2 * math.Pi / 180
+	osgbE0    = 400000.0
+	osgbN0    = -100000.0
+	grs80A    = 6378137.0
+	grs80B    = 6356752.3141
+	arcSecond = math.Pi / (180 * 3600)
+)
+
+// GridReference returns the Ordnance Survey grid reference of the square
+// containing a National Grid easting and northing - the two letters of the
+// 100 km square followed by figures digits of each of the easting and
+// northing within it, for example TQ1652 for the 1 km square at 516000,
+// 152000 with figures 2.
+func GridReference(e, n float64, figures int) (string, error) {
+	if e < 0 || e >= 700000 || n < 0 || n >= 1300000 {
+		return "", fmt.Errorf("%g,%g is outside the National Grid", e, n)
+	}
+	if figures < 0 || figures > 5 {
+		return "", fmt.Errorf("grid reference with %d figures - expected 0 to 5", figures)
+	}
+	e100k := int(e) / 100000
+	n100k := int(n) / 100000
+	// The letters run from A to Z, leaving out I, in five by five blocks
+	// from the top left.
+	first := (19-n100k)/5*5 + (e100k+10)/5
+	second := (19-n100k)*5%25 + e100k%5
+	letter := func(i int) byte {
+		if i > 7 {
+			i++
+		}
+		return byte('A' + i)
+	}
+	if figures == 0 {
+		return string([]byte{letter(first), letter(second)}), nil
+	}
+	scale := int(math.Pow10(5 - figures))
+	return fmt.Sprintf("%c%c%0*d%0*d", letter(first), letter(second),
+		figures, int(e)%100000/scale, figures, int(n)%100000/scale), nil
+}
+
+// ParseGridReference returns the National Grid easting and northing of
+// the south west corner of the square given by an Ordnance Survey grid
+// reference, and the length of its side in metres.  The reference is two
+// letters and an even number of figures, such as TQ1652, optionally
+// followed by the quarter of a 10 km square - TQ15se is the 5 km square in
+// the south east corner of TQ15.  Spaces and case are ignored.
+func ParseGridReference(ref string) (e, n, size float64, err error) {
+	s := strings.ToUpper(strings.ReplaceAll(ref, " ", ""))
+	quarter := ""
+	for _, q := range []string{"NW", "NE", "SW", "SE"} {
+		if len(s) > 2 && strings.HasSuffix(s, q) {
+			quarter, s = q, strings.TrimSuffix(s, q)
+			break
+		}
+	}
+	bad := fmt.Errorf("%q is not a grid reference - expected two letters and an even number of figures, such as TQ1652", ref)
+	if len(s) < 2 || len(s)%2 != 0 || len(s) > 12 {
+		return 0, 0, 0, bad
+	}
+	index := func(c byte) int {
+		if c < 'A' || c > 'Z' || c == 'I' {
+			return -1
+		}
+		if c > 'I' {
+			return int(c-'A') - 1
+		}
+		return int(c - 'A')
+	}
+	first, second := index(s[0]), index(s[1])
+	if first < 0 || second < 0 {
+		return 0, 0, 0, bad
+	}
+	e100k := first%5*5 - 10 + second%5
+	n100k := 19 - (first/5*5 + second/5)
+	if e100k < 0 || e100k >= 7 || n100k < 0 || n100k >= 13 {
+		return 0, 0, 0, fmt.Errorf("%q is outside the National Grid", ref)
+	}
+	figures := (len(s) - 2) / 2
+	size = 100000 / math.Pow10(figures)
+	e, n = float64(e100k)*100000, float64(n100k)*100000
+	if figures > 0 {
+		de, err1 := strconv.Atoi(s[2 : 2+figures])
+		dn, err2 := strconv.Atoi(s[2+figures:])
+		if err1 != nil || err2 != nil || strings.ContainsAny(s[2:], "+-") {
+			return 0, 0, 0, bad
+		}
+		e += float64(de) * size
+		n += float64(dn) * size
+	}
+	if quarter != "" {
+		if figures != 1 {
+			return 0, 0, 0, fmt.Errorf("%q - only a 10 km square, such as TQ15, has quarters", ref)
+		}
+		size /= 2
+		if quarter[1] == 'E' {
+			e += size
+		}
+		if quarter[0] == 'N' {
+			n += size
+		}
+	}
+	return e, n, size, nil
+}
+
+// helmert holds the parameters of a seven parameter transformation.
+type helmert struct {
+	tx, ty, tz float64 // metres
+	s          float64 // parts per million
+	rx, ry, rz float64 // arc seconds
+}
+
+var wgs84ToOSGB36 = helmert{-446.448, 125.157, -542.060, 20.4894, -0.1502, -0.2470, -0.8421}
+var osgb36ToWGS84 = helmert{446.448, -125.157, 542.060, -20.4894, 0.1502, 0.2470, 0.8421}
+
+// Code returns "EPSG:27700".
+func (OSGB) Code() string { return "EPSG:27700" }
+
+// ToWGS84 converts a National Grid easting and northing to longitude and
+// latitude.
+func (OSGB) ToWGS84(x, y float64) (lon, lat float64) {
+	phi, lambda := gridToLatLon(x, y)
+	cx, cy, cz := toCartesian(phi, lambda, airyA, airyB)
+	cx, cy, cz = osgb36ToWGS84.apply(cx, cy, cz)
+	phi, lambda = fromCartesian(cx, cy, cz, grs80A, grs80B)
+	return lambda * 180 / math.Pi, phi * 180 / math.Pi
+}
+
+// FromWGS84 converts longitude and latitude to a National Grid easting and
+// northing.
+func (OSGB) FromWGS84(lon, lat float64) (x, y float64) {
+	cx, cy, cz := toCartesian(lat*math.Pi/180, lon*math.Pi/180, grs80A, grs80B)
+	cx, cy, cz = wgs84ToOSGB36.apply(cx, cy, cz)
+	phi, lambda := fromCartesian(cx, cy, cz, airyA, airyB)
+	return latLonToGrid(phi, lambda)
+}
+
+func (h helmert) apply(x, y, z float64) (float64, float64, float64) {
+	s := 1 + h.s*1e-6
+	rx := h.rx * arcSecond
+	ry := h.ry * arcSecond
+	rz := h.rz * arcSecond
+	return h.tx + s*x - rz*y + ry*z,
+		h.ty + rz*x + s*y - rx*z,
+		h.tz - ry*x + rx*y + s*z
+}
+
+// toCartesian converts latitude and longitude in radians on the given
+// ellipsoid to earth-centred cartesian coordinates, assuming zero height.
+func toCartesian(phi, lambda, a, b float64) (x, y, z float64) {
+	e2 := 1 - b*b/(a*a)
+	sinPhi := math.Sin(phi)
+	nu := a / math.Sqrt(1-e2*sinPhi*sinPhi)
+	x = nu * math.Cos(phi) * math.Cos(lambda)
+	y = nu * math.Cos(phi) * math.Sin(lambda)
+	z = (1 - e2) * nu * sinPhi
+	return x, y, z
+}
+
+// fromCartesian converts earth-centred cartesian coordinates to latitude and
+// longitude in radians on the given ellipsoid.
+func fromCartesian(x, y, z, a, b float64) (phi, lambda float64) {
+	e2 := 1 - b*b/(a*a)
+	p := math.Sqrt(x*x + y*y)
+	phi = math.Atan2(z, p*(1-e2))
+	for i := 0; i < 10; i++ {
+		sinPhi := math.Sin(phi)
+		nu := a / math.Sqrt(1-e2*sinPhi*sinPhi)
+		next := math.Atan2(z+e2*nu*sinPhi, p)
+		if math.Abs(next-phi) < 1e-12 {
+			phi = next
+			break
+		}
+		phi = next
+	}
+	return phi, math.Atan2(y, x)
+}
+
+// meridionalArc returns the developed arc of the meridian from the true
+// origin to latitude phi.
+func meridionalArc(phi float64) float64 {
+	n := (airyA - airyB) / (airyA + airyB)
+	n2 := n * n
+	n3 := n2 * n
+	dPhi := phi - osgbLat0
+	sPhi := phi + osgbLat0
+	return airyB * osgbF0 * ((1+n+1.25*n2+1.25*n3)*dPhi -
+		(3*n+3*n2+21.0/8*n3)*math.Sin(dPhi)*math.Cos(sPhi) +
+		(15.0/8*n2+15.0/8*n3)*math.Sin(2*dPhi)*math.Cos(2*sPhi) -
+		35.0/24*n3*math.Sin(3*dPhi)*math.Cos(3*sPhi))
+}
+
+// latLonToGrid projects OSGB36 latitude and longitude in radians onto the
+// National Grid.
+func latLonToGrid(phi, lambda float64) (e, n float64) {
+	e2 := 1 - airyB*airyB/(airyA*airyA)
+	sinPhi := math.Sin(phi)
+	cosPhi := math.Cos(phi)
+	tanPhi := math.Tan(phi)
+	tan2 := tanPhi * tanPhi
+	tan4 := tan2 * tan2
+	nu := airyA * osgbF0 / math.Sqrt(1-e2*sinPhi*sinPhi)
+	rho := airyA * osgbF0 * (1 - e2) / math.Pow(1-e2*sinPhi*sinPhi, 1.5)
+	eta2 := nu/rho - 1
+	cos3 := cosPhi * cosPhi * cosPhi
+	cos5 := cos3 * cosPhi * cosPhi
+
+	i := meridionalArc(phi) + osgbN0
+	ii := nu / 2 * sinPhi * cosPhi
+	iii := nu / 24 * sinPhi * cos3 * (5 - tan2 + 9*eta2)
+	iiia := nu / 720 * sinPhi * cos5 * (61 - 58*tan2 + tan4)
+	iv := nu * cosPhi
+	v := nu / 6 * cos3 * (nu/rho - tan2)
+	vi := nu / 120 * cos5 * (5 - 18*tan2 + tan4 + 14*eta2 - 58*tan2*eta2)
+
+	dl := lambda - osgbLon0
+	dl2 := dl * dl
+	n = i + ii*dl2 + iii*dl2*dl2 + iiia*dl2*dl2*dl2
+	e = osgbE0 + iv*dl + v*dl2*dl + vi*dl2*dl2*dl
+	return e, n
+}
+
+// gridToLatLon converts a National Grid easting and northing to OSGB36
+// latitude and longitude in radians.
+func gridToLatLon(e, n float64) (phi, lambda float64) {
+	e2 := 1 - airyB*airyB/(airyA*airyA)
+	phi = (n-osgbN0)/(airyA*osgbF0) + osgbLat0
+	m := meridionalArc(phi)
+	for i := 0; i < 20 && math.Abs(n-osgbN0-m) >= 0.00001; i++ {
+		phi += (n - osgbN0 - m) / (airyA * osgbF0)
+		m = meridionalArc(phi)
+	}
+
+	sinPhi := math.Sin(phi)
+	secPhi := 1 / math.Cos(phi)
+	tanPhi := math.Tan(phi)
+	tan2 := tanPhi * tanPhi
+	tan4 := tan2 * tan2
+	tan6 := tan4 * tan2
+	nu := airyA * osgbF0 / math.Sqrt(1-e2*sinPhi*sinPhi)
+	rho := airyA * osgbF0 * (1 - e2) / math.Pow(1-e2*sinPhi*sinPhi, 1.5)
+	eta2 := nu/rho - 1
+	nu3 := nu * nu * nu
+	nu5 := nu3 * nu * nu
+	nu7 := nu5 * nu * nu
+
+	vii := tanPhi / (2 * rho * nu)
+	viii := tanPhi / (24 * rho * nu3) * (5 + 3*tan2 + eta2 - 9*tan2*eta2)
+	ix := tanPhi / (720 * rho * nu5) * (61 + 90*tan2 + 45*tan4)
+	x := secPhi / nu
+	xi := secPhi / (6 * nu3) * (nu/rho + 2*tan2)
+	xii := secPhi / (120 * nu5) * (5 + 28*tan2 + 24*tan4)
+	xiia := secPhi / (5040 * nu7) * (61 + 662*tan2 + 1320*tan4 + 720*tan6)
+
+	de := e - osgbE0
+	de2 := de * de
+	phi = phi - vii*de2 + viii*de2*de2 - ix*de2*de2*de2
+	lambda = osgbLon0 + x*de - xi*de2*de + xii*de2*de2*de - xiia*de2*de2*de2*de
+	return phi, lambda
+}
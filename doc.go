@@ -0,0 +1,6 @@
+// Package tiler holds the packages behind the tiler program, which draws
+// ESRI grid files of heights as pictures and web map tiles.  The program
+// itself is in cmd/tiler.  The esri package reads and writes grids, render
+// draws them, tile cuts them into z/x/y tiles and pipeline chains those
+// steps together.
+package tiler
@@ -0,0 +1,156 @@
+package esri
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// The binary grid format is a compact copy of a Grid that loads much faster
+// than the text format, for use as a cache.  It is a header of
+//
+//	magic "TILERGRD", version, ncols, nrows (uint32)
+//	xllcorner, yllcorner, cellsize (float32), NODATA_value (int32)
+//	smallest and largest heights (float32), 1 if they are set (uint32)
+//
+// followed by the heights as float32, a row at a time from the top, all
+// least significant byte first.  Version 1 files, which don't have the
+// smallest and largest heights, can still be read.
+
+// BinaryMagic starts every binary grid, so that it can be recognised.
+const BinaryMagic = "TILERGRD"
+
+// binaryVersion is the version of the binary grid format.
+const binaryVersion = 2
+
+// binaryHeader is the fixed part of a binary grid.
+type binaryHeader struct {
+	Magic     [8]byte
+	Version   uint32
+	Ncols     uint32
+	Nrows     uint32
+	Xllcorner float32
+	Yllcorner float32
+	CellSize  float32
+	NoData    int32
+}
+
+// binaryRange follows binaryHeader from version 2, so that a mapped grid
+// doesn't have to look at every height to find the range.
+type binaryRange struct {
+	MinHeight float32
+	MaxHeight float32
+	Set       uint32
+}
+
+// ReadBinaryGridFromFile is a factory method that reads a Grid from a file
+// in the binary grid format.
+func ReadBinaryGridFromFile(filename string) (*Grid, error) {
+	in, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	g, err := ReadBinaryGrid(in)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return g, nil
+}
+
+// ReadBinaryGrid is a factory method that reads a Grid in the binary grid
+// format.
+func ReadBinaryGrid(in io.Reader) (*Grid, error) {
+	r := bufio.NewReader(in)
+	var h binaryHeader
+	err := binary.Read(r, binary.LittleEndian, &h)
+	if err != nil {
+		return nil, err
+	}
+	if string(h.Magic[:]) != BinaryMagic {
+		return nil, fmt.Errorf("not a binary grid")
+	}
+	if h.Version < 1 || h.Version > binaryVersion {
+		return nil, fmt.Errorf("binary grid version %d - expected %d", h.Version, binaryVersion)
+	}
+	if h.Version > 1 {
+		// SetHeight finds the range again as the heights are read.
+		var hr binaryRange
+		err = binary.Read(r, binary.LittleEndian, &hr)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := CheckSize(int(h.Ncols), int(h.Nrows)); err != nil {
+		return nil, err
+	}
+	g := NewGrid(int(h.Ncols), int(h.Nrows))
+	g.SetXllcorner(h.Xllcorner)
+	g.SetYllcorner(h.Yllcorner)
+	g.SetCellSize(h.CellSize)
+	g.SetNoDataValue(int(h.NoData))
+	buf := make([]byte, 4*g.ncols)
+	for row := 0; row < g.nrows; row++ {
+		_, err := io.ReadFull(r, buf)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", row+1, err)
+		}
+		for col := 0; col < g.ncols; col++ {
+			g.SetHeight(row, col, math.Float32frombits(binary.LittleEndian.Uint32(buf[4*col:])))
+		}
+	}
+	return g, nil
+}
+
+// WriteBinaryToFile writes the Grid to a file in the binary grid format.
+func (g Grid) WriteBinaryToFile(filename string) error {
+	out, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	err = g.WriteBinary(out)
+	if err != nil {
+		out.Close()
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+	return out.Close()
+}
+
+// WriteBinary writes the Grid in the binary grid format, as read by
+// ReadBinaryGrid.
+func (g Grid) WriteBinary(w io.Writer) error {
+	out := bufio.NewWriter(w)
+	h := binaryHeader{
+		Version:   binaryVersion,
+		Ncols:     uint32(g.ncols),
+		Nrows:     uint32(g.nrows),
+		Xllcorner: g.xllcorner,
+		Yllcorner: g.yllcorner,
+		CellSize:  g.cellsize,
+		NoData:    int32(g.noDataValue),
+	}
+	copy(h.Magic[:], BinaryMagic)
+	err := binary.Write(out, binary.LittleEndian, &h)
+	if err != nil {
+		return err
+	}
+	hr := binaryRange{MinHeight: g.minHeight, MaxHeight: g.maxHeight}
+	if g.minHeightSet && g.maxHeightSet {
+		hr.Set = 1
+	}
+	err = binary.Write(out, binary.LittleEndian, &hr)
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, 4*g.ncols)
+	for row := 0; row < g.nrows; row++ {
+		for col, height := range g.height[row] {
+			binary.LittleEndian.PutUint32(buf[4*col:], math.Float32bits(height))
+		}
+		out.Write(buf)
+	}
+	return out.Flush()
+}
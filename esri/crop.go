@@ -0,0 +1,58 @@
+package esri
+
+import (
+	"fmt"
+	"math"
+)
+
+// Crop returns a new Grid containing the cells of g that overlap the bounding
+// box (minX, minY) to (maxX, maxY), given in map coordinates.  The corner
+// coordinates of the result are recomputed so that it sits at the same place
+// on the map as the original cells.  A cell that is partly inside the box is
+// included.
+func (g Grid) Crop(minX, minY, maxX, maxY float32) (*Grid, error) {
+	if minX >= maxX || minY >= maxY {
+		return nil, fmt.Errorf("Crop: empty bounding box (%f,%f) (%f,%f)",
+			minX, minY, maxX, maxY)
+	}
+
+	top := g.yllcorner + float32(g.nrows)*g.cellsize
+
+	// Column and row ranges, first inclusive, last exclusive.
+	firstCol := int(math.Floor(float64((minX - g.xllcorner) / g.cellsize)))
+	lastCol := int(math.Ceil(float64((maxX - g.xllcorner) / g.cellsize)))
+	firstRow := int(math.Floor(float64((top - maxY) / g.cellsize)))
+	lastRow := int(math.Ceil(float64((top - minY) / g.cellsize)))
+
+	if firstCol < 0 {
+		firstCol = 0
+	}
+	if lastCol > g.ncols {
+		lastCol = g.ncols
+	}
+	if firstRow < 0 {
+		firstRow = 0
+	}
+	if lastRow > g.nrows {
+		lastRow = g.nrows
+	}
+
+	if firstCol >= lastCol || firstRow >= lastRow {
+		return nil, fmt.Errorf("Crop: bounding box (%f,%f) (%f,%f) does not overlap the grid",
+			minX, minY, maxX, maxY)
+	}
+
+	result := NewGrid(lastCol-firstCol, lastRow-firstRow)
+	result.SetXllcorner(g.xllcorner + float32(firstCol)*g.cellsize)
+	result.SetYllcorner(g.yllcorner + float32(g.nrows-lastRow)*g.cellsize)
+	result.SetCellSize(g.cellsize)
+	result.SetNoDataValue(g.noDataValue)
+
+	for row := firstRow; row < lastRow; row++ {
+		for col := firstCol; col < lastCol; col++ {
+			result.SetHeight(row-firstRow, col-firstCol, g.height[row][col])
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,76 @@
+package esri
+
+import (
+	"errors"
+	"fmt"
+)
+
+// HeaderError is a fault in the header of an ESRI Grid - a missing line, a
+// line with the wrong name or a value that isn't a number.  Use errors.As
+// to find it under the errors that wrap it.
+type HeaderError struct {
+	File string
+	// Line is the line of the file, from 1.
+	Line int
+	// Column is 1 for the name of the field and 2 for its value, or 0 if
+	// the whole line is at fault.
+	Column int
+	// Field is the name of the field expected on the line, such as "ncols".
+	Field string
+	// Token is the text at fault, or "" if there is none.
+	Token string
+	Err   error
+}
+
+// Error gives the line and what's wrong with it.  The file isn't
+// included, because the callers of the readers already know it.
+func (e *HeaderError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *HeaderError) Unwrap() error {
+	return e.Err
+}
+
+// DataError is a fault in the rows of an ESRI Grid - a value that isn't a
+// number, a line with the wrong number of values or that's too long, or
+// too few or too many lines.  Only a bad value is always an error; the
+// rest are warnings unless WithStrict is given.  Use errors.As to find it
+// under the errors that wrap it.
+type DataError struct {
+	File string
+	// Line is the line of the file, from 1.
+	Line int
+	// Column is the position of the value in the line, from 1, or 0 if
+	// the whole line is at fault.
+	Column int
+	// Token is the text at fault, or "" if there is none.
+	Token string
+	Err   error
+}
+
+// Error gives the line, the column if there is one, and what's wrong.  The
+// file isn't included, because the callers of the readers already know it.
+func (e *DataError) Error() string {
+	if e.Column > 0 {
+		return fmt.Sprintf("line %d column %d: %v", e.Line, e.Column, e.Err)
+	}
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *DataError) Unwrap() error {
+	return e.Err
+}
+
+// ErrNotNumber is the error under a DataError or HeaderError for a value
+// that isn't a number.
+var ErrNotNumber = errors.New("not a number")
+
+// badValue returns the DataError for token, the value at the given line
+// and column, which isn't a number.
+func badValue(file string, line, column int, token []byte) *DataError {
+	return &DataError{File: file, Line: line, Column: column, Token: string(token),
+		Err: fmt.Errorf("%q is %w", token, ErrNotNumber)}
+}
@@ -0,0 +1,199 @@
+package esri
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DefaultNoData is the No Data value given to grids read from formats whose
+// No Data value isn't a whole number, such as NaN.
+const DefaultNoData = -9999
+
+// NoDataFor returns the No Data value for a Grid made from data in another
+// format whose No Data value is v.
+func NoDataFor(v float64) int {
+	if v == math.Trunc(v) && math.Abs(v) < 1e9 {
+		return int(v)
+	}
+	return DefaultNoData
+}
+
+// ReadFloatGridFromFile is a factory method that reads an ESRI GridFloat
+// grid - a .flt file of 32 bit floating point heights with a .hdr header
+// file beside it.  filename can be either of the two.
+func ReadFloatGridFromFile(filename string) (*Grid, error) {
+	base := strings.TrimSuffix(filename, filepath.Ext(filename))
+	header, err := os.Open(base + ".hdr")
+	if err != nil {
+		return nil, err
+	}
+	defer header.Close()
+	data, err := os.Open(base + ".flt")
+	if err != nil {
+		return nil, err
+	}
+	defer data.Close()
+	g, err := ReadFloatGrid(header, data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", base+".flt", err)
+	}
+	return g, nil
+}
+
+// ReadFloatGrid is a factory method that reads an ESRI GridFloat grid from
+// its header and its data.
+func ReadFloatGrid(header, data io.Reader) (*Grid, error) {
+	fields := make(map[string]string)
+	scanner := bufio.NewScanner(header)
+	for scanner.Scan() {
+		field := strings.Fields(scanner.Text())
+		if len(field) >= 2 {
+			fields[strings.ToLower(field[0])] = field[1]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	number := func(name string) (float64, error) {
+		s, ok := fields[name]
+		if !ok {
+			return 0, fmt.Errorf("header has no %s", name)
+		}
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0, fmt.Errorf("header %s %q is not a number", name, s)
+		}
+		return v, nil
+	}
+
+	ncols, err := number("ncols")
+	if err != nil {
+		return nil, err
+	}
+	nrows, err := number("nrows")
+	if err != nil {
+		return nil, err
+	}
+	cellsize, err := number("cellsize")
+	if err != nil {
+		return nil, err
+	}
+	if ncols < 1 || nrows < 1 || cellsize <= 0 {
+		return nil, fmt.Errorf("header gives %g columns and %g rows of size %g", ncols, nrows, cellsize)
+	}
+	// The position is of the lower left corner or of the centre of the
+	// lower left cell.
+	var x, y float64
+	if _, ok := fields["xllcenter"]; ok {
+		x, err = number("xllcenter")
+		x -= cellsize / 2
+	} else {
+		x, err = number("xllcorner")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := fields["yllcenter"]; ok {
+		y, err = number("yllcenter")
+		y -= cellsize / 2
+	} else {
+		y, err = number("yllcorner")
+	}
+	if err != nil {
+		return nil, err
+	}
+	noData := math.NaN()
+	if _, ok := fields["nodata_value"]; ok {
+		noData, err = number("nodata_value")
+		if err != nil {
+			return nil, err
+		}
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	switch strings.ToUpper(fields["byteorder"]) {
+	case "", "LSBFIRST", "I":
+	case "MSBFIRST", "M":
+		order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("header byteorder %q - expected LSBFIRST or MSBFIRST", fields["byteorder"])
+	}
+
+	if err := CheckSize(int(ncols), int(nrows)); err != nil {
+		return nil, err
+	}
+	g := NewGrid(int(ncols), int(nrows))
+	g.SetXllcorner(float32(x))
+	g.SetYllcorner(float32(y))
+	g.SetCellSize(float32(cellsize))
+	g.SetNoDataValue(NoDataFor(noData))
+	r := bufio.NewReader(data)
+	buf := make([]byte, 4*g.ncols)
+	for row := 0; row < g.nrows; row++ {
+		_, err := io.ReadFull(r, buf)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", row+1, err)
+		}
+		for col := 0; col < g.ncols; col++ {
+			h := math.Float32frombits(order.Uint32(buf[4*col:]))
+			if h != h || h == float32(noData) {
+				h = float32(g.noDataValue)
+			}
+			g.SetHeight(row, col, h)
+		}
+	}
+	return g, nil
+}
+
+// WriteFloatToFile writes the Grid in ESRI GridFloat format, as a .flt file
+// and a .hdr file.  filename can be the name of either.
+func (g Grid) WriteFloatToFile(filename string) error {
+	base := strings.TrimSuffix(filename, filepath.Ext(filename))
+	header, err := os.Create(base + ".hdr")
+	if err != nil {
+		return err
+	}
+	data, err := os.Create(base + ".flt")
+	if err != nil {
+		header.Close()
+		return err
+	}
+	err = g.WriteFloat(header, data)
+	err1 := header.Close()
+	err2 := data.Close()
+	if err == nil {
+		err = err1
+	}
+	if err == nil {
+		err = err2
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", base+".flt", err)
+	}
+	return nil
+}
+
+// WriteFloat writes the Grid in ESRI GridFloat format, the header to header
+// and the heights, least significant byte first, to data.
+func (g Grid) WriteFloat(header, data io.Writer) error {
+	_, err := fmt.Fprintf(header, "ncols %d\nnrows %d\nxllcorner %g\nyllcorner %g\ncellsize %g\nNODATA_value %d\nbyteorder LSBFIRST\n",
+		g.ncols, g.nrows, g.xllcorner, g.yllcorner, g.cellsize, g.noDataValue)
+	if err != nil {
+		return err
+	}
+	out := bufio.NewWriter(data)
+	buf := make([]byte, 4*g.ncols)
+	for row := 0; row < g.nrows; row++ {
+		for col, h := range g.height[row] {
+			binary.LittleEndian.PutUint32(buf[4*col:], math.Float32bits(h))
+		}
+		out.Write(buf)
+	}
+	return out.Flush()
+}
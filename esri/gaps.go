@@ -0,0 +1,58 @@
+package esri
+
+import "math"
+
+// gapDirections are the directions searched for data by FillGaps.
+var gapDirections = [][2]int{
+	{0, 1}, {1, 1}, {1, 0}, {1, -1}, {0, -1}, {-1, -1}, {-1, 0}, {-1, 1},
+	{1, 2}, {2, 1}, {2, -1}, {1, -2}, {-1, -2}, {-2, -1}, {-2, 1}, {-1, 2},
+}
+
+// FillGaps returns a copy of g in which the cells holding the No Data value
+// are given heights interpolated from the data around them.  For each
+// such cell the nearest cell holding data is found in each of sixteen
+// directions, looking no further than maxDistance map units, and their
+// heights are averaged weighted by the inverse square of their distance.
+// Cells with no data within maxDistance in any direction are left as they
+// are.  The heights used are always the original ones, never filled ones.
+func (g Grid) FillGaps(maxDistance float64) *Grid {
+	result := NewGrid(g.ncols, g.nrows)
+	result.SetXllcorner(g.xllcorner)
+	result.SetYllcorner(g.yllcorner)
+	result.SetCellSize(g.cellsize)
+	result.SetNoDataValue(g.noDataValue)
+
+	limit := maxDistance / float64(g.cellsize)
+	for row := 0; row < g.nrows; row++ {
+		for col := 0; col < g.ncols; col++ {
+			if !g.IsNoData(row, col) {
+				result.SetHeight(row, col, g.height[row][col])
+				continue
+			}
+			sum, weights := 0.0, 0.0
+			for _, d := range gapDirections {
+				step := math.Hypot(float64(d[0]), float64(d[1]))
+				for i := 1; float64(i)*step <= limit; i++ {
+					r, c := row+i*d[0], col+i*d[1]
+					if r < 0 || r >= g.nrows || c < 0 || c >= g.ncols {
+						break
+					}
+					if g.IsNoData(r, c) {
+						continue
+					}
+					distance := float64(i) * step
+					w := 1 / (distance * distance)
+					sum += w * float64(g.height[r][c])
+					weights += w
+					break
+				}
+			}
+			if weights > 0 {
+				result.SetHeight(row, col, float32(sum/weights))
+			} else {
+				result.SetHeight(row, col, g.height[row][col])
+			}
+		}
+	}
+	return result
+}
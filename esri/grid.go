@@ -2,11 +2,16 @@ package esri
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
+	"math"
 	"os"
-	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 )
 
 // Grid defines a data structure that holds a 3D ESRI Grid read from a
@@ -56,154 +61,162 @@ type Grid struct {
 	minHeightSet bool
 	minHeight    float32
 	height       [][]float32
-	verbose      bool
+	// mapped says which rows are still in a read only mapping of a file -
+	// see MapBinaryGridFromFile.  It's nil for a Grid that isn't mapped.
+	mapped []bool
 }
 
-//ReadGridFromFile is a factory method that reads data from an ESRI Grid
-// format file and returns a Grid object.
-//
-func ReadGridFromFile(filename string, verbose bool) (*Grid, error) {
-	m := "ReadGridFromFile"
-	if verbose {
-		log.Printf("%s: %s", m, filename)
-	}
-
-	in, err := os.Open(filename)
-	if err != nil {
-		log.Printf(filename + err.Error())
-		return nil, err
-	}
-
+// NewGrid is a factory method that creates an empty Grid with the given
+// number of columns and rows.  The other header values can be set using
+// the setters.
+func NewGrid(ncols, nrows int) *Grid {
 	grid := new(Grid)
+	grid.ncols = ncols
+	grid.nrows = nrows
+	grid.height = newHeights(ncols, nrows)
+	return grid
+}
 
-	r := bufio.NewReader(in)
-
-	lineNum := 0
-	fieldName := "ncols"
-	grid.ncols, err = readIntFromHeader(r, fieldName, verbose)
-	if err != nil {
-		return nil, err
-	}
-	lineNum++
-	if verbose {
-		log.Printf("%s: %s %d", m, fieldName, grid.ncols)
+// newHeights returns nrows rows of ncols heights.  The rows share one
+// array, so that a big grid is two allocations rather than one a row.
+func newHeights(ncols, nrows int) [][]float32 {
+	height := make([][]float32, nrows)
+	cells := make([]float32, ncols*nrows)
+	for i := range height {
+		height[i] = cells[i*ncols : (i+1)*ncols : (i+1)*ncols]
 	}
+	return height
+}
 
-	fieldName = "nrows"
-	grid.nrows, err = readIntFromHeader(r, fieldName, verbose)
-	if err != nil {
-		return nil, err
-	}
-	lineNum++
-	if verbose {
-		log.Printf("%s: %s %d", m, fieldName, grid.nrows)
-	}
+// lineBuffers holds the line and field buffers used by readGrid, so that
+// reading many grids, such as a big tile set, reuses them rather than
+// making new ones for each grid.
+var lineBuffers = sync.Pool{
+	New: func() interface{} { return new(lineBuffer) },
+}
 
-	grid.height = make([][]float32, grid.nrows)
+// lineBuffer is a line of a grid file and its fields.
+type lineBuffer struct {
+	line   []byte
+	fields [][]byte
+}
 
-	for i := 0; i < grid.nrows; i++ {
-		grid.height[i] = make([]float32, grid.ncols)
-	}
+// LevelTrace is the log level of the messages about every line and cell of
+// a grid, which are far too many for slog.LevelDebug.
+const LevelTrace = slog.LevelDebug - 4
 
-	fieldName = "xllcorner"
-	grid.xllcorner, err = readFloat32FromHeader(r, fieldName, verbose)
-	if err != nil {
-		return nil, err
-	}
-	lineNum++
-	if verbose {
-		log.Printf("%s: %s %f", m, fieldName, grid.xllcorner)
+//ReadGridFromFile is a factory method that reads data from an ESRI Grid
+// format file and returns a Grid object.  Progress is logged through the
+// default slog logger unless WithLogger says otherwise.  The options are
+// described with ReadOption.  The file can be a zip file holding one grid
+// - see WalkZip - in which case WithProgress is ignored.
+//
+func ReadGridFromFile(filename string, opts ...ReadOption) (*Grid, error) {
+	c := newReadConfig(opts)
+	c.log.Debug("ReadGridFromFile", "file", filename)
+
+	if isZip(filename) {
+		var g *Grid
+		err := walkOneGrid(c.ctx, filename, func(name string, in io.Reader) error {
+			var err error
+			g, err = readGrid(in, name, c)
+			return err
+		})
+		return g, err
 	}
-
-	fieldName = "yllcorner"
-	grid.yllcorner, err = readFloat32FromHeader(r, fieldName, verbose)
+	f, in, err := openGridFile(filename, c)
 	if err != nil {
 		return nil, err
 	}
-	lineNum++
-	if verbose {
-		log.Printf("%s: %s %f", m, fieldName, grid.yllcorner)
-	}
+	defer f.Close()
+	return readGrid(in, filename, c)
+}
 
-	fieldName = "cellsize"
-	grid.cellsize, err = readFloat32FromHeader(r, fieldName, verbose)
+// openGridFile opens filename and returns the file, to be closed, and the
+// reader to read it through, which calls the progress function of c if
+// there is one.
+func openGridFile(filename string, c *readConfig) (*os.File, io.Reader, error) {
+	f, err := os.Open(filename)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	lineNum++
-	if verbose {
-		log.Printf("%s: %s %f", m, fieldName, grid.cellsize)
+	if c.progress == nil {
+		return f, f, nil
 	}
-
-	fieldName = "NODATA_value"
-	grid.noDataValue, err = readIntFromHeader(r, fieldName, verbose)
+	fi, err := f.Stat()
 	if err != nil {
-		return nil, err
+		f.Close()
+		return nil, nil, err
 	}
-	lineNum++
+	return f, NewProgressReader(f, fi.Size(), c.progress), nil
+}
 
-	log.Printf("NODATA_value %d", grid.noDataValue)
+// ReadGridFromFileWithProgress is a factory method that reads a Grid from an
+// ESRI Grid format file like ReadGridFromFile, calling progress as it goes
+// with the number of bytes read so far and the size of the file.  progress
+// may be nil.  It's the same as ReadGridFromFile with WithProgress.
+func ReadGridFromFileWithProgress(filename string, progress ProgressFunc) (*Grid, error) {
+	return ReadGridFromFile(filename, WithProgress(progress))
+}
 
-	// Read nrows of lines each containing ncols floats, space separated.
-	log.Printf("%s: reading %d data lines", m, grid.nrows)
+// ReadGridFromFileContext is a factory method that reads a Grid from an ESRI
+// Grid format file like ReadGridFromFileWithProgress, giving up with
+// ctx.Err() if ctx is cancelled or its deadline passes.  It's the same as
+// ReadGridFromFile with WithContext and WithProgress.
+func ReadGridFromFileContext(ctx context.Context, filename string, progress ProgressFunc) (*Grid, error) {
+	return ReadGridFromFile(filename, WithContext(ctx), WithProgress(progress))
+}
 
-	linesExpected := grid.nrows + 6
+// ReadGrid is a factory method that reads ESRI Grid format data and returns a
+// Grid object.  The options are described with ReadOption.
+func ReadGrid(in io.Reader, opts ...ReadOption) (*Grid, error) {
+	return readGrid(in, "input", newReadConfig(opts))
+}
 
-	for row := 0; ; row++ {
-		line, err := r.ReadString('\n')
-		if err != nil {
-			break
-		}
-		lineNum++
-		if lineNum > linesExpected {
-			log.Printf("%s: warning: file %s has too many lines - expected %d\n", m, filename, linesExpected)
-			break
-		}
-		line, err = stripSpaces(line)
+// ReadGridContext is a factory method that reads ESRI Grid format data like
+// ReadGrid, giving up with ctx.Err() if ctx is cancelled or its deadline
+// passes.  It's the same as ReadGrid with WithContext.
+func ReadGridContext(ctx context.Context, in io.Reader) (*Grid, error) {
+	return ReadGrid(in, WithContext(ctx))
+}
+
+// readGrid reads ESRI Grid format data.  The filename is used in messages.
+func readGrid(in io.Reader, filename string, c *readConfig) (*Grid, error) {
+	rr, err := newRowReader(in, filename, c)
+	if err != nil {
+		return nil, err
+	}
+	h := rr.Header()
+	grid := NewGrid(h.Ncols, h.Nrows)
+	grid.xllcorner, grid.yllcorner = h.Xllcorner, h.Yllcorner
+	grid.cellsize, grid.noDataValue = h.CellSize, h.NoDataValue
+
+	// Rows that are missing or the wrong length are left as zeros, or set
+	// to No Data with MissingAsNoData.  The rows are parsed in parallel
+	// unless there's only one CPU or every line and cell is to be logged,
+	// which needs them in order.
+	if workers := Workers(); workers > 1 && !rr.trace {
+		err = readRowsParallel(rr, grid, workers)
 		if err != nil {
-			log.Printf("%s: stripSpaces failed - %s", m, err.Error())
 			return nil, err
 		}
-		if verbose {
-			log.Println(line)
-		}
-
-		numbers := strings.Split(line, " ")
-		if len(numbers) > grid.ncols {
-			log.Printf("warning: line %d has too many columns - got %d expected %d\n",
-				lineNum, len(numbers), grid.ncols)
-			continue
-		}
-		if len(numbers) < grid.ncols {
-			log.Printf("warning: line %d has too few columns - got %d expected %d\n",
-				lineNum, len(numbers), grid.ncols)
-			continue
-		}
-		for col := range numbers {
-			var f float32
-			_, err := fmt.Sscanf(numbers[col], "%f", &f)
+	} else {
+		for row := 0; ; row++ {
+			heights, err := rr.Next()
+			if err == io.EOF {
+				break
+			}
 			if err != nil {
-				log.Printf("%d %d %s", row, col, err.Error())
 				return nil, err
 			}
-
-			// Set height, maxheight and minHeight
-			grid.SetHeight(row, col, f)
-
-			if verbose {
-				log.Printf("height[%d][%d] %f", row, col, grid.height[row][col])
+			for col, f := range heights {
+				// Set height, maxheight and minHeight
+				grid.SetHeight(row, col, f)
 			}
 		}
 	}
 
-	if lineNum < linesExpected {
-		log.Printf("warning: file %s has too few lines - got %d expected %d\n",
-			filename, lineNum, linesExpected)
-	}
-
-	if verbose {
-		log.Printf("maxHeight %f minheight %f", grid.maxHeight, grid.minHeight)
-	}
+	c.log.Debug("read grid", "file", filename, "maxHeight", grid.maxHeight, "minHeight", grid.minHeight)
 
 	return grid, nil
 }
@@ -248,6 +261,39 @@ func (g Grid) MinHeight() float32 {
 	return g.minHeight
 }
 
+// Bounds returns the map coordinates of the bottom left and top right
+// corners of the Grid.
+func (g Grid) Bounds() (minX, minY, maxX, maxY float64) {
+	minX = float64(g.xllcorner)
+	minY = float64(g.yllcorner)
+	maxX = minX + float64(g.ncols)*float64(g.cellsize)
+	maxY = minY + float64(g.nrows)*float64(g.cellsize)
+	return minX, minY, maxX, maxY
+}
+
+// Cell returns the row and column of the cell containing the map position
+// (x, y).  ok is false if the position is outside the Grid.
+func (g Grid) Cell(x, y float64) (row, col int, ok bool) {
+	minX, _, _, maxY := g.Bounds()
+	col = int(math.Floor((x - minX) / float64(g.cellsize)))
+	row = int(math.Floor((maxY - y) / float64(g.cellsize)))
+	if row < 0 || row >= g.nrows || col < 0 || col >= g.ncols {
+		return 0, 0, false
+	}
+	return row, col, true
+}
+
+// HeightAt returns the height of the cell containing the map position
+// (x, y).  ok is false if the position is outside the Grid or the cell holds
+// the No Data value.
+func (g Grid) HeightAt(x, y float64) (height float32, ok bool) {
+	row, col, ok := g.Cell(x, y)
+	if !ok || g.IsNoData(row, col) {
+		return 0, false
+	}
+	return g.height[row][col], true
+}
+
 // SetNCols sets the number of columns in the Grid.
 func (g *Grid) SetNCols(ncols int) {
 	g.ncols = ncols
@@ -278,20 +324,34 @@ func (g *Grid) SetNoDataValue(noDataValue int) {
 	g.noDataValue = noDataValue
 }
 
+// IsNoData returns true if cell (row, col) holds the No Data value.
+func (g Grid) IsNoData(row, col int) bool {
+	return g.height[row][col] == float32(g.noDataValue)
+}
+
 // Height gets the height of cell (row, col).
 func (g Grid) Height(row, col int) float32 {
 	return g.height[row][col]
 }
 
-// SetHeight sets the height of cell (row, col).
+// SetHeight sets the height of cell (row, col).  The No Data value is not
+// counted in the maximum and minimum heights.
 func (g *Grid) SetHeight(row, col int, height float32) {
 
 	if row >= g.nrows || col >= g.ncols {
-		log.Printf("SetHeight(%d,%d) - out of range", row, col)
+		slog.Warn("SetHeight - out of range", "row", row, "col", col)
 		return
 	}
+	if g.mapped != nil && g.mapped[row] {
+		g.height[row] = append([]float32(nil), g.height[row]...)
+		g.mapped[row] = false
+	}
 	g.height[row][col] = height
 
+	if height == float32(g.noDataValue) {
+		return
+	}
+
 	if g.maxHeightSet {
 		if height > g.maxHeight {
 			g.maxHeight = height
@@ -311,65 +371,104 @@ func (g *Grid) SetHeight(row, col int, height float32) {
 	}
 }
 
-func readIntFromHeader(r *bufio.Reader, fieldName string, verbose bool) (int, error) {
-	m := "readIntHeader"
-	line, err := r.ReadString('\n')
-	if err != nil {
-		return 0, err
-	}
-	if verbose {
-		log.Printf("%s: line %s", m, line)
-	}
-	line, err = stripSpaces(line)
-	field := strings.Split(line, " ")
-	if field[0] != fieldName {
-		log.Printf("%s: expected %s, got %s", m, fieldName, line)
+// readLine reads the next line from r into buf, which it reuses, and
+// returns it without its line ending.  Like ReadString it returns io.EOF
+// at the end of the data, along with the last line if that has no line
+// ending.  A line longer than max bytes gives errLineTooLong, so that a
+// corrupt file with no line endings isn't read into memory.
+func readLine(r *bufio.Reader, buf []byte, max int) ([]byte, error) {
+	buf = buf[:0]
+	for {
+		chunk, err := r.ReadSlice('\n')
+		buf = append(buf, chunk...)
+		if len(buf) > max {
+			return buf[:0], errLineTooLong
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			return bytes.TrimRight(buf, "\r"), err
+		}
+		return bytes.TrimRight(buf, "\r\n"), nil
 	}
-	var result int
-	_, err = fmt.Sscanf(field[1], "%d", &result)
-	if err != nil {
-		return 0, err
+}
+
+// splitFields splits line at runs of spaces and tabs into fields, which it
+// reuses, and returns them.  The fields are slices of line.
+func splitFields(line []byte, fields [][]byte) [][]byte {
+	fields = fields[:0]
+	start := -1
+	for i, c := range line {
+		if c == ' ' || c == '\t' || c == '\r' {
+			if start >= 0 {
+				fields = append(fields, line[start:i])
+				start = -1
+			}
+		} else if start < 0 {
+			start = i
+		}
 	}
-	if verbose {
-		log.Printf("%s: %s %d", m, fieldName, result)
+	if start >= 0 {
+		fields = append(fields, line[start:])
 	}
-
-	return result, nil
+	return fields
 }
 
-func readFloat32FromHeader(r *bufio.Reader, fieldName string, verbose bool) (float32, error) {
-	m := "readFloat32FromHeader"
+// readHeaderLine reads line lineNum of the header of the file from r and
+// returns its value, which should follow the given field name.  Another
+// name is a warning, or with WithStrict an error.  The errors are
+// HeaderErrors.
+func readHeaderLine(r *bufio.Reader, file string, lineNum int, fieldName string, c *readConfig) (string, error) {
+	m := "readHeaderLine"
 	line, err := r.ReadString('\n')
 	if err != nil {
-		return 0, err
+		return "", &HeaderError{File: file, Line: lineNum, Field: fieldName,
+			Err: fmt.Errorf("the header ends before %s: %w", fieldName, err)}
 	}
-	if verbose {
-		log.Printf("%s: line %s", m, line)
+	c.log.Debug(m, "line", line)
+	field := strings.Fields(line)
+	if len(field) < 2 {
+		text := strings.TrimSpace(line)
+		return "", &HeaderError{File: file, Line: lineNum, Field: fieldName, Token: text,
+			Err: fmt.Errorf("expected %s and a value, got %q", fieldName, text)}
 	}
-	line, err = stripSpaces(line)
-	field := strings.Split(line, " ")
 	if field[0] != fieldName {
-		log.Printf("%s: expected %s, got %s", m, fieldName, line)
+		if c.strict {
+			return "", &HeaderError{File: file, Line: lineNum, Column: 1, Field: fieldName, Token: field[0],
+				Err: fmt.Errorf("expected %s, got %q", fieldName, field[0])}
+		}
+		c.log.Warn(m+": unexpected header", "expected", fieldName, "got", strings.TrimSpace(line))
 	}
-	var result float32
-	_, err = fmt.Sscanf(field[1], "%f", &result)
+	return field[1], nil
+}
+
+func readIntFromHeader(r *bufio.Reader, file string, lineNum int, fieldName string, c *readConfig) (int, error) {
+	value, err := readHeaderLine(r, file, lineNum, fieldName, c)
 	if err != nil {
 		return 0, err
 	}
-	if verbose {
-		log.Printf("%s: %s %f", m, fieldName, result)
+	result, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, &HeaderError{File: file, Line: lineNum, Column: 2, Field: fieldName, Token: value,
+			Err: fmt.Errorf("%s %q is not a whole number", fieldName, value)}
 	}
+	c.log.Debug("readIntFromHeader", fieldName, result)
 
 	return result, nil
 }
 
-func stripSpaces(s string) (string, error) {
-	// Remove spaces from the beginning and the end of the staring.
-	s = strings.TrimSpace(s)
-	// Reduce multiple adjacent spaces within the string to a single space.
-	re, err := regexp.Compile("  +")
+func readFloat32FromHeader(r *bufio.Reader, file string, lineNum int, fieldName string, c *readConfig) (float32, error) {
+	value, err := readHeaderLine(r, file, lineNum, fieldName, c)
+	if err != nil {
+		return 0, err
+	}
+	result, err := strconv.ParseFloat(value, 32)
 	if err != nil {
-		return s, err
+		return 0, &HeaderError{File: file, Line: lineNum, Column: 2, Field: fieldName, Token: value,
+			Err: fmt.Errorf("%s %q is %w", fieldName, value, ErrNotNumber)}
 	}
-	return re.ReplaceAllLiteralString(s, " "), nil
+	c.log.Debug("readFloat32FromHeader", fieldName, result)
+
+	return float32(result), nil
 }
@@ -0,0 +1,254 @@
+package esri
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// readTest reads data as a grid with the given number of workers, and
+// returns the grid and what was logged.
+func readTest(t *testing.T, data string, workers int, opts ...ReadOption) (*Grid, string, error) {
+	t.Helper()
+	SetWorkers(workers)
+	defer SetWorkers(0)
+	var log bytes.Buffer
+	opts = append(opts, WithLogger(slog.New(slog.NewTextHandler(&log, nil))))
+	g, err := ReadGrid(strings.NewReader(data), opts...)
+	return g, log.String(), err
+}
+
+// heights returns the heights of g row by row.
+func heights(g *Grid) [][]float32 {
+	result := make([][]float32, g.Nrows())
+	for row := range result {
+		result[row] = make([]float32, g.Ncols())
+		for col := range result[row] {
+			result[row][col] = g.Height(row, col)
+		}
+	}
+	return result
+}
+
+const header = "ncols 3\nnrows 2\nxllcorner 0\nyllcorner 0\ncellsize 1\nNODATA_value -9999\n"
+
+func TestReadGridLineEndings(t *testing.T) {
+	want := [][]float32{{1, 2, 3}, {4, 5, 6}}
+	tests := []struct {
+		name string
+		data string
+		warn string
+	}{
+		{"newline", header + "1 2 3\n4 5 6\n", ""},
+		{"no newline at the end", header + "1 2 3\n4 5 6", "the last line has no line ending"},
+		{"CRLF", strings.ReplaceAll(header+"1 2 3\n4 5 6\n", "\n", "\r\n"), ""},
+		{"CRLF and no newline at the end", strings.ReplaceAll(header+"1 2 3\n4 5 6", "\n", "\r\n"), "the last line has no line ending"},
+		{"tabs and spaces", header + "1\t2  3 \n 4 5\t6\n", ""},
+		{"blank space at the end", header + "1 2 3\n4 5 6\n  ", ""},
+	}
+	for _, test := range tests {
+		for _, workers := range []int{1, 4} {
+			t.Run(fmt.Sprintf("%s/%d workers", test.name, workers), func(t *testing.T) {
+				g, log, err := readTest(t, test.data, workers)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := heights(g); fmt.Sprint(got) != fmt.Sprint(want) {
+					t.Errorf("got %v, want %v", got, want)
+				}
+				if test.warn == "" && strings.Contains(log, "WARN") {
+					t.Errorf("unexpected warning %s", log)
+				}
+				if test.warn != "" && !strings.Contains(log, test.warn) {
+					t.Errorf("no warning %q in %q", test.warn, log)
+				}
+				if g.MinHeight() != 1 || g.MaxHeight() != 6 {
+					t.Errorf("heights %g to %g, want 1 to 6", g.MinHeight(), g.MaxHeight())
+				}
+			})
+		}
+	}
+}
+
+func TestReadGridFaultyRows(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    [][]float32 // with MissingAsNoData
+		warn    string
+		strict  bool // whether WithStrict makes it an error
+		errLine int
+	}{
+		{"short row", header + "1 2\n4 5 6\n", [][]float32{{-9999, -9999, -9999}, {4, 5, 6}}, "too few columns", true, 7},
+		{"long row", header + "1 2 3\n4 5 6 7\n", [][]float32{{1, 2, 3}, {-9999, -9999, -9999}}, "too many columns", true, 8},
+		{"missing row", header + "1 2 3\n", [][]float32{{1, 2, 3}, {-9999, -9999, -9999}}, "too few lines", true, 8},
+		{"extra row", header + "1 2 3\n4 5 6\n7 8 9\n", [][]float32{{1, 2, 3}, {4, 5, 6}}, "too many lines", true, 9},
+		{"extra row with no newline", header + "1 2 3\n4 5 6\n7 8 9", [][]float32{{1, 2, 3}, {4, 5, 6}}, "too many lines", true, 9},
+	}
+	for _, test := range tests {
+		for _, workers := range []int{1, 4} {
+			t.Run(fmt.Sprintf("%s/%d workers", test.name, workers), func(t *testing.T) {
+				g, log, err := readTest(t, test.data, workers, WithNoDataPolicy(MissingAsNoData))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := heights(g); fmt.Sprint(got) != fmt.Sprint(test.want) {
+					t.Errorf("got %v, want %v", got, test.want)
+				}
+				if !strings.Contains(log, test.warn) {
+					t.Errorf("no warning %q in %q", test.warn, log)
+				}
+
+				_, _, err = readTest(t, test.data, workers, WithStrict())
+				var de *DataError
+				switch {
+				case !test.strict:
+					if err != nil {
+						t.Errorf("strict: %v", err)
+					}
+				case !errors.As(err, &de):
+					t.Errorf("strict: got %v, want a DataError", err)
+				case de.Line != test.errLine:
+					t.Errorf("strict: error on line %d, want %d - %v", de.Line, test.errLine, err)
+				}
+			})
+		}
+	}
+}
+
+func TestReadGridMissingRowsAsZero(t *testing.T) {
+	// Without WithNoDataPolicy, a missing row is left as zeros.
+	g, _, err := readTest(t, header+"1 2 3\n", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]float32{{1, 2, 3}, {0, 0, 0}}
+	if got := heights(g); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestReadGridBadTokens(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		line   int
+		column int
+		token  string
+	}{
+		{"letter", header + "1 x 3\n4 5 6\n", 7, 2, "x"},
+		{"second row", header + "1 2 3\n4 5 6z\n", 8, 3, "6z"},
+		{"no newline at the end", header + "1 2 3\n4 5 ?", 8, 3, "?"},
+		{"comma", header + "1,5 2 3\n4 5 6\n", 7, 1, "1,5"},
+	}
+	for _, test := range tests {
+		for _, workers := range []int{1, 4} {
+			t.Run(fmt.Sprintf("%s/%d workers", test.name, workers), func(t *testing.T) {
+				_, _, err := readTest(t, test.data, workers)
+				var de *DataError
+				if !errors.As(err, &de) {
+					t.Fatalf("got %v, want a DataError", err)
+				}
+				if !errors.Is(err, ErrNotNumber) {
+					t.Errorf("got %v, want ErrNotNumber", err)
+				}
+				if de.Line != test.line || de.Column != test.column || de.Token != test.token {
+					t.Errorf("got line %d column %d token %q, want %d, %d, %q",
+						de.Line, de.Column, de.Token, test.line, test.column, test.token)
+				}
+			})
+		}
+	}
+}
+
+func TestReadGridMissingNoDataLine(t *testing.T) {
+	data := "ncols 3\nnrows 2\nxllcorner 0\nyllcorner 0\ncellsize 1\n1 2 3\n4 5 6\n"
+	g, _, err := readTest(t, data, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Header().NoDataValue != DefaultNoData {
+		t.Errorf("No Data value %d, want %d", g.Header().NoDataValue, DefaultNoData)
+	}
+	want := [][]float32{{1, 2, 3}, {4, 5, 6}}
+	if got := heights(g); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	_, _, err = readTest(t, data, 1, WithStrict())
+	var he *HeaderError
+	if !errors.As(err, &he) || he.Line != 6 {
+		t.Errorf("strict: got %v, want a HeaderError on line 6", err)
+	}
+}
+
+// bigGrid returns a grid file big enough to be read in several chunks by
+// the workers, with a short row and a bad row and with or without a last
+// line ending.
+func bigGrid(ncols, nrows int, ending string, lastNewline bool) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "ncols %d%snrows %d%sxllcorner 0%syllcorner 0%scellsize 1%sNODATA_value -9999%s",
+		ncols, ending, nrows, ending, ending, ending, ending, ending)
+	for row := 0; row < nrows; row++ {
+		n := ncols
+		if row == nrows/3 {
+			n-- // short
+		}
+		for col := 0; col < n; col++ {
+			if col > 0 {
+				b.WriteByte(' ')
+			}
+			if row == nrows/2 && col == 7 {
+				b.WriteString("-9999")
+				continue
+			}
+			fmt.Fprintf(&b, "%.3f", float64(row*ncols+col)/7)
+		}
+		if row < nrows-1 || lastNewline {
+			b.WriteString(ending)
+		}
+	}
+	return b.String()
+}
+
+func TestReadGridWorkersAgree(t *testing.T) {
+	for _, ending := range []string{"\n", "\r\n"} {
+		for _, lastNewline := range []bool{true, false} {
+			data := bigGrid(500, 600, ending, lastNewline)
+			if len(data) < 2*chunkSize {
+				t.Fatalf("the grid is %d bytes - too small for several chunks", len(data))
+			}
+			for _, policy := range []NoDataPolicy{MissingAsZero, MissingAsNoData} {
+				name := fmt.Sprintf("%q/newline %v/policy %d", ending, lastNewline, policy)
+				t.Run(name, func(t *testing.T) {
+					one, _, err := readTest(t, data, 1, WithNoDataPolicy(policy))
+					if err != nil {
+						t.Fatal(err)
+					}
+					many, _, err := readTest(t, data, 8, WithNoDataPolicy(policy))
+					if err != nil {
+						t.Fatal(err)
+					}
+					if one.MinHeight() != many.MinHeight() || one.MaxHeight() != many.MaxHeight() {
+						t.Errorf("heights %g to %g with one worker, %g to %g with several",
+							one.MinHeight(), one.MaxHeight(), many.MinHeight(), many.MaxHeight())
+					}
+					for row := 0; row < one.Nrows(); row++ {
+						for col := 0; col < one.Ncols(); col++ {
+							if one.Height(row, col) != many.Height(row, col) {
+								t.Fatalf("row %d col %d is %g with one worker, %g with several",
+									row, col, one.Height(row, col), many.Height(row, col))
+							}
+						}
+					}
+					last := float32((600*500 - 1)) / 7
+					if got := one.Height(599, 499); got < last-0.001 || got > last+0.001 {
+						t.Errorf("the last cell is %g, want %g", got, last)
+					}
+				})
+			}
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package esri
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+// Header holds the header of a grid, which gives its size and position.
+type Header struct {
+	Ncols       int
+	Nrows       int
+	Xllcorner   float32
+	Yllcorner   float32
+	CellSize    float32
+	NoDataValue int
+}
+
+// ReadHeaderFromFile reads just the header of an ESRI Grid format file,
+// which is much quicker than reading the whole grid.  WithLogger and
+// WithStrict apply to it.  A fault in the header is a HeaderError.  As with
+// ReadGridFromFile, the file can be a zip file holding one grid.
+func ReadHeaderFromFile(filename string, opts ...ReadOption) (Header, error) {
+	if isZip(filename) {
+		c := newReadConfig(opts)
+		var h Header
+		err := walkOneGrid(c.ctx, filename, func(name string, in io.Reader) error {
+			var err error
+			h, _, err = readHeader(bufio.NewReader(in), name, c)
+			return err
+		})
+		return h, err
+	}
+	in, err := os.Open(filename)
+	if err != nil {
+		return Header{}, err
+	}
+	defer in.Close()
+	h, _, err := readHeader(bufio.NewReader(in), filename, newReadConfig(opts))
+	return h, err
+}
+
+// readHeader reads the header of an ESRI Grid and returns it with the
+// number of lines it took - six, or five if there's no NODATA_value line.
+// The filename is recorded in the errors.
+func readHeader(r *bufio.Reader, filename string, c *readConfig) (Header, int, error) {
+	var h Header
+	var err error
+	if h.Ncols, err = readIntFromHeader(r, filename, 1, "ncols", c); err != nil {
+		return h, 0, err
+	}
+	if h.Nrows, err = readIntFromHeader(r, filename, 2, "nrows", c); err != nil {
+		return h, 0, err
+	}
+	if h.Xllcorner, err = readFloat32FromHeader(r, filename, 3, "xllcorner", c); err != nil {
+		return h, 0, err
+	}
+	if h.Yllcorner, err = readFloat32FromHeader(r, filename, 4, "yllcorner", c); err != nil {
+		return h, 0, err
+	}
+	if h.CellSize, err = readFloat32FromHeader(r, filename, 5, "cellsize", c); err != nil {
+		return h, 0, err
+	}
+	// Some suppliers, such as the Ordnance Survey, leave out the
+	// NODATA_value line when there are no gaps.
+	if !c.strict && startsWithNumber(r) {
+		c.log.Debug("readHeader: no NODATA_value line", "file", filename)
+		h.NoDataValue = DefaultNoData
+		return h, 5, nil
+	}
+	h.NoDataValue, err = readIntFromHeader(r, filename, 6, "NODATA_value", c)
+	return h, 6, err
+}
+
+// Header returns the header of the Grid.
+func (g Grid) Header() Header {
+	return Header{g.ncols, g.nrows, g.xllcorner, g.yllcorner, g.cellsize, g.noDataValue}
+}
+
+// Bounds returns the map coordinates of the bottom left and top right
+// corners of the grid.
+func (h Header) Bounds() (minX, minY, maxX, maxY float64) {
+	minX = float64(h.Xllcorner)
+	minY = float64(h.Yllcorner)
+	maxX = minX + float64(h.Ncols)*float64(h.CellSize)
+	maxY = minY + float64(h.Nrows)*float64(h.CellSize)
+	return minX, minY, maxX, maxY
+}
+
+// CropSize returns the number of columns and rows that Crop would give for
+// the same bounding box, or zero if the box doesn't overlap the grid.
+func (h Header) CropSize(minX, minY, maxX, maxY float32) (ncols, nrows int) {
+	if minX >= maxX || minY >= maxY {
+		return 0, 0
+	}
+	top := h.Yllcorner + float32(h.Nrows)*h.CellSize
+	firstCol := int(math.Max(0, math.Floor(float64((minX-h.Xllcorner)/h.CellSize))))
+	lastCol := int(math.Min(float64(h.Ncols), math.Ceil(float64((maxX-h.Xllcorner)/h.CellSize))))
+	firstRow := int(math.Max(0, math.Floor(float64((top-maxY)/h.CellSize))))
+	lastRow := int(math.Min(float64(h.Nrows), math.Ceil(float64((top-minY)/h.CellSize))))
+	if firstCol >= lastCol || firstRow >= lastRow {
+		return 0, 0
+	}
+	return lastCol - firstCol, lastRow - firstRow
+}
+
+// startsWithNumber reports whether the next line to be read from r, which
+// is left unread, starts with a number.
+func startsWithNumber(r *bufio.Reader) bool {
+	// A peek at the start of the line is enough to see the first value.
+	b, _ := r.Peek(64)
+	line, _, _ := strings.Cut(string(b), "\n")
+	field := strings.Fields(line)
+	return len(field) > 0 && isNumber(field[0])
+}
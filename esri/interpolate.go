@@ -0,0 +1,50 @@
+package esri
+
+import "math"
+
+// InterpolatedHeightAt returns the height at the map position (x, y),
+// interpolated bilinearly between the centres of the four nearest cells.
+// If any of those cells holds the No Data value, or the position is within
+// half a cell of the edge, the height of the cell containing the position is
+// returned instead.  ok is false if the position is outside the Grid or its
+// cell holds the No Data value.
+func (g Grid) InterpolatedHeightAt(x, y float64) (height float32, ok bool) {
+	height, ok = g.HeightAt(x, y)
+	if !ok {
+		return 0, false
+	}
+
+	minX, _, _, maxY := g.Bounds()
+	cellsize := float64(g.cellsize)
+	// Position in cell units measured from the centre of cell (0, 0).
+	fc := (x-minX)/cellsize - 0.5
+	fr := (maxY-y)/cellsize - 0.5
+	col := int(math.Floor(fc))
+	row := int(math.Floor(fr))
+	if row < 0 || col < 0 || row+1 >= g.nrows || col+1 >= g.ncols {
+		return height, true
+	}
+	if g.IsNoData(row, col) || g.IsNoData(row, col+1) ||
+		g.IsNoData(row+1, col) || g.IsNoData(row+1, col+1) {
+		return height, true
+	}
+
+	dx := fc - float64(col)
+	dy := fr - float64(row)
+	top := float64(g.height[row][col])*(1-dx) + float64(g.height[row][col+1])*dx
+	bottom := float64(g.height[row+1][col])*(1-dx) + float64(g.height[row+1][col+1])*dx
+	return float32(top*(1-dy) + bottom*dy), true
+}
+
+// InterpolatedHeightAt returns the height at the map position (x, y),
+// interpolated within the Grid that covers it.  ok is false if no Grid has
+// data there.
+func (ts *TileSet) InterpolatedHeightAt(x, y float64) (height float32, ok bool) {
+	for _, g := range ts.grids {
+		height, ok = g.InterpolatedHeightAt(x, y)
+		if ok {
+			return height, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,87 @@
+package esri
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Limits are the biggest grids that the readers will make, so that a
+// corrupt or hostile header can't make them ask for gigabytes of memory.
+// A limit of 0 is no limit.
+type Limits struct {
+	MaxCols  int
+	MaxRows  int
+	MaxCells int64
+}
+
+// DefaultLimits are the Limits until SetLimits is called - up to 2^20
+// columns and rows and 2^30 cells, which is 4GB of heights.
+var DefaultLimits = Limits{MaxCols: 1 << 20, MaxRows: 1 << 20, MaxCells: 1 << 30}
+
+// maxFieldBytes is the most bytes allowed for each value of a line of
+// grid data, including the spaces, and lineSlack the extra allowed for
+// each line, so a line can be no longer than maxLineLength says.
+const (
+	maxFieldBytes = 64
+	lineSlack     = 1024
+)
+
+// maxWarnings is the most warnings about the rows of a grid that are
+// logged.  The rest are counted and the count logged at the end.
+const maxWarnings = 10
+
+// errLineTooLong is returned by readLine for a line longer than it was
+// allowed.
+var errLineTooLong = errors.New("line too long")
+
+var (
+	limitsLock sync.RWMutex
+	limits     = DefaultLimits
+)
+
+// SetLimits sets the Limits of the grids that ReadGrid, NewRowReader and
+// the other readers will make.
+func SetLimits(l Limits) {
+	limitsLock.Lock()
+	defer limitsLock.Unlock()
+	limits = l
+}
+
+// GetLimits returns the Limits set by SetLimits.
+func GetLimits() Limits {
+	limitsLock.RLock()
+	defer limitsLock.RUnlock()
+	return limits
+}
+
+// CheckSize returns an error if a grid of ncols by nrows cells has no cells
+// or is bigger than the Limits allow.  Readers call it before they make the
+// Grid.
+func CheckSize(ncols, nrows int) error {
+	if ncols < 1 {
+		return fmt.Errorf("ncols %d is not greater than zero", ncols)
+	}
+	if nrows < 1 {
+		return fmt.Errorf("nrows %d is not greater than zero", nrows)
+	}
+	l := GetLimits()
+	if l.MaxCols > 0 && ncols > l.MaxCols {
+		return fmt.Errorf("ncols %d is more than the limit of %d", ncols, l.MaxCols)
+	}
+	if l.MaxRows > 0 && nrows > l.MaxRows {
+		return fmt.Errorf("nrows %d is more than the limit of %d", nrows, l.MaxRows)
+	}
+	// Divide rather than multiply, which could overflow.
+	if l.MaxCells > 0 && int64(ncols) > l.MaxCells/int64(nrows) {
+		return fmt.Errorf("%d by %d cells is more than the limit of %d", ncols, nrows, l.MaxCells)
+	}
+	return nil
+}
+
+// maxLineLength returns the longest line of data allowed in a grid with
+// ncols columns.  A longer line is taken to be corrupt rather than read
+// into memory.
+func maxLineLength(ncols int) int {
+	return maxFieldBytes*ncols + lineSlack
+}
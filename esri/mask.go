@@ -0,0 +1,73 @@
+package esri
+
+import (
+	"fmt"
+
+	"github.com/goblimey/tiler/geom"
+)
+
+// Mask returns a copy of g in which every cell whose centre is outside all of
+// the given polygons is set to the No Data value.  The polygons must be in the
+// same map coordinates as the grid.
+func (g Grid) Mask(polygons []geom.Polygon) (*Grid, error) {
+	if len(polygons) == 0 {
+		return nil, fmt.Errorf("Mask: no polygons")
+	}
+
+	result := NewGrid(g.ncols, g.nrows)
+	result.SetXllcorner(g.xllcorner)
+	result.SetYllcorner(g.yllcorner)
+	result.SetCellSize(g.cellsize)
+	result.SetNoDataValue(g.noDataValue)
+
+	noData := float32(g.noDataValue)
+	inside := make([]bool, g.ncols)
+	for row := 0; row < g.nrows; row++ {
+		g.inside(polygons, row, inside)
+		for col := 0; col < g.ncols; col++ {
+			if inside[col] {
+				result.SetHeight(row, col, g.height[row][col])
+			} else {
+				result.SetHeight(row, col, noData)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// inside sets inside[col] for each column of the row to whether the centre
+// of the cell is inside any of the polygons.
+func (g Grid) inside(polygons []geom.Polygon, row int, inside []bool) {
+	cellsize := float64(g.cellsize)
+	xll := float64(g.xllcorner)
+	top := float64(g.yllcorner) + float64(g.nrows)*cellsize
+
+	for col := range inside {
+		inside[col] = false
+	}
+
+	// Scan the line through the cell centres and mark the cells between
+	// each pair of crossings.
+	y := top - (float64(row)+0.5)*cellsize
+	for _, polygon := range polygons {
+		crossings := polygon.Crossings(y)
+		for i := 0; i+1 < len(crossings); i += 2 {
+			// Start at or just before the first column whose centre is
+			// in the span.
+			first := int((crossings[i]-xll)/cellsize - 0.5)
+			if first < 0 {
+				first = 0
+			}
+			for col := first; col < g.ncols; col++ {
+				x := xll + (float64(col)+0.5)*cellsize
+				if x >= crossings[i+1] {
+					break
+				}
+				if x >= crossings[i] {
+					inside[col] = true
+				}
+			}
+		}
+	}
+}
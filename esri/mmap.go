@@ -0,0 +1,112 @@
+package esri
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"unsafe"
+)
+
+// MapBinaryGridFromFile is a factory method that returns a Grid whose heights
+// are those in a binary grid file, mapped into memory rather than read.
+// The operating system reads the parts of the file that are used as they
+// are used and can drop them again when memory is short, so a set of grids
+// much bigger than the memory of the machine can be worked on.  The mapping
+// is read only - SetHeight copies a row before changing it, so changes to
+// the heights are not written to the file.  The mapping lasts as long as
+// the program.  Where files can't be mapped, or the machine doesn't store
+// numbers least significant byte first as the file does, the file is read
+// as by ReadBinaryGridFromFile.
+func MapBinaryGridFromFile(filename string) (*Grid, error) {
+	if !littleEndian() {
+		return ReadBinaryGridFromFile(filename)
+	}
+	return mapBinaryGridFromFile(filename)
+}
+
+// littleEndian returns true if the machine stores numbers least
+// significant byte first.
+func littleEndian() bool {
+	n := uint16(1)
+	return *(*byte)(unsafe.Pointer(&n)) == 1
+}
+
+// binaryHeaderSize is the size of binaryHeader in a file, and
+// binaryRangeSize the size of the binaryRange that follows it from version
+// 2.
+const (
+	binaryHeaderSize = 36
+	binaryRangeSize  = 12
+)
+
+// gridFromMapping returns a Grid that uses data, a binary grid file mapped
+// into memory, for its heights.
+func gridFromMapping(data []byte) (*Grid, error) {
+	if len(data) < binaryHeaderSize || string(data[:8]) != BinaryMagic {
+		return nil, fmt.Errorf("not a binary grid")
+	}
+	le := binary.LittleEndian
+	version := le.Uint32(data[8:])
+	if version < 1 || version > binaryVersion {
+		return nil, fmt.Errorf("binary grid version %d - expected %d", version, binaryVersion)
+	}
+	size := binaryHeaderSize
+	if version > 1 {
+		size += binaryRangeSize
+	}
+	ncols, nrows := int(le.Uint32(data[12:])), int(le.Uint32(data[16:]))
+	if ncols < 1 || nrows < 1 {
+		return nil, fmt.Errorf("binary grid of %d by %d cells", ncols, nrows)
+	}
+	if int64(len(data)-size) != 4*int64(ncols)*int64(nrows) {
+		return nil, fmt.Errorf("binary grid of %d by %d cells should be %d bytes, not %d",
+			ncols, nrows, int64(size)+4*int64(ncols)*int64(nrows), len(data))
+	}
+	g := new(Grid)
+	g.ncols, g.nrows = ncols, nrows
+	g.xllcorner = math.Float32frombits(le.Uint32(data[20:]))
+	g.yllcorner = math.Float32frombits(le.Uint32(data[24:]))
+	g.cellsize = math.Float32frombits(le.Uint32(data[28:]))
+	g.noDataValue = int(int32(le.Uint32(data[32:])))
+
+	// The header is a multiple of four bytes long, so the heights are
+	// aligned as float32s need to be.
+	cells := unsafe.Slice((*float32)(unsafe.Pointer(&data[size])), ncols*nrows)
+	g.height = make([][]float32, nrows)
+	g.mapped = make([]bool, nrows)
+	for i := range g.height {
+		g.height[i] = cells[i*ncols : (i+1)*ncols : (i+1)*ncols]
+		g.mapped[i] = true
+	}
+	if version == 1 {
+		g.findRange()
+		return g, nil
+	}
+	g.minHeight = math.Float32frombits(le.Uint32(data[36:]))
+	g.maxHeight = math.Float32frombits(le.Uint32(data[40:]))
+	set := le.Uint32(data[44:]) != 0
+	g.minHeightSet, g.maxHeightSet = set, set
+	return g, nil
+}
+
+// findRange sets the largest and smallest heights of the Grid, leaving out
+// the No Data value.  It's for version 1 files, which don't record them.
+func (g *Grid) findRange() {
+	noData := float32(g.noDataValue)
+	g.maxHeightSet, g.minHeightSet = false, false
+	for _, row := range g.height {
+		for _, h := range row {
+			if h == noData {
+				continue
+			}
+			if !g.maxHeightSet || h > g.maxHeight {
+				g.maxHeight = h
+				g.maxHeightSet = true
+			}
+			if !g.minHeightSet || h < g.minHeight {
+				g.minHeight = h
+				g.minHeightSet = true
+			}
+		}
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package esri
+
+// mapBinaryGridFromFile reads a binary grid file, on systems where this
+// package doesn't map files into memory.
+func mapBinaryGridFromFile(filename string) (*Grid, error) {
+	return ReadBinaryGridFromFile(filename)
+}
@@ -0,0 +1,36 @@
+//go:build unix
+
+package esri
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// mapBinaryGridFromFile maps a binary grid file into memory, read only.
+func mapBinaryGridFromFile(filename string) (*Grid, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	// The mapping outlives the file descriptor.
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fi.Size() < binaryHeaderSize {
+		return nil, fmt.Errorf("%s: not a binary grid", filename)
+	}
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(fi.Size()), syscall.PROT_READ, syscall.MAP_PRIVATE)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	g, err := gridFromMapping(data)
+	if err != nil {
+		syscall.Munmap(data)
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return g, nil
+}
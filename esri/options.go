@@ -0,0 +1,106 @@
+package esri
+
+import (
+	"context"
+	"log/slog"
+)
+
+// ReadOption changes how ReadGrid, ReadGridFromFile and NewRowReader read a
+// grid, for example WithContext or WithStrict.  New options can be added
+// without changing the functions that take them.
+type ReadOption func(*readConfig)
+
+// NoDataPolicy says what the cells of rows that are missing from a grid
+// file, or that have the wrong number of values, are set to.
+type NoDataPolicy int
+
+const (
+	// MissingAsZero leaves the cells as zero, as ReadGrid always has.
+	MissingAsZero NoDataPolicy = iota
+	// MissingAsNoData sets the cells to the No Data value of the grid, so
+	// that they aren't drawn and don't count in the heights.
+	MissingAsNoData
+)
+
+// readConfig is the result of applying the ReadOptions.
+type readConfig struct {
+	ctx      context.Context
+	progress ProgressFunc
+	log      *slog.Logger
+	verbose  bool
+	strict   bool
+	missing  NoDataPolicy
+	header   func(Header) error
+}
+
+// newReadConfig returns the configuration given by opts.
+func newReadConfig(opts []ReadOption) *readConfig {
+	c := &readConfig{ctx: context.Background()}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.log == nil {
+		c.log = slog.Default()
+	}
+	return c
+}
+
+// WithContext gives up reading with ctx.Err() once ctx is cancelled or its
+// deadline passes.
+func WithContext(ctx context.Context) ReadOption {
+	return func(c *readConfig) {
+		c.ctx = ctx
+	}
+}
+
+// WithProgress calls progress as the file is read with the number of bytes
+// read so far and the size of the file.  Only ReadGridFromFile knows the
+// size, so the other readers ignore it.
+func WithProgress(progress ProgressFunc) ReadOption {
+	return func(c *readConfig) {
+		c.progress = progress
+	}
+}
+
+// WithLogger sends the messages about the grid to log rather than to the
+// default slog logger.
+func WithLogger(log *slog.Logger) ReadOption {
+	return func(c *readConfig) {
+		c.log = log
+	}
+}
+
+// WithVerbose logs every warning about the rows of the grid, rather than
+// the first few and a count of the rest.
+func WithVerbose() ReadOption {
+	return func(c *readConfig) {
+		c.verbose = true
+	}
+}
+
+// WithStrict makes the faults that are normally warnings errors - a header
+// line with the wrong name, a row with the wrong number of values, and too
+// few or too many rows.
+func WithStrict() ReadOption {
+	return func(c *readConfig) {
+		c.strict = true
+	}
+}
+
+// WithNoDataPolicy sets what the cells of missing and short rows are set
+// to.  The default is MissingAsZero.
+func WithNoDataPolicy(p NoDataPolicy) ReadOption {
+	return func(c *readConfig) {
+		c.missing = p
+	}
+}
+
+// WithHeaderFunc calls f with the header of the grid once it's read,
+// before any of the rows, for example so that ReadGridFunc's callers can
+// see the size and the No Data value.  An error from f stops the reading
+// and is returned.  ReadHeaderFromFile ignores it.
+func WithHeaderFunc(f func(Header) error) ReadOption {
+	return func(c *readConfig) {
+		c.header = f
+	}
+}
@@ -0,0 +1,281 @@
+package esri
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+	"sync"
+)
+
+// chunkSize is roughly how much of the data is given to a worker at a
+// time by readRowsParallel.
+const chunkSize = 1 << 20
+
+// chunk is a run of whole lines of grid data, starting at the given line of
+// the file and row of the grid.
+type chunk struct {
+	data []byte
+	line int
+	row  int
+}
+
+// chunkResult is what a worker found in its chunks - the range of the
+// heights and the first value that isn't a number or line that's too long,
+// if any.
+type chunkResult struct {
+	heights heightRange
+	errLine int
+	err     error
+}
+
+// heightRange is the lowest and highest heights seen, leaving out No Data.
+type heightRange struct {
+	found    bool
+	min, max float32
+}
+
+// add counts h in the range.
+func (r *heightRange) add(h float32) {
+	if !r.found || h < r.min {
+		r.min = h
+	}
+	if !r.found || h > r.max {
+		r.max = h
+	}
+	r.found = true
+}
+
+// readRowsParallel reads the rows that follow the header from rr into the
+// Grid, which has the size given by the header.  The data is read in chunks
+// of whole lines, which are parsed by the given number of workers at the
+// same time.  The rows are checked as RowReader.Next checks them, with the
+// same warnings, but the warnings about different chunks can come in any
+// order.  The Grid and the error returned are the same as reading the rows
+// in order would give, whatever the number of workers.
+func readRowsParallel(rr *RowReader, grid *Grid, workers int) error {
+	chunks := make(chan chunk, workers)
+	// Used chunk buffers come back on free to be read into again.
+	free := make(chan []byte, 2*workers)
+	results := make([]chunkResult, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(result *chunkResult) {
+			defer wg.Done()
+			var fields [][]byte
+			for c := range chunks {
+				fields = parseChunk(rr, grid, c, fields, result)
+				select {
+				case free <- c.data[:0]:
+				default:
+				}
+			}
+		}(&results[w])
+	}
+
+	err := splitChunks(rr, chunks, free)
+	close(chunks)
+	wg.Wait()
+	if err != nil {
+		// A bad value on an earlier line is the one that reading the rows
+		// in order would have found, whatever the number of workers.
+		var de *DataError
+		if errors.As(err, &de) {
+			for i := range results {
+				if results[i].err != nil && results[i].errLine < de.Line {
+					return firstResult(results).err
+				}
+			}
+		}
+		return err
+	}
+	// After the workers, so that the count of warnings is complete.
+	finishErr := rr.finish()
+	if rr.cfg.missing == MissingAsNoData {
+		// The rows after the end of the data.
+		for row := rr.lineNum - rr.headLen; row < grid.nrows; row++ {
+			fillNoData(grid.height[row], grid.noDataValue)
+		}
+	}
+
+	for i := range results {
+		r := &results[i]
+		if r.heights.found {
+			if !grid.maxHeightSet || r.heights.max > grid.maxHeight {
+				grid.maxHeight = r.heights.max
+				grid.maxHeightSet = true
+			}
+			if !grid.minHeightSet || r.heights.min < grid.minHeight {
+				grid.minHeight = r.heights.min
+				grid.minHeightSet = true
+			}
+		}
+	}
+	// The first bad value in the file is the one reported.
+	if first := firstResult(results); first != nil {
+		return first.err
+	}
+	return finishErr
+}
+
+// firstResult returns the result with the error on the earliest line, or
+// nil if none of them has an error.
+func firstResult(results []chunkResult) *chunkResult {
+	var first *chunkResult
+	for i := range results {
+		r := &results[i]
+		if r.err != nil && (first == nil || r.errLine < first.errLine) {
+			first = r
+		}
+	}
+	return first
+}
+
+// splitChunks reads the data of the rows from rr and sends it on chunks in
+// pieces of whole lines, using the buffers from free if there are any.  A
+// line longer than rr allows is an error, and so is cancelling the context
+// of rr.
+func splitChunks(rr *RowReader, chunks chan<- chunk, free <-chan []byte) error {
+	nrows := rr.header.Nrows
+	for rr.row < nrows {
+		if err := rr.cfg.ctx.Err(); err != nil {
+			return err
+		}
+		var buf []byte
+		select {
+		case buf = <-free:
+		default:
+			buf = make([]byte, 0, chunkSize+64*1024)
+		}
+		buf = buf[:chunkSize]
+		n, err := io.ReadFull(rr.r, buf)
+		buf = buf[:n]
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			rr.ended = true
+		} else if err != nil {
+			return err
+		}
+		if !rr.ended {
+			// Read on to the end of the line, unless it's too long.
+			tail := len(buf) - bytes.LastIndexByte(buf, '\n') - 1
+			for {
+				rest, err := rr.r.ReadSlice('\n')
+				tail += len(rest)
+				if tail > rr.maxLine {
+					line := rr.lineNum + bytes.Count(buf, []byte{'\n'}) + 1
+					return rr.dataError(line, "the line is longer than %d bytes", rr.maxLine)
+				}
+				buf = append(buf, rest...)
+				if err == bufio.ErrBufferFull {
+					continue
+				}
+				if err == io.EOF {
+					rr.ended = true
+				} else if err != nil {
+					return err
+				}
+				break
+			}
+		}
+		// The chunk ends at a line ending unless it's the end of the data.
+		// A last line with no line ending is a row all the same, but spaces
+		// after the last line ending are dropped.
+		if end := bytes.LastIndexByte(buf, '\n') + 1; end < len(buf) {
+			if rr.ended && len(bytes.TrimSpace(buf[end:])) > 0 {
+				rr.warn("the last line has no line ending", "line", rr.lineNum+bytes.Count(buf, []byte{'\n'})+1)
+				buf = append(buf, '\n')
+			} else {
+				buf = buf[:end]
+			}
+		}
+
+		lines := bytes.Count(buf, []byte{'\n'})
+		if rr.row+lines > nrows {
+			// Keep just the lines of the rows.
+			keep := 0
+			for i := 0; i < nrows-rr.row; i++ {
+				keep += bytes.IndexByte(buf[keep:], '\n') + 1
+			}
+			buf = buf[:keep]
+			lines = nrows - rr.row
+			err := rr.fault(rr.dataError(nrows+rr.headLen+1, "more than the %d rows given by nrows", nrows),
+				"too many lines", "expected", nrows+rr.headLen)
+			if err != nil {
+				return err
+			}
+			// There's no need to look for more.
+			rr.ended = true
+		}
+		if lines > 0 {
+			chunks <- chunk{buf, rr.lineNum + 1, rr.row}
+		}
+		rr.row += lines
+		rr.lineNum += lines
+		if rr.ended && rr.row < nrows {
+			err := rr.fault(rr.dataError(rr.lineNum+1, "the grid ends after %d lines - expected %d", rr.lineNum, nrows+rr.headLen),
+				"too few lines", "got", rr.lineNum, "expected", nrows+rr.headLen)
+			if err != nil {
+				return err
+			}
+			rr.row = nrows
+		}
+	}
+	return nil
+}
+
+// parseChunk parses the lines of a chunk into the rows of the Grid and
+// adds what it found to result.  fields is reused for the fields of each
+// line and returned for the next chunk.
+func parseChunk(rr *RowReader, grid *Grid, c chunk, fields [][]byte, result *chunkResult) [][]byte {
+	noData := float32(grid.noDataValue)
+	data := c.data
+	for i := 0; len(data) > 0; i++ {
+		end := bytes.IndexByte(data, '\n')
+		line := bytes.TrimRight(data[:end], "\r")
+		data = data[end+1:]
+		lineNum, row := c.line+i, c.row+i
+		if end+1 > rr.maxLine {
+			// As RowReader.Next would find.
+			if result.err == nil || lineNum < result.errLine {
+				result.errLine = lineNum
+				result.err = rr.dataError(lineNum, "the line is longer than %d bytes", rr.maxLine)
+			}
+			continue
+		}
+
+		fields = splitFields(line, fields)
+		if err := rr.checkColumns(lineNum, len(fields)); err != nil {
+			if result.err == nil || lineNum < result.errLine {
+				result.errLine = lineNum
+				result.err = err
+			}
+			continue
+		}
+		if len(fields) != grid.ncols {
+			if rr.cfg.missing == MissingAsNoData {
+				fillNoData(grid.height[row], grid.noDataValue)
+			}
+			continue
+		}
+		heights := grid.height[row]
+		for col := range fields {
+			f, err := strconv.ParseFloat(string(fields[col]), 32)
+			if err != nil {
+				if result.err == nil || lineNum < result.errLine {
+					rr.cfg.log.Error("bad height", "file", rr.filename, "line", lineNum, "column", col+1,
+						"error", err)
+					result.errLine = lineNum
+					result.err = badValue(rr.filename, lineNum, col+1, fields[col])
+				}
+				break
+			}
+			heights[col] = float32(f)
+			if heights[col] != noData {
+				result.heights.add(heights[col])
+			}
+		}
+	}
+	return fields
+}
@@ -0,0 +1,31 @@
+package esri
+
+import "io"
+
+// ProgressFunc is called as a long job goes on with the amount done so far
+// and the total, in whatever units suit the job - bytes read, rows drawn and
+// so on.  The total is zero if it isn't known.
+type ProgressFunc func(done, total int64)
+
+// progressReader counts the bytes read through it.
+type progressReader struct {
+	r        io.Reader
+	done     int64
+	total    int64
+	progress ProgressFunc
+}
+
+// NewProgressReader returns a reader that reads from r and calls progress
+// after each read with the number of bytes read so far and total, the
+// number expected.  Wrapping the input to ReadGrid or ReadBinaryGrid in one
+// shows how the reading is going.
+func NewProgressReader(r io.Reader, total int64, progress ProgressFunc) io.Reader {
+	return &progressReader{r: r, total: total, progress: progress}
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.done += int64(n)
+	p.progress(p.done, p.total)
+	return n, err
+}
@@ -0,0 +1,48 @@
+package esri
+
+import (
+	"fmt"
+	"math"
+)
+
+// Class maps the heights from Min up to but not including Max to Value.
+// Min can be minus infinity and Max plus infinity for an open-ended range.
+type Class struct {
+	Min, Max float64
+	Value    float32
+}
+
+// Reclassify returns a Grid holding, for each cell of g, the Value of the
+// first of classes whose range includes the cell's height, for example to
+// sort heights into bands for drawing in a few colours or turning into
+// polygons.  Cells holding the No Data value or with heights outside all of
+// the ranges hold the No Data value in the result.
+func (g Grid) Reclassify(classes []Class) (*Grid, error) {
+	noData := float32(g.noDataValue)
+	for _, c := range classes {
+		if c.Min >= c.Max {
+			return nil, fmt.Errorf("Reclassify: class %g to %g is empty", c.Min, c.Max)
+		}
+		if c.Value == noData || math.IsNaN(float64(c.Value)) {
+			return nil, fmt.Errorf("Reclassify: class value %g is the No Data value", c.Value)
+		}
+	}
+
+	result := g.empty()
+	for row := 0; row < g.nrows; row++ {
+		for col := 0; col < g.ncols; col++ {
+			result.SetHeight(row, col, noData)
+			if g.IsNoData(row, col) {
+				continue
+			}
+			h := float64(g.height[row][col])
+			for _, c := range classes {
+				if h >= c.Min && h < c.Max {
+					result.SetHeight(row, col, c.Value)
+					break
+				}
+			}
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,240 @@
+package esri
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// RepairFile reads the named ESRI grid file and writes a mended copy of it
+// to out.  See Repair.
+func RepairFile(input string, out io.Writer) ([]Problem, error) {
+	in, err := os.Open(input)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	changes, err := Repair(in, out)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", input, err)
+	}
+	return changes, nil
+}
+
+// Repair copies an ESRI grid from in to out, mending the faults that
+// Validate finds where it can.  The header names are given their usual
+// case and a missing NODATA_value line is added.  Short rows are padded
+// with NODATA, extra values and rows are dropped and missing rows added as
+// NODATA.  Values that aren't numbers or are within 1 of the NODATA value
+// become NODATA, and NODATA is always written the same way.  The values are
+// separated by single spaces and every line ends with a newline.  It
+// returns the changes made, with the line and column in the input.  The
+// error is for failures to read or write and for grids that can't be
+// mended because their size or position isn't given.
+func Repair(in io.Reader, out io.Writer) ([]Problem, error) {
+	var changes []Problem
+	report := func(line, column int, format string, args ...interface{}) {
+		changes = append(changes, Problem{line, column, fmt.Sprintf(format, args...)})
+	}
+
+	r := bufio.NewReader(in)
+	lineNum := 0
+	respaced := 0
+	// readLine returns the next line without its line ending.  ok is false
+	// at the end of the input.
+	readLine := func() (line string, ok bool, err error) {
+		line, err = r.ReadString('\n')
+		if err == io.EOF {
+			if line == "" {
+				return "", false, nil
+			}
+			lineNum++
+			report(lineNum, 0, "added the missing line ending")
+			return strings.TrimRight(line, "\r"), true, nil
+		}
+		if err != nil {
+			return "", false, err
+		}
+		lineNum++
+		line = strings.TrimRight(line, "\n")
+		if strings.HasSuffix(line, "\r") {
+			respaced++
+			line = strings.TrimRight(line, "\r")
+		}
+		return line, true, nil
+	}
+
+	// The header.  A line that starts with a number is the first row of
+	// data, which means the header is short.
+	var header [6]string
+	// Header lines that need no change are copied as they are.
+	var keep [6]string
+	var pending string
+	havePending := false
+	for i, name := range headerFields {
+		line, ok, err := readLine()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("the header ends after %d lines - expected %s", i, name)
+		}
+		field := strings.Fields(line)
+		if len(field) > 0 && isNumber(field[0]) {
+			if name != "NODATA_value" {
+				return nil, fmt.Errorf("line %d: the header has no %s line", lineNum, name)
+			}
+			header[i] = strconv.Itoa(DefaultNoData)
+			report(lineNum, 0, "added the missing line NODATA_value %d", DefaultNoData)
+			pending, havePending = line, true
+			break
+		}
+		if len(field) != 2 {
+			return nil, fmt.Errorf("line %d: expected %q and a value, got %q", lineNum, name, line)
+		}
+		if field[0] != name {
+			if !strings.EqualFold(field[0], name) {
+				return nil, fmt.Errorf("line %d: expected %q, got %q", lineNum, name, field[0])
+			}
+			report(lineNum, 1, "changed %q to %q", field[0], name)
+		}
+		if !isNumber(field[1]) {
+			return nil, fmt.Errorf("line %d: %s %q is not a number", lineNum, name, field[1])
+		}
+		header[i] = field[1]
+		if field[0] == name {
+			keep[i] = line
+		}
+	}
+
+	ncols64, _ := strconv.ParseFloat(header[0], 64)
+	nrows64, _ := strconv.ParseFloat(header[1], 64)
+	if ncols64 < 1 || ncols64 != math.Trunc(ncols64) || nrows64 < 1 || nrows64 != math.Trunc(nrows64) {
+		return nil, fmt.Errorf("the size %s by %s is not two whole numbers greater than zero", header[0], header[1])
+	}
+	ncols, nrows := int(ncols64), int(nrows64)
+	for i, n := range []int{ncols, nrows} {
+		if header[i] != strconv.Itoa(n) {
+			report(i+1, 2, "changed %s %s to %d", headerFields[i], header[i], n)
+			header[i] = strconv.Itoa(n)
+			keep[i] = ""
+		}
+	}
+
+	// NODATA must be a whole number for ReadGrid.
+	oldNoData, _ := strconv.ParseFloat(header[5], 64)
+	noData := oldNoData
+	if noData != math.Trunc(noData) || math.Abs(noData) > math.MaxInt32 {
+		noData = DefaultNoData
+		report(6, 2, "changed NODATA_value %s to %d, which is a whole number", header[5], DefaultNoData)
+	} else if header[5] != strconv.Itoa(int(noData)) {
+		report(6, 2, "changed NODATA_value %s to %d", header[5], int(noData))
+	}
+	noDataText := strconv.Itoa(int(noData))
+	if header[5] != noDataText {
+		header[5] = noDataText
+		keep[5] = ""
+	}
+
+	w := bufio.NewWriter(out)
+	for i, name := range headerFields {
+		if keep[i] != "" {
+			fmt.Fprintf(w, "%s\n", keep[i])
+		} else {
+			fmt.Fprintf(w, "%s %s\n", name, header[i])
+		}
+	}
+
+	rows := 0
+	respelled := 0
+	values := make([]string, ncols)
+	for {
+		var line string
+		if havePending {
+			line, havePending = pending, false
+		} else {
+			var ok bool
+			var err error
+			line, ok, err = readLine()
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				break
+			}
+		}
+		field := strings.Fields(line)
+		if len(field) == 0 {
+			report(lineNum, 0, "removed the empty line")
+			continue
+		}
+		if rows == nrows {
+			report(lineNum, 0, "removed the row - there are more than the %d rows given by nrows", nrows)
+			continue
+		}
+		rows++
+		if strings.Join(field, " ") != line {
+			respaced++
+		}
+		extra := len(field) - ncols
+		if extra > 0 {
+			field = field[:ncols]
+		}
+		for i, s := range field {
+			h, err := strconv.ParseFloat(s, 64)
+			switch {
+			case err != nil || math.IsInf(h, 0) || math.IsNaN(h):
+				report(lineNum, i+1, "changed %q, which is not a number, to NODATA", s)
+				s = noDataText
+			case h == oldNoData || h == noData:
+				if s != noDataText {
+					respelled++
+					s = noDataText
+				}
+			case math.Abs(h-oldNoData) < 1:
+				report(lineNum, i+1, "changed %s, which is close to NODATA_value %g, to NODATA", s, oldNoData)
+				s = noDataText
+			}
+			values[i] = s
+		}
+		if extra > 0 {
+			report(lineNum, ncols+1, "removed %d values after the %d given by ncols", extra, ncols)
+		}
+		if len(field) < ncols {
+			report(lineNum, len(field)+1, "added %d NODATA values to make %d", ncols-len(field), ncols)
+			for i := len(field); i < ncols; i++ {
+				values[i] = noDataText
+			}
+		}
+		w.WriteString(strings.Join(values, " "))
+		w.WriteByte('\n')
+	}
+	if rows < nrows {
+		report(lineNum, 0, "added %d rows of NODATA to make %d", nrows-rows, nrows)
+		for i := range values {
+			values[i] = noDataText
+		}
+		row := strings.Join(values, " ")
+		for ; rows < nrows; rows++ {
+			w.WriteString(row)
+			w.WriteByte('\n')
+		}
+	}
+	if respelled > 0 {
+		report(0, 0, "wrote %d NODATA values that were written another way as %s", respelled, noDataText)
+	}
+	if respaced > 0 {
+		report(0, 0, "changed the spaces or line endings of %d lines", respaced)
+	}
+	return changes, w.Flush()
+}
+
+// isNumber returns true if s is a finite number.
+func isNumber(s string) bool {
+	v, err := strconv.ParseFloat(s, 64)
+	return err == nil && !math.IsInf(v, 0) && !math.IsNaN(v)
+}
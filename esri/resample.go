@@ -0,0 +1,84 @@
+package esri
+
+import (
+	"fmt"
+	"math"
+)
+
+// ResampleMethods are the ways that Resample can find the heights of the new
+// cells.
+var ResampleMethods = []string{"nearest", "bilinear", "average"}
+
+// Resample returns a new Grid covering the same area as g with cells of the
+// given size.  method chooses how the new heights are found: "nearest"
+// takes the height of the old cell under the centre of the new one,
+// "bilinear" interpolates between the centres of the nearest old cells and
+// "average" takes the mean of the old cells whose centres are inside the
+// new one, which suits making a grid coarser.  Where the new cells are
+// smaller, average falls back to nearest.  If the area isn't a whole number
+// of new cells across, the last row and column stick out past it.
+func (g Grid) Resample(cellsize float32, method string) (*Grid, error) {
+	if cellsize <= 0 {
+		return nil, fmt.Errorf("Resample: cell size %g is not greater than zero", cellsize)
+	}
+	var heightAt func(x, y float64) (float32, bool)
+	switch method {
+	case "nearest", "average":
+		heightAt = g.HeightAt
+	case "bilinear":
+		heightAt = g.InterpolatedHeightAt
+	default:
+		return nil, fmt.Errorf("Resample: unknown method %q", method)
+	}
+
+	minX, _, _, maxY := g.Bounds()
+	size := float64(cellsize)
+	// Allow for rounding when the new size divides the old extent exactly.
+	ncols := int(math.Ceil(float64(g.ncols)*float64(g.cellsize)/size - 1e-6))
+	nrows := int(math.Ceil(float64(g.nrows)*float64(g.cellsize)/size - 1e-6))
+	result := NewGrid(ncols, nrows)
+	result.SetXllcorner(g.xllcorner)
+	result.SetYllcorner(float32(maxY - float64(nrows)*size))
+	result.SetCellSize(cellsize)
+	result.SetNoDataValue(g.noDataValue)
+
+	var sum []float64
+	var count []int
+	if method == "average" {
+		sum = make([]float64, ncols*nrows)
+		count = make([]int, ncols*nrows)
+		half := float64(g.cellsize) / 2
+		for row := 0; row < g.nrows; row++ {
+			y := maxY - float64(row)*float64(g.cellsize) - half
+			r := int((maxY - y) / size)
+			for col := 0; col < g.ncols; col++ {
+				if g.IsNoData(row, col) {
+					continue
+				}
+				x := minX + float64(col)*float64(g.cellsize) + half
+				c := int((x - minX) / size)
+				if r < nrows && c < ncols {
+					sum[r*ncols+c] += float64(g.height[row][col])
+					count[r*ncols+c]++
+				}
+			}
+		}
+	}
+
+	for row := 0; row < nrows; row++ {
+		y := maxY - (float64(row)+0.5)*size
+		for col := 0; col < ncols; col++ {
+			if count != nil && count[row*ncols+col] > 0 {
+				i := row*ncols + col
+				result.SetHeight(row, col, float32(sum[i]/float64(count[i])))
+				continue
+			}
+			h, ok := heightAt(minX+(float64(col)+0.5)*size, y)
+			if !ok {
+				h = float32(g.noDataValue)
+			}
+			result.SetHeight(row, col, h)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,60 @@
+package esri
+
+import "io"
+
+// RowFunc is called by ReadGridFunc with the index of each row of a grid,
+// from 0 at the top, and its heights.  An error stops the reading.
+type RowFunc func(row int, values []float32) error
+
+// ReadGridFunc reads ESRI Grid format data from in a row at a time, from
+// the top, and calls f with each row, so that the heights can be worked on
+// as they're parsed without making a Grid.  values is overwritten after f
+// returns, so f must copy any heights it keeps.  A row that's missing or
+// has the wrong number of values is nil, or a row of No Data with
+// MissingAsNoData, as RowReader.Next gives it.  An error from f stops the
+// reading and is returned.  WithHeaderFunc gives the header before the
+// rows.  The other options are described with ReadOption - WithProgress is
+// ignored.
+func ReadGridFunc(in io.Reader, f RowFunc, opts ...ReadOption) error {
+	return readGridFunc(in, "input", f, newReadConfig(opts))
+}
+
+// ReadGridFromFileFunc reads the ESRI Grid format file filename a row at a
+// time like ReadGridFunc.  As with ReadGridFromFile, the file can be a zip
+// file holding one grid.
+func ReadGridFromFileFunc(filename string, f RowFunc, opts ...ReadOption) error {
+	c := newReadConfig(opts)
+	if isZip(filename) {
+		return walkOneGrid(c.ctx, filename, func(name string, in io.Reader) error {
+			return readGridFunc(in, name, f, c)
+		})
+	}
+	file, in, err := openGridFile(filename, c)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return readGridFunc(in, filename, f, c)
+}
+
+// readGridFunc reads the rows of ESRI Grid format data and calls f with
+// each.  The filename is used in messages.
+func readGridFunc(in io.Reader, filename string, f RowFunc, c *readConfig) error {
+	rr, err := newRowReader(in, filename, c)
+	if err != nil {
+		return err
+	}
+	for row := 0; ; row++ {
+		values, err := rr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		err = f(row, values)
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package esri
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"sync/atomic"
+)
+
+// RowReader reads the rows of ESRI Grid format data one at a time, from the
+// top, so that a grid can be worked through without holding all of it in
+// memory.
+type RowReader struct {
+	r        *bufio.Reader
+	filename string
+	header   Header
+	lineNum  int
+	headLen  int // the number of lines in the header
+	row      int
+	ended    bool // no more lines
+	heights  []float32
+	buf      *lineBuffer
+	trace    bool
+	cfg      *readConfig
+	maxLine  int   // the longest line allowed
+	warnings int32 // the number of warnings about the rows
+}
+
+// NewRowReader is a factory method that reads the header of ESRI Grid format
+// data from in and returns a RowReader for the rows that follow.  The
+// filename is used in messages.  A grid bigger than the Limits set by
+// SetLimits is an error.  The options are described with ReadOption -
+// WithProgress is ignored.
+func NewRowReader(in io.Reader, filename string, opts ...ReadOption) (*RowReader, error) {
+	return newRowReader(in, filename, newReadConfig(opts))
+}
+
+// NewRowReaderContext is a factory method that returns a RowReader like
+// NewRowReader whose Next returns ctx.Err() once ctx is cancelled or its
+// deadline passes.  It's the same as NewRowReader with WithContext.
+func NewRowReaderContext(ctx context.Context, in io.Reader, filename string) (*RowReader, error) {
+	return NewRowReader(in, filename, WithContext(ctx))
+}
+
+// newRowReader returns a RowReader configured by c.
+func newRowReader(in io.Reader, filename string, c *readConfig) (*RowReader, error) {
+	rr := &RowReader{filename: filename, cfg: c}
+	// The per-line and per-cell messages are costly, so check once.
+	rr.trace = c.log.Enabled(c.ctx, LevelTrace)
+	// A big buffer so that most rows fit in it.  See readLine.
+	rr.r = bufio.NewReaderSize(in, 64*1024)
+
+	var err error
+	rr.header, rr.headLen, err = readHeader(rr.r, filename, c)
+	if err != nil {
+		return nil, err
+	}
+	h := &rr.header
+	rr.lineNum = rr.headLen
+	if err := CheckSize(h.Ncols, h.Nrows); err != nil {
+		return nil, err
+	}
+	rr.maxLine = maxLineLength(h.Ncols)
+	if c.header != nil {
+		if err := c.header(*h); err != nil {
+			return nil, err
+		}
+	}
+
+	c.log.Info("reading grid", "file", filename, "ncols", h.Ncols, "nrows", h.Nrows,
+		"xllcorner", h.Xllcorner, "yllcorner", h.Yllcorner,
+		"cellsize", h.CellSize, "nodata", h.NoDataValue)
+
+	rr.heights = make([]float32, h.Ncols)
+	rr.buf = lineBuffers.Get().(*lineBuffer)
+	return rr, nil
+}
+
+// Header returns the header of the grid.
+func (rr *RowReader) Header() Header {
+	return rr.header
+}
+
+// Next returns the heights of the next row, which are overwritten by the
+// following call, or io.EOF after the last row.  A row whose line has the
+// wrong number of values, or that is missing because the data ends early,
+// is logged as a warning and returned as nil, or as a row of No Data with
+// MissingAsNoData.  With WithStrict it's an error.  A value that isn't a
+// number, or a line that's too long, is an error.  The errors about the
+// data are DataErrors.
+func (rr *RowReader) Next() ([]float32, error) {
+	if rr.row == rr.header.Nrows {
+		if err := rr.finish(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+	if err := rr.cfg.ctx.Err(); err != nil {
+		return nil, err
+	}
+	row := rr.row
+	rr.row++
+	if rr.ended {
+		return rr.missingRow(), nil
+	}
+
+	var err error
+	rr.buf.line, err = readLine(rr.r, rr.buf.line, rr.maxLine)
+	if err == io.EOF && len(bytes.TrimSpace(rr.buf.line)) > 0 {
+		// The last line has no line ending, but it's a row all the same.
+		// The next call finds the end of the data.
+		rr.warn("the last line has no line ending", "line", rr.lineNum+1)
+		err = nil
+	}
+	if err == io.EOF {
+		rr.ended = true
+		err = rr.fault(rr.dataError(rr.lineNum+1, "the grid ends after %d lines - expected %d", rr.lineNum, rr.header.Nrows+rr.headLen),
+			"too few lines", "got", rr.lineNum, "expected", rr.header.Nrows+rr.headLen)
+		if err != nil {
+			return nil, err
+		}
+		return rr.missingRow(), nil
+	}
+	if err == errLineTooLong {
+		return nil, rr.dataError(rr.lineNum+1, "the line is longer than %d bytes", rr.maxLine)
+	}
+	if err != nil {
+		return nil, err
+	}
+	rr.lineNum++
+	line := rr.buf.line
+	if rr.trace {
+		rr.cfg.log.Log(rr.cfg.ctx, LevelTrace, "data line", "line", rr.lineNum, "text", string(line))
+	}
+
+	// The line and the list of its fields are reused for every row, so
+	// that reading a big grid doesn't allocate for each line and value.
+	rr.buf.fields = splitFields(line, rr.buf.fields)
+	numbers := rr.buf.fields
+	if err := rr.checkColumns(rr.lineNum, len(numbers)); err != nil {
+		return nil, err
+	}
+	if len(numbers) != rr.header.Ncols {
+		return rr.missingRow(), nil
+	}
+	for col := range numbers {
+		// The conversion to a string doesn't allocate because ParseFloat
+		// doesn't keep it.
+		f, err := strconv.ParseFloat(string(numbers[col]), 32)
+		if err != nil {
+			rr.cfg.log.Error("bad height", "file", rr.filename, "line", rr.lineNum, "column", col+1,
+				"error", err)
+			return nil, badValue(rr.filename, rr.lineNum, col+1, numbers[col])
+		}
+		rr.heights[col] = float32(f)
+		if rr.trace {
+			rr.cfg.log.Log(rr.cfg.ctx, LevelTrace, "height", "row", row, "col", col, "height", rr.heights[col])
+		}
+	}
+	return rr.heights, nil
+}
+
+// checkColumns reports a line with the wrong number of values - see fault.
+func (rr *RowReader) checkColumns(lineNum, got int) error {
+	expected := rr.header.Ncols
+	if got == expected {
+		return nil
+	}
+	msg := "too many columns"
+	if got < expected {
+		msg = "too few columns"
+	}
+	return rr.fault(rr.dataError(lineNum, "%d values - expected %d", got, expected),
+		msg, "line", lineNum, "got", got, "expected", expected)
+}
+
+// missingRow returns what Next gives for a row that's missing or has the
+// wrong number of values - nil, or with MissingAsNoData a row of No Data.
+func (rr *RowReader) missingRow() []float32 {
+	if rr.cfg.missing != MissingAsNoData {
+		return nil
+	}
+	fillNoData(rr.heights, rr.header.NoDataValue)
+	return rr.heights
+}
+
+// fillNoData sets every height in heights to the No Data value.
+func fillNoData(heights []float32, noData int) {
+	for i := range heights {
+		heights[i] = float32(noData)
+	}
+}
+
+// finish checks for lines after the last row, logs the number of warnings
+// that weren't logged and gives back the line buffers.  With WithStrict,
+// more lines are an error.
+func (rr *RowReader) finish() error {
+	if rr.buf == nil {
+		return nil
+	}
+	var err error
+	if !rr.ended {
+		line, readErr := readLine(rr.r, rr.buf.line, rr.maxLine)
+		if readErr == nil || readErr == errLineTooLong || len(bytes.TrimSpace(line)) > 0 {
+			err = rr.fault(rr.dataError(rr.header.Nrows+rr.headLen+1, "more than the %d rows given by nrows", rr.header.Nrows),
+				"too many lines", "expected", rr.header.Nrows+rr.headLen)
+		}
+	}
+	if n := atomic.LoadInt32(&rr.warnings); n > maxWarnings && !rr.cfg.verbose {
+		rr.cfg.log.Warn("more warnings not logged", "file", rr.filename, "count", n-maxWarnings)
+	}
+	lineBuffers.Put(rr.buf)
+	rr.buf = nil
+	return err
+}
+
+// dataError returns a DataError for the whole of the given line.
+func (rr *RowReader) dataError(line int, format string, args ...interface{}) *DataError {
+	return &DataError{File: rr.filename, Line: line, Err: fmt.Errorf(format, args...)}
+}
+
+// fault reports a fault in the rows that is normally only a warning.  With
+// WithStrict it returns err, and otherwise it logs msg and args as a
+// warning and returns nil.
+func (rr *RowReader) fault(err error, msg string, args ...interface{}) error {
+	if rr.cfg.strict {
+		return err
+	}
+	rr.warn(msg, args...)
+	return nil
+}
+
+// warn logs a warning about the rows of the grid, unless there have been
+// maxWarnings already, so that a badly broken file doesn't give a message
+// for every line.  WithVerbose logs them all.  It's safe to call from the
+// workers of readRowsParallel.
+func (rr *RowReader) warn(msg string, args ...interface{}) {
+	if atomic.AddInt32(&rr.warnings, 1) > maxWarnings && !rr.cfg.verbose {
+		return
+	}
+	rr.cfg.log.Warn(msg, append([]interface{}{"file", rr.filename}, args...)...)
+}
@@ -0,0 +1,61 @@
+package esri
+
+// Sampler looks up heights in a TileSet for a long run of points, such as a
+// file of survey points or GPS fixes.  Points next to each other are usually
+// in the same Grid, so the Sampler tries the Grid that answered last before
+// searching the whole mosaic, which saves time with a mosaic of many Grids.
+// It gives the same answers as the TileSet.  A Sampler must not be shared
+// between goroutines.
+type Sampler struct {
+	ts   *TileSet
+	last int
+	// alone is true for each Grid whose area doesn't overlap any Grid
+	// listed before it, so that it has the last word inside its area.
+	alone []bool
+}
+
+// NewSampler is a factory method that creates a Sampler for a TileSet.
+// Grids added to the TileSet afterwards are ignored.
+func NewSampler(ts *TileSet) *Sampler {
+	s := Sampler{ts: ts, last: -1, alone: make([]bool, len(ts.grids))}
+	for i, g := range ts.grids {
+		minX, minY, maxX, maxY := g.Bounds()
+		s.alone[i] = true
+		for _, earlier := range ts.grids[:i] {
+			x0, y0, x1, y1 := earlier.Bounds()
+			if x0 < maxX && x1 > minX && y0 < maxY && y1 > minY {
+				s.alone[i] = false
+				break
+			}
+		}
+	}
+	return &s
+}
+
+// InterpolatedHeightAt returns the height at the map position (x, y) as
+// described for TileSet.InterpolatedHeightAt.
+func (s *Sampler) InterpolatedHeightAt(x, y float64) (height float32, ok bool) {
+	if s.last >= 0 {
+		g := s.ts.grids[s.last]
+		minX, minY, maxX, maxY := g.Bounds()
+		// On the edge, a neighbouring Grid listed earlier may win.
+		if x > minX && x < maxX && y > minY && y < maxY {
+			height, ok = g.InterpolatedHeightAt(x, y)
+			if ok {
+				return height, true
+			}
+		}
+	}
+	for i, g := range s.ts.grids[:len(s.alone)] {
+		height, ok = g.InterpolatedHeightAt(x, y)
+		if ok {
+			if s.alone[i] {
+				s.last = i
+			} else {
+				s.last = -1
+			}
+			return height, true
+		}
+	}
+	return 0, false
+}
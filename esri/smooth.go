@@ -0,0 +1,127 @@
+package esri
+
+import (
+	"math"
+	"sort"
+)
+
+// GaussianSmooth returns a copy of g blurred with a Gaussian filter whose
+// standard deviation is sigma map units.  The filter reaches out three
+// standard deviations.  Cells holding the No Data value are left as they
+// are and don't contribute to their neighbours - the weights of the cells
+// that do are scaled up to make up for them, so heights near the edge of
+// the data aren't dragged down.
+func (g Grid) GaussianSmooth(sigma float64) *Grid {
+	s := sigma / float64(g.cellsize)
+	radius := int(math.Ceil(3 * s))
+	if s <= 0 || radius < 1 {
+		return g.copy()
+	}
+	kernel := make([]float64, 2*radius+1)
+	for i := range kernel {
+		d := float64(i - radius)
+		kernel[i] = math.Exp(-d * d / (2 * s * s))
+	}
+
+	// The filter is separable - blur the rows, then the columns, keeping the
+	// sums of the weights so that missing cells can be allowed for.
+	sums := make([][]float64, g.nrows)
+	weights := make([][]float64, g.nrows)
+	for row := 0; row < g.nrows; row++ {
+		sums[row] = make([]float64, g.ncols)
+		weights[row] = make([]float64, g.ncols)
+		for col := 0; col < g.ncols; col++ {
+			for i, k := range kernel {
+				c := col + i - radius
+				if c < 0 || c >= g.ncols || g.IsNoData(row, c) {
+					continue
+				}
+				sums[row][col] += k * float64(g.height[row][c])
+				weights[row][col] += k
+			}
+		}
+	}
+
+	result := g.empty()
+	for row := 0; row < g.nrows; row++ {
+		for col := 0; col < g.ncols; col++ {
+			if g.IsNoData(row, col) {
+				result.SetHeight(row, col, g.height[row][col])
+				continue
+			}
+			sum, weight := 0.0, 0.0
+			for i, k := range kernel {
+				r := row + i - radius
+				if r < 0 || r >= g.nrows {
+					continue
+				}
+				sum += k * sums[r][col]
+				weight += k * weights[r][col]
+			}
+			result.SetHeight(row, col, float32(sum/weight))
+		}
+	}
+	return result
+}
+
+// MedianSmooth returns a copy of g in which each cell holds the median
+// height of the cells within radius cells of it, in a square.  The median
+// removes spikes and pits without blurring edges the way GaussianSmooth
+// does.  Cells holding the No Data value are left as they are and are left
+// out of their neighbours' medians.
+func (g Grid) MedianSmooth(radius int) *Grid {
+	if radius < 1 {
+		return g.copy()
+	}
+	result := g.empty()
+	window := make([]float32, 0, (2*radius+1)*(2*radius+1))
+	for row := 0; row < g.nrows; row++ {
+		for col := 0; col < g.ncols; col++ {
+			if g.IsNoData(row, col) {
+				result.SetHeight(row, col, g.height[row][col])
+				continue
+			}
+			window = window[:0]
+			for r := row - radius; r <= row+radius; r++ {
+				if r < 0 || r >= g.nrows {
+					continue
+				}
+				for c := col - radius; c <= col+radius; c++ {
+					if c < 0 || c >= g.ncols || g.IsNoData(r, c) {
+						continue
+					}
+					window = append(window, g.height[r][c])
+				}
+			}
+			sort.Slice(window, func(i, j int) bool { return window[i] < window[j] })
+			n := len(window)
+			median := window[n/2]
+			if n%2 == 0 {
+				median = (window[n/2-1] + window[n/2]) / 2
+			}
+			result.SetHeight(row, col, median)
+		}
+	}
+	return result
+}
+
+// empty returns a Grid with the same header as g and no heights set.
+func (g Grid) empty() *Grid {
+	result := NewGrid(g.ncols, g.nrows)
+	result.SetXllcorner(g.xllcorner)
+	result.SetYllcorner(g.yllcorner)
+	result.SetCellSize(g.cellsize)
+	result.SetNoDataValue(g.noDataValue)
+	return result
+}
+
+// copy returns a copy of g.
+func (g Grid) copy() *Grid {
+	result := g.empty()
+	for row := 0; row < g.nrows; row++ {
+		for col := 0; col < g.ncols; col++ {
+			result.SetHeight(row, col, g.height[row][col])
+		}
+	}
+	return result
+}
@@ -0,0 +1,147 @@
+package esri
+
+import (
+	"math"
+	"sort"
+
+	"github.com/goblimey/tiler/geom"
+)
+
+// Stats summarises a set of heights.  If Count is zero, the other fields
+// are zero.
+type Stats struct {
+	Count  int
+	Min    float64
+	Max    float64
+	Mean   float64
+	StdDev float64
+	// sorted holds the heights in ascending order, for Percentile.
+	sorted []float32
+}
+
+// NewStats is a factory method that summarises some heights.
+func NewStats(heights []float32) Stats {
+	s := Stats{Count: len(heights)}
+	if s.Count == 0 {
+		return s
+	}
+	s.sorted = append([]float32(nil), heights...)
+	sort.Slice(s.sorted, func(i, j int) bool { return s.sorted[i] < s.sorted[j] })
+	s.Min = float64(s.sorted[0])
+	s.Max = float64(s.sorted[s.Count-1])
+	sum := 0.0
+	for _, h := range s.sorted {
+		sum += float64(h)
+	}
+	s.Mean = sum / float64(s.Count)
+	squares := 0.0
+	for _, h := range s.sorted {
+		d := float64(h) - s.Mean
+		squares += d * d
+	}
+	s.StdDev = math.Sqrt(squares / float64(s.Count))
+	return s
+}
+
+// Percentile returns the height below which p percent of the heights fall,
+// interpolating between the two nearest heights - so Percentile(50) is the
+// median.  It returns NaN if there are no heights.
+func (s Stats) Percentile(p float64) float64 {
+	if s.Count == 0 {
+		return math.NaN()
+	}
+	if p <= 0 {
+		return s.Min
+	}
+	if p >= 100 {
+		return s.Max
+	}
+	position := p / 100 * float64(s.Count-1)
+	i := int(position)
+	if i+1 >= s.Count {
+		return float64(s.sorted[i])
+	}
+	t := position - float64(i)
+	return float64(s.sorted[i])*(1-t) + float64(s.sorted[i+1])*t
+}
+
+// Histogram divides the range of the heights into bins of equal width and
+// returns the number of heights in each, lowest first.  Bin i covers Min +
+// i*(Max-Min)/bins up to the start of the next one, and the last bin
+// includes Max.  It returns nil if there are no heights.
+func (s Stats) Histogram(bins int) []int {
+	if s.Count == 0 || bins < 1 {
+		return nil
+	}
+	counts := make([]int, bins)
+	width := (s.Max - s.Min) / float64(bins)
+	for _, h := range s.sorted {
+		i := bins - 1
+		if width > 0 {
+			i = int((float64(h) - s.Min) / width)
+		}
+		if i >= bins {
+			i = bins - 1
+		}
+		counts[i]++
+	}
+	return counts
+}
+
+// Heights returns the heights of the cells of g that hold data, a row at a
+// time from the top.
+func (g Grid) Heights() []float32 {
+	var heights []float32
+	for row := 0; row < g.nrows; row++ {
+		for col := 0; col < g.ncols; col++ {
+			if !g.IsNoData(row, col) {
+				heights = append(heights, g.height[row][col])
+			}
+		}
+	}
+	return heights
+}
+
+// Stats summarises the heights of the cells of g that hold data.
+func (g Grid) Stats() Stats {
+	return NewStats(g.Heights())
+}
+
+// ZonalStats summarises the heights of the cells of g that hold data and
+// whose centres are inside the polygon, as Mask would keep them.
+func (g Grid) ZonalStats(polygon geom.Polygon) Stats {
+	var heights []float32
+	polygons := []geom.Polygon{polygon}
+	inside := make([]bool, g.ncols)
+	first, last := g.rowsCovering(polygon)
+	for row := first; row <= last; row++ {
+		g.inside(polygons, row, inside)
+		for col, in := range inside {
+			if in && !g.IsNoData(row, col) {
+				heights = append(heights, g.height[row][col])
+			}
+		}
+	}
+	return NewStats(heights)
+}
+
+// rowsCovering returns the first and last rows of g that the polygon might
+// cover.
+func (g Grid) rowsCovering(polygon geom.Polygon) (first, last int) {
+	_, minY, _, maxY := polygon.Bounds()
+	if minY > maxY {
+		// No points.
+		return 0, -1
+	}
+	cellsize := float64(g.cellsize)
+	top := float64(g.yllcorner) + float64(g.nrows)*cellsize
+	first = int(math.Floor((top - maxY) / cellsize))
+	last = int(math.Floor((top - minY) / cellsize))
+	if first < 0 {
+		first = 0
+	}
+	if last > g.nrows-1 {
+		last = g.nrows - 1
+	}
+	return first, last
+}
@@ -0,0 +1,57 @@
+package esri
+
+import (
+	"fmt"
+	"math"
+)
+
+// Subtract returns a Grid holding the height of each cell of g less the
+// height of the same cell of other - for example a surface model less a
+// terrain model gives the height of trees and buildings, and a later survey
+// less an earlier one shows what has changed.  The Grids must line up as
+// described for Aligned.  Cells holding the No Data value in either Grid
+// hold g's No Data value in the result.
+func (g Grid) Subtract(other *Grid) (*Grid, error) {
+	err := g.Aligned(other)
+	if err != nil {
+		return nil, fmt.Errorf("Subtract: %w", err)
+	}
+
+	result := g.empty()
+	noData := float32(g.noDataValue)
+	for row := 0; row < g.nrows; row++ {
+		for col := 0; col < g.ncols; col++ {
+			if g.IsNoData(row, col) || other.IsNoData(row, col) {
+				result.SetHeight(row, col, noData)
+				continue
+			}
+			d := g.height[row][col] - other.height[row][col]
+			if d == noData {
+				// Don't let a real difference look like missing data.
+				d = math.Nextafter32(d, 0)
+			}
+			result.SetHeight(row, col, d)
+		}
+	}
+	return result, nil
+}
+
+// Aligned returns an error if other doesn't line up with g - if it doesn't
+// have the same number of rows and columns, the same cell size and the same
+// corner, to within a thousandth of a cell.
+func (g Grid) Aligned(other *Grid) error {
+	if g.ncols != other.ncols || g.nrows != other.nrows {
+		return fmt.Errorf("grids are %dx%d and %dx%d cells",
+			g.ncols, g.nrows, other.ncols, other.nrows)
+	}
+	tolerance := float64(g.cellsize) / 1000
+	if math.Abs(float64(g.cellsize-other.cellsize)) > tolerance {
+		return fmt.Errorf("cell sizes %g and %g differ", g.cellsize, other.cellsize)
+	}
+	if math.Abs(float64(g.xllcorner-other.xllcorner)) > tolerance ||
+		math.Abs(float64(g.yllcorner-other.yllcorner)) > tolerance {
+		return fmt.Errorf("corners (%g,%g) and (%g,%g) differ",
+			g.xllcorner, g.yllcorner, other.xllcorner, other.yllcorner)
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package esri
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// TileSet is a mosaic of Grids, for example the set of Environment Agency
+// tiles covering an area.  The Grids are expected to use the same map
+// coordinates and not to overlap.  Where they do overlap, the first one
+// listed wins.
+type TileSet struct {
+	grids        []*Grid
+	maxHeightSet bool
+	maxHeight    float32
+	minHeightSet bool
+	minHeight    float32
+}
+
+// NewTileSet is a factory method that creates a TileSet from some Grids.
+func NewTileSet(grids ...*Grid) *TileSet {
+	ts := new(TileSet)
+	for _, g := range grids {
+		ts.Add(g)
+	}
+	return ts
+}
+
+// ReadTileSetFromFiles is a factory method that reads a list of ESRI grid
+// files and returns a TileSet.  The files are read at the same time, by
+// Workers() goroutines, and the Grids are added in the order of the list.  If any
+// of the files can't be read the error lists all of the failures.  A zip
+// file in the list adds all of the grids in it - see ReadGridsFromZip.
+func ReadTileSetFromFiles(filenames []string) (*TileSet, error) {
+	return ReadTileSetFromFilesContext(context.Background(), filenames)
+}
+
+// ReadTileSetFromFilesContext is a factory method that reads a list of ESRI
+// grid files like ReadTileSetFromFiles, giving up with ctx.Err() if ctx is
+// cancelled or its deadline passes.
+func ReadTileSetFromFilesContext(ctx context.Context, filenames []string) (*TileSet, error) {
+	grids := make([][]*Grid, len(filenames))
+	errs := make([]error, len(filenames))
+	workers := Workers()
+	if workers > len(filenames) {
+		workers = len(filenames)
+	}
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				if strings.ToLower(filepath.Ext(filenames[i])) == ".zip" {
+					grids[i], errs[i] = ReadGridsFromZip(ctx, filenames[i])
+					continue
+				}
+				grid, err := ReadGridFromFileContext(ctx, filenames[i], nil)
+				if err != nil {
+					errs[i] = fmt.Errorf("%s: %w", filenames[i], err)
+					continue
+				}
+				grids[i] = []*Grid{grid}
+			}
+		}()
+	}
+	for i := range filenames {
+		if ctx.Err() != nil {
+			break
+		}
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	// Rather than a failure for every file that was being read.
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	err := errors.Join(errs...)
+	if err != nil {
+		return nil, err
+	}
+	ts := NewTileSet()
+	for _, gs := range grids {
+		for _, g := range gs {
+			ts.Add(g)
+		}
+	}
+	return ts, nil
+}
+
+// ReadTileSetFromManifest is a factory method that reads a mosaic manifest
+// and returns a TileSet.  See ReadManifest.
+func ReadTileSetFromManifest(filename string) (*TileSet, error) {
+	filenames, err := ReadManifest(filename)
+	if err != nil {
+		return nil, err
+	}
+	return ReadTileSetFromFiles(filenames)
+}
+
+// ReadManifest reads a mosaic manifest and returns the names of the grid
+// files it lists.  The manifest is a text file naming one grid file per
+// line.  Relative names are taken from the directory holding the manifest.
+// Blank lines and lines starting with # are ignored.
+func ReadManifest(filename string) ([]string, error) {
+	m := "ReadManifest"
+	in, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+
+	dir := filepath.Dir(filename)
+	var filenames []string
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !filepath.IsAbs(line) {
+			line = filepath.Join(dir, line)
+		}
+		filenames = append(filenames, line)
+	}
+	err = scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+	slog.Debug(m, "manifest", filename, "grids", len(filenames))
+	return filenames, nil
+}
+
+// Add adds a Grid to the TileSet.
+func (ts *TileSet) Add(g *Grid) {
+	ts.grids = append(ts.grids, g)
+	if g.maxHeightSet {
+		if !ts.maxHeightSet || g.maxHeight > ts.maxHeight {
+			ts.maxHeight = g.maxHeight
+			ts.maxHeightSet = true
+		}
+	}
+	if g.minHeightSet {
+		if !ts.minHeightSet || g.minHeight < ts.minHeight {
+			ts.minHeight = g.minHeight
+			ts.minHeightSet = true
+		}
+	}
+}
+
+// Grids returns the Grids in the TileSet.
+func (ts *TileSet) Grids() []*Grid {
+	return ts.grids
+}
+
+// MaxHeight returns the largest height reading in the TileSet.
+func (ts *TileSet) MaxHeight() float32 {
+	return ts.maxHeight
+}
+
+// MinHeight returns the smallest height reading in the TileSet.
+func (ts *TileSet) MinHeight() float32 {
+	return ts.minHeight
+}
+
+// Bounds returns the map coordinates of the bottom left and top right
+// corners of the area covered by the TileSet.
+func (ts *TileSet) Bounds() (minX, minY, maxX, maxY float64) {
+	minX, minY = math.Inf(1), math.Inf(1)
+	maxX, maxY = math.Inf(-1), math.Inf(-1)
+	for _, g := range ts.grids {
+		x0, y0, x1, y1 := g.Bounds()
+		minX = math.Min(minX, x0)
+		minY = math.Min(minY, y0)
+		maxX = math.Max(maxX, x1)
+		maxY = math.Max(maxY, y1)
+	}
+	return minX, minY, maxX, maxY
+}
+
+// HeightAt returns the height of the cell containing the map position
+// (x, y).  ok is false if no Grid has data there.
+func (ts *TileSet) HeightAt(x, y float64) (height float32, ok bool) {
+	for _, g := range ts.grids {
+		height, ok = g.HeightAt(x, y)
+		if ok {
+			return height, true
+		}
+	}
+	return 0, false
+}
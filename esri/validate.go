@@ -0,0 +1,185 @@
+package esri
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Problem is a fault found by Validate.  Line and Column count from 1.
+// Column is zero if the problem is with the whole line, and Line is zero if
+// it's with the whole file.
+type Problem struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+// String gives the problem as "line:column: message", leaving out the
+// parts that are zero.
+func (p Problem) String() string {
+	switch {
+	case p.Line == 0:
+		return p.Message
+	case p.Column == 0:
+		return fmt.Sprintf("%d: %s", p.Line, p.Message)
+	default:
+		return fmt.Sprintf("%d:%d: %s", p.Line, p.Column, p.Message)
+	}
+}
+
+// headerFields are the names of the header lines, in the order they must
+// come in.
+var headerFields = []string{"ncols", "nrows", "xllcorner", "yllcorner", "cellsize", "NODATA_value"}
+
+// ValidateFile checks that the named file is a well formed ESRI grid.  See
+// Validate.  As with ReadGridFromFile, the file can be a zip file holding
+// one grid.
+func ValidateFile(filename string) ([]Problem, error) {
+	if isZip(filename) {
+		var problems []Problem
+		err := walkOneGrid(context.Background(), filename, func(name string, in io.Reader) error {
+			var err error
+			problems, err = Validate(in)
+			return err
+		})
+		return problems, err
+	}
+	in, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	return Validate(in)
+}
+
+// Validate checks that in holds a well formed ESRI grid: a complete header,
+// nrows lines of ncols numbers, and heights that are consistent with the
+// NODATA value.  It returns the problems found, which are none if the grid
+// is good.  The error is only for failures to read.
+func Validate(in io.Reader) ([]Problem, error) {
+	var problems []Problem
+	report := func(line, column int, format string, args ...interface{}) {
+		problems = append(problems, Problem{line, column, fmt.Sprintf(format, args...)})
+	}
+
+	r := bufio.NewReader(in)
+	lineNum := 0
+	// readLine returns the next line without its line ending.  ok is false
+	// at the end of the input.
+	readLine := func() (line string, ok bool, err error) {
+		line, err = r.ReadString('\n')
+		if err == io.EOF {
+			if line == "" {
+				return "", false, nil
+			}
+			lineNum++
+			// ReadGrid stops at the end of the last complete line.
+			report(lineNum, 0, "no line ending - the line is ignored")
+			return strings.TrimRight(line, "\r"), true, nil
+		}
+		if err != nil {
+			return "", false, err
+		}
+		lineNum++
+		return strings.TrimRight(line, "\r\n"), true, nil
+	}
+
+	var header [6]float64
+	for i, name := range headerFields {
+		line, ok, err := readLine()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			report(0, 0, "the header ends after %d lines - expected %s", i, name)
+			return problems, nil
+		}
+		field := strings.Fields(line)
+		if len(field) != 2 {
+			report(lineNum, 0, "expected %q and a value, got %q", name, line)
+			return problems, nil
+		}
+		if field[0] != name {
+			report(lineNum, 1, "expected %q, got %q", name, field[0])
+		}
+		v, err := strconv.ParseFloat(field[1], 64)
+		if err != nil || math.IsInf(v, 0) || math.IsNaN(v) {
+			report(lineNum, 2, "%s %q is not a number", name, field[1])
+			return problems, nil
+		}
+		header[i] = v
+	}
+
+	ncols, nrows, cellsize, noData := header[0], header[1], header[4], header[5]
+	if ncols < 1 || ncols != math.Trunc(ncols) {
+		report(1, 2, "ncols %g is not a whole number greater than zero", ncols)
+	}
+	if nrows < 1 || nrows != math.Trunc(nrows) {
+		report(2, 2, "nrows %g is not a whole number greater than zero", nrows)
+	}
+	if cellsize <= 0 {
+		report(5, 2, "cellsize %g is not greater than zero", cellsize)
+	}
+	if noData != math.Trunc(noData) {
+		report(6, 2, "NODATA_value %g is not a whole number - it's read as %d", noData, int(noData))
+	}
+	if len(problems) == 0 {
+		if err := CheckSize(int(ncols), int(nrows)); err != nil {
+			report(0, 0, "%v - the grid is too big to read", err)
+		}
+	}
+	if len(problems) > 0 && (ncols < 1 || nrows < 1) {
+		// Without the dimensions the data can't be checked.
+		return problems, nil
+	}
+
+	rows := 0
+	data := 0
+	for {
+		line, ok, err := readLine()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		rows++
+		if rows == int(nrows)+1 {
+			report(lineNum, 0, "more than the %d rows given by nrows", int(nrows))
+		}
+		if rows > int(nrows) {
+			continue
+		}
+		field := strings.Fields(line)
+		if len(field) != int(ncols) {
+			report(lineNum, 0, "%d values - expected %d", len(field), int(ncols))
+		}
+		for i, s := range field {
+			h, err := strconv.ParseFloat(s, 32)
+			if err != nil || math.IsInf(h, 0) || math.IsNaN(h) {
+				report(lineNum, i+1, "%q is not a number", s)
+				continue
+			}
+			if h == noData {
+				continue
+			}
+			data++
+			if math.Abs(h-noData) < 1 {
+				report(lineNum, i+1, "%s is close to NODATA_value %g - should it be NODATA?", s, noData)
+			}
+		}
+	}
+	if rows < int(nrows) {
+		report(lineNum, 0, "%d rows - expected %d", rows, int(nrows))
+	}
+	if rows > 0 && data == 0 {
+		report(0, 0, "every cell is NODATA")
+	}
+	return problems, nil
+}
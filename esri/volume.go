@@ -0,0 +1,58 @@
+package esri
+
+import "fmt"
+
+// CutFill gives the earthworks needed to bring a surface to a level or to
+// another surface.  Cut is the volume of material above the target, to be
+// dug away, and Fill is the volume of the space below it, to be filled in,
+// both in cubic map units.  CutArea and FillArea are the areas of the cells
+// above and below the target in square map units, and Cells is the number of
+// cells counted.
+type CutFill struct {
+	Cut, Fill         float64
+	CutArea, FillArea float64
+	Cells             int
+}
+
+// Net returns the volume of material left over when the cut is used for
+// the fill - negative if more has to be brought in.
+func (c CutFill) Net() float64 {
+	return c.Cut - c.Fill
+}
+
+// CutFill returns the earthworks needed to bring the cells of g that hold
+// data to the given level, each cell counting as a column of its full size.
+func (g Grid) CutFill(level float64) CutFill {
+	var result CutFill
+	area := float64(g.cellsize) * float64(g.cellsize)
+	for row := 0; row < g.nrows; row++ {
+		for col := 0; col < g.ncols; col++ {
+			if g.IsNoData(row, col) {
+				continue
+			}
+			result.Cells++
+			d := float64(g.height[row][col]) - level
+			switch {
+			case d > 0:
+				result.Cut += d * area
+				result.CutArea += area
+			case d < 0:
+				result.Fill -= d * area
+				result.FillArea += area
+			}
+		}
+	}
+	return result
+}
+
+// CutFillTo returns the earthworks needed to turn the surface g into the
+// surface target, for example the ground as surveyed into a design, over the
+// cells where both hold data.  The Grids must line up as described for
+// Aligned.
+func (g Grid) CutFillTo(target *Grid) (CutFill, error) {
+	d, err := g.Subtract(target)
+	if err != nil {
+		return CutFill{}, fmt.Errorf("CutFillTo: %w", err)
+	}
+	return d.CutFill(0), nil
+}
@@ -0,0 +1,29 @@
+package esri
+
+import (
+	"runtime"
+	"sync/atomic"
+)
+
+// workers is the number of goroutines set by SetWorkers, or 0.
+var workers int32
+
+// SetWorkers sets the number of goroutines that share out work such as
+// parsing a grid, reading the grids of a TileSet or, in the render package,
+// shading a picture.  n less than 1 gives the default, one for each CPU the
+// program may use (see runtime.GOMAXPROCS).
+func SetWorkers(n int) {
+	if n < 0 {
+		n = 0
+	}
+	atomic.StoreInt32(&workers, int32(n))
+}
+
+// Workers returns the number of goroutines to share work between - see
+// SetWorkers.
+func Workers() int {
+	if n := atomic.LoadInt32(&workers); n > 0 {
+		return int(n)
+	}
+	return runtime.GOMAXPROCS(0)
+}
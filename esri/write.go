@@ -0,0 +1,43 @@
+package esri
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+// WriteToFile writes the Grid to an ESRI Grid format file.
+func (g Grid) WriteToFile(filename string) error {
+	out, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	err = g.Write(out)
+	if err != nil {
+		out.Close()
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+	return out.Close()
+}
+
+// Write writes the Grid in ESRI Grid format, as read by ReadGrid.
+func (g Grid) Write(w io.Writer) error {
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, "ncols %d\nnrows %d\nxllcorner %g\nyllcorner %g\ncellsize %g\nNODATA_value %d\n",
+		g.ncols, g.nrows, g.xllcorner, g.yllcorner, g.cellsize, g.noDataValue)
+	var buf []byte
+	for row := 0; row < g.nrows; row++ {
+		buf = buf[:0]
+		for col := 0; col < g.ncols; col++ {
+			if col > 0 {
+				buf = append(buf, ' ')
+			}
+			buf = strconv.AppendFloat(buf, float64(g.height[row][col]), 'g', -1, 32)
+		}
+		buf = append(buf, '\n')
+		out.Write(buf)
+	}
+	return out.Flush()
+}
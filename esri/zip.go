@@ -0,0 +1,138 @@
+package esri
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ErrMosaicZip is returned when a zip file holding more than one grid is
+// read as a single grid.  Read it as a mosaic with ReadGridsFromZip.
+var ErrMosaicZip = errors.New("the zip file holds more than one grid, so it must be read as a mosaic")
+
+// isZip returns true if filename is the name of a zip file.
+func isZip(filename string) bool {
+	return strings.ToLower(filepath.Ext(filename)) == ".zip"
+}
+
+// walkOneGrid calls fn with the name and contents of the only ESRI ASCII
+// grid in the zip file filename, such as a single tile of a lidar
+// download, so that it can be read like a grid file.  It returns an error
+// wrapping ErrMosaicZip if there is more than one.
+func walkOneGrid(ctx context.Context, filename string, fn func(name string, in io.Reader) error) error {
+	// Count the grids first, so that fn isn't given the first of a mosaic.
+	count := 0
+	err := WalkZip(ctx, filename, func(name string, in io.Reader) error {
+		count++
+		if count > 1 {
+			return ErrMosaicZip
+		}
+		return nil
+	})
+	switch {
+	case errors.Is(err, ErrMosaicZip):
+		return fmt.Errorf("%s: %w", filename, ErrMosaicZip)
+	case err != nil:
+		return err
+	case count == 0:
+		return fmt.Errorf("%s: the zip file holds no ESRI ASCII grid (.asc) files", filename)
+	}
+	return WalkZip(ctx, filename, fn)
+}
+
+// WalkZip calls fn with the name and the contents of each ESRI ASCII grid
+// (.asc) file in the zip file filename, in the order they are stored.  Zip
+// files inside it are walked too, to any depth, as in the Ordnance Survey's
+// OS Terrain 50 and OS Terrain 5 downloads, where each 10 km square is a
+// zip file within the zip file of the whole country.  The name of a grid
+// in a zip file inside another is the names of the zip files and the grid
+// joined with "/".  Other files are ignored.  Walking stops at the first
+// error from fn, or with ctx.Err() once ctx is cancelled.
+func WalkZip(ctx context.Context, filename string, fn func(name string, in io.Reader) error) error {
+	z, err := zip.OpenReader(filename)
+	if err != nil {
+		return err
+	}
+	defer z.Close()
+	err = walkZip(ctx, &z.Reader, "", fn)
+	if err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+	return nil
+}
+
+// walkZip walks the zip file z for WalkZip, with prefix put before the
+// names in it.
+func walkZip(ctx context.Context, z *zip.Reader, prefix string, fn func(name string, in io.Reader) error) error {
+	for _, f := range z.File {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		name := prefix + f.Name
+		switch strings.ToLower(path.Ext(f.Name)) {
+		case ".asc":
+			in, err := f.Open()
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			err = fn(name, in)
+			in.Close()
+			if err != nil {
+				return err
+			}
+		case ".zip":
+			// A zip file can't be read as a stream, so the inner one is
+			// held in memory.  They are small - a few megabytes.
+			in, err := f.Open()
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			data, err := io.ReadAll(in)
+			in.Close()
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			inner, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			err = walkZip(ctx, inner, name+"/", fn)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ReadGridsFromZip reads the ESRI ASCII grids in the zip file filename and
+// the zip files inside it - see WalkZip.  Together they are usually a
+// mosaic, such as OS Terrain 50.  The options are described with
+// ReadOption, except that WithContext is given by ctx and WithProgress is
+// ignored.
+func ReadGridsFromZip(ctx context.Context, filename string, opts ...ReadOption) ([]*Grid, error) {
+	c := newReadConfig(opts)
+	c.ctx = ctx
+	var grids []*Grid
+	err := WalkZip(ctx, filename, func(name string, in io.Reader) error {
+		g, err := readGrid(in, name, c)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		grids = append(grids, g)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return grids, nil
+}
@@ -0,0 +1,57 @@
+package geojson
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+
+	"github.com/goblimey/tiler/geom"
+)
+
+// PointWriter writes a FeatureCollection of Point Features a Feature at a
+// time, for collections too big to gather in a FeatureCollection.
+type PointWriter struct {
+	out   *bufio.Writer
+	count int
+}
+
+// NewPointWriter is a factory method that creates a PointWriter writing to
+// w.  Close must be called to finish the FeatureCollection.
+func NewPointWriter(w io.Writer) *PointWriter {
+	return &PointWriter{out: bufio.NewWriterSize(w, 1<<20)}
+}
+
+// Write writes a Point Feature.  properties may be nil.
+func (pw *PointWriter) Write(p geom.Point, properties map[string]interface{}) error {
+	if properties == nil {
+		properties = map[string]interface{}{}
+	}
+	b, err := json.Marshal(feature{
+		Type:       "Feature",
+		Geometry:   geometry{Type: "Point", Coordinates: [2]float64{p.X, p.Y}},
+		Properties: properties,
+	})
+	if err != nil {
+		return err
+	}
+	if pw.count == 0 {
+		pw.out.WriteString(`{"type":"FeatureCollection","features":[` + "\n")
+	} else {
+		pw.out.WriteString(",\n")
+	}
+	pw.count++
+	_, err = pw.out.Write(b)
+	return err
+}
+
+// Close finishes the FeatureCollection.  It doesn't close the writer
+// given to NewPointWriter.
+func (pw *PointWriter) Close() error {
+	if pw.count == 0 {
+		pw.out.WriteString(`{"type":"FeatureCollection","features":[`)
+	} else {
+		pw.out.WriteString("\n")
+	}
+	pw.out.WriteString("]}\n")
+	return pw.out.Flush()
+}
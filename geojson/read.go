@@ -0,0 +1,205 @@
+// Package geojson reads and writes the parts of the GeoJSON format (RFC 7946)
+// that the tiler uses.
+//
+// The coordinates are passed through as they are, so they must be in the
+// same coordinate system as the grids that they are used with.
+package geojson
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/goblimey/tiler/geom"
+)
+
+// object holds any GeoJSON object - a FeatureCollection, a Feature or a
+// geometry.
+type object struct {
+	Type        string          `json:"type"`
+	Features    []object        `json:"features"`
+	Geometry    *object         `json:"geometry"`
+	Geometries  []object        `json:"geometries"`
+	Coordinates json.RawMessage `json:"coordinates"`
+}
+
+// ReadPolygonsFromFile reads a GeoJSON file and returns the Polygons and
+// MultiPolygons that it contains as a list of polygons.
+func ReadPolygonsFromFile(filename string) ([]geom.Polygon, error) {
+	in, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+
+	polygons, err := ReadPolygons(in)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return polygons, nil
+}
+
+// ReadPolygons reads GeoJSON text and returns the Polygons and MultiPolygons
+// that it contains as a list of polygons.  Other geometries are ignored.
+func ReadPolygons(r io.Reader) ([]geom.Polygon, error) {
+	var obj object
+	err := json.NewDecoder(r).Decode(&obj)
+	if err != nil {
+		return nil, err
+	}
+
+	var polygons []geom.Polygon
+	err = collectPolygons(&obj, &polygons)
+	if err != nil {
+		return nil, err
+	}
+	if len(polygons) == 0 {
+		return nil, fmt.Errorf("no polygons found")
+	}
+	return polygons, nil
+}
+
+func collectPolygons(obj *object, polygons *[]geom.Polygon) error {
+	switch obj.Type {
+	case "FeatureCollection":
+		for i := range obj.Features {
+			err := collectPolygons(&obj.Features[i], polygons)
+			if err != nil {
+				return err
+			}
+		}
+	case "Feature":
+		if obj.Geometry != nil {
+			return collectPolygons(obj.Geometry, polygons)
+		}
+	case "GeometryCollection":
+		for i := range obj.Geometries {
+			err := collectPolygons(&obj.Geometries[i], polygons)
+			if err != nil {
+				return err
+			}
+		}
+	case "Polygon":
+		var coords [][][]float64
+		err := json.Unmarshal(obj.Coordinates, &coords)
+		if err != nil {
+			return fmt.Errorf("Polygon: %w", err)
+		}
+		polygon, err := makePolygon(coords)
+		if err != nil {
+			return err
+		}
+		*polygons = append(*polygons, polygon)
+	case "MultiPolygon":
+		var coords [][][][]float64
+		err := json.Unmarshal(obj.Coordinates, &coords)
+		if err != nil {
+			return fmt.Errorf("MultiPolygon: %w", err)
+		}
+		for _, c := range coords {
+			polygon, err := makePolygon(c)
+			if err != nil {
+				return err
+			}
+			*polygons = append(*polygons, polygon)
+		}
+	}
+	return nil
+}
+
+func makePolygon(coords [][][]float64) (geom.Polygon, error) {
+	polygon := make(geom.Polygon, 0, len(coords))
+	for _, c := range coords {
+		ring := make(geom.Ring, 0, len(c))
+		for _, position := range c {
+			if len(position) < 2 {
+				return nil, fmt.Errorf("position %v has fewer than two coordinates", position)
+			}
+			ring = append(ring, geom.Point{X: position[0], Y: position[1]})
+		}
+		polygon = append(polygon, ring)
+	}
+	return polygon, nil
+}
+
+// ReadPoints reads GeoJSON text and returns the positions in the Points,
+// MultiPoints, LineStrings and MultiLineStrings that it contains, in order.
+// Other geometries are ignored.
+func ReadPoints(r io.Reader) ([]geom.Point, error) {
+	var obj object
+	err := json.NewDecoder(r).Decode(&obj)
+	if err != nil {
+		return nil, err
+	}
+
+	var points []geom.Point
+	err = collectPoints(&obj, &points)
+	if err != nil {
+		return nil, err
+	}
+	if len(points) == 0 {
+		return nil, fmt.Errorf("no points found")
+	}
+	return points, nil
+}
+
+func collectPoints(obj *object, points *[]geom.Point) error {
+	switch obj.Type {
+	case "FeatureCollection":
+		for i := range obj.Features {
+			err := collectPoints(&obj.Features[i], points)
+			if err != nil {
+				return err
+			}
+		}
+	case "Feature":
+		if obj.Geometry != nil {
+			return collectPoints(obj.Geometry, points)
+		}
+	case "GeometryCollection":
+		for i := range obj.Geometries {
+			err := collectPoints(&obj.Geometries[i], points)
+			if err != nil {
+				return err
+			}
+		}
+	case "Point":
+		var coords []float64
+		err := json.Unmarshal(obj.Coordinates, &coords)
+		if err != nil {
+			return fmt.Errorf("Point: %w", err)
+		}
+		return appendPositions(points, [][]float64{coords})
+	case "MultiPoint", "LineString":
+		var coords [][]float64
+		err := json.Unmarshal(obj.Coordinates, &coords)
+		if err != nil {
+			return fmt.Errorf("%s: %w", obj.Type, err)
+		}
+		return appendPositions(points, coords)
+	case "MultiLineString":
+		var coords [][][]float64
+		err := json.Unmarshal(obj.Coordinates, &coords)
+		if err != nil {
+			return fmt.Errorf("MultiLineString: %w", err)
+		}
+		for _, c := range coords {
+			err = appendPositions(points, c)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func appendPositions(points *[]geom.Point, coords [][]float64) error {
+	for _, position := range coords {
+		if len(position) < 2 {
+			return fmt.Errorf("position %v has fewer than two coordinates", position)
+		}
+		*points = append(*points, geom.Point{X: position[0], Y: position[1]})
+	}
+	return nil
+}
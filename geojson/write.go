@@ -0,0 +1,131 @@
+package geojson
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/goblimey/tiler/geom"
+)
+
+// FeatureCollection gathers Features to be written as a GeoJSON
+// FeatureCollection.
+type FeatureCollection struct {
+	features []feature
+}
+
+type feature struct {
+	Type       string                 `json:"type"`
+	Geometry   geometry               `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type geometry struct {
+	Type        string      `json:"type"`
+	Coordinates interface{} `json:"coordinates"`
+}
+
+// AddLineString adds a LineString Feature.  properties may be nil.
+func (fc *FeatureCollection) AddLineString(line geom.Line, properties map[string]interface{}) {
+	coordinates := make([][2]float64, len(line))
+	for i, p := range line {
+		coordinates[i] = [2]float64{p.X, p.Y}
+	}
+	fc.add(geometry{Type: "LineString", Coordinates: coordinates}, properties)
+}
+
+// AddPoint adds a Point Feature.  properties may be nil.
+func (fc *FeatureCollection) AddPoint(p geom.Point, properties map[string]interface{}) {
+	fc.add(geometry{Type: "Point", Coordinates: [2]float64{p.X, p.Y}}, properties)
+}
+
+// AddMultiPolygon adds a MultiPolygon Feature.  properties may be nil.
+// Rings are closed by repeating their first point if they don't already.
+func (fc *FeatureCollection) AddMultiPolygon(polygons []geom.Polygon, properties map[string]interface{}) {
+	coordinates := make([][][][2]float64, len(polygons))
+	for i, polygon := range polygons {
+		coordinates[i] = make([][][2]float64, len(polygon))
+		for j, ring := range polygon {
+			positions := make([][2]float64, 0, len(ring)+1)
+			for _, p := range ring {
+				positions = append(positions, [2]float64{p.X, p.Y})
+			}
+			if len(ring) > 0 && ring[0] != ring[len(ring)-1] {
+				positions = append(positions, [2]float64{ring[0].X, ring[0].Y})
+			}
+			coordinates[i][j] = positions
+		}
+	}
+	fc.add(geometry{Type: "MultiPolygon", Coordinates: coordinates}, properties)
+}
+
+func (fc *FeatureCollection) add(g geometry, properties map[string]interface{}) {
+	if properties == nil {
+		properties = map[string]interface{}{}
+	}
+	fc.features = append(fc.features, feature{Type: "Feature", Geometry: g, Properties: properties})
+}
+
+// Write writes the FeatureCollection as GeoJSON text.
+func (fc *FeatureCollection) Write(w io.Writer) error {
+	features := fc.features
+	if features == nil {
+		features = []feature{}
+	}
+	return json.NewEncoder(w).Encode(struct {
+		Type     string    `json:"type"`
+		Features []feature `json:"features"`
+	}{"FeatureCollection", features})
+}
+
+// WriteToFile writes the FeatureCollection to a GeoJSON file.
+func (fc *FeatureCollection) WriteToFile(filename string) error {
+	out, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	err = fc.Write(out)
+	if err != nil {
+		out.Close()
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+	return out.Close()
+}
+
+// WriteLineStringsToFile writes the lines to a GeoJSON file as described for
+// WriteLineStrings.
+func WriteLineStringsToFile(filename string, lines []geom.Line, properties []map[string]interface{}) error {
+	fc, err := lineStrings(lines, properties)
+	if err != nil {
+		return err
+	}
+	return fc.WriteToFile(filename)
+}
+
+// WriteLineStrings writes the lines as a FeatureCollection of LineString
+// Features.  properties, if not nil, gives the properties of each Feature and
+// must be the same length as lines.
+func WriteLineStrings(w io.Writer, lines []geom.Line, properties []map[string]interface{}) error {
+	fc, err := lineStrings(lines, properties)
+	if err != nil {
+		return err
+	}
+	return fc.Write(w)
+}
+
+func lineStrings(lines []geom.Line, properties []map[string]interface{}) (*FeatureCollection, error) {
+	if properties != nil && len(properties) != len(lines) {
+		return nil, fmt.Errorf("WriteLineStrings: %d lines but %d sets of properties",
+			len(lines), len(properties))
+	}
+	fc := new(FeatureCollection)
+	for i, line := range lines {
+		var p map[string]interface{}
+		if properties != nil {
+			p = properties[i]
+		}
+		fc.AddLineString(line, p)
+	}
+	return fc, nil
+}
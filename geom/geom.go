@@ -0,0 +1,140 @@
+// Package geom holds the simple geometry types shared by the readers and
+// writers of vector formats such as GeoJSON and shapefiles.  Coordinates are
+// map coordinates in the same system as the grids they are used with.
+package geom
+
+import (
+	"math"
+	"sort"
+)
+
+// Point is a position on the map.
+type Point struct {
+	X float64
+	Y float64
+}
+
+// Ring is a closed sequence of points.  The last point may or may not repeat
+// the first.
+type Ring []Point
+
+// Line is an open sequence of points.  A line that ends where it starts is
+// closed.
+type Line []Point
+
+// Polygon is an area bounded by an outer ring, optionally with holes.  The
+// first ring is the outer boundary and any others are holes.
+type Polygon []Ring
+
+// Bounds returns the bounding box of the polygon.
+func (p Polygon) Bounds() (minX, minY, maxX, maxY float64) {
+	minX, minY = math.Inf(1), math.Inf(1)
+	maxX, maxY = math.Inf(-1), math.Inf(-1)
+	for _, ring := range p {
+		for _, pt := range ring {
+			minX = math.Min(minX, pt.X)
+			minY = math.Min(minY, pt.Y)
+			maxX = math.Max(maxX, pt.X)
+			maxY = math.Max(maxY, pt.Y)
+		}
+	}
+	return minX, minY, maxX, maxY
+}
+
+// Area returns the area of the polygon - the area inside the outer ring less
+// the areas of the holes.  The rings may run either way round.
+func (p Polygon) Area() float64 {
+	area := 0.0
+	for i, ring := range p {
+		a := 0.0
+		n := len(ring)
+		for j := 0; j < n; j++ {
+			k := (j + 1) % n
+			a += ring[j].X*ring[k].Y - ring[k].X*ring[j].Y
+		}
+		if i == 0 {
+			area += math.Abs(a) / 2
+		} else {
+			area -= math.Abs(a) / 2
+		}
+	}
+	return area
+}
+
+// Crossings returns the x coordinates, in ascending order, where the
+// horizontal line through y crosses the edges of the polygon.  Taken in pairs
+// they give the stretches of the line that are inside the polygon.
+func (p Polygon) Crossings(y float64) []float64 {
+	var result []float64
+	for _, ring := range p {
+		n := len(ring)
+		for i := 0; i < n; i++ {
+			a := ring[i]
+			b := ring[(i+1)%n]
+			// The half-open test counts a vertex on the line exactly once.
+			if (a.Y <= y) != (b.Y <= y) {
+				result = append(result, a.X+(y-a.Y)*(b.X-a.X)/(b.Y-a.Y))
+			}
+		}
+	}
+	sort.Float64s(result)
+	return result
+}
+
+// Contains returns true if the point (x, y) is inside the polygon.
+func (p Polygon) Contains(x, y float64) bool {
+	inside := false
+	for _, cx := range p.Crossings(y) {
+		if cx > x {
+			break
+		}
+		inside = !inside
+	}
+	return inside
+}
+
+// Simplify returns the line with points removed by the Douglas-Peucker
+// algorithm, so that no point removed is further than tolerance from the
+// simplified line.  The first and last points are always kept.
+func (l Line) Simplify(tolerance float64) Line {
+	if len(l) < 3 {
+		return l
+	}
+	keep := make([]bool, len(l))
+	keep[0], keep[len(l)-1] = true, true
+	// Spans still to be examined, as pairs of indexes.
+	spans := [][2]int{{0, len(l) - 1}}
+	for len(spans) > 0 {
+		first, last := spans[len(spans)-1][0], spans[len(spans)-1][1]
+		spans = spans[:len(spans)-1]
+		worst, worstDistance := -1, tolerance
+		for i := first + 1; i < last; i++ {
+			d := distanceToSegment(l[i], l[first], l[last])
+			if d > worstDistance {
+				worst, worstDistance = i, d
+			}
+		}
+		if worst >= 0 {
+			keep[worst] = true
+			spans = append(spans, [2]int{first, worst}, [2]int{worst, last})
+		}
+	}
+	result := make(Line, 0, len(l))
+	for i, p := range l {
+		if keep[i] {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// distanceToSegment returns the distance from p to the segment from a to b.
+func distanceToSegment(p, a, b Point) float64 {
+	dx, dy := b.X-a.X, b.Y-a.Y
+	if dx == 0 && dy == 0 {
+		return math.Hypot(p.X-a.X, p.Y-a.Y)
+	}
+	t := ((p.X-a.X)*dx + (p.Y-a.Y)*dy) / (dx*dx + dy*dy)
+	t = math.Max(0, math.Min(1, t))
+	return math.Hypot(p.X-(a.X+t*dx), p.Y-(a.Y+t*dy))
+}
@@ -0,0 +1,121 @@
+package geotiff
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+)
+
+// decompress expands one strip or tile, which should come to size bytes.
+func decompress(compression int, src []byte, size int) ([]byte, error) {
+	switch compression {
+	case compressionNone:
+		return src, nil
+	case compressionLZW:
+		return lzwDecode(src, size)
+	case compressionDeflate, compressionOldDeflate:
+		r, err := zlib.NewReader(bytes.NewReader(src))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		out := make([]byte, size)
+		_, err = io.ReadFull(r, out)
+		return out, err
+	case compressionPackBits:
+		return packBitsDecode(src, size)
+	}
+	return nil, fmt.Errorf("unsupported compression %d", compression)
+}
+
+// lzwDecode expands TIFF LZW data, which differs from the LZW in GIF files
+// in putting the most significant bit first and widening the codes one code
+// early.
+func lzwDecode(src []byte, size int) ([]byte, error) {
+	const (
+		clear = 256
+		eoi   = 257
+		first = 258
+	)
+	// Each string in the table is a run of bytes already in out, given by
+	// its start and length.  The string added after each code is the
+	// previous string and the first byte of the current one, and that's
+	// always the bytes from the start of the previous string.
+	var start, length [4096]int
+	out := make([]byte, 0, size)
+	width, next := 9, first
+	prevStart, prevLength := -1, 0
+
+	var acc uint32
+	bits, pos := 0, 0
+	for len(out) < size {
+		for bits < width {
+			if pos >= len(src) {
+				return out, nil
+			}
+			acc = acc<<8 | uint32(src[pos])
+			pos++
+			bits += 8
+		}
+		code := int(acc>>uint(bits-width)) & (1<<uint(width) - 1)
+		bits -= width
+
+		if code == eoi {
+			break
+		}
+		if code == clear {
+			width, next = 9, first
+			prevStart = -1
+			continue
+		}
+
+		at := len(out)
+		switch {
+		case code < clear:
+			out = append(out, byte(code))
+		case code < next && code >= first:
+			out = append(out, out[start[code]:start[code]+length[code]]...)
+		case code == next && prevStart >= 0:
+			out = append(out, out[prevStart:prevStart+prevLength]...)
+			out = append(out, out[prevStart])
+		default:
+			return nil, fmt.Errorf("bad LZW code %d", code)
+		}
+		if prevStart >= 0 && next < len(start) {
+			start[next], length[next] = prevStart, prevLength+1
+			next++
+		}
+		prevStart, prevLength = at, len(out)-at
+		if next >= 1<<uint(width)-1 && width < 12 {
+			width++
+		}
+	}
+	return out, nil
+}
+
+// packBitsDecode expands PackBits data, a simple run length encoding.
+func packBitsDecode(src []byte, size int) ([]byte, error) {
+	out := make([]byte, 0, size)
+	for i := 0; i < len(src) && len(out) < size; {
+		n := int(int8(src[i]))
+		i++
+		switch {
+		case n >= 0:
+			if i+n+1 > len(src) {
+				return nil, fmt.Errorf("PackBits literal runs past the end of the data")
+			}
+			out = append(out, src[i:i+n+1]...)
+			i += n + 1
+		case n != -128:
+			if i >= len(src) {
+				return nil, fmt.Errorf("PackBits repeat runs past the end of the data")
+			}
+			for j := 0; j < 1-n; j++ {
+				out = append(out, src[i])
+			}
+			i++
+		}
+	}
+	return out, nil
+}
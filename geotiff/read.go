@@ -0,0 +1,480 @@
+// Package geotiff reads and writes GeoTIFF files holding a single band of
+// heights, such as the digital terrain models published by mapping agencies.
+package geotiff
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/goblimey/tiler/esri"
+)
+
+// TIFF tags used in GeoTIFF height files.
+const (
+	tagImageWidth         = 256
+	tagImageLength        = 257
+	tagBitsPerSample      = 258
+	tagCompression        = 259
+	tagPhotometric        = 262
+	tagStripOffsets       = 273
+	tagSamplesPerPixel    = 277
+	tagRowsPerStrip       = 278
+	tagStripByteCounts    = 279
+	tagPlanarConfig       = 284
+	tagPredictor          = 317
+	tagTileWidth          = 322
+	tagTileLength         = 323
+	tagTileOffsets        = 324
+	tagTileByteCounts     = 325
+	tagSampleFormat       = 339
+	tagModelPixelScale    = 33550
+	tagModelTiepoint      = 33922
+	tagModelTransform     = 34264
+	tagGeoKeyDirectory    = 34735
+	tagGDALNoData         = 42113
+	keyModelType          = 1024
+	keyRasterType         = 1025
+	keyGeographicType     = 2048
+	keyProjectedType      = 3072
+	rasterPixelIsPoint    = 2
+	compressionNone       = 1
+	compressionLZW        = 5
+	compressionDeflate    = 8
+	compressionPackBits   = 32773
+	compressionOldDeflate = 32946
+)
+
+// typeSizes gives the size in bytes of each TIFF field type.
+var typeSizes = map[uint16]int{
+	1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8, 16: 8, 17: 8,
+}
+
+// field is the value of a TIFF tag.
+type field struct {
+	typ   uint16
+	count int
+	data  []byte
+}
+
+// decoder holds a TIFF file while it's being read.
+type decoder struct {
+	data   []byte
+	order  binary.ByteOrder
+	fields map[uint16]field
+}
+
+// ReadFromFile is a factory method that reads a Grid from a GeoTIFF file.
+func ReadFromFile(filename string) (*esri.Grid, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	g, err := decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return g, nil
+}
+
+// Read is a factory method that reads a Grid from GeoTIFF data.  Only the
+// first image in the file is read, and it must have one band.  The cells
+// must be square and the image must not be rotated.
+func Read(in io.Reader) (*esri.Grid, error) {
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return nil, err
+	}
+	return decode(data)
+}
+
+// decode reads a Grid from the GeoTIFF data.
+func decode(data []byte) (*esri.Grid, error) {
+	d := decoder{data: data, fields: make(map[uint16]field)}
+	if len(data) < 8 {
+		return nil, fmt.Errorf("not a TIFF file")
+	}
+	switch string(data[:2]) {
+	case "II":
+		d.order = binary.LittleEndian
+	case "MM":
+		d.order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("not a TIFF file")
+	}
+	var err error
+	switch d.order.Uint16(data[2:]) {
+	case 42:
+		err = d.readIFD(uint64(d.order.Uint32(data[4:])), false)
+	case 43:
+		if len(data) < 16 {
+			return nil, fmt.Errorf("short BigTIFF header")
+		}
+		err = d.readIFD(d.order.Uint64(data[8:]), true)
+	default:
+		return nil, fmt.Errorf("not a TIFF file")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	width, err := d.uint(tagImageWidth)
+	if err != nil {
+		return nil, err
+	}
+	height, err := d.uint(tagImageLength)
+	if err != nil {
+		return nil, err
+	}
+	if d.uintOr(tagSamplesPerPixel, 1) != 1 {
+		return nil, fmt.Errorf("%d bands - expected one", d.uintOr(tagSamplesPerPixel, 1))
+	}
+	bits := d.uintOr(tagBitsPerSample, 1)
+	format := d.uintOr(tagSampleFormat, 1)
+	sample, err := d.sampleReader(bits, format)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := esri.CheckSize(width, height); err != nil {
+		return nil, err
+	}
+	g := esri.NewGrid(width, height)
+	err = d.georeference(g)
+	if err != nil {
+		return nil, err
+	}
+	noData := math.NaN()
+	if f, ok := d.fields[tagGDALNoData]; ok {
+		s := strings.TrimSpace(strings.TrimRight(string(f.data), "\x00"))
+		noData, err = strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("GDAL_NODATA %q is not a number", s)
+		}
+	}
+	g.SetNoDataValue(esri.NoDataFor(noData))
+
+	err = d.readBlocks(width, height, bits/8, func(block []byte, x, y, w, h int) {
+		for r := 0; r < h; r++ {
+			if y+r >= height {
+				break
+			}
+			for c := 0; c < w && x+c < width; c++ {
+				v := sample(block[(r*w+c)*bits/8:])
+				if v != v || float32(v) == float32(noData) {
+					v = float64(g.NoDataValue())
+				}
+				g.SetHeight(y+r, x+c, float32(v))
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// readIFD reads the tags of the image file directory at offset.
+func (d *decoder) readIFD(offset uint64, big bool) error {
+	countSize, entrySize, valueSize := 2, 12, 4
+	if big {
+		countSize, entrySize, valueSize = 8, 20, 8
+	}
+	if offset+uint64(countSize) > uint64(len(d.data)) {
+		return fmt.Errorf("image directory at %d is past the end of the file", offset)
+	}
+	var n uint64
+	if big {
+		n = d.order.Uint64(d.data[offset:])
+	} else {
+		n = uint64(d.order.Uint16(d.data[offset:]))
+	}
+	p := offset + uint64(countSize)
+	if p+n*uint64(entrySize) > uint64(len(d.data)) {
+		return fmt.Errorf("image directory at %d is cut short", offset)
+	}
+	for i := uint64(0); i < n; i++ {
+		e := d.data[p+i*uint64(entrySize):]
+		tag := d.order.Uint16(e)
+		typ := d.order.Uint16(e[2:])
+		var count uint64
+		if big {
+			count = d.order.Uint64(e[4:])
+		} else {
+			count = uint64(d.order.Uint32(e[4:]))
+		}
+		size, ok := typeSizes[typ]
+		if !ok {
+			continue
+		}
+		length := count * uint64(size)
+		value := e[8:]
+		if big {
+			value = e[12:]
+		}
+		var data []byte
+		if length <= uint64(valueSize) {
+			data = value[:length]
+		} else {
+			var at uint64
+			if big {
+				at = d.order.Uint64(value)
+			} else {
+				at = uint64(d.order.Uint32(value))
+			}
+			if at+length > uint64(len(d.data)) {
+				return fmt.Errorf("tag %d is past the end of the file", tag)
+			}
+			data = d.data[at : at+length]
+		}
+		d.fields[tag] = field{typ, int(count), data}
+	}
+	return nil
+}
+
+// uints returns the values of a tag holding whole numbers.
+func (d *decoder) uints(tag uint16) ([]uint64, error) {
+	f, ok := d.fields[tag]
+	if !ok {
+		return nil, fmt.Errorf("no tag %d", tag)
+	}
+	v := make([]uint64, f.count)
+	for i := range v {
+		switch f.typ {
+		case 1, 7:
+			v[i] = uint64(f.data[i])
+		case 3:
+			v[i] = uint64(d.order.Uint16(f.data[2*i:]))
+		case 4:
+			v[i] = uint64(d.order.Uint32(f.data[4*i:]))
+		case 16:
+			v[i] = d.order.Uint64(f.data[8*i:])
+		default:
+			return nil, fmt.Errorf("tag %d has type %d - expected a whole number", tag, f.typ)
+		}
+	}
+	return v, nil
+}
+
+// uint returns the first value of a tag holding whole numbers.
+func (d *decoder) uint(tag uint16) (int, error) {
+	v, err := d.uints(tag)
+	if err != nil {
+		return 0, err
+	}
+	if len(v) == 0 {
+		return 0, fmt.Errorf("tag %d is empty", tag)
+	}
+	return int(v[0]), nil
+}
+
+// uintOr returns the first value of a tag holding whole numbers, or def if
+// the tag isn't there.
+func (d *decoder) uintOr(tag uint16, def int) int {
+	v, err := d.uint(tag)
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+// floats returns the values of a tag holding doubles.
+func (d *decoder) floats(tag uint16) ([]float64, bool) {
+	f, ok := d.fields[tag]
+	if !ok || f.typ != 12 {
+		return nil, false
+	}
+	v := make([]float64, f.count)
+	for i := range v {
+		v[i] = math.Float64frombits(d.order.Uint64(f.data[8*i:]))
+	}
+	return v, true
+}
+
+// georeference sets the position and cell size of g from the GeoTIFF tags.
+func (d *decoder) georeference(g *esri.Grid) error {
+	var x, y, sx, sy float64
+	if m, ok := d.floats(tagModelTransform); ok && len(m) >= 8 {
+		if m[1] != 0 || m[4] != 0 {
+			return fmt.Errorf("the image is rotated")
+		}
+		sx, x, sy, y = m[0], m[3], -m[5], m[7]
+	} else {
+		scale, ok1 := d.floats(tagModelPixelScale)
+		tie, ok2 := d.floats(tagModelTiepoint)
+		if !ok1 || !ok2 || len(scale) < 2 || len(tie) < 6 {
+			return fmt.Errorf("no georeferencing - expected ModelPixelScale and ModelTiepoint tags")
+		}
+		sx, sy = scale[0], scale[1]
+		x, y = tie[3]-tie[0]*sx, tie[4]+tie[1]*sy
+	}
+	if sx <= 0 || sy <= 0 || math.Abs(sx-sy) > 1e-6*sx {
+		return fmt.Errorf("cells are %g by %g - expected them to be square", sx, sy)
+	}
+	if d.rasterType() == rasterPixelIsPoint {
+		x -= sx / 2
+		y += sy / 2
+	}
+	g.SetXllcorner(float32(x))
+	g.SetYllcorner(float32(y - float64(g.Nrows())*sy))
+	g.SetCellSize(float32(sx))
+	return nil
+}
+
+// rasterType returns the value of the GTRasterTypeGeoKey, or zero.
+func (d *decoder) rasterType() int {
+	keys, err := d.uints(tagGeoKeyDirectory)
+	if err != nil || len(keys) < 4 {
+		return 0
+	}
+	for i := 4; i+3 < len(keys); i += 4 {
+		if keys[i] == keyRasterType && keys[i+1] == 0 {
+			return int(keys[i+3])
+		}
+	}
+	return 0
+}
+
+// sampleReader returns a function that decodes one sample.
+func (d *decoder) sampleReader(bits, format int) (func(b []byte) float64, error) {
+	order := d.order
+	switch {
+	case format == 1 && bits == 8:
+		return func(b []byte) float64 { return float64(b[0]) }, nil
+	case format == 2 && bits == 8:
+		return func(b []byte) float64 { return float64(int8(b[0])) }, nil
+	case format == 1 && bits == 16:
+		return func(b []byte) float64 { return float64(order.Uint16(b)) }, nil
+	case format == 2 && bits == 16:
+		return func(b []byte) float64 { return float64(int16(order.Uint16(b))) }, nil
+	case format == 1 && bits == 32:
+		return func(b []byte) float64 { return float64(order.Uint32(b)) }, nil
+	case format == 2 && bits == 32:
+		return func(b []byte) float64 { return float64(int32(order.Uint32(b))) }, nil
+	case format == 3 && bits == 32:
+		return func(b []byte) float64 { return float64(math.Float32frombits(order.Uint32(b))) }, nil
+	case format == 3 && bits == 64:
+		return func(b []byte) float64 { return math.Float64frombits(order.Uint64(b)) }, nil
+	}
+	return nil, fmt.Errorf("unsupported sample format %d with %d bits", format, bits)
+}
+
+// readBlocks decompresses each strip or tile of the image and calls f with
+// its samples, its position in the image and its size.
+func (d *decoder) readBlocks(width, height, sampleSize int, f func(block []byte, x, y, w, h int)) error {
+	offsetTag, countTag := uint16(tagStripOffsets), uint16(tagStripByteCounts)
+	blockWidth, blockHeight := width, d.uintOr(tagRowsPerStrip, height)
+	tiled := false
+	if _, ok := d.fields[tagTileWidth]; ok {
+		tiled = true
+		offsetTag, countTag = tagTileOffsets, tagTileByteCounts
+		blockWidth = d.uintOr(tagTileWidth, 0)
+		blockHeight = d.uintOr(tagTileLength, 0)
+	}
+	if blockWidth <= 0 || blockHeight <= 0 {
+		return fmt.Errorf("blocks of %d by %d", blockWidth, blockHeight)
+	}
+	if blockHeight > height && !tiled {
+		blockHeight = height
+	}
+	offsets, err := d.uints(offsetTag)
+	if err != nil {
+		return err
+	}
+	counts, err := d.uints(countTag)
+	if err != nil {
+		return err
+	}
+	across := (width + blockWidth - 1) / blockWidth
+	down := (height + blockHeight - 1) / blockHeight
+	if len(offsets) < across*down || len(counts) < len(offsets) {
+		return fmt.Errorf("%d blocks - expected %d", len(offsets), across*down)
+	}
+	compression := d.uintOr(tagCompression, compressionNone)
+	predictor := d.uintOr(tagPredictor, 1)
+
+	for i := 0; i < across*down; i++ {
+		x := (i % across) * blockWidth
+		y := (i / across) * blockHeight
+		rows := blockHeight
+		if !tiled && y+rows > height {
+			rows = height - y
+		}
+		size := blockWidth * rows * sampleSize
+		start, length := offsets[i], counts[i]
+		if start+length > uint64(len(d.data)) {
+			return fmt.Errorf("block %d is past the end of the file", i)
+		}
+		block, err := decompress(compression, d.data[start:start+length], size)
+		if err != nil {
+			return fmt.Errorf("block %d: %w", i, err)
+		}
+		if len(block) < size {
+			return fmt.Errorf("block %d has %d bytes - expected %d", i, len(block), size)
+		}
+		block = block[:size]
+		for r := 0; r < rows; r++ {
+			row := block[r*blockWidth*sampleSize : (r+1)*blockWidth*sampleSize]
+			err = unpredict(predictor, row, sampleSize, d.order)
+			if err != nil {
+				return err
+			}
+		}
+		f(block, x, y, blockWidth, rows)
+	}
+	return nil
+}
+
+// unpredict reverses the predictor applied to a row of samples before they
+// were compressed, leaving them in the file's byte order.
+func unpredict(predictor int, row []byte, sampleSize int, order binary.ByteOrder) error {
+	switch predictor {
+	case 1:
+	case 2:
+		// Horizontal differencing of whole samples.
+		n := len(row) / sampleSize
+		switch sampleSize {
+		case 1:
+			for i := 1; i < n; i++ {
+				row[i] += row[i-1]
+			}
+		case 2:
+			for i := 1; i < n; i++ {
+				order.PutUint16(row[2*i:], order.Uint16(row[2*i:])+order.Uint16(row[2*i-2:]))
+			}
+		case 4:
+			for i := 1; i < n; i++ {
+				order.PutUint32(row[4*i:], order.Uint32(row[4*i:])+order.Uint32(row[4*i-4:]))
+			}
+		case 8:
+			for i := 1; i < n; i++ {
+				order.PutUint64(row[8*i:], order.Uint64(row[8*i:])+order.Uint64(row[8*i-8:]))
+			}
+		}
+	case 3:
+		// Floating point: the bytes were differenced after being split into
+		// planes, most significant first.
+		for i := 1; i < len(row); i++ {
+			row[i] += row[i-1]
+		}
+		planes := append([]byte(nil), row...)
+		n := len(row) / sampleSize
+		for s := 0; s < n; s++ {
+			for b := 0; b < sampleSize; b++ {
+				v := planes[b*n+s]
+				if order == binary.ByteOrder(binary.LittleEndian) {
+					row[s*sampleSize+sampleSize-1-b] = v
+				} else {
+					row[s*sampleSize+b] = v
+				}
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported predictor %d", predictor)
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package geotiff
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/goblimey/tiler/esri"
+)
+
+// Options control how Write writes a GeoTIFF.
+type Options struct {
+	// EPSG is the code of the coordinate reference system of the grid, or
+	// zero to leave it out.
+	EPSG int
+	// Compress compresses the heights with Deflate.
+	Compress bool
+}
+
+// entry is a tag to be written.
+type entry struct {
+	tag   uint16
+	typ   uint16
+	count int
+	data  []byte
+}
+
+// WriteToFile writes the Grid to a GeoTIFF file.
+func WriteToFile(filename string, g *esri.Grid, options Options) error {
+	out, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	err = Write(out, g, options)
+	if err != nil {
+		out.Close()
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+	return out.Close()
+}
+
+// Write writes the Grid as a GeoTIFF of 32 bit floating point heights, with
+// the No Data value in the GDAL_NODATA tag.
+func Write(w io.Writer, g *esri.Grid, options Options) error {
+	order := binary.LittleEndian
+	ncols, nrows := g.Ncols(), g.Nrows()
+	if ncols == 0 || nrows == 0 {
+		return fmt.Errorf("the grid is empty")
+	}
+
+	// Strips of about 64KB before compression.
+	rowsPerStrip := 65536 / (4 * ncols)
+	if rowsPerStrip < 1 {
+		rowsPerStrip = 1
+	}
+	if rowsPerStrip > nrows {
+		rowsPerStrip = nrows
+	}
+	var strips [][]byte
+	for top := 0; top < nrows; top += rowsPerStrip {
+		var raw []byte
+		for row := top; row < top+rowsPerStrip && row < nrows; row++ {
+			for col := 0; col < ncols; col++ {
+				raw = order.AppendUint32(raw, math.Float32bits(g.Height(row, col)))
+			}
+		}
+		if options.Compress {
+			var buf bytes.Buffer
+			z := zlib.NewWriter(&buf)
+			z.Write(raw)
+			err := z.Close()
+			if err != nil {
+				return err
+			}
+			raw = buf.Bytes()
+		}
+		strips = append(strips, raw)
+	}
+
+	compression := uint16(compressionNone)
+	if options.Compress {
+		compression = compressionDeflate
+	}
+	var offsets, counts []uint32
+	offset := uint32(8)
+	for _, s := range strips {
+		offsets = append(offsets, offset)
+		counts = append(counts, uint32(len(s)))
+		offset += uint32(len(s))
+	}
+	x, y, cellsize := float64(g.Xllcorner()), float64(g.Yllcorner()), float64(g.CellSize())
+	top := y + float64(nrows)*cellsize
+
+	entries := []entry{
+		longs(tagImageWidth, uint32(ncols)),
+		longs(tagImageLength, uint32(nrows)),
+		shorts(tagBitsPerSample, 32),
+		shorts(tagCompression, compression),
+		shorts(tagPhotometric, 1),
+		longs(tagStripOffsets, offsets...),
+		shorts(tagSamplesPerPixel, 1),
+		longs(tagRowsPerStrip, uint32(rowsPerStrip)),
+		longs(tagStripByteCounts, counts...),
+		shorts(tagPlanarConfig, 1),
+		shorts(tagSampleFormat, 3),
+		doubles(tagModelPixelScale, cellsize, cellsize, 0),
+		doubles(tagModelTiepoint, 0, 0, 0, x, top, 0),
+		shorts(tagGeoKeyDirectory, geoKeys(options.EPSG)...),
+		ascii(tagGDALNoData, strconv.Itoa(g.NoDataValue())),
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].tag < entries[j].tag })
+
+	// The directory goes after the strips, on a word boundary, and the
+	// values too big to go in it follow it.
+	ifd := offset + offset%2
+	extra := ifd + 2 + 12*uint32(len(entries)) + 4
+	var directory, values bytes.Buffer
+	directory.Write(order.AppendUint16(nil, uint16(len(entries))))
+	for _, e := range entries {
+		b := order.AppendUint16(nil, e.tag)
+		b = order.AppendUint16(b, e.typ)
+		b = order.AppendUint32(b, uint32(e.count))
+		if len(e.data) <= 4 {
+			field := make([]byte, 4)
+			copy(field, e.data)
+			b = append(b, field...)
+		} else {
+			b = order.AppendUint32(b, extra+uint32(values.Len()))
+			values.Write(e.data)
+			if values.Len()%2 == 1 {
+				values.WriteByte(0)
+			}
+		}
+		directory.Write(b)
+	}
+	directory.Write(make([]byte, 4)) // No more directories.
+
+	out := bufio.NewWriter(w)
+	out.WriteString("II")
+	out.Write(order.AppendUint16(nil, 42))
+	out.Write(order.AppendUint32(nil, ifd))
+	for _, s := range strips {
+		out.Write(s)
+	}
+	if offset%2 == 1 {
+		out.WriteByte(0)
+	}
+	out.Write(directory.Bytes())
+	out.Write(values.Bytes())
+	return out.Flush()
+}
+
+// geoKeys returns the GeoKeyDirectory for a grid in the coordinate reference
+// system with the given EPSG code.  The heights are of areas, not points.
+func geoKeys(epsg int) []uint16 {
+	keys := [][4]uint16{{keyRasterType, 0, 1, 1}}
+	switch epsg {
+	case 0:
+	case 4326:
+		keys = append(keys, [4]uint16{keyModelType, 0, 1, 2}, [4]uint16{keyGeographicType, 0, 1, uint16(epsg)})
+	default:
+		keys = append(keys, [4]uint16{keyModelType, 0, 1, 1}, [4]uint16{keyProjectedType, 0, 1, uint16(epsg)})
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i][0] < keys[j][0] })
+	directory := []uint16{1, 1, 0, uint16(len(keys))}
+	for _, k := range keys {
+		directory = append(directory, k[:]...)
+	}
+	return directory
+}
+
+func shorts(tag uint16, v ...uint16) entry {
+	var b []byte
+	for _, s := range v {
+		b = binary.LittleEndian.AppendUint16(b, s)
+	}
+	return entry{tag, 3, len(v), b}
+}
+
+func longs(tag uint16, v ...uint32) entry {
+	var b []byte
+	for _, l := range v {
+		b = binary.LittleEndian.AppendUint32(b, l)
+	}
+	return entry{tag, 4, len(v), b}
+}
+
+func doubles(tag uint16, v ...float64) entry {
+	var b []byte
+	for _, d := range v {
+		b = binary.LittleEndian.AppendUint64(b, math.Float64bits(d))
+	}
+	return entry{tag, 12, len(v), b}
+}
+
+func ascii(tag uint16, s string) entry {
+	return entry{tag, 2, len(s) + 1, append([]byte(s), 0)}
+}
@@ -0,0 +1,115 @@
+// Package gpx reads and writes the GPS Exchange Format used by GPS receivers
+// and route planning tools.  Only the waypoints, routes and tracks are kept,
+// with the position, elevation, time and name of each point.
+package gpx
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Namespace is the XML namespace of GPX 1.1.
+const Namespace = "http://www.topografix.com/GPX/1/1"
+
+// GPX is the contents of a GPX file.
+type GPX struct {
+	XMLName   xml.Name
+	Version   string  `xml:"version,attr"`
+	Creator   string  `xml:"creator,attr"`
+	Waypoints []Point `xml:"wpt"`
+	Routes    []Route `xml:"rte"`
+	Tracks    []Track `xml:"trk"`
+}
+
+// Route is a planned sequence of points.
+type Route struct {
+	Name   string  `xml:"name,omitempty"`
+	Points []Point `xml:"rtept"`
+}
+
+// Track is a recorded journey, in one or more segments.  A new segment
+// starts where the receiver lost its fix or was switched off.
+type Track struct {
+	Name     string    `xml:"name,omitempty"`
+	Segments []Segment `xml:"trkseg"`
+}
+
+// Segment is an unbroken part of a Track.
+type Segment struct {
+	Points []Point `xml:"trkpt"`
+}
+
+// Point is a position given as WGS84 latitude and longitude in degrees, with
+// the elevation in metres if known.
+type Point struct {
+	Lat  float64  `xml:"lat,attr"`
+	Lon  float64  `xml:"lon,attr"`
+	Ele  *float64 `xml:"ele"`
+	Time string   `xml:"time,omitempty"`
+	Name string   `xml:"name,omitempty"`
+}
+
+// ReadFromFile reads a GPX file.
+func ReadFromFile(filename string) (*GPX, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	g, err := Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return g, nil
+}
+
+// Read reads a GPX document.
+func Read(r io.Reader) (*GPX, error) {
+	var g GPX
+	err := xml.NewDecoder(r).Decode(&g)
+	if err != nil {
+		return nil, err
+	}
+	if g.XMLName.Local != "gpx" {
+		return nil, fmt.Errorf("not a GPX document - the root element is %s", g.XMLName.Local)
+	}
+	return &g, nil
+}
+
+// WriteToFile writes g to a GPX file.
+func (g *GPX) WriteToFile(filename string) error {
+	out, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	err = g.Write(out)
+	if err != nil {
+		out.Close()
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+	return out.Close()
+}
+
+// Write writes g as a GPX 1.1 document.
+func (g *GPX) Write(w io.Writer) error {
+	out := *g
+	out.XMLName = xml.Name{Space: Namespace, Local: "gpx"}
+	out.Version = "1.1"
+	if out.Creator == "" {
+		out.Creator = "tiler"
+	}
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+	e := xml.NewEncoder(w)
+	e.Indent("", "  ")
+	err = e.Encode(out)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
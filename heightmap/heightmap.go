@@ -0,0 +1,118 @@
+// Package heightmap resamples a Grid to the square heightmaps that game
+// engines read, and writes them as raw 16 bit samples with a JSON file
+// giving the heights and distances they stand for.  It also writes Grids
+// as Terragen terrains for landscape rendering.
+package heightmap
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/goblimey/tiler/esri"
+)
+
+// The smallest and largest heightmaps, in samples along each side.  Unity
+// takes sizes from 33 to 4097.
+const (
+	MinSize = 33
+	MaxSize = 4097
+)
+
+// Heightmap is a square of samples of a Grid, Size rows of Size from the
+// north west corner.  The outer samples are at the centres of the outer
+// cells of the Grid, so the samples are spaced Width / (Size - 1) apart
+// east to west and Length / (Size - 1) apart north to south.
+type Heightmap struct {
+	Size    int
+	Heights []float64
+	// West and South are the map position of the south west sample.
+	West, South float64
+	// Width and Length are the distances in map units from the west
+	// samples to the east ones and from the south samples to the north
+	// ones.
+	Width, Length float64
+	// Min and Max are the lowest and highest heights.
+	Min, Max float64
+}
+
+// FitSize returns the smallest heightmap size, a power of two plus one,
+// with at least n samples along each side, kept within MinSize and MaxSize.
+func FitSize(n int) int {
+	size := MinSize
+	for size < n && size < MaxSize {
+		size = 2*size - 1
+	}
+	return size
+}
+
+// ValidSize returns an error unless size is a power of two plus one from
+// MinSize to MaxSize.
+func ValidSize(size int) error {
+	if size < MinSize || size > MaxSize || (size-1)&(size-2) != 0 {
+		return fmt.Errorf("heightmap size %d is not a power of two plus one from %d to %d", size, MinSize, MaxSize)
+	}
+	return nil
+}
+
+// FromGrid is a factory method that samples the Grid g to make a Heightmap
+// of size by size, interpolating bilinearly between the cells.  Samples
+// that fall on cells holding the No Data value are set to the lowest
+// height.
+func FromGrid(g *esri.Grid, size int) (*Heightmap, error) {
+	err := ValidSize(size)
+	if err != nil {
+		return nil, err
+	}
+	if g.Ncols() < 2 || g.Nrows() < 2 {
+		return nil, fmt.Errorf("the grid has %d columns and %d rows - a heightmap needs at least 2 of each", g.Ncols(), g.Nrows())
+	}
+	cellSize := float64(g.CellSize())
+	minX, minY, _, _ := g.Bounds()
+	h := &Heightmap{
+		Size:    size,
+		Heights: make([]float64, size*size),
+		West:    minX + cellSize/2,
+		South:   minY + cellSize/2,
+		Width:   float64(g.Ncols()-1) * cellSize,
+		Length:  float64(g.Nrows()-1) * cellSize,
+		Min:     math.Inf(1),
+		Max:     math.Inf(-1),
+	}
+	found := make([]bool, size*size)
+	for row := 0; row < size; row++ {
+		y := h.South + h.Length*float64(size-1-row)/float64(size-1)
+		for col := 0; col < size; col++ {
+			x := h.West + h.Width*float64(col)/float64(size-1)
+			height, ok := g.InterpolatedHeightAt(x, y)
+			if !ok {
+				continue
+			}
+			i := row*size + col
+			h.Heights[i], found[i] = float64(height), true
+			h.Min = math.Min(h.Min, h.Heights[i])
+			h.Max = math.Max(h.Max, h.Heights[i])
+		}
+	}
+	if math.IsInf(h.Min, 1) {
+		return nil, fmt.Errorf("the grid has no data")
+	}
+	for i := range h.Heights {
+		if !found[i] {
+			h.Heights[i] = h.Min
+		}
+	}
+	return h, nil
+}
+
+// Scaled returns the heights as whole numbers from 0 for Min to 65535 for
+// Max.  If the heightmap is flat, they are all 0.
+func (h *Heightmap) Scaled() []uint16 {
+	scaled := make([]uint16, len(h.Heights))
+	if h.Max <= h.Min {
+		return scaled
+	}
+	for i, height := range h.Heights {
+		scaled[i] = uint16(math.Round((height - h.Min) * math.MaxUint16 / (h.Max - h.Min)))
+	}
+	return scaled
+}
@@ -0,0 +1,120 @@
+package heightmap
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/goblimey/tiler/esri"
+	"github.com/goblimey/tiler/tile"
+)
+
+// The ways that pictures can hold heights.
+const (
+	// Grey is shades of grey, 8 or 16 bit, from black for the lowest
+	// height to white for the highest.
+	Grey = "grey"
+	// TerrainRGB is the Mapbox Terrain-RGB encoding - see tile.DecodeMapbox.
+	TerrainRGB = "terrain-rgb"
+	// Terrarium is the Terrarium encoding - see tile.DecodeTerrarium.
+	Terrarium = "terrarium"
+)
+
+// Encodings lists the ways that pictures can hold heights.
+var Encodings = []string{Grey, TerrainRGB, Terrarium}
+
+// ImageOptions say how FromImage finds the heights and positions of the
+// pixels of a picture.
+type ImageOptions struct {
+	// Encoding is one of the Encodings.
+	Encoding string
+	// MinHeight and MaxHeight are the heights of black and white in a
+	// Grey picture.
+	MinHeight, MaxHeight float64
+	// West, South, East and North are the map positions of the edges of
+	// the picture.  The pixels must be square.
+	West, South, East, North float64
+}
+
+// ReadImageFromFile is a factory method that reads a Grid from the PNG
+// file filename - see FromImage.
+func ReadImageFromFile(filename string, options ImageOptions) (*esri.Grid, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	g, err := FromImage(img, options)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return g, nil
+}
+
+// FromImage is a factory method that makes a Grid from a picture of
+// heights, such as a heightmap for a game or a downloaded terrain tile,
+// with a cell for each pixel.  Transparent pixels hold the No Data value.
+func FromImage(img image.Image, options ImageOptions) (*esri.Grid, error) {
+	var decode func(c color.Color) float64
+	switch strings.ToLower(options.Encoding) {
+	case Grey:
+		if options.MaxHeight <= options.MinHeight {
+			return nil, fmt.Errorf("the highest height %g is not above the lowest %g", options.MaxHeight, options.MinHeight)
+		}
+		scale := (options.MaxHeight - options.MinHeight) / math.MaxUint16
+		decode = func(c color.Color) float64 {
+			return options.MinHeight + float64(color.Gray16Model.Convert(c).(color.Gray16).Y)*scale
+		}
+	case TerrainRGB:
+		decode = func(c color.Color) float64 {
+			return tile.DecodeMapbox(color.RGBAModel.Convert(c).(color.RGBA))
+		}
+	case Terrarium:
+		decode = func(c color.Color) float64 {
+			return tile.DecodeTerrarium(color.RGBAModel.Convert(c).(color.RGBA))
+		}
+	default:
+		return nil, fmt.Errorf("unknown height encoding %q - expected %s", options.Encoding, strings.Join(Encodings, ", "))
+	}
+
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+	if err := esri.CheckSize(width, height); err != nil {
+		return nil, err
+	}
+	cellSize := (options.East - options.West) / float64(width)
+	cellHeight := (options.North - options.South) / float64(height)
+	if cellSize <= 0 || cellHeight <= 0 {
+		return nil, fmt.Errorf("the bounds %g,%g,%g,%g are not west, south, east and north",
+			options.West, options.South, options.East, options.North)
+	}
+	if math.Abs(cellSize-cellHeight) > cellSize/1000 {
+		return nil, fmt.Errorf("the pixels of the %d by %d picture are %g by %g map units - they must be square",
+			width, height, cellSize, cellHeight)
+	}
+
+	g := esri.NewGrid(width, height)
+	g.SetXllcorner(float32(options.West))
+	g.SetYllcorner(float32(options.South))
+	g.SetCellSize(float32(cellSize))
+	g.SetNoDataValue(esri.DefaultNoData)
+	for row := 0; row < height; row++ {
+		for col := 0; col < width; col++ {
+			c := img.At(b.Min.X+col, b.Min.Y+row)
+			if _, _, _, a := c.RGBA(); a == 0 {
+				g.SetHeight(row, col, esri.DefaultNoData)
+				continue
+			}
+			g.SetHeight(row, col, float32(decode(c)))
+		}
+	}
+	return g, nil
+}
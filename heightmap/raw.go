@@ -0,0 +1,121 @@
+package heightmap
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/goblimey/tiler/internal/safefile"
+)
+
+// Info describes a RAW heightmap - its size and the heights and distances
+// that its samples stand for, with the settings that Unity and Unreal
+// Engine need to import it at its true scale.  The distances are in map
+// units, which the engine settings take to be metres.
+type Info struct {
+	Width     int    `json:"width"`
+	Height    int    `json:"height"`
+	BitDepth  int    `json:"bitDepth"`
+	ByteOrder string `json:"byteOrder"`
+	RowOrder  string `json:"rowOrder"`
+	// MinHeight and MaxHeight are the heights of samples 0 and 65535.
+	MinHeight float64 `json:"minHeight"`
+	MaxHeight float64 `json:"maxHeight"`
+	// West, South, East and North are the map positions of the outer
+	// samples.
+	West  float64 `json:"west"`
+	South float64 `json:"south"`
+	East  float64 `json:"east"`
+	North float64 `json:"north"`
+	// Spacing is the distance between samples, east to west and north to
+	// south.
+	Spacing [2]float64 `json:"spacing"`
+	Unity   Unity      `json:"unity"`
+	Unreal  Unreal     `json:"unreal"`
+}
+
+// Unity holds the terrain settings that give a Unity terrain made from the
+// heightmap its true size, in metres.  The terrain should sit at the
+// height MinHeight.
+type Unity struct {
+	TerrainWidth  float64 `json:"terrainWidth"`
+	TerrainLength float64 `json:"terrainLength"`
+	TerrainHeight float64 `json:"terrainHeight"`
+}
+
+// Unreal holds the landscape scale, in centimetres per sample for X and Y,
+// and the Z location that give an Unreal Engine landscape made from the
+// heightmap its true size.  Unreal maps the samples to ±256 times the Z
+// scale, centred on the Z location.
+type Unreal struct {
+	ScaleX    float64 `json:"scaleX"`
+	ScaleY    float64 `json:"scaleY"`
+	ScaleZ    float64 `json:"scaleZ"`
+	LocationZ float64 `json:"locationZ"`
+}
+
+// Info returns the description of the Heightmap written as RAW.
+func (h *Heightmap) Info() Info {
+	spacingX := h.Width / float64(h.Size-1)
+	spacingY := h.Length / float64(h.Size-1)
+	heightRange := h.Max - h.Min
+	return Info{
+		Width:     h.Size,
+		Height:    h.Size,
+		BitDepth:  16,
+		ByteOrder: "little-endian",
+		RowOrder:  "north to south",
+		MinHeight: h.Min,
+		MaxHeight: h.Max,
+		West:      h.West,
+		South:     h.South,
+		East:      h.West + h.Width,
+		North:     h.South + h.Length,
+		Spacing:   [2]float64{spacingX, spacingY},
+		Unity:     Unity{h.Width, h.Length, heightRange},
+		Unreal: Unreal{
+			ScaleX:    spacingX * 100,
+			ScaleY:    spacingY * 100,
+			ScaleZ:    heightRange * 100 / 512,
+			LocationZ: (h.Min + heightRange/2) * 100,
+		},
+	}
+}
+
+// Write writes the Info as indented JSON.
+func (i Info) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(i)
+}
+
+// WriteRAWToFiles writes the Heightmap to the RAW file filename and its
+// Info to a JSON file with the same name ending ".json".
+func (h *Heightmap) WriteRAWToFiles(filename string) error {
+	err := safefile.Write(filename, h.WriteRAW)
+	if err != nil {
+		return err
+	}
+	return safefile.Write(InfoName(filename), h.Info().Write)
+}
+
+// InfoName returns the name of the JSON file that describes the RAW file
+// filename.
+func InfoName(filename string) string {
+	return strings.TrimSuffix(filename, filepath.Ext(filename)) + ".json"
+}
+
+// WriteRAW writes the heights of the Heightmap as RAW, the format that
+// Unity and Unreal Engine import - Scaled 16 bit little-endian whole
+// numbers, row by row from the north west corner, with no header.
+func (h *Heightmap) WriteRAW(w io.Writer) error {
+	out := bufio.NewWriter(w)
+	err := binary.Write(out, binary.LittleEndian, h.Scaled())
+	if err != nil {
+		return err
+	}
+	return out.Flush()
+}
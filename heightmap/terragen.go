@@ -0,0 +1,112 @@
+package heightmap
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/goblimey/tiler/esri"
+	"github.com/goblimey/tiler/internal/safefile"
+)
+
+// terragenMagic starts a Terragen terrain file.
+const terragenMagic = "TERRAGENTERRAIN "
+
+// WriteTerragenToFile writes the Grid g to a Terragen terrain (.ter) file -
+// see WriteTerragen.
+func WriteTerragenToFile(filename string, g *esri.Grid) error {
+	return safefile.Write(filename, func(w io.Writer) error {
+		return WriteTerragen(w, g)
+	})
+}
+
+// WriteTerragen writes the Grid g as a Terragen terrain, the format that
+// the Terragen landscape renderer reads, with a point for each cell.  The
+// points are g.CellSize() apart, taken to be metres, and the heights are
+// stored to within a few thousandths of the range between the lowest and
+// the highest.  Cells holding the No Data value are set to the lowest
+// height.
+func WriteTerragen(w io.Writer, g *esri.Grid) error {
+	ncols, nrows := g.Ncols(), g.Nrows()
+	if ncols < 2 || nrows < 2 || ncols > math.MaxInt16 || nrows > math.MaxInt16 {
+		return fmt.Errorf("the grid has %d columns and %d rows - a Terragen terrain has from 2 to %d of each",
+			ncols, nrows, math.MaxInt16)
+	}
+	lowest, highest, found := 0.0, 0.0, false
+	for row := 0; row < nrows; row++ {
+		for col := 0; col < ncols; col++ {
+			if g.IsNoData(row, col) {
+				continue
+			}
+			h := float64(g.Height(row, col))
+			if !found {
+				lowest, highest, found = h, h, true
+			}
+			lowest, highest = math.Min(lowest, h), math.Max(highest, h)
+		}
+	}
+	if !found {
+		return fmt.Errorf("the grid has no data")
+	}
+
+	// A height is base + elevation * scale / 65536 metres, with base and
+	// scale 16 bit numbers chosen to fit the range of heights and each
+	// elevation from -32768 to 32767.
+	base := math.Round((lowest + highest) / 2)
+	if base < math.MinInt16 || base > math.MaxInt16 {
+		return fmt.Errorf("the heights, from %g to %g, are too far from sea level for a Terragen terrain", lowest, highest)
+	}
+	reach := math.Max(highest-base, base-lowest)
+	scale := math.Max(1, math.Ceil(reach*65536/math.MaxInt16))
+	if scale > math.MaxInt16 {
+		return fmt.Errorf("the heights, from %g to %g, are too far apart for a Terragen terrain", lowest, highest)
+	}
+
+	out := bufio.NewWriter(w)
+	put := func(v interface{}) {
+		binary.Write(out, binary.LittleEndian, v)
+	}
+	out.WriteString(terragenMagic)
+	size := ncols
+	if nrows < size {
+		size = nrows
+	}
+	out.WriteString("SIZE")
+	put([]int16{int16(size - 1), 0})
+	if ncols != nrows {
+		out.WriteString("XPTS")
+		put([]int16{int16(ncols), 0})
+		out.WriteString("YPTS")
+		put([]int16{int16(nrows), 0})
+	}
+	cellSize := g.CellSize()
+	out.WriteString("SCAL")
+	put([]float32{cellSize, cellSize, 1})
+	out.WriteString("ALTW")
+	put([]int16{int16(scale), int16(base)})
+
+	// The rows run from south to north.
+	elevations := make([]int16, ncols)
+	for row := nrows - 1; row >= 0; row-- {
+		for col := range elevations {
+			h := lowest
+			if !g.IsNoData(row, col) {
+				h = float64(g.Height(row, col))
+			}
+			e := math.Round((h - base) * 65536 / scale)
+			elevations[col] = int16(math.Max(math.MinInt16, math.Min(math.MaxInt16, e)))
+		}
+		put(elevations)
+	}
+	// The chunks are aligned to 4 bytes.
+	if ncols*nrows%2 != 0 {
+		put(int16(0))
+	}
+	_, err := out.WriteString("EOF ")
+	if err != nil {
+		return err
+	}
+	return out.Flush()
+}
@@ -0,0 +1,117 @@
+package hydro
+
+import (
+	"container/heap"
+	"math"
+
+	"github.com/goblimey/tiler/esri"
+)
+
+// Fill returns a copy of g with its depressions filled, so that water can
+// flow from every cell to the edge of the Grid or to a cell holding the No
+// Data value.  It uses the priority-flood method, working inwards from the
+// edges in order of height and raising each cell that is lower than the
+// cell it was reached from.  If slope is true, filled areas and flats are
+// given the smallest possible slope towards their outlet instead of being
+// left level, so that FlowDirection finds a way out of them.
+func Fill(g *esri.Grid, slope bool) *esri.Grid {
+	nrows, ncols := g.Nrows(), g.Ncols()
+	result := esri.NewGrid(ncols, nrows)
+	result.SetXllcorner(g.Xllcorner())
+	result.SetYllcorner(g.Yllcorner())
+	result.SetCellSize(g.CellSize())
+	result.SetNoDataValue(g.NoDataValue())
+
+	heights := make([][]float32, nrows)
+	done := make([][]bool, nrows)
+	for row := 0; row < nrows; row++ {
+		heights[row] = make([]float32, ncols)
+		done[row] = make([]bool, ncols)
+		for col := 0; col < ncols; col++ {
+			heights[row][col] = g.Height(row, col)
+			done[row][col] = g.IsNoData(row, col)
+		}
+	}
+
+	// Start from the cells that water can leave the Grid from.
+	q := new(cellQueue)
+	for row := 0; row < nrows; row++ {
+		for col := 0; col < ncols; col++ {
+			if done[row][col] {
+				continue
+			}
+			for _, n := range neighbours {
+				r, c := row+n.dRow, col+n.dCol
+				if r < 0 || r >= nrows || c < 0 || c >= ncols || g.IsNoData(r, c) {
+					done[row][col] = true
+					heap.Push(q, cell{heights[row][col], q.next(), row, col})
+					break
+				}
+			}
+		}
+	}
+
+	for q.Len() > 0 {
+		from := heap.Pop(q).(cell)
+		lowest := from.height
+		if slope {
+			lowest = math.Nextafter32(lowest, float32(math.Inf(1)))
+		}
+		for _, n := range neighbours {
+			r, c := from.row+n.dRow, from.col+n.dCol
+			if r < 0 || r >= nrows || c < 0 || c >= ncols || done[r][c] {
+				continue
+			}
+			done[r][c] = true
+			if heights[r][c] < lowest {
+				heights[r][c] = lowest
+			}
+			heap.Push(q, cell{heights[r][c], q.next(), r, c})
+		}
+	}
+
+	for row := 0; row < nrows; row++ {
+		for col := 0; col < ncols; col++ {
+			result.SetHeight(row, col, heights[row][col])
+		}
+	}
+	return result
+}
+
+// cell is a cell waiting to be visited by Fill.  order breaks ties between
+// cells of the same height, first come first served.
+type cell struct {
+	height   float32
+	order    int
+	row, col int
+}
+
+// cellQueue is a priority queue of cells, lowest first.
+type cellQueue struct {
+	cells []cell
+	count int
+}
+
+func (q *cellQueue) next() int {
+	q.count++
+	return q.count
+}
+
+func (q cellQueue) Len() int { return len(q.cells) }
+
+func (q cellQueue) Less(i, j int) bool {
+	if q.cells[i].height != q.cells[j].height {
+		return q.cells[i].height < q.cells[j].height
+	}
+	return q.cells[i].order < q.cells[j].order
+}
+
+func (q cellQueue) Swap(i, j int) { q.cells[i], q.cells[j] = q.cells[j], q.cells[i] }
+
+func (q *cellQueue) Push(x interface{}) { q.cells = append(q.cells, x.(cell)) }
+
+func (q *cellQueue) Pop() interface{} {
+	last := q.cells[len(q.cells)-1]
+	q.cells = q.cells[:len(q.cells)-1]
+	return last
+}
@@ -0,0 +1,167 @@
+// Package hydro derives hydrological grids, such as the direction water
+// flows across the ground, from a Grid of heights.
+package hydro
+
+import (
+	"math"
+
+	"github.com/goblimey/tiler/esri"
+)
+
+// The D8 flow directions, coded as in ESRI's ArcGIS - each cell drains to
+// the neighbour in one of eight directions.  NoFlow marks a cell with no
+// lower neighbour, such as a pit or a flat.
+const (
+	NoFlow    = 0
+	East      = 1
+	SouthEast = 2
+	South     = 4
+	SouthWest = 8
+	West      = 16
+	NorthWest = 32
+	North     = 64
+	NorthEast = 128
+)
+
+// neighbours gives the row and column offsets of each flow direction.
+var neighbours = []struct {
+	direction  int
+	dRow, dCol int
+}{
+	{East, 0, 1}, {SouthEast, 1, 1}, {South, 1, 0}, {SouthWest, 1, -1},
+	{West, 0, -1}, {NorthWest, -1, -1}, {North, -1, 0}, {NorthEast, -1, 1},
+}
+
+// FlowDirection returns a Grid covering the same area as g that gives the
+// D8 flow direction of each cell - the direction of the neighbour with the
+// steepest drop, allowing for the greater distance to the diagonal
+// neighbours.  Water is not sent to cells holding the No Data value or off
+// the edge of the Grid.  Cells holding the No Data value are No Data in the
+// result.
+func FlowDirection(g *esri.Grid) *esri.Grid {
+	result := like(g)
+	for row := 0; row < g.Nrows(); row++ {
+		for col := 0; col < g.Ncols(); col++ {
+			if g.IsNoData(row, col) {
+				result.SetHeight(row, col, float32(result.NoDataValue()))
+				continue
+			}
+			result.SetHeight(row, col, float32(direction(g, row, col)))
+		}
+	}
+	return result
+}
+
+// direction returns the D8 flow direction of cell (row, col).
+func direction(g *esri.Grid, row, col int) int {
+	h := float64(g.Height(row, col))
+	best, steepest := NoFlow, 0.0
+	for _, n := range neighbours {
+		r, c := row+n.dRow, col+n.dCol
+		if r < 0 || r >= g.Nrows() || c < 0 || c >= g.Ncols() || g.IsNoData(r, c) {
+			continue
+		}
+		drop := h - float64(g.Height(r, c))
+		if n.dRow != 0 && n.dCol != 0 {
+			drop /= math.Sqrt2
+		}
+		if drop > steepest {
+			best, steepest = n.direction, drop
+		}
+	}
+	return best
+}
+
+// FlowAccumulation returns a Grid covering the same area as directions, a
+// Grid made by FlowDirection, that gives the number of cells upstream of
+// each cell - the cells whose water flows through it.  Multiplied by the
+// area of a cell, that's the area draining into the cell.  Cells holding the
+// No Data value are No Data in the result.
+func FlowAccumulation(directions *esri.Grid) *esri.Grid {
+	nrows, ncols := directions.Nrows(), directions.Ncols()
+	// downstream returns the cell that (row, col) drains into.  ok is false
+	// if it doesn't drain anywhere.
+	downstream := func(row, col int) (r, c int, ok bool) {
+		if directions.IsNoData(row, col) {
+			return 0, 0, false
+		}
+		d := int(directions.Height(row, col))
+		for _, n := range neighbours {
+			if n.direction == d {
+				r, c = row+n.dRow, col+n.dCol
+				if r < 0 || r >= nrows || c < 0 || c >= ncols || directions.IsNoData(r, c) {
+					return 0, 0, false
+				}
+				return r, c, true
+			}
+		}
+		return 0, 0, false
+	}
+
+	// Work downstream from the cells that nothing drains into, so that each
+	// cell's total is complete before it's passed on.
+	inflows := make([][]int, nrows)
+	for row := range inflows {
+		inflows[row] = make([]int, ncols)
+	}
+	for row := 0; row < nrows; row++ {
+		for col := 0; col < ncols; col++ {
+			if r, c, ok := downstream(row, col); ok {
+				inflows[r][c]++
+			}
+		}
+	}
+	counts := make([][]float32, nrows)
+	for row := range counts {
+		counts[row] = make([]float32, ncols)
+	}
+	var queue [][2]int
+	for row := 0; row < nrows; row++ {
+		for col := 0; col < ncols; col++ {
+			if !directions.IsNoData(row, col) && inflows[row][col] == 0 {
+				queue = append(queue, [2]int{row, col})
+			}
+		}
+	}
+	for len(queue) > 0 {
+		row, col := queue[0][0], queue[0][1]
+		queue = queue[1:]
+		r, c, ok := downstream(row, col)
+		if !ok {
+			continue
+		}
+		counts[r][c] += counts[row][col] + 1
+		inflows[r][c]--
+		if inflows[r][c] == 0 {
+			queue = append(queue, [2]int{r, c})
+		}
+	}
+
+	result := like(directions)
+	for row := 0; row < nrows; row++ {
+		for col := 0; col < ncols; col++ {
+			if directions.IsNoData(row, col) {
+				result.SetHeight(row, col, float32(result.NoDataValue()))
+				continue
+			}
+			result.SetHeight(row, col, counts[row][col])
+		}
+	}
+	return result
+}
+
+// like returns an empty Grid covering the same area as g.  Its No Data value
+// is g's if that's negative, otherwise -9999, so that it can't be confused
+// with a flow direction or a count.
+func like(g *esri.Grid) *esri.Grid {
+	result := esri.NewGrid(g.Ncols(), g.Nrows())
+	result.SetXllcorner(g.Xllcorner())
+	result.SetYllcorner(g.Yllcorner())
+	result.SetCellSize(g.CellSize())
+	noData := g.NoDataValue()
+	if noData >= 0 {
+		noData = -9999
+	}
+	result.SetNoDataValue(noData)
+	return result
+}
@@ -0,0 +1,55 @@
+// Package safefile writes files so that they are either whole or absent.
+// The contents go to a temporary file in the same folder, which replaces
+// the file only once it is complete, so a failure or an interruption
+// never leaves half a file, nor spoils one that was there before.
+package safefile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Write creates or replaces filename, calling write to fill it.
+func Write(filename string, write func(w io.Writer) error) error {
+	return WriteContext(context.Background(), filename, write)
+}
+
+// WriteContext is like Write, but leaves filename as it was if ctx is
+// cancelled before the file is finished.
+func WriteContext(ctx context.Context, filename string, write func(w io.Writer) error) error {
+	temp, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		// Report the file asked for, not the temporary one.
+		var pathErr *os.PathError
+		if errors.As(err, &pathErr) {
+			pathErr.Path = filename
+		}
+		return err
+	}
+	// CreateTemp makes files only the owner can read.
+	err = temp.Chmod(0644)
+	if err == nil {
+		err = write(temp)
+		if err != nil {
+			err = fmt.Errorf("%s: %w", filename, err)
+		}
+	}
+	closeErr := temp.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), filename)
+	}
+	if err != nil {
+		os.Remove(temp.Name())
+	}
+	return err
+}
@@ -0,0 +1,177 @@
+// Package lidar downloads the Environment Agency's national lidar
+// programme height models of England, which the Defra Survey Data Download
+// service publishes as open data, and unpacks them ready to read as a
+// mosaic.  The service offers each product as zip files of 5 km squares of
+// the National Grid, named like TQ15se - the south east quarter of the
+// 10 km square TQ15 - each holding grid files of the 1 km squares inside.
+package lidar
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/goblimey/tiler/crs"
+)
+
+// TileSize is the length of the side of a tile in metres.
+const TileSize = 5000
+
+// DefaultURL is the address of a tile's zip file of the 2022 1 m composite
+// DTM in the Defra Survey Data Download service, with {tile} where the
+// tile name goes - see URL.
+const DefaultURL = "https://api.agrimetrics.co.uk/tiles/collections/survey/lidar_composite_dtm/2022/1/{tile}?subscription-key=public"
+
+// ErrNoTile is returned by Download when the service has no tile of that
+// name - usually because the square is sea or hasn't been surveyed.
+var ErrNoTile = errors.New("no tile")
+
+// Tiles returns the names of the 5 km tiles that cover the area (minE,
+// minN) to (maxE, maxN), given as National Grid eastings and northings,
+// from the south west.
+func Tiles(minE, minN, maxE, maxN float64) ([]string, error) {
+	if minE >= maxE || minN >= maxN {
+		return nil, fmt.Errorf("empty area %g,%g,%g,%g", minE, minN, maxE, maxN)
+	}
+	var names []string
+	for n := math.Floor(minN/TileSize) * TileSize; n < maxN; n += TileSize {
+		for e := math.Floor(minE/TileSize) * TileSize; e < maxE; e += TileSize {
+			name, err := TileName(e, n)
+			if err != nil {
+				return nil, err
+			}
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// TileName returns the name of the 5 km tile holding the National Grid
+// position (e, n), such as TQ15se.
+func TileName(e, n float64) (string, error) {
+	ref, err := crs.GridReference(e, n, 1)
+	if err != nil {
+		return "", err
+	}
+	quarter := []byte("sw")
+	if math.Mod(n, 10000) >= TileSize {
+		quarter[0] = 'n'
+	}
+	if math.Mod(e, 10000) >= TileSize {
+		quarter[1] = 'e'
+	}
+	return ref + string(quarter), nil
+}
+
+// URL returns the address of the tile name, made from template by
+// replacing {tile} with the name.
+func URL(template, name string) string {
+	return strings.ReplaceAll(template, "{tile}", name)
+}
+
+// Download fetches the zip file at url into the folder dir, as name.zip,
+// unless it's there already, and returns its name.  It returns an error
+// wrapping ErrNoTile if the service has no such file.  The file is written
+// under another name and renamed once it's complete, so that an
+// interrupted download isn't taken for a whole one.
+func Download(ctx context.Context, client *http.Client, url, dir, name string) (string, error) {
+	filename := filepath.Join(dir, name+".zip")
+	if _, err := os.Stat(filename); err == nil {
+		slog.Debug("already downloaded", "file", filename)
+		return filename, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", "tiler")
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return "", fmt.Errorf("%s: %w", url, ErrNoTile)
+	case resp.StatusCode != http.StatusOK:
+		return "", fmt.Errorf("%s: %s", url, resp.Status)
+	}
+
+	partial := filename + ".part"
+	out, err := os.Create(partial)
+	if err != nil {
+		return "", err
+	}
+	size, err := io.Copy(out, resp.Body)
+	if err == nil {
+		err = out.Close()
+	} else {
+		out.Close()
+	}
+	if err != nil {
+		os.Remove(partial)
+		return "", fmt.Errorf("%s: %w", url, err)
+	}
+	slog.Info("downloaded", "tile", name, "bytes", size)
+	return filename, os.Rename(partial, filename)
+}
+
+// gridExtensions are the ends of the names of the grid files in the zip
+// files.
+var gridExtensions = map[string]bool{".asc": true, ".tif": true, ".tiff": true}
+
+// Unpack copies the grid files in the zip file filename into the folder
+// dir, unless they're there already, and returns their names.  The
+// folders within the zip file are ignored.
+func Unpack(filename, dir string) ([]string, error) {
+	z, err := zip.OpenReader(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer z.Close()
+	var names []string
+	for _, f := range z.File {
+		base := filepath.Base(filepath.FromSlash(f.Name))
+		if f.FileInfo().IsDir() || !gridExtensions[strings.ToLower(filepath.Ext(base))] {
+			continue
+		}
+		name := filepath.Join(dir, base)
+		names = append(names, name)
+		if info, err := os.Stat(name); err == nil && info.Size() == int64(f.UncompressedSize64) {
+			continue
+		}
+		err := unpackFile(f, name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filename, err)
+		}
+	}
+	return names, nil
+}
+
+// unpackFile copies the file f from a zip file to filename.
+func unpackFile(f *zip.File, filename string) error {
+	in, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if err != nil {
+		out.Close()
+		os.Remove(filename)
+		return err
+	}
+	return out.Close()
+}
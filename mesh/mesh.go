@@ -0,0 +1,172 @@
+// Package mesh turns a Grid into a solid of triangles - the ground on top,
+// walls down each side and a flat base - and writes it in the file formats
+// that 3D printers and modelling programs read.
+package mesh
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/goblimey/tiler/esri"
+)
+
+// Options control how FromGrid builds a Mesh.
+type Options struct {
+	// Base is the thickness of the solid below the lowest height, in map
+	// units.  With none, the solid has no thickness at its lowest points,
+	// which a 3D printer can't make.
+	Base float64
+	// Exaggeration multiplies the heights, or 0 to leave them as they are.
+	Exaggeration float64
+}
+
+// Vertex is a corner of a triangle.
+type Vertex struct {
+	X, Y, Z float64
+}
+
+// TexCoord is the place in a picture draped over a Mesh that is pinned to a
+// vertex, from 0 to 1 across the picture and from 0 at the bottom to 1 at
+// the top.
+type TexCoord struct {
+	U, V float64
+}
+
+// Mesh is a solid made of triangles.  Each triangle is three indexes into
+// Vertices, in counter-clockwise order seen from outside the solid.
+// TexCoords, if there are any, has the place in the picture for each
+// vertex, and Heights the height of the ground that each vertex stands
+// for.
+type Mesh struct {
+	Vertices  []Vertex
+	TexCoords []TexCoord
+	Heights   []float64
+	Triangles [][3]int
+}
+
+// FromGrid is a factory method that builds a watertight Mesh from the Grid
+// g, with a vertex at the centre of each cell.  The coordinates are in map
+// units from the centre of the south west cell, with the base at Z = 0, so
+// that a 3D printer needs only a scale.  Cells holding the No Data value
+// are set to the lowest height.  The TexCoords fit a picture of the Grid
+// with one pixel per cell, such as render.HeightImage draws, pinning each
+// vertex to the centre of its cell's pixel; the walls take the colours of
+// the cells along the edge.  The Heights are those of the cells, and on the
+// base the lowest height less the thickness of the base.
+func FromGrid(g *esri.Grid, options Options) (*Mesh, error) {
+	ncols, nrows := g.Ncols(), g.Nrows()
+	if ncols < 2 || nrows < 2 {
+		return nil, fmt.Errorf("the grid has %d columns and %d rows - a mesh needs at least 2 of each", ncols, nrows)
+	}
+	if options.Base < 0 {
+		return nil, fmt.Errorf("base thickness %g is less than 0", options.Base)
+	}
+	exaggeration := options.Exaggeration
+	if exaggeration == 0 {
+		exaggeration = 1
+	}
+	if exaggeration < 0 {
+		return nil, fmt.Errorf("exaggeration %g is less than 0", exaggeration)
+	}
+	lowest, found := 0.0, false
+	for row := 0; row < nrows; row++ {
+		for col := 0; col < ncols; col++ {
+			if g.IsNoData(row, col) {
+				continue
+			}
+			if h := float64(g.Height(row, col)); !found || h < lowest {
+				lowest, found = h, true
+			}
+		}
+	}
+	cellSize := float64(g.CellSize())
+
+	m := &Mesh{
+		Vertices:  make([]Vertex, 0, ncols*nrows+2*(ncols+nrows)),
+		TexCoords: make([]TexCoord, 0, ncols*nrows+2*(ncols+nrows)),
+		Heights:   make([]float64, 0, ncols*nrows+2*(ncols+nrows)),
+		Triangles: make([][3]int, 0, 2*(ncols-1)*(nrows-1)+8*(ncols+nrows)),
+	}
+
+	// The top, from the heights.  The vertex of cell (row, col) is
+	// row*ncols + col.
+	for row := 0; row < nrows; row++ {
+		y := float64(nrows-1-row) * cellSize
+		v := 1 - (float64(row)+0.5)/float64(nrows)
+		for col := 0; col < ncols; col++ {
+			m.TexCoords = append(m.TexCoords, TexCoord{(float64(col) + 0.5) / float64(ncols), v})
+			h := lowest
+			if !g.IsNoData(row, col) {
+				h = float64(g.Height(row, col))
+			}
+			z := options.Base + (h-lowest)*exaggeration
+			m.Vertices = append(m.Vertices, Vertex{float64(col) * cellSize, y, z})
+			m.Heights = append(m.Heights, h)
+		}
+	}
+	for row := 0; row < nrows-1; row++ {
+		for col := 0; col < ncols-1; col++ {
+			nw := row*ncols + col
+			ne, sw, se := nw+1, nw+ncols, nw+ncols+1
+			m.Triangles = append(m.Triangles, [3]int{sw, se, ne}, [3]int{sw, ne, nw})
+		}
+	}
+
+	// The cells around the edge, counter-clockwise seen from above - east
+	// along the south edge, north up the east edge, west along the north
+	// edge and south down the west edge.
+	var edge []int
+	for col := 0; col < ncols-1; col++ {
+		edge = append(edge, (nrows-1)*ncols+col)
+	}
+	for row := nrows - 1; row > 0; row-- {
+		edge = append(edge, row*ncols+ncols-1)
+	}
+	for col := ncols - 1; col > 0; col-- {
+		edge = append(edge, col)
+	}
+	for row := 0; row < nrows-1; row++ {
+		edge = append(edge, row*ncols)
+	}
+
+	// The walls, each from a vertex of the top down to one on the base.
+	baseHeight := lowest - options.Base/exaggeration
+	bottom := make([]int, len(edge))
+	for i, v := range edge {
+		bottom[i] = len(m.Vertices)
+		m.Vertices = append(m.Vertices, Vertex{m.Vertices[v].X, m.Vertices[v].Y, 0})
+		m.TexCoords = append(m.TexCoords, m.TexCoords[v])
+		m.Heights = append(m.Heights, baseHeight)
+	}
+	for i := range edge {
+		j := (i + 1) % len(edge)
+		a, b, a0, b0 := edge[i], edge[j], bottom[i], bottom[j]
+		m.Triangles = append(m.Triangles, [3]int{a0, b0, b}, [3]int{a0, b, a})
+	}
+
+	// The base, fanned out from its centre so that it shares every edge
+	// with the walls.
+	centre := len(m.Vertices)
+	m.Vertices = append(m.Vertices, Vertex{float64(ncols-1) * cellSize / 2, float64(nrows-1) * cellSize / 2, 0})
+	m.TexCoords = append(m.TexCoords, TexCoord{0.5, 0.5})
+	m.Heights = append(m.Heights, baseHeight)
+	for i := range bottom {
+		j := (i + 1) % len(bottom)
+		m.Triangles = append(m.Triangles, [3]int{centre, bottom[j], bottom[i]})
+	}
+	return m, nil
+}
+
+// Normal returns the unit vector at right angles to triangle t, pointing
+// out of the solid.
+func (m *Mesh) Normal(t [3]int) Vertex {
+	a, b, c := m.Vertices[t[0]], m.Vertices[t[1]], m.Vertices[t[2]]
+	ux, uy, uz := b.X-a.X, b.Y-a.Y, b.Z-a.Z
+	vx, vy, vz := c.X-a.X, c.Y-a.Y, c.Z-a.Z
+	n := Vertex{uy*vz - uz*vy, uz*vx - ux*vz, ux*vy - uy*vx}
+	length := math.Sqrt(n.X*n.X + n.Y*n.Y + n.Z*n.Z)
+	if length == 0 {
+		return Vertex{}
+	}
+	return Vertex{n.X / length, n.Y / length, n.Z / length}
+}
@@ -0,0 +1,96 @@
+package mesh
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/goblimey/tiler/internal/safefile"
+)
+
+// objMaterial is the name of the one material in the MTL files written by
+// WriteMTL.
+const objMaterial = "terrain"
+
+// WriteOBJToFiles writes the Mesh to the Wavefront OBJ file filename, and
+// if texture isn't "" the material file that drapes the picture texture
+// over it, named like filename with .mtl in place of its extension.
+// texture is written into the material file as it's given, so it should be
+// relative to the folder holding filename.
+func (m *Mesh) WriteOBJToFiles(filename, texture string) error {
+	var mtl string
+	if texture != "" {
+		mtlFile := strings.TrimSuffix(filename, filepath.Ext(filename)) + ".mtl"
+		err := safefile.Write(mtlFile, func(w io.Writer) error {
+			return WriteMTL(w, texture)
+		})
+		if err != nil {
+			return err
+		}
+		mtl = filepath.Base(mtlFile)
+	}
+	return safefile.Write(filename, func(w io.Writer) error {
+		return m.WriteOBJ(w, mtl)
+	})
+}
+
+// WriteOBJ writes the Mesh as a Wavefront OBJ model, which Blender and most
+// other modelling programs read.  If mtl isn't "" the model uses the
+// material in the material file of that name, as written by WriteMTL, and
+// the TexCoords are written with the vertices.
+func (m *Mesh) WriteOBJ(w io.Writer, mtl string) error {
+	textured := mtl != "" && len(m.TexCoords) == len(m.Vertices)
+	out := bufio.NewWriter(w)
+	if textured {
+		fmt.Fprintf(out, "mtllib %s\n", mtl)
+	}
+	var line []byte
+	number := func(name string, values ...float64) {
+		line = append(line[:0], name...)
+		for _, v := range values {
+			line = append(line, ' ')
+			line = strconv.AppendFloat(line, v, 'f', -1, 32)
+		}
+		line = append(line, '\n')
+		out.Write(line)
+	}
+	for _, v := range m.Vertices {
+		number("v", v.X, v.Y, v.Z)
+	}
+	if textured {
+		for _, t := range m.TexCoords {
+			number("vt", t.U, t.V)
+		}
+		fmt.Fprintf(out, "usemtl %s\n", objMaterial)
+	}
+
+	// The vertices are numbered from 1, and each has the texture
+	// coordinates of the same number.
+	for _, t := range m.Triangles {
+		line = append(line[:0], 'f')
+		for _, v := range t {
+			line = append(line, ' ')
+			line = strconv.AppendInt(line, int64(v+1), 10)
+			if textured {
+				line = append(line, '/')
+				line = strconv.AppendInt(line, int64(v+1), 10)
+			}
+		}
+		line = append(line, '\n')
+		_, err := out.Write(line)
+		if err != nil {
+			return err
+		}
+	}
+	return out.Flush()
+}
+
+// WriteMTL writes a Wavefront material file with a matt material that
+// shows the picture texture, for the models written by WriteOBJ.
+func WriteMTL(w io.Writer, texture string) error {
+	_, err := fmt.Fprintf(w, "newmtl %s\nKa 1 1 1\nKd 1 1 1\nKs 0 0 0\nillum 1\nmap_Kd %s\n", objMaterial, texture)
+	return err
+}
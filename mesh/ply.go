@@ -0,0 +1,132 @@
+package mesh
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+
+	"github.com/goblimey/tiler/internal/safefile"
+)
+
+// PLYOptions control how WritePLY writes a Mesh.
+type PLYOptions struct {
+	// ASCII asks for text rather than binary.
+	ASCII bool
+	// Colours, if there are any, has the colour of each vertex, as
+	// Colours returns them.
+	Colours []color.NRGBA
+}
+
+// WritePLYToFile writes the Mesh to a PLY file.
+func (m *Mesh) WritePLYToFile(filename string, options PLYOptions) error {
+	return safefile.Write(filename, func(w io.Writer) error {
+		return m.WritePLY(w, options)
+	})
+}
+
+// WritePLY writes the Mesh in the Stanford PLY format that MeshLab and
+// CloudCompare read, binary or text.  Each vertex has its position, its
+// height as an "elevation" property, if the Mesh has Heights, and its
+// colour, if options gives them.
+func (m *Mesh) WritePLY(w io.Writer, options PLYOptions) error {
+	if m.Heights != nil && len(m.Heights) != len(m.Vertices) {
+		return fmt.Errorf("%d heights for %d vertices", len(m.Heights), len(m.Vertices))
+	}
+	if options.Colours != nil && len(options.Colours) != len(m.Vertices) {
+		return fmt.Errorf("%d colours for %d vertices", len(options.Colours), len(m.Vertices))
+	}
+	if uint64(len(m.Vertices)) > math.MaxInt32 {
+		return fmt.Errorf("%d vertices are too many for PLY", len(m.Vertices))
+	}
+	out := bufio.NewWriter(w)
+	format := "binary_little_endian"
+	if options.ASCII {
+		format = "ascii"
+	}
+	fmt.Fprintf(out, "ply\nformat %s 1.0\ncomment tiler terrain mesh\n", format)
+	fmt.Fprintf(out, "element vertex %d\nproperty float x\nproperty float y\nproperty float z\n", len(m.Vertices))
+	if m.Heights != nil {
+		fmt.Fprintf(out, "property float elevation\n")
+	}
+	if options.Colours != nil {
+		fmt.Fprintf(out, "property uchar red\nproperty uchar green\nproperty uchar blue\n")
+	}
+	fmt.Fprintf(out, "element face %d\nproperty list uchar int vertex_indices\nend_header\n", len(m.Triangles))
+
+	if options.ASCII {
+		for i, v := range m.Vertices {
+			fmt.Fprintf(out, "%g %g %g", float32(v.X), float32(v.Y), float32(v.Z))
+			if m.Heights != nil {
+				fmt.Fprintf(out, " %g", float32(m.Heights[i]))
+			}
+			if options.Colours != nil {
+				c := options.Colours[i]
+				fmt.Fprintf(out, " %d %d %d", c.R, c.G, c.B)
+			}
+			fmt.Fprintln(out)
+		}
+		for _, t := range m.Triangles {
+			fmt.Fprintf(out, "3 %d %d %d\n", t[0], t[1], t[2])
+		}
+		return out.Flush()
+	}
+
+	order := binary.LittleEndian
+	record := make([]byte, 0, 19)
+	for i, v := range m.Vertices {
+		record = record[:0]
+		record = order.AppendUint32(record, math.Float32bits(float32(v.X)))
+		record = order.AppendUint32(record, math.Float32bits(float32(v.Y)))
+		record = order.AppendUint32(record, math.Float32bits(float32(v.Z)))
+		if m.Heights != nil {
+			record = order.AppendUint32(record, math.Float32bits(float32(m.Heights[i])))
+		}
+		if options.Colours != nil {
+			c := options.Colours[i]
+			record = append(record, c.R, c.G, c.B)
+		}
+		out.Write(record)
+	}
+	face := make([]byte, 13)
+	face[0] = 3
+	for _, t := range m.Triangles {
+		for i, v := range t {
+			order.PutUint32(face[1+4*i:], uint32(v))
+		}
+		_, err := out.Write(face)
+		if err != nil {
+			return err
+		}
+	}
+	return out.Flush()
+}
+
+// Colours returns the colour of the picture img at the TexCoords of each
+// vertex of the Mesh, as draped over it.
+func (m *Mesh) Colours(img image.Image) []color.NRGBA {
+	b := img.Bounds()
+	colours := make([]color.NRGBA, len(m.TexCoords))
+	for i, t := range m.TexCoords {
+		x := b.Min.X + int(math.Floor(t.U*float64(b.Dx())))
+		y := b.Min.Y + int(math.Floor((1-t.V)*float64(b.Dy())))
+		x = clamp(x, b.Min.X, b.Max.X-1)
+		y = clamp(y, b.Min.Y, b.Max.Y-1)
+		colours[i] = color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+	}
+	return colours
+}
+
+// clamp returns v moved into the range lo to hi.
+func clamp(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
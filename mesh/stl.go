@@ -0,0 +1,55 @@
+package mesh
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/goblimey/tiler/internal/safefile"
+)
+
+// stlHeader is the 80 bytes at the start of a binary STL file, which
+// mustn't start with "solid", as that marks a text STL file.
+const stlHeader = "tiler terrain mesh"
+
+// WriteSTLToFile writes the Mesh to a binary STL file.
+func (m *Mesh) WriteSTLToFile(filename string) error {
+	return safefile.Write(filename, m.WriteSTL)
+}
+
+// WriteSTL writes the Mesh as binary STL, the format that 3D printing
+// programs read.  STL has no units - the coordinates are map units, so for
+// British National Grid or UTM data 1 is a metre.
+func (m *Mesh) WriteSTL(w io.Writer) error {
+	if uint64(len(m.Triangles)) > math.MaxUint32 {
+		return fmt.Errorf("%d triangles are too many for STL", len(m.Triangles))
+	}
+	out := bufio.NewWriter(w)
+	order := binary.LittleEndian
+	header := make([]byte, 84)
+	copy(header, stlHeader)
+	order.PutUint32(header[80:], uint32(len(m.Triangles)))
+	out.Write(header)
+
+	// Each triangle is its normal, its three vertices and a 2 byte
+	// attribute count that is always 0.
+	record := make([]byte, 50)
+	put := func(offset int, v Vertex) {
+		order.PutUint32(record[offset:], math.Float32bits(float32(v.X)))
+		order.PutUint32(record[offset+4:], math.Float32bits(float32(v.Y)))
+		order.PutUint32(record[offset+8:], math.Float32bits(float32(v.Z)))
+	}
+	for _, t := range m.Triangles {
+		put(0, m.Normal(t))
+		for i, v := range t {
+			put(12+12*i, m.Vertices[v])
+		}
+		_, err := out.Write(record)
+		if err != nil {
+			return err
+		}
+	}
+	return out.Flush()
+}
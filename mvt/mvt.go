@@ -0,0 +1,218 @@
+// Package mvt encodes line features as Mapbox Vector Tiles (version 2.1 of
+// the specification).  The protocol buffer encoding is written out by hand
+// since only a small part of it is needed.
+package mvt
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// DefaultExtent is the usual size of a tile in tile coordinates.
+const DefaultExtent = 4096
+
+// lineString is the geometry type of a feature made of lines.
+const lineString = 2
+
+// Geometry commands.
+const (
+	moveTo = 1
+	lineTo = 2
+)
+
+// Point is a position in tile coordinates, from (0, 0) at the top left to
+// (extent, extent) at the bottom right.  Positions a little outside that
+// range are allowed so that lines carry on across the edges of the tile.
+type Point struct {
+	X, Y int
+}
+
+// Feature is a set of lines with the same properties.
+type Feature struct {
+	Lines [][]Point
+	// Properties values may be strings, float64s, ints or bools.
+	Properties map[string]interface{}
+}
+
+// Layer is a named set of features.
+type Layer struct {
+	Name     string
+	Extent   int
+	Features []Feature
+}
+
+// Encode returns a tile holding the layers.  Lines with fewer than two
+// distinct points are left out, as are features with no lines left.
+func Encode(layers ...Layer) ([]byte, error) {
+	var tile []byte
+	for _, layer := range layers {
+		data, err := encodeLayer(layer)
+		if err != nil {
+			return nil, err
+		}
+		tile = appendBytes(tile, 3, data)
+	}
+	return tile, nil
+}
+
+func encodeLayer(layer Layer) ([]byte, error) {
+	extent := layer.Extent
+	if extent <= 0 {
+		extent = DefaultExtent
+	}
+	var keys []string
+	keyIndex := make(map[string]int)
+	var values [][]byte
+	valueIndex := make(map[string]int)
+
+	var data []byte
+	data = appendVarint(data, 15, 2)
+	data = appendBytes(data, 1, []byte(layer.Name))
+	for id, f := range layer.Features {
+		geometry := encodeLines(f.Lines)
+		if len(geometry) == 0 {
+			continue
+		}
+
+		// Tags are pairs of key and value indexes, in a fixed order.
+		names := make([]string, 0, len(f.Properties))
+		for name := range f.Properties {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		var tags []uint32
+		for _, name := range names {
+			value, err := encodeValue(f.Properties[name])
+			if err != nil {
+				return nil, fmt.Errorf("layer %s property %s: %w", layer.Name, name, err)
+			}
+			k, ok := keyIndex[name]
+			if !ok {
+				k = len(keys)
+				keyIndex[name] = k
+				keys = append(keys, name)
+			}
+			v, ok := valueIndex[string(value)]
+			if !ok {
+				v = len(values)
+				valueIndex[string(value)] = v
+				values = append(values, value)
+			}
+			tags = append(tags, uint32(k), uint32(v))
+		}
+
+		var feature []byte
+		feature = appendVarint(feature, 1, uint64(id+1))
+		if len(tags) > 0 {
+			feature = appendBytes(feature, 2, packed(tags))
+		}
+		feature = appendVarint(feature, 3, lineString)
+		feature = appendBytes(feature, 4, packed(geometry))
+		data = appendBytes(data, 2, feature)
+	}
+	for _, key := range keys {
+		data = appendBytes(data, 3, []byte(key))
+	}
+	for _, value := range values {
+		data = appendBytes(data, 4, value)
+	}
+	data = appendVarint(data, 5, uint64(extent))
+	return data, nil
+}
+
+// encodeLines returns the geometry commands drawing the lines.
+func encodeLines(lines [][]Point) []uint32 {
+	var result []uint32
+	var cursor Point
+	for _, line := range lines {
+		// Drop repeated points, which would give zero length segments.
+		points := make([]Point, 0, len(line))
+		for _, p := range line {
+			if len(points) == 0 || p != points[len(points)-1] {
+				points = append(points, p)
+			}
+		}
+		if len(points) < 2 {
+			continue
+		}
+		result = append(result, command(moveTo, 1),
+			zigzag(points[0].X-cursor.X), zigzag(points[0].Y-cursor.Y))
+		result = append(result, command(lineTo, len(points)-1))
+		for i := 1; i < len(points); i++ {
+			result = append(result, zigzag(points[i].X-points[i-1].X), zigzag(points[i].Y-points[i-1].Y))
+		}
+		cursor = points[len(points)-1]
+	}
+	return result
+}
+
+// encodeValue returns the protocol buffer form of a property value.
+func encodeValue(v interface{}) ([]byte, error) {
+	switch value := v.(type) {
+	case string:
+		return appendBytes(nil, 1, []byte(value)), nil
+	case float64:
+		return appendFixed64(nil, 3, math.Float64bits(value)), nil
+	case int:
+		return appendVarint(nil, 6, uint64(zigzag64(int64(value)))), nil
+	case bool:
+		b := uint64(0)
+		if value {
+			b = 1
+		}
+		return appendVarint(nil, 7, b), nil
+	}
+	return nil, fmt.Errorf("unsupported value type %T", v)
+}
+
+func command(id, count int) uint32 {
+	return uint32(id&7) | uint32(count)<<3
+}
+
+func zigzag(n int) uint32 {
+	return uint32((int32(n) << 1) ^ (int32(n) >> 31))
+}
+
+func zigzag64(n int64) uint64 {
+	return uint64((n << 1) ^ (n >> 63))
+}
+
+// packed returns a packed repeated uint32 field's contents.
+func packed(values []uint32) []byte {
+	var result []byte
+	for _, v := range values {
+		result = varint(result, uint64(v))
+	}
+	return result
+}
+
+func varint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+// appendVarint appends a varint field.
+func appendVarint(b []byte, field int, v uint64) []byte {
+	b = varint(b, uint64(field)<<3)
+	return varint(b, v)
+}
+
+// appendBytes appends a length delimited field.
+func appendBytes(b []byte, field int, data []byte) []byte {
+	b = varint(b, uint64(field)<<3|2)
+	b = varint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+// appendFixed64 appends a 64 bit field.
+func appendFixed64(b []byte, field int, v uint64) []byte {
+	b = varint(b, uint64(field)<<3|1)
+	for i := 0; i < 8; i++ {
+		b = append(b, byte(v>>(8*i)))
+	}
+	return b
+}
@@ -0,0 +1,332 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"strconv"
+
+	"github.com/goblimey/tiler/contour"
+	"github.com/goblimey/tiler/crs"
+	"github.com/goblimey/tiler/internal/safefile"
+	"github.com/goblimey/tiler/render"
+)
+
+// Page sizes in millimetres, portrait.
+var (
+	A4 = [2]float64{210, 297}
+	A3 = [2]float64{297, 420}
+)
+
+// pointsPerMM converts millimetres to PDF points.
+const pointsPerMM = 72 / 25.4
+
+// The layout of the sheet, in millimetres.
+const (
+	margin       = 15
+	titleHeight  = 12
+	footerHeight = 22
+)
+
+// Options control the drawing of a map sheet.
+type Options struct {
+	// Page is the width and height of the paper in millimetres - A4 if
+	// it's zero.  It's turned to landscape if that fits the map better.
+	Page [2]float64
+	// Scale is the scale of the map, for example 10000 for 1:10000.  If
+	// it's zero, the map fills the page.
+	Scale float64
+	// Title, if given, is written above the map.
+	Title string
+	// Picture, if not nil, is the ground, drawn to cover the whole area.
+	Picture image.Image
+	// Contours are drawn over the picture, the index contours thicker and
+	// labelled LabelSpacing map units apart, or not at all if that's 0.
+	Contours     []contour.Contour
+	LabelSpacing float64
+	// Legend, if not nil, explains the colours of the picture.
+	Legend *Legend
+	// Units, if given, is the name of the map units, such as "m", and a
+	// scale bar is drawn in them.
+	Units string
+	// CRS, if not nil, is the coordinate reference system of the map, and
+	// the sheet is registered with the WGS84 positions of the corners of
+	// the map, as a GeoPDF.
+	CRS crs.CRS
+}
+
+// Legend is a bar of the colours of a ColourRamp, marked with the heights
+// at either end and some between.
+type Legend struct {
+	Title          string
+	Ramp           render.ColourRamp
+	Floor, Ceiling float64
+}
+
+// WriteMapToFile writes a PDF file as described for WriteMap.
+func WriteMapToFile(filename string, minX, minY, maxX, maxY float64, options Options) error {
+	return safefile.Write(filename, func(w io.Writer) error {
+		return WriteMap(w, minX, minY, maxX, maxY, options)
+	})
+}
+
+// WriteMap draws a map sheet of the area (minX, minY) to (maxX, maxY),
+// given in map coordinates, as a one page PDF document.  The picture is
+// written with one image pixel per pixel, and the contours, labels, legend
+// and scale bar as lines and text, so that they print sharply.
+func WriteMap(w io.Writer, minX, minY, maxX, maxY float64, options Options) error {
+	if minX >= maxX || minY >= maxY {
+		return fmt.Errorf("WriteMap: empty area (%f,%f) (%f,%f)", minX, minY, maxX, maxY)
+	}
+	width, height := maxX-minX, maxY-minY
+
+	// Choose the page and fit the map into the space between the title
+	// and the footer.
+	page := options.Page
+	if page[0] <= 0 || page[1] <= 0 {
+		page = A4
+	}
+	if (width > height) != (page[0] > page[1]) {
+		page[0], page[1] = page[1], page[0]
+	}
+	top := page[1] - margin
+	if options.Title != "" {
+		top -= titleHeight
+	}
+	spaceWidth := page[0] - 2*margin
+	spaceHeight := top - margin - footerHeight
+	scale := math.Min(spaceWidth/width, spaceHeight/height)
+	if options.Scale > 0 {
+		scale = 1000 / options.Scale
+		if width*scale > spaceWidth+1e-9 || height*scale > spaceHeight+1e-9 {
+			return fmt.Errorf("at 1:%g the map is %.0f by %.0f mm, too big for the %g by %g mm space on the page",
+				options.Scale, width*scale, height*scale, spaceWidth, spaceHeight)
+		}
+	}
+	// The map frame in points, and the conversion from map coordinates.
+	mapWidth, mapHeight := width*scale*pointsPerMM, height*scale*pointsPerMM
+	x0 := (page[0]*pointsPerMM - mapWidth) / 2
+	y0 := top*pointsPerMM - mapHeight
+	k := scale * pointsPerMM
+	toPage := func(x, y float64) (float64, float64) {
+		return x0 + (x-minX)*k, y0 + (y-minY)*k
+	}
+
+	d := new(document)
+	var content bytes.Buffer
+	resources := "/Font << /F1 1 0 R >>"
+	d.add("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+
+	if options.Picture != nil {
+		picture := addImage(d, options.Picture)
+		resources += fmt.Sprintf(" /XObject << /Im1 %d 0 R >>", picture)
+		fmt.Fprintf(&content, "q %.3f 0 0 %.3f %.3f %.3f cm /Im1 Do Q\n", mapWidth, mapHeight, x0, y0)
+	}
+
+	// The contours and their labels, clipped to the frame.
+	fmt.Fprintf(&content, "q %.3f %.3f %.3f %.3f re W n\n0.545 0.271 0.075 RG 1 J 1 j\n", x0, y0, mapWidth, mapHeight)
+	for _, index := range []bool{false, true} {
+		lineWidth := 0.3
+		if index {
+			lineWidth = 0.8
+		}
+		fmt.Fprintf(&content, "%g w\n", lineWidth)
+		for _, c := range options.Contours {
+			if c.Index != index || len(c.Line) < 2 {
+				continue
+			}
+			for i, p := range c.Line {
+				x, y := toPage(p.X, p.Y)
+				operator := "l"
+				if i == 0 {
+					operator = "m"
+				}
+				fmt.Fprintf(&content, "%.2f %.2f %s\n", x, y, operator)
+			}
+			content.WriteString("S\n")
+		}
+	}
+	if options.LabelSpacing > 0 {
+		const fontSize = 6.0
+		for _, c := range options.Contours {
+			if !c.Index {
+				continue
+			}
+			for _, label := range c.Labels(options.LabelSpacing, 4*fontSize/k) {
+				x, y := toPage(label.Point.X, label.Point.Y)
+				// A white halo, then the text.
+				writeText(&content, label.Text, fontSize, x, y, label.Angle, "1 g 1 G 1.5 w 2 Tr")
+				writeText(&content, label.Text, fontSize, x, y, label.Angle, "0.545 0.271 0.075 rg 0 Tr")
+			}
+		}
+	}
+	content.WriteString("Q\n")
+	fmt.Fprintf(&content, "0 G 0.5 w %.3f %.3f %.3f %.3f re S\n", x0, y0, mapWidth, mapHeight)
+
+	if options.Title != "" {
+		fmt.Fprintf(&content, "0 g BT /F1 16 Tf %.3f %.3f Td %s Tj ET\n",
+			x0, (page[1]-margin-titleHeight+4)*pointsPerMM, text(options.Title))
+	}
+	footer := (margin + 6) * pointsPerMM
+	if options.Legend != nil {
+		writeLegend(&content, options.Legend, x0, footer, math.Min(70*pointsPerMM, mapWidth/2))
+	}
+	if options.Units != "" {
+		writeScaleBar(&content, options, x0+mapWidth, footer, k, mapWidth/3)
+	}
+
+	contents := d.addStream("", content.Bytes())
+	pageObject := fmt.Sprintf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %.3f %.3f] /Resources << %s >> /Contents %d 0 R",
+		len(d.objects)+2, page[0]*pointsPerMM, page[1]*pointsPerMM, resources, contents)
+	if options.CRS != nil {
+		pageObject += " " + viewport(options.CRS, minX, minY, maxX, maxY, x0, y0, mapWidth, mapHeight)
+	}
+	pageNumber := d.add(pageObject + " >>")
+	pages := d.add(fmt.Sprintf("<< /Type /Pages /Kids [%d 0 R] /Count 1 >>", pageNumber))
+	root := d.add(fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pages))
+	return d.write(w, root)
+}
+
+// addImage adds img to d as an RGB image, with a soft mask for its
+// transparency if it has any, and returns its object number.
+func addImage(d *document, img image.Image) int {
+	b := img.Bounds()
+	rgb := make([]byte, 0, 3*b.Dx()*b.Dy())
+	alpha := make([]byte, 0, b.Dx()*b.Dy())
+	opaque := true
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			rgb = append(rgb, c.R, c.G, c.B)
+			alpha = append(alpha, c.A)
+			opaque = opaque && c.A == 255
+		}
+	}
+	dict := fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /BitsPerComponent 8", b.Dx(), b.Dy())
+	mask := ""
+	if !opaque {
+		n := d.addStream(dict+" /ColorSpace /DeviceGray", alpha)
+		mask = fmt.Sprintf(" /SMask %d 0 R", n)
+	}
+	return d.addStream(dict+" /ColorSpace /DeviceRGB"+mask, rgb)
+}
+
+// writeText writes s centred on (x, y), turned angle degrees
+// anticlockwise, after the operators in state that set its colours and
+// rendering mode.
+func writeText(w io.Writer, s string, size, x, y, angle float64, state string) {
+	a := angle * math.Pi / 180
+	cos, sin := math.Cos(a), math.Sin(a)
+	// The text starts half its width back along the line and a third of
+	// its size down.
+	half, drop := textWidth(s, size)/2, size/3
+	tx := x - half*cos + drop*sin
+	ty := y - half*sin - drop*cos
+	fmt.Fprintf(w, "q %s BT /F1 %g Tf %.4f %.4f %.4f %.4f %.3f %.3f Tm %s Tj ET Q\n",
+		state, size, cos, sin, -sin, cos, tx, ty, text(s))
+}
+
+// writeLegend draws the legend as a bar of width points with its bottom
+// left corner at (x, y + 8), marked with heights beneath it and its title
+// above.
+func writeLegend(w io.Writer, legend *Legend, x, y, width float64) {
+	const steps = 100
+	const barHeight = 10
+	barY := y + 8
+	step := width / steps
+	for i := 0; i < steps; i++ {
+		c := legend.Ramp((float32(i) + 0.5) / steps)
+		fmt.Fprintf(w, "%.3f %.3f %.3f rg %.3f %.3f %.3f %.3f re f\n",
+			float64(c.R)/255, float64(c.G)/255, float64(c.B)/255, x+float64(i)*step, barY, step+0.1, float64(barHeight))
+	}
+	fmt.Fprintf(w, "0 G 0.3 w %.3f %.3f %.3f %.3f re S\n", x, barY, width, float64(barHeight))
+
+	span := legend.Ceiling - legend.Floor
+	if span > 0 {
+		for _, v := range ticks(legend.Floor, legend.Ceiling, 5) {
+			tx := x + (v-legend.Floor)/span*width
+			fmt.Fprintf(w, "%.3f %.3f m %.3f %.3f l S\n", tx, barY, tx, barY-2)
+			writeText(w, strconv.FormatFloat(v, 'f', -1, 64), 7, tx, barY-6, 0, "0 g")
+		}
+	}
+	if legend.Title != "" {
+		fmt.Fprintf(w, "0 g BT /F1 8 Tf %.3f %.3f Td %s Tj ET\n", x, barY+barHeight+4, text(legend.Title))
+	}
+}
+
+// writeScaleBar draws a scale bar at most maxWidth points long, ending at
+// right, in the map units of options, with k points to the map unit, and
+// the scale above it if options give one.
+func writeScaleBar(w io.Writer, options Options, right, y, k, maxWidth float64) {
+	length := niceLength(maxWidth / k)
+	barWidth := length * k
+	x := right - barWidth
+	barY := y + 8
+	const parts = 4
+	for i := 0; i < parts; i++ {
+		fill := "1 g"
+		if i%2 == 0 {
+			fill = "0 g"
+		}
+		fmt.Fprintf(w, "%s 0 G 0.3 w %.3f %.3f %.3f 4 re B\n", fill, x+float64(i)*barWidth/parts, barY, barWidth/parts)
+	}
+	writeText(w, "0", 7, x, barY-6, 0, "0 g")
+	writeText(w, strconv.FormatFloat(length, 'f', -1, 64)+" "+options.Units, 7, right, barY-6, 0, "0 g")
+	if options.Scale > 0 {
+		s := "Scale 1:" + strconv.FormatFloat(options.Scale, 'f', -1, 64)
+		fmt.Fprintf(w, "0 g BT /F1 8 Tf %.3f %.3f Td %s Tj ET\n", right-textWidth(s, 8), barY+12, text(s))
+	}
+}
+
+// niceLength returns the longest of 1, 2 or 5 times a power of ten that
+// is no longer than max.
+func niceLength(max float64) float64 {
+	power := math.Pow(10, math.Floor(math.Log10(max)))
+	for _, m := range []float64{5, 2, 1} {
+		if m*power <= max {
+			return m * power
+		}
+	}
+	return power
+}
+
+// ticks returns round numbers from low to high, about count of them.
+func ticks(low, high float64, count int) []float64 {
+	raw := (high - low) / float64(count)
+	power := math.Pow(10, math.Floor(math.Log10(raw)))
+	step := 10 * power
+	for _, m := range []float64{1, 2, 5} {
+		if m*power >= raw {
+			step = m * power
+			break
+		}
+	}
+	var result []float64
+	for n := math.Ceil(low/step - 1e-9); n*step <= high+1e-9*step; n++ {
+		result = append(result, n*step)
+	}
+	return result
+}
+
+// viewport returns the /VP entry of a page that registers the map frame
+// (x0, y0) to (x0 + width, y0 + height) in points, covering the area
+// (minX, minY) to (maxX, maxY) in the coordinate reference system c, with
+// the WGS84 positions of its corners, as ISO 32000-2 geospatial PDF.
+func viewport(c crs.CRS, minX, minY, maxX, maxY, x0, y0, width, height float64) string {
+	// The corners in the order of the unit square of LPTS - bottom left,
+	// top left, top right and bottom right.
+	corners := [][2]float64{{minX, minY}, {minX, maxY}, {maxX, maxY}, {maxX, minY}}
+	var gpts bytes.Buffer
+	for _, p := range corners {
+		lon, lat := c.ToWGS84(p[0], p[1])
+		fmt.Fprintf(&gpts, " %.9f %.9f", lat, lon)
+	}
+	const wgs84 = `GEOGCS["WGS 84",DATUM["WGS_1984",SPHEROID["WGS 84",6378137,298.257223563]],PRIMEM["Greenwich",0],UNIT["degree",0.0174532925199433]]`
+	return fmt.Sprintf("/VP [<< /Type /Viewport /BBox [%.3f %.3f %.3f %.3f] /Measure << /Type /Measure /Subtype /GEO "+
+		"/Bounds [0 0 0 1 1 1 1 0] /GCS << /Type /GEOGCS /EPSG 4326 /WKT %s >> /GPTS [%s ] /LPTS [0 0 0 1 1 1 1 0] "+
+		"/PDU [/M /SQM /DEG] >> >>]",
+		x0, y0, x0+width, y0+height, text(wgs84), gpts.String())
+}
@@ -0,0 +1,105 @@
+// Package pdf draws map sheets as PDF documents for printing - a picture
+// of the ground with contours over it, a title, a legend of the colours
+// and a scale bar - optionally registered with the positions of its
+// corners, as a GeoPDF, so that GIS programs can place it.
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// document gathers the numbered objects of a PDF file.
+type document struct {
+	objects [][]byte
+}
+
+// add adds an object and returns its number.
+func (d *document) add(object string) int {
+	d.objects = append(d.objects, []byte(object))
+	return len(d.objects)
+}
+
+// addStream adds a stream object compressed with Flate, with dict the
+// entries of its dictionary other than its length and filter, and returns
+// its number.
+func (d *document) addStream(dict string, data []byte) int {
+	var compressed bytes.Buffer
+	z := zlib.NewWriter(&compressed)
+	z.Write(data)
+	z.Close()
+	var object bytes.Buffer
+	fmt.Fprintf(&object, "<< %s /Length %d /Filter /FlateDecode >>\nstream\n", dict, compressed.Len())
+	object.Write(compressed.Bytes())
+	object.WriteString("\nendstream")
+	d.objects = append(d.objects, object.Bytes())
+	return len(d.objects)
+}
+
+// write writes the document with the object numbered root as its
+// catalogue.
+func (d *document) write(w io.Writer, root int) error {
+	var out bytes.Buffer
+	// The comment of bytes above 127 marks the file as binary.
+	out.WriteString("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(d.objects))
+	for i, object := range d.objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n", i+1)
+		out.Write(object)
+		out.WriteString("\nendobj\n")
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(d.objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(d.objects)+1, root, xref)
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// text returns s as a PDF string in the WinAnsi encoding of the standard
+// fonts.  Characters that it doesn't have become question marks.
+func text(s string) string {
+	var b strings.Builder
+	b.WriteByte('(')
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < ' ' || r > 0xff || (r >= 0x7f && r < 0xa0):
+			b.WriteByte('?')
+		default:
+			b.WriteByte(byte(r))
+		}
+	}
+	b.WriteByte(')')
+	return b.String()
+}
+
+// helveticaWidths are the widths of the characters of Helvetica in
+// thousandths of the font size, for those that aren't 556.
+var helveticaWidths = map[rune]int{
+	' ': 278, '.': 278, ',': 278, ':': 278, '-': 333, '(': 333, ')': 333,
+	'/': 278, 'i': 222, 'j': 222, 'l': 222, 'f': 278, 't': 278, 'r': 333,
+	'm': 833, 'w': 722, 'k': 500, 's': 500, 'c': 500, 'v': 500, 'x': 500,
+	'y': 500, 'z': 500, 'I': 278, 'J': 500, 'M': 833, 'W': 944,
+}
+
+// textWidth returns the width of s in Helvetica of the given size.
+func textWidth(s string, size float64) float64 {
+	width := 0
+	for _, r := range s {
+		w, ok := helveticaWidths[r]
+		if !ok {
+			w = 556
+		}
+		width += w
+	}
+	return float64(width) * size / 1000
+}
@@ -0,0 +1,179 @@
+package pipeline
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"image"
+	"io"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/goblimey/tiler/esri"
+	"github.com/goblimey/tiler/internal/safefile"
+)
+
+// Manifest records how a set of tiles was made - the input files and
+// their checksums, the options used, the program and its version, the
+// number of tiles written at each zoom level and how long it took - so
+// that a large tile set can be checked and made again.  Its JSON form is
+// written by Write:
+//
+//	m := pipeline.NewManifest()
+//	m.Options = map[string]string{"fill": "10", "zoom": "10-16"}
+//	p := pipeline.Pipeline{
+//		Source:   m.File("tq1652_DTM_1M.asc"),
+//		Renderer: pipeline.Hillshade(315, 45),
+//		Sinks:    []pipeline.Sink{pipeline.Tiles(crs.OSGB{}, 10, 16, m.Count(pipeline.Dir("tiles")))},
+//	}
+//	err := p.Run(ctx)
+//	...
+//	m.Finish()
+//	err = m.WriteFile("tiles/manifest.json")
+type Manifest struct {
+	// Program is the import path of the program's main package.
+	Program string `json:"program"`
+	// Version is the version of the program's module, which is "(devel)"
+	// if it was built from a working copy rather than installed.
+	Version string `json:"version"`
+	// Revision is the version control revision it was built from, if
+	// known, and Modified is true if the working copy had changes.
+	Revision  string          `json:"revision,omitempty"`
+	Modified  bool            `json:"modified,omitempty"`
+	GoVersion string          `json:"goVersion"`
+	Inputs    []ManifestInput `json:"inputs"`
+	// Options are the settings that the tiles were made with, in whatever
+	// form the program gives them.
+	Options map[string]string `json:"options,omitempty"`
+	// Zooms has the number of tiles written at each zoom level, in order
+	// of zoom, and Tiles is the total.
+	Zooms       []ZoomCount `json:"zooms"`
+	Tiles       int         `json:"tiles"`
+	Started     time.Time   `json:"started"`
+	Finished    time.Time   `json:"finished"`
+	WallSeconds float64     `json:"wallSeconds"`
+
+	mutex sync.Mutex
+}
+
+// ManifestInput is an input file recorded in a Manifest.
+type ManifestInput struct {
+	File   string `json:"file"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// ZoomCount is the number of tiles written at a zoom level.
+type ZoomCount struct {
+	Zoom  int `json:"zoom"`
+	Tiles int `json:"tiles"`
+}
+
+// NewManifest is a factory method that returns a Manifest for a run
+// starting now, holding the version of the program as recorded in it by
+// the go command.
+func NewManifest() *Manifest {
+	m := &Manifest{Version: "unknown", GoVersion: runtime.Version(), Started: time.Now()}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return m
+	}
+	m.Program, m.Version = info.Path, info.Main.Version
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			m.Revision = s.Value
+		case "vcs.modified":
+			m.Modified = s.Value == "true"
+		}
+	}
+	return m
+}
+
+// AddInput records the file filename, with its size and SHA-256 checksum,
+// in the inputs.
+func (m *Manifest) AddInput(filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return err
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.Inputs = append(m.Inputs, ManifestInput{filename, size, hex.EncodeToString(h.Sum(nil))})
+	return nil
+}
+
+// File is a Source like the File function that also records filename in
+// the inputs.
+func (m *Manifest) File(filename string, opts ...esri.ReadOption) Source {
+	return SourceFunc(func(ctx context.Context) (*esri.Grid, error) {
+		err := m.AddInput(filename)
+		if err != nil {
+			return nil, err
+		}
+		return File(filename, opts...).Grid(ctx)
+	})
+}
+
+// Count returns a TileWriter that hands the tiles on to w and counts those
+// that it writes without error.
+func (m *Manifest) Count(w TileWriter) TileWriter {
+	return TileWriterFunc(func(ctx context.Context, z, x, y int, img *image.RGBA) error {
+		err := w.WriteTile(ctx, z, x, y, img)
+		if err != nil {
+			return err
+		}
+		m.AddTiles(z, 1)
+		return nil
+	})
+}
+
+// AddTiles records n tiles written at zoom level z, for tiles that aren't
+// written through Count.
+func (m *Manifest) AddTiles(z, n int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.Tiles += n
+	i := 0
+	for i < len(m.Zooms) && m.Zooms[i].Zoom < z {
+		i++
+	}
+	if i == len(m.Zooms) || m.Zooms[i].Zoom != z {
+		m.Zooms = append(m.Zooms, ZoomCount{})
+		copy(m.Zooms[i+1:], m.Zooms[i:])
+		m.Zooms[i] = ZoomCount{Zoom: z}
+	}
+	m.Zooms[i].Tiles += n
+}
+
+// Finish records the end of the run and the time it took.
+func (m *Manifest) Finish() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.Finished = time.Now()
+	m.WallSeconds = m.Finished.Sub(m.Started).Seconds()
+}
+
+// Write writes the Manifest to w as indented JSON.
+func (m *Manifest) Write(w io.Writer) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(m)
+}
+
+// WriteFile writes the Manifest to the file filename as indented JSON.
+func (m *Manifest) WriteFile(filename string) error {
+	return safefile.Write(filename, m.Write)
+}
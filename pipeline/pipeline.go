@@ -0,0 +1,126 @@
+// Package pipeline assembles programs that read a grid, change it, draw it
+// and write the results out of small stages - a Source, any number of
+// Transforms, a Renderer and one or more Sinks - so that, for example, read
+// → fill gaps → hillshade → tiles needs no glue code of its own:
+//
+//	p := pipeline.Pipeline{
+//		Source:     pipeline.File("tq1652_DTM_1M.asc"),
+//		Transforms: []pipeline.Transform{pipeline.FillGaps(10)},
+//		Renderer:   pipeline.Hillshade(315, 45),
+//		Sinks:      []pipeline.Sink{pipeline.Tiles(crs.OSGB{}, 10, 16, pipeline.Dir("tiles"))},
+//	}
+//	err := p.Run(ctx)
+//
+// Each stage is an interface with one method, and each has a Func type that
+// turns an ordinary function into a stage, as http.HandlerFunc does.
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"image"
+
+	"github.com/goblimey/tiler/esri"
+)
+
+// Source produces the Grid that a Pipeline works on.
+type Source interface {
+	Grid(ctx context.Context) (*esri.Grid, error)
+}
+
+// Transform makes a new Grid from g, for example by filling its gaps.  It
+// may return g itself if there is nothing to change.
+type Transform interface {
+	Transform(ctx context.Context, g *esri.Grid) (*esri.Grid, error)
+}
+
+// Renderer draws a Grid as a picture with one pixel per cell, so that the
+// pixel (col, row) shows the cell in that row and column.
+type Renderer interface {
+	Render(ctx context.Context, g *esri.Grid) (*image.RGBA, error)
+}
+
+// Sink writes the results of a Pipeline - the Grid after the Transforms and
+// the picture the Renderer drew of it, which is nil if there is no
+// Renderer.
+type Sink interface {
+	Write(ctx context.Context, g *esri.Grid, img *image.RGBA) error
+}
+
+// SourceFunc makes a function a Source.
+type SourceFunc func(ctx context.Context) (*esri.Grid, error)
+
+// Grid calls f.
+func (f SourceFunc) Grid(ctx context.Context) (*esri.Grid, error) {
+	return f(ctx)
+}
+
+// TransformFunc makes a function a Transform.
+type TransformFunc func(ctx context.Context, g *esri.Grid) (*esri.Grid, error)
+
+// Transform calls f.
+func (f TransformFunc) Transform(ctx context.Context, g *esri.Grid) (*esri.Grid, error) {
+	return f(ctx, g)
+}
+
+// RendererFunc makes a function a Renderer.
+type RendererFunc func(ctx context.Context, g *esri.Grid) (*image.RGBA, error)
+
+// Render calls f.
+func (f RendererFunc) Render(ctx context.Context, g *esri.Grid) (*image.RGBA, error) {
+	return f(ctx, g)
+}
+
+// SinkFunc makes a function a Sink.
+type SinkFunc func(ctx context.Context, g *esri.Grid, img *image.RGBA) error
+
+// Write calls f.
+func (f SinkFunc) Write(ctx context.Context, g *esri.Grid, img *image.RGBA) error {
+	return f(ctx, g, img)
+}
+
+// Pipeline is a Source, the Transforms applied in turn to the Grid it
+// gives, an optional Renderer and the Sinks that the results are written
+// to.
+type Pipeline struct {
+	Source     Source
+	Transforms []Transform
+	Renderer   Renderer
+	Sinks      []Sink
+}
+
+// Run runs the stages of the Pipeline in order.  It stops at the first
+// stage that fails, or once ctx is cancelled, and returns the error.
+func (p Pipeline) Run(ctx context.Context) error {
+	if p.Source == nil {
+		return errors.New("the pipeline has no source")
+	}
+	g, err := p.Source.Grid(ctx)
+	if err != nil {
+		return err
+	}
+	g, err = Apply(ctx, g, p.Transforms)
+	if err != nil {
+		return err
+	}
+	var img *image.RGBA
+	if p.Renderer != nil {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		img, err = p.Renderer.Render(ctx, g)
+		if err != nil {
+			return err
+		}
+	}
+	for _, s := range p.Sinks {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		err = s.Write(ctx, g, img)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
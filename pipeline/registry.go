@@ -0,0 +1,179 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/goblimey/tiler/esri"
+)
+
+// GridTransform makes a function that changes a Grid a Transform, for
+// transforms that don't need the context.
+type GridTransform func(g *esri.Grid) (*esri.Grid, error)
+
+// Transform calls f.
+func (f GridTransform) Transform(ctx context.Context, g *esri.Grid) (*esri.Grid, error) {
+	return f(g)
+}
+
+// TransformMaker makes the Transform registered under a name, given the
+// argument that follows the name and a colon - "3" for "smooth:3", or ""
+// if there is none.
+type TransformMaker func(arg string) (Transform, error)
+
+// registered is a Transform registered by RegisterTransform.
+type registered struct {
+	summary string
+	maker   TransformMaker
+}
+
+var (
+	registryLock sync.RWMutex
+	registry     = make(map[string]registered)
+)
+
+// RegisterTransform makes the Transforms made by maker available to
+// ParseTransforms, and so to the -transform flag, as name.  summary
+// describes it for help.  Registering a name again replaces the Transform.
+func RegisterTransform(name, summary string, maker TransformMaker) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	registry[strings.ToLower(name)] = registered{summary, maker}
+}
+
+// TransformNames returns the names of the registered Transforms in
+// alphabetical order.
+func TransformNames() []string {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// TransformSummary returns the summary given when name was registered.
+func TransformSummary(name string) string {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	return registry[strings.ToLower(name)].summary
+}
+
+// ParseTransforms makes the Transforms named in spec, a comma separated
+// list of registered names each optionally followed by a colon and an
+// argument, for example "fillnodata,smooth:3,resample:2m".  An empty spec
+// gives no Transforms.
+func ParseTransforms(spec string) ([]Transform, error) {
+	var transforms []Transform
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, arg := item, ""
+		if i := strings.Index(item, ":"); i >= 0 {
+			name, arg = item[:i], item[i+1:]
+		}
+		registryLock.RLock()
+		r, ok := registry[strings.ToLower(name)]
+		registryLock.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("unknown transform %q - expected one of %s", name, strings.Join(TransformNames(), ", "))
+		}
+		t, err := r.maker(arg)
+		if err != nil {
+			return nil, fmt.Errorf("transform %s: %v", item, err)
+		}
+		transforms = append(transforms, t)
+	}
+	return transforms, nil
+}
+
+// Apply applies transforms to g in turn and returns the result.
+func Apply(ctx context.Context, g *esri.Grid, transforms []Transform) (*esri.Grid, error) {
+	for _, t := range transforms {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		var err error
+		g, err = t.Transform(ctx, g)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+func init() {
+	RegisterTransform("fillnodata", "fill No Data cells from the nearest data - fillnodata:D looks no more than D map units away",
+		func(arg string) (Transform, error) {
+			distance := math.Inf(1)
+			if arg != "" {
+				var err error
+				distance, err = parseDistance(arg)
+				if err != nil {
+					return nil, err
+				}
+			}
+			return FillGaps(distance), nil
+		})
+	RegisterTransform("smooth", "gaussian smoothing - smooth:S has a standard deviation of S map units, 2 if not given",
+		func(arg string) (Transform, error) {
+			sigma, err := parseDistanceOr(arg, 2)
+			if err != nil {
+				return nil, err
+			}
+			return GridTransform(func(g *esri.Grid) (*esri.Grid, error) {
+				return g.GaussianSmooth(sigma), nil
+			}), nil
+		})
+	RegisterTransform("median", "median smoothing - median:R has a radius of R map units, 2 if not given",
+		func(arg string) (Transform, error) {
+			radius, err := parseDistanceOr(arg, 2)
+			if err != nil {
+				return nil, err
+			}
+			return GridTransform(func(g *esri.Grid) (*esri.Grid, error) {
+				return g.MedianSmooth(int(math.Round(radius / float64(g.CellSize())))), nil
+			}), nil
+		})
+	RegisterTransform("resample", "resample to a new cell size - resample:C makes cells C map units across, using bilinear interpolation",
+		func(arg string) (Transform, error) {
+			if arg == "" {
+				return nil, fmt.Errorf("the cell size is missing - for example resample:2")
+			}
+			cellsize, err := parseDistance(arg)
+			if err != nil {
+				return nil, err
+			}
+			return GridTransform(func(g *esri.Grid) (*esri.Grid, error) {
+				return g.Resample(float32(cellsize), "bilinear")
+			}), nil
+		})
+}
+
+// parseDistanceOr returns the distance given by arg, or def if arg is
+// empty.
+func parseDistanceOr(arg string, def float64) (float64, error) {
+	if arg == "" {
+		return def, nil
+	}
+	return parseDistance(arg)
+}
+
+// parseDistance parses a distance in map units greater than zero, which
+// may be followed by "m", as in "2m".
+func parseDistance(arg string) (float64, error) {
+	d, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(arg), "m"), 64)
+	if err != nil || d <= 0 || math.IsNaN(d) || math.IsInf(d, 0) {
+		return 0, fmt.Errorf("%q is not a distance greater than zero", arg)
+	}
+	return d, nil
+}
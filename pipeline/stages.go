@@ -0,0 +1,76 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"io"
+
+	"github.com/goblimey/tiler/esri"
+	"github.com/goblimey/tiler/internal/safefile"
+	"github.com/goblimey/tiler/render"
+)
+
+// File is a Source that reads the ESRI ASCII grid file filename with
+// esri.ReadGridFromFile.  The context given to Run is passed on, so opts
+// needn't include esri.WithContext.
+func File(filename string, opts ...esri.ReadOption) Source {
+	return SourceFunc(func(ctx context.Context) (*esri.Grid, error) {
+		return esri.ReadGridFromFile(filename, append([]esri.ReadOption{esri.WithContext(ctx)}, opts...)...)
+	})
+}
+
+// Reader is a Source that reads an ESRI ASCII grid from in.
+func Reader(in io.Reader, opts ...esri.ReadOption) Source {
+	return SourceFunc(func(ctx context.Context) (*esri.Grid, error) {
+		return esri.ReadGrid(in, append([]esri.ReadOption{esri.WithContext(ctx)}, opts...)...)
+	})
+}
+
+// FillGaps is a Transform that fills the No Data cells of the Grid with
+// heights interpolated from the data within maxDistance map units, as
+// esri.Grid.FillGaps does.
+func FillGaps(maxDistance float64) Transform {
+	return TransformFunc(func(ctx context.Context, g *esri.Grid) (*esri.Grid, error) {
+		return g.FillGaps(maxDistance), nil
+	})
+}
+
+// Heights is a Renderer that draws the heights of the Grid with
+// render.HeightImage, in shades of grey unless opts include
+// render.WithPalette.
+func Heights(opts ...render.Option) Renderer {
+	return RendererFunc(func(ctx context.Context, g *esri.Grid) (*image.RGBA, error) {
+		return render.HeightImage(g, append([]render.Option{render.WithContext(ctx)}, opts...)...)
+	})
+}
+
+// Hillshade is a Renderer that draws the Grid lit by a sun at the given
+// azimuth and altitude in degrees, as render.HillshadeImage does.
+func Hillshade(azimuth, altitude float64) Renderer {
+	return RendererFunc(func(ctx context.Context, g *esri.Grid) (*image.RGBA, error) {
+		return render.HillshadeImage(g, azimuth, altitude), nil
+	})
+}
+
+// PNG is a Sink that writes the picture to the PNG file filename.  If ctx is
+// cancelled while it's writing, the file is left as it was.
+func PNG(filename string) Sink {
+	return SinkFunc(func(ctx context.Context, g *esri.Grid, img *image.RGBA) error {
+		if img == nil {
+			return errors.New("the pipeline has no renderer to draw " + filename)
+		}
+		return safefile.WriteContext(ctx, filename, func(w io.Writer) error {
+			return png.Encode(w, img)
+		})
+	})
+}
+
+// GridFile is a Sink that writes the Grid to the ESRI ASCII grid file
+// filename, for example to keep a copy after the Transforms.
+func GridFile(filename string) Sink {
+	return SinkFunc(func(ctx context.Context, g *esri.Grid, img *image.RGBA) error {
+		return safefile.WriteContext(ctx, filename, g.Write)
+	})
+}
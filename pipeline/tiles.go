@@ -0,0 +1,125 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+
+	"github.com/goblimey/tiler/crs"
+	"github.com/goblimey/tiler/esri"
+	"github.com/goblimey/tiler/internal/safefile"
+	"github.com/goblimey/tiler/render"
+	"github.com/goblimey/tiler/tile"
+)
+
+// TileWriter stores the z/x/y web map tiles made by the Tiles Sink.  Dir
+// writes them to a folder; a TileWriter for another store, such as an
+// MBTiles file, only needs to implement WriteTile.
+type TileWriter interface {
+	WriteTile(ctx context.Context, z, x, y int, img *image.RGBA) error
+}
+
+// TileWriterFunc makes a function a TileWriter.
+type TileWriterFunc func(ctx context.Context, z, x, y int, img *image.RGBA) error
+
+// WriteTile calls f.
+func (f TileWriterFunc) WriteTile(ctx context.Context, z, x, y int, img *image.RGBA) error {
+	return f(ctx, z, x, y, img)
+}
+
+// Dir is a TileWriter that writes each tile as the PNG file {z}/{x}/{y}.png
+// in the folder dir, the layout that web maps ask for.
+func Dir(dir string) TileWriter {
+	return TileWriterFunc(func(ctx context.Context, z, x, y int, img *image.RGBA) error {
+		filename := filepath.Join(dir, fmt.Sprint(z), fmt.Sprint(x), fmt.Sprint(y)+".png")
+		err := os.MkdirAll(filepath.Dir(filename), 0755)
+		if err != nil {
+			return err
+		}
+		return safefile.WriteContext(ctx, filename, func(w io.Writer) error {
+			return png.Encode(w, img)
+		})
+	})
+}
+
+// Tiles is a Sink that cuts the picture into the web map tiles that cover
+// the Grid at each zoom level from minZoom to maxZoom and hands them to w.
+// c is the coordinate reference system of the Grid.  Each pixel of a tile
+// is taken from the pixel of the picture drawn for the cell under its
+// centre, and pixels outside the Grid are transparent.  Tiles that don't
+// touch any cell of the Grid aren't written.
+func Tiles(c crs.CRS, minZoom, maxZoom int, w TileWriter) Sink {
+	return SinkFunc(func(ctx context.Context, g *esri.Grid, img *image.RGBA) error {
+		if img == nil {
+			return errors.New("the pipeline has no renderer to draw the tiles")
+		}
+		if minZoom < 0 || maxZoom > tile.MaxZoom || minZoom > maxZoom {
+			return fmt.Errorf("zoom levels %d to %d are not in the range 0 to %d", minZoom, maxZoom, tile.MaxZoom)
+		}
+		west, south, east, north := wgs84Bounds(c, g)
+		mercator := crs.WebMercator{}
+		for z := minZoom; z <= maxZoom; z++ {
+			x0, y0 := tile.Containing(z, west, north)
+			x1, y1 := tile.Containing(z, east, south)
+			for x := x0; x <= x1; x++ {
+				for y := y0; y <= y1; y++ {
+					if err := ctx.Err(); err != nil {
+						return err
+					}
+					t, ok := cutTile(c, mercator, g, img, z, x, y)
+					if !ok {
+						continue
+					}
+					err := w.WriteTile(ctx, z, x, y, t)
+					if err != nil {
+						return err
+					}
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// wgs84Bounds returns the longitudes and latitudes that enclose the Grid g,
+// whose map coordinates are in c.
+func wgs84Bounds(c crs.CRS, g *esri.Grid) (west, south, east, north float64) {
+	minX, minY, maxX, maxY := g.Bounds()
+	west, south = math.Inf(1), math.Inf(1)
+	east, north = math.Inf(-1), math.Inf(-1)
+	for _, corner := range [][2]float64{{minX, minY}, {minX, maxY}, {maxX, minY}, {maxX, maxY}} {
+		lon, lat := c.ToWGS84(corner[0], corner[1])
+		west, east = math.Min(west, lon), math.Max(east, lon)
+		south, north = math.Min(south, lat), math.Max(north, lat)
+	}
+	return west, south, east, north
+}
+
+// cutTile draws tile (z, x, y) from img, the picture of g.  ok is false if
+// no pixel of the tile is over g.
+func cutTile(c crs.CRS, mercator crs.WebMercator, g *esri.Grid, img *image.RGBA, z, x, y int) (t *image.RGBA, ok bool) {
+	t = image.NewRGBA(image.Rect(0, 0, tile.Size, tile.Size))
+	minX, _, _, maxY := tile.Bounds(z, x, y)
+	res := tile.Resolution(z)
+	for py := 0; py < tile.Size; py++ {
+		my := maxY - (float64(py)+0.5)*res
+		pix := render.RowPix(t, py)
+		for px := 0; px < tile.Size; px++ {
+			mx := minX + (float64(px)+0.5)*res
+			gx, gy := c.FromWGS84(mercator.ToWGS84(mx, my))
+			row, col, in := g.Cell(gx, gy)
+			if !in {
+				continue
+			}
+			ok = true
+			render.SetPixel(pix, px, img.RGBAAt(col, row))
+		}
+	}
+	return t, ok
+}
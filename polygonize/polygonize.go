@@ -0,0 +1,309 @@
+// Package polygonize turns areas of a Grid into polygons.  The polygons
+// follow the edges of the cells, so they match the data exactly but have
+// stepped edges.
+package polygonize
+
+import (
+	"math"
+	"sort"
+
+	"github.com/goblimey/tiler/esri"
+	"github.com/goblimey/tiler/geom"
+)
+
+// Band is the area of a Grid with heights from Min up to Max.
+type Band struct {
+	Min, Max float64
+	Polygons []geom.Polygon
+}
+
+// Class is the area of a Grid holding one value.
+type Class struct {
+	Value    float32
+	Polygons []geom.Polygon
+}
+
+// vertex is a cell corner, counted in cells from the top left corner of the
+// Grid.
+type vertex struct {
+	col, row int
+}
+
+// Bands returns the polygons covering the cells with heights in each range
+// between consecutive breaks, which must be in ascending order.  Each band
+// includes its lower break and, for the last band only, its upper break.
+// Cells holding the No Data value or outside all of the ranges are left
+// out, as are bands with no cells.
+func Bands(g *esri.Grid, breaks []float64) []Band {
+	if len(breaks) < 2 {
+		return nil
+	}
+	last := len(breaks) - 2
+	regions := trace(g, func(row, col int) int {
+		if g.IsNoData(row, col) {
+			return -1
+		}
+		h := float64(g.Height(row, col))
+		if h < breaks[0] || h > breaks[last+1] {
+			return -1
+		}
+		// The first break above h, less one.
+		band := sort.Search(len(breaks), func(i int) bool { return breaks[i] > h }) - 1
+		if band > last {
+			band = last
+		}
+		return band
+	})
+
+	var result []Band
+	for band := 0; band <= last; band++ {
+		if len(regions[band]) > 0 {
+			result = append(result, Band{Min: breaks[band], Max: breaks[band+1], Polygons: regions[band]})
+		}
+	}
+	return result
+}
+
+// Regions returns the polygons covering the cells for which in returns
+// true.  Cells that only touch at a corner are in separate polygons.
+func Regions(g *esri.Grid, in func(row, col int) bool) []geom.Polygon {
+	return trace(g, func(row, col int) int {
+		if in(row, col) {
+			return 0
+		}
+		return -1
+	})[0]
+}
+
+// Classes returns the polygons covering the cells holding each value, in
+// ascending order of value, for a Grid holding a few distinct values such as
+// one made by esri.Grid.Reclassify.  Cells holding the No Data value are
+// left out.
+func Classes(g *esri.Grid) []Class {
+	index := make(map[float32]int)
+	var values []float32
+	for row := 0; row < g.Nrows(); row++ {
+		for col := 0; col < g.Ncols(); col++ {
+			if g.IsNoData(row, col) {
+				continue
+			}
+			v := g.Height(row, col)
+			if _, ok := index[v]; !ok {
+				index[v] = 0
+				values = append(values, v)
+			}
+		}
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	for i, v := range values {
+		index[v] = i
+	}
+
+	regions := trace(g, func(row, col int) int {
+		if g.IsNoData(row, col) {
+			return -1
+		}
+		return index[g.Height(row, col)]
+	})
+	result := make([]Class, len(values))
+	for i, v := range values {
+		result[i] = Class{Value: v, Polygons: regions[i]}
+	}
+	return result
+}
+
+// trace returns the polygons covering the cells with each label.  Cells
+// labelled -1 are left out.
+func trace(g *esri.Grid, label func(row, col int) int) map[int][]geom.Polygon {
+	nrows, ncols := g.Nrows(), g.Ncols()
+	labels := make([][]int, nrows)
+	for row := range labels {
+		labels[row] = make([]int, ncols)
+		for col := range labels[row] {
+			labels[row][col] = label(row, col)
+		}
+	}
+	at := func(row, col int) int {
+		if row < 0 || row >= nrows || col < 0 || col >= ncols {
+			return -1
+		}
+		return labels[row][col]
+	}
+
+	// The boundary edges of each label, from each vertex to the next, with
+	// the region on the left going anticlockwise round the outside.
+	edges := make(map[int]map[vertex][]vertex)
+	add := func(l int, from, to vertex) {
+		if edges[l] == nil {
+			edges[l] = make(map[vertex][]vertex)
+		}
+		edges[l][from] = append(edges[l][from], to)
+	}
+	for row := 0; row < nrows; row++ {
+		for col := 0; col < ncols; col++ {
+			l := labels[row][col]
+			if l < 0 {
+				continue
+			}
+			topLeft, topRight := vertex{col, row}, vertex{col + 1, row}
+			bottomLeft, bottomRight := vertex{col, row + 1}, vertex{col + 1, row + 1}
+			if at(row+1, col) != l {
+				add(l, bottomLeft, bottomRight)
+			}
+			if at(row, col+1) != l {
+				add(l, bottomRight, topRight)
+			}
+			if at(row-1, col) != l {
+				add(l, topRight, topLeft)
+			}
+			if at(row, col-1) != l {
+				add(l, topLeft, bottomLeft)
+			}
+		}
+	}
+
+	minX, _, _, maxY := g.Bounds()
+	cellsize := float64(g.CellSize())
+	point := func(v vertex) geom.Point {
+		return geom.Point{X: minX + float64(v.col)*cellsize, Y: maxY - float64(v.row)*cellsize}
+	}
+
+	result := make(map[int][]geom.Polygon)
+	for l, e := range edges {
+		var outers, holes []geom.Ring
+		for _, ring := range rings(e) {
+			r := make(geom.Ring, len(ring))
+			for i, v := range ring {
+				r[i] = point(v)
+			}
+			if area(r) > 0 {
+				outers = append(outers, r)
+			} else {
+				holes = append(holes, r)
+			}
+		}
+		result[l] = assemble(outers, holes, cellsize)
+	}
+	return result
+}
+
+// rings links the edges into closed rings of vertices, leaving out the
+// vertices where the ring goes straight on.  Where two rings touch at a
+// corner, the sharpest left turn is taken so that they stay separate.
+func rings(edges map[vertex][]vertex) [][]vertex {
+	var result [][]vertex
+	// Visit the start vertices in a fixed order.
+	starts := make([]vertex, 0, len(edges))
+	for v := range edges {
+		starts = append(starts, v)
+	}
+	sort.Slice(starts, func(i, j int) bool {
+		if starts[i].row != starts[j].row {
+			return starts[i].row < starts[j].row
+		}
+		return starts[i].col < starts[j].col
+	})
+
+	for _, start := range starts {
+		for len(edges[start]) > 0 {
+			var ring []vertex
+			from := start
+			first := take(edges, from, 0, 0)
+			to := first
+			for {
+				dCol, dRow := to.col-from.col, to.row-from.row
+				// Back at the start, the ring carries on along its first
+				// edge, which has already been taken.
+				next := first
+				if to != start {
+					next = take(edges, to, dCol, dRow)
+				}
+				if next.col-to.col != dCol || next.row-to.row != dRow {
+					// A corner.
+					ring = append(ring, to)
+				}
+				if to == start {
+					break
+				}
+				from, to = to, next
+			}
+			result = append(result, ring)
+		}
+	}
+	return result
+}
+
+// take removes and returns an edge leading from v, preferring a left turn
+// from the direction (dCol, dRow), then straight on, then a right turn.
+func take(edges map[vertex][]vertex, v vertex, dCol, dRow int) vertex {
+	out := edges[v]
+	best := 0
+	if len(out) > 1 {
+		// Rows run down the map, so a left turn from (dCol, dRow) is
+		// (dRow, -dCol).
+		preferences := []vertex{{v.col + dRow, v.row - dCol}, {v.col + dCol, v.row + dRow}}
+		for _, p := range preferences {
+			found := false
+			for i, to := range out {
+				if to == p {
+					best, found = i, true
+					break
+				}
+			}
+			if found {
+				break
+			}
+		}
+	}
+	to := out[best]
+	edges[v] = append(out[:best], out[best+1:]...)
+	if len(edges[v]) == 0 {
+		delete(edges, v)
+	}
+	return to
+}
+
+// area returns the signed area of a ring, positive if it runs anticlockwise.
+func area(r geom.Ring) float64 {
+	a := 0.0
+	for i := range r {
+		j := (i + 1) % len(r)
+		a += r[i].X*r[j].Y - r[j].X*r[i].Y
+	}
+	return a / 2
+}
+
+// assemble puts each hole in the smallest outer ring around it.
+func assemble(outers, holes []geom.Ring, cellsize float64) []geom.Polygon {
+	polygons := make([]geom.Polygon, len(outers))
+	areas := make([]float64, len(outers))
+	bounds := make([][4]float64, len(outers))
+	for i, r := range outers {
+		polygons[i] = geom.Polygon{r}
+		areas[i] = area(r)
+		x0, y0, x1, y1 := polygons[i].Bounds()
+		bounds[i] = [4]float64{x0, y0, x1, y1}
+	}
+	for _, hole := range holes {
+		// A point just inside the region, on the left of the hole's first
+		// edge, which goes clockwise.
+		a, b := hole[0], hole[1]
+		length := math.Hypot(b.X-a.X, b.Y-a.Y)
+		dx, dy := (b.X-a.X)/length, (b.Y-a.Y)/length
+		px := (a.X+b.X)/2 - dy*cellsize/2
+		py := (a.Y+b.Y)/2 + dx*cellsize/2
+		owner := -1
+		for i := range outers {
+			if px < bounds[i][0] || px > bounds[i][2] || py < bounds[i][1] || py > bounds[i][3] {
+				continue
+			}
+			if (owner < 0 || areas[i] < areas[owner]) && polygons[i].Contains(px, py) {
+				owner = i
+			}
+		}
+		if owner >= 0 {
+			polygons[owner] = append(polygons[owner], hole)
+		}
+	}
+	return polygons
+}
@@ -0,0 +1,77 @@
+package profile
+
+import (
+	"math"
+	"strconv"
+)
+
+// Extent returns the length of the profile and the lowest and highest
+// heights with data.  ok is false if no sample has data.
+func Extent(samples []Sample) (length, low, high float64, ok bool) {
+	low, high = math.Inf(1), math.Inf(-1)
+	for _, s := range samples {
+		if s.Distance > length {
+			length = s.Distance
+		}
+		if s.OK {
+			low = math.Min(low, s.Height)
+			high = math.Max(high, s.Height)
+			ok = true
+		}
+	}
+	return length, low, high, ok
+}
+
+// AutoExaggeration returns the vertical exaggeration that makes a chart of
+// a profile of the given length and range of heights a third as high as it
+// is long.
+func AutoExaggeration(length, low, high float64) float64 {
+	if high <= low || length <= 0 {
+		return 1
+	}
+	return length / (3 * (high - low))
+}
+
+// Ticks returns the positions for about count marks along an axis running
+// from low to high - multiples of 1, 2 or 5 times a power of ten, starting
+// at or below low and ending at or above high - and the step between them.
+func Ticks(low, high float64, count int) (ticks []float64, step float64) {
+	if count < 1 {
+		count = 1
+	}
+	span := high - low
+	if span <= 0 {
+		span = 1
+	}
+	raw := span / float64(count)
+	power := math.Pow(10, math.Floor(math.Log10(raw)))
+	step = 10 * power
+	for _, m := range []float64{1, 2, 5} {
+		if m*power >= raw {
+			step = m * power
+			break
+		}
+	}
+	first := math.Floor(low/step + 1e-9)
+	last := math.Ceil(high/step - 1e-9)
+	if last <= first {
+		last = first + 1
+	}
+	for n := first; n <= last; n++ {
+		ticks = append(ticks, n*step)
+	}
+	return ticks, step
+}
+
+// TickLabel returns the text of the mark at v on an axis with marks step
+// apart, with as many decimal places as the step needs.
+func TickLabel(v, step float64) string {
+	places := 0
+	if step < 1 {
+		places = int(math.Ceil(-math.Log10(step) - 1e-9))
+	}
+	if math.Abs(v) < step/2 {
+		v = 0
+	}
+	return strconv.FormatFloat(v, 'f', places, 64)
+}
@@ -0,0 +1,88 @@
+// Package profile samples the heights along a line across a surface, to
+// show how the ground rises and falls along a path or a cross-section.
+package profile
+
+import (
+	"math"
+
+	"github.com/goblimey/tiler/geom"
+)
+
+// Surface gives the height at a map position.  esri.Grid and esri.TileSet
+// are Surfaces.
+type Surface interface {
+	InterpolatedHeightAt(x, y float64) (height float32, ok bool)
+}
+
+// Sample is the height at a point on a line.  Distance is measured along the
+// line from its start, in map units.  OK is false if the surface has no data
+// at the point, in which case Height is zero.
+type Sample struct {
+	X, Y     float64
+	Distance float64
+	Height   float64
+	OK       bool
+}
+
+// Points returns the height at each of the points of line.
+func Points(s Surface, line geom.Line) []Sample {
+	samples := make([]Sample, len(line))
+	distance := 0.0
+	for i, p := range line {
+		if i > 0 {
+			distance += math.Hypot(p.X-line[i-1].X, p.Y-line[i-1].Y)
+		}
+		samples[i] = sample(s, p.X, p.Y, distance)
+	}
+	return samples
+}
+
+// Along returns the height at intervals of spacing map units along line,
+// and at each of its points, so that the profile keeps its corners.
+func Along(s Surface, line geom.Line, spacing float64) []Sample {
+	if len(line) == 0 {
+		return nil
+	}
+	if spacing <= 0 {
+		return Points(s, line)
+	}
+	samples := []Sample{sample(s, line[0].X, line[0].Y, 0)}
+	distance := 0.0
+	for i := 1; i < len(line); i++ {
+		a, b := line[i-1], line[i]
+		length := math.Hypot(b.X-a.X, b.Y-a.Y)
+		// The steps that fall strictly inside this leg, then its end.
+		for d := spacing - math.Mod(distance, spacing); d < length; d += spacing {
+			t := d / length
+			samples = append(samples, sample(s, a.X+t*(b.X-a.X), a.Y+t*(b.Y-a.Y), distance+d))
+		}
+		distance += length
+		samples = append(samples, sample(s, b.X, b.Y, distance))
+	}
+	return samples
+}
+
+func sample(s Surface, x, y, distance float64) Sample {
+	height, ok := s.InterpolatedHeightAt(x, y)
+	return Sample{X: x, Y: y, Distance: distance, Height: float64(height), OK: ok}
+}
+
+// Climb returns the total ascent and descent along the samples, skipping
+// any without data.  Both are positive.
+func Climb(samples []Sample) (ascent, descent float64) {
+	last := math.NaN()
+	for _, s := range samples {
+		if !s.OK {
+			continue
+		}
+		if !math.IsNaN(last) {
+			if s.Height > last {
+				ascent += s.Height - last
+			} else {
+				descent += last - s.Height
+			}
+		}
+		last = s.Height
+	}
+	return ascent, descent
+}
@@ -0,0 +1,218 @@
+package qmesh
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// The WGS84 ellipsoid, on which Cesium places the tiles.
+const (
+	semiMajorAxis = 6378137.0
+	semiMinorAxis = 6356752.3142451793
+)
+
+// farAway is the distance of the horizon occlusion point of tiles too big
+// for the calculation, in radii of the Earth.
+const farAway = 1e6
+
+// quantized is the largest of the u, v and height values of a vertex.
+const quantized = 32767
+
+// ecef is a point in the Earth-centred, Earth-fixed frame, in metres.
+type ecef struct {
+	x, y, z float64
+}
+
+// toECEF returns the point at longitude lon and latitude lat in degrees,
+// height metres above the ellipsoid.
+func toECEF(lon, lat, height float64) ecef {
+	phi, lambda := lat*math.Pi/180, lon*math.Pi/180
+	e2 := 1 - semiMinorAxis*semiMinorAxis/(semiMajorAxis*semiMajorAxis)
+	n := semiMajorAxis / math.Sqrt(1-e2*math.Sin(phi)*math.Sin(phi))
+	return ecef{
+		(n + height) * math.Cos(phi) * math.Cos(lambda),
+		(n + height) * math.Cos(phi) * math.Sin(lambda),
+		(n*(1-e2) + height) * math.Sin(phi),
+	}
+}
+
+// The arithmetic of points and the vectors between them.
+
+func (p ecef) sub(q ecef) ecef      { return ecef{p.x - q.x, p.y - q.y, p.z - q.z} }
+func (p ecef) scale(s float64) ecef { return ecef{p.x * s, p.y * s, p.z * s} }
+func (p ecef) dot(q ecef) float64   { return p.x*q.x + p.y*q.y + p.z*q.z }
+func (p ecef) length() float64      { return math.Sqrt(p.dot(p)) }
+func (p ecef) cross(q ecef) ecef {
+	return ecef{p.y*q.z - p.z*q.y, p.z*q.x - p.x*q.z, p.x*q.y - p.y*q.x}
+}
+
+// scaledSpace returns p in the frame scaled to make the ellipsoid a unit
+// sphere.
+func (p ecef) scaledSpace() ecef {
+	return ecef{p.x / semiMajorAxis, p.y / semiMajorAxis, p.z / semiMinorAxis}
+}
+
+// Write writes tile (z, x, y) in the quantized-mesh-1.0 format, with the
+// heights given, Size rows of Size from the north west corner, as Sample
+// returns them.
+func Write(w io.Writer, z, x, y int, heights []float64) error {
+	if len(heights) != Size*Size {
+		return fmt.Errorf("%d heights - expected %d", len(heights), Size*Size)
+	}
+	west, south, east, north := Bounds(z, x, y)
+	minHeight, maxHeight := heights[0], heights[0]
+	for _, h := range heights {
+		minHeight = math.Min(minHeight, h)
+		maxHeight = math.Max(maxHeight, h)
+	}
+
+	// The triangles, two to each square of vertices and counter-clockwise
+	// seen from above, with the vertices numbered in the order that they
+	// are first used, as the high water mark encoding of the indexes
+	// needs.
+	number := make([]int, Size*Size)
+	for i := range number {
+		number[i] = -1
+	}
+	var order []int
+	var indexes []int
+	use := func(vertex int) {
+		if number[vertex] < 0 {
+			number[vertex] = len(order)
+			order = append(order, vertex)
+		}
+		indexes = append(indexes, number[vertex])
+	}
+	for row := 0; row < Size-1; row++ {
+		for col := 0; col < Size-1; col++ {
+			nw := row*Size + col
+			ne, sw, se := nw+1, nw+Size, nw+Size+1
+			for _, v := range []int{sw, se, ne, sw, ne, nw} {
+				use(v)
+			}
+		}
+	}
+
+	// The header - the centre of the tile, its range of heights, a sphere
+	// enclosing it and the point that Cesium checks is over the horizon.
+	points := make([]ecef, len(heights))
+	lo := ecef{math.Inf(1), math.Inf(1), math.Inf(1)}
+	hi := ecef{math.Inf(-1), math.Inf(-1), math.Inf(-1)}
+	for i, h := range heights {
+		row, col := i/Size, i%Size
+		lon := west + (east-west)*float64(col)/(Size-1)
+		lat := north - (north-south)*float64(row)/(Size-1)
+		p := toECEF(lon, lat, h)
+		points[i] = p
+		lo = ecef{math.Min(lo.x, p.x), math.Min(lo.y, p.y), math.Min(lo.z, p.z)}
+		hi = ecef{math.Max(hi.x, p.x), math.Max(hi.y, p.y), math.Max(hi.z, p.z)}
+	}
+	centre := toECEF((west+east)/2, (south+north)/2, (minHeight+maxHeight)/2)
+	sphere := ecef{(lo.x + hi.x) / 2, (lo.y + hi.y) / 2, (lo.z + hi.z) / 2}
+	radius := 0.0
+	for _, p := range points {
+		radius = math.Max(radius, p.sub(sphere).length())
+	}
+	horizon := horizonPoint(sphere, points)
+
+	out := bufio.NewWriter(w)
+	put := func(v interface{}) {
+		binary.Write(out, binary.LittleEndian, v)
+	}
+	put([]float64{centre.x, centre.y, centre.z})
+	put([]float32{float32(minHeight), float32(maxHeight)})
+	put([]float64{sphere.x, sphere.y, sphere.z, radius})
+	put([]float64{horizon.x, horizon.y, horizon.z})
+
+	// The vertices, as u, v and height each from 0 to 32767, zig-zag
+	// encoded differences from the one before.
+	u := make([]uint16, len(order))
+	v := make([]uint16, len(order))
+	hv := make([]uint16, len(order))
+	var lastU, lastV, lastH int
+	for i, vertex := range order {
+		row, col := vertex/Size, vertex%Size
+		qu := int(math.Round(float64(col) * quantized / (Size - 1)))
+		qv := int(math.Round(float64(Size-1-row) * quantized / (Size - 1)))
+		qh := 0
+		if maxHeight > minHeight {
+			qh = int(math.Round((heights[vertex] - minHeight) * quantized / (maxHeight - minHeight)))
+		}
+		u[i], v[i], hv[i] = zigZag(qu-lastU), zigZag(qv-lastV), zigZag(qh-lastH)
+		lastU, lastV, lastH = qu, qv, qh
+	}
+	put(uint32(len(order)))
+	put(u)
+	put(v)
+	put(hv)
+
+	// The triangles, as 16 bit indexes in high water mark encoding.  The
+	// vertex data is a whole number of 16 bit values, so no padding is
+	// needed.
+	put(uint32(len(indexes) / 3))
+	encoded := make([]uint16, len(indexes))
+	highest := 0
+	for i, index := range indexes {
+		encoded[i] = uint16(highest - index)
+		if index == highest {
+			highest++
+		}
+	}
+	put(encoded)
+
+	// The vertices along the west, south, east and north edges, which
+	// Cesium uses to hide the cracks between tiles of different zoom
+	// levels.
+	edge := func(vertex func(i int) int) {
+		indexes := make([]uint16, Size)
+		for i := range indexes {
+			indexes[i] = uint16(number[vertex(i)])
+		}
+		put(uint32(Size))
+		put(indexes)
+	}
+	edge(func(i int) int { return (Size - 1 - i) * Size })
+	edge(func(i int) int { return (Size-1)*Size + i })
+	edge(func(i int) int { return (Size-1-i)*Size + Size - 1 })
+	edge(func(i int) int { return i })
+	return out.Flush()
+}
+
+// zigZag encodes n, which may be negative, as a whole number - 0, -1, 1,
+// -2, 2 ... become 0, 1, 2, 3, 4 ...
+func zigZag(n int) uint16 {
+	return uint16((n << 1) ^ (n >> 63))
+}
+
+// horizonPoint returns the horizon occlusion point of a tile with the
+// given points, in the frame scaled to make the ellipsoid a unit sphere,
+// in the direction of direction - if that point is below the horizon, so
+// is the whole tile.  This is Cesium's EllipsoidalOccluder calculation.
+func horizonPoint(direction ecef, points []ecef) ecef {
+	d := direction.scaledSpace()
+	d = d.scale(1 / d.length())
+	magnitude := 0.0
+	for _, p := range points {
+		s := p.scaledSpace()
+		m2 := s.dot(s)
+		m := math.Sqrt(m2)
+		dir := s.scale(1 / m)
+		m2, m = math.Max(1, m2), math.Max(1, m)
+		cosAlpha := dir.dot(d)
+		sinAlpha := dir.cross(d).length()
+		cosBeta := 1 / m
+		sinBeta := math.Sqrt(m2-1) * cosBeta
+		denominator := cosAlpha*cosBeta - sinAlpha*sinBeta
+		if denominator <= 0 {
+			// The tile wraps too far round the world for a point to be
+			// found, as at zoom 0.  A point far out in its direction is
+			// below the horizon only from the far side of the world.
+			return d.scale(farAway)
+		}
+		magnitude = math.Max(magnitude, 1/denominator)
+	}
+	return d.scale(magnitude)
+}
@@ -0,0 +1,133 @@
+package qmesh
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+
+	"github.com/goblimey/tiler/crs"
+	"github.com/goblimey/tiler/esri"
+	"github.com/goblimey/tiler/internal/safefile"
+)
+
+// Layer is the layer.json file that describes a tile set to Cesium.
+type Layer struct {
+	TileJSON    string        `json:"tilejson"`
+	Name        string        `json:"name"`
+	Version     string        `json:"version"`
+	Format      string        `json:"format"`
+	Scheme      string        `json:"scheme"`
+	Tiles       []string      `json:"tiles"`
+	Projection  string        `json:"projection"`
+	Bounds      [4]float64    `json:"bounds"`
+	MinZoom     int           `json:"minzoom"`
+	MaxZoom     int           `json:"maxzoom"`
+	Attribution string        `json:"attribution,omitempty"`
+	Available   [][]TileRange `json:"available"`
+}
+
+// TileRange is a block of tiles at one zoom level, from (StartX, StartY)
+// to (EndX, EndY) inclusive.
+type TileRange struct {
+	StartX int `json:"startX"`
+	StartY int `json:"startY"`
+	EndX   int `json:"endX"`
+	EndY   int `json:"endY"`
+}
+
+// Write writes the Layer as indented JSON.
+func (l *Layer) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(l)
+}
+
+// Range returns the tiles at zoom level z that cover the area from west to
+// east and south to north.  Zoom 0 is always both tiles, as Cesium starts
+// from them.
+func Range(z int, west, south, east, north float64) TileRange {
+	if z == 0 {
+		return TileRange{0, 0, 1, 0}
+	}
+	x0, y0 := Containing(z, west, south)
+	x1, y1 := Containing(z, east, north)
+	return TileRange{x0, y0, x1, y1}
+}
+
+// WriteTileset writes a tile set for the TileSet ts, whose grids are in the
+// coordinate reference system c, to the folder dir - the tiles covering
+// the grids at each zoom level from 0 to maxZoom as {z}/{x}/{y}.terrain
+// files, and layer.json describing them, with the given name.  It returns
+// the number of tiles written at each zoom level, indexed by zoom, and
+// gives up with ctx.Err() if ctx is cancelled.
+func WriteTileset(ctx context.Context, dir, name string, ts *esri.TileSet, c crs.CRS, maxZoom int) ([]int, error) {
+	if maxZoom < 0 || maxZoom > MaxZoom {
+		return nil, fmt.Errorf("zoom level %d is not in the range 0 to %d", maxZoom, MaxZoom)
+	}
+	west, south, east, north := wgs84Bounds(ts, c)
+	layer := &Layer{
+		TileJSON:   "2.1.0",
+		Name:       name,
+		Version:    "1.0.0",
+		Format:     "quantized-mesh-1.0",
+		Scheme:     "tms",
+		Tiles:      []string{"{z}/{x}/{y}.terrain"},
+		Projection: "EPSG:4326",
+		Bounds:     [4]float64{west, south, east, north},
+		MaxZoom:    maxZoom,
+	}
+	counts := make([]int, maxZoom+1)
+	for z := 0; z <= maxZoom; z++ {
+		r := Range(z, west, south, east, north)
+		layer.Available = append(layer.Available, []TileRange{r})
+		for x := r.StartX; x <= r.EndX; x++ {
+			for y := r.StartY; y <= r.EndY; y++ {
+				heights, _, err := Sample(ctx, ts, c, z, x, y)
+				if err != nil {
+					return counts, err
+				}
+				filename := filepath.Join(dir, fmt.Sprint(z), fmt.Sprint(x), fmt.Sprint(y)+".terrain")
+				err = os.MkdirAll(filepath.Dir(filename), 0755)
+				if err != nil {
+					return counts, err
+				}
+				err = safefile.Write(filename, func(w io.Writer) error {
+					return Write(w, z, x, y, heights)
+				})
+				if err != nil {
+					return counts, err
+				}
+				counts[z]++
+			}
+		}
+	}
+	err := safefile.Write(filepath.Join(dir, "layer.json"), layer.Write)
+	return counts, err
+}
+
+// wgs84Bounds returns the longitudes and latitudes that enclose the
+// TileSet ts, whose grids are in c.  The edges are sampled because they
+// aren't straight lines after reprojection.
+func wgs84Bounds(ts *esri.TileSet, c crs.CRS) (west, south, east, north float64) {
+	minX, minY, maxX, maxY := ts.Bounds()
+	west, south = math.Inf(1), math.Inf(1)
+	east, north = math.Inf(-1), math.Inf(-1)
+	const steps = 16
+	for i := 0; i <= steps; i++ {
+		for j := 0; j <= steps; j++ {
+			if i != 0 && i != steps && j != 0 && j != steps {
+				continue
+			}
+			x := minX + (maxX-minX)*float64(i)/steps
+			y := minY + (maxY-minY)*float64(j)/steps
+			lon, lat := c.ToWGS84(x, y)
+			west, east = math.Min(west, lon), math.Max(east, lon)
+			south, north = math.Min(south, lat), math.Max(north, lat)
+		}
+	}
+	return west, south, east, north
+}
@@ -0,0 +1,91 @@
+// Package qmesh makes terrain tiles in Cesium's quantized-mesh-1.0 format,
+// which CesiumJS streams to show the ground as true 3D terrain.  The tiles
+// follow the geographic TMS tiling scheme that Cesium uses for terrain -
+// two tiles covering the world at zoom 0, x counted east from 180°W and y
+// counted north from 90°S - and each is a regular mesh of Size by Size
+// vertices.  A tile set is a folder of {z}/{x}/{y}.terrain files with a
+// layer.json file describing it.
+package qmesh
+
+import (
+	"context"
+	"math"
+
+	"github.com/goblimey/tiler/crs"
+	"github.com/goblimey/tiler/esri"
+)
+
+// Size is the number of vertices along each side of a tile.
+const Size = 65
+
+// MaxZoom is the deepest zoom level that this package makes tiles for.
+const MaxZoom = 22
+
+// metresPerDegree is the length of a degree of longitude at the equator.
+const metresPerDegree = 2 * math.Pi * semiMajorAxis / 360
+
+// Bounds returns the longitudes and latitudes of the edges of tile (z, x,
+// y).
+func Bounds(z, x, y int) (west, south, east, north float64) {
+	size := 180 / math.Exp2(float64(z))
+	west = -180 + float64(x)*size
+	south = -90 + float64(y)*size
+	return west, south, west + size, south + size
+}
+
+// Containing returns the x and y of the tile at zoom level z that holds
+// the point at longitude lon and latitude lat.
+func Containing(z int, lon, lat float64) (x, y int) {
+	size := 180 / math.Exp2(float64(z))
+	x = int(math.Floor((lon + 180) / size))
+	y = int(math.Floor((lat + 90) / size))
+	maxY := 1<<z - 1
+	maxX := 2*maxY + 1
+	return clamp(x, 0, maxX), clamp(y, 0, maxY)
+}
+
+// clamp returns v moved into the range lo to hi.
+func clamp(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
+
+// NativeZoom returns the zoom level at which the vertices of a tile are
+// about cellSize metres apart at the equator, the deepest that's worth
+// making for grids with cells of that size.
+func NativeZoom(cellSize float64) int {
+	z := int(math.Floor(math.Log2(180 * metresPerDegree / ((Size - 1) * cellSize))))
+	return clamp(z, 0, MaxZoom)
+}
+
+// Sample returns the heights of the vertices of tile (z, x, y), Size rows
+// of Size from the north west corner, taken from the TileSet ts, whose
+// grids are in the coordinate reference system c.  Vertices with no data
+// are at 0, sea level.  found is false if none of them has data.  The
+// vertices along the edges are shared with the next tiles, so that there
+// are no gaps between them.  It gives up with ctx.Err() if ctx is
+// cancelled.
+func Sample(ctx context.Context, ts *esri.TileSet, c crs.CRS, z, x, y int) (heights []float64, found bool, err error) {
+	west, south, east, north := Bounds(z, x, y)
+	heights = make([]float64, Size*Size)
+	for row := 0; row < Size; row++ {
+		if err := ctx.Err(); err != nil {
+			return nil, false, err
+		}
+		lat := north - (north-south)*float64(row)/(Size-1)
+		for col := 0; col < Size; col++ {
+			lon := west + (east-west)*float64(col)/(Size-1)
+			h, ok := ts.HeightAt(c.FromWGS84(lon, lat))
+			if ok {
+				heights[row*Size+col] = float64(h)
+				found = true
+			}
+		}
+	}
+	return heights, found, nil
+}
@@ -0,0 +1,69 @@
+package render
+
+import (
+	"image"
+	"image/color"
+	"sort"
+
+	"github.com/goblimey/tiler/esri"
+)
+
+// Palette gives the colours ClassImage uses for classes without a colour of
+// their own, in order of value - a set of colours that are easy to tell
+// apart.
+var Palette = []color.RGBA{
+	{141, 211, 199, 255},
+	{255, 255, 179, 255},
+	{190, 186, 218, 255},
+	{251, 128, 114, 255},
+	{128, 177, 211, 255},
+	{253, 180, 98, 255},
+	{179, 222, 105, 255},
+	{252, 205, 229, 255},
+	{217, 217, 217, 255},
+	{188, 128, 189, 255},
+	{204, 235, 197, 255},
+	{255, 237, 111, 255},
+}
+
+// ClassImage draws a Grid holding a few distinct values, such as one made
+// by esri.Grid.Reclassify, with one pixel per cell in the colour given for
+// its value in colours.  Values with no colour given take the colours of
+// Palette in ascending order of value, starting again when it runs out.
+// Cells holding the No Data value are left transparent.
+func ClassImage(grid *esri.Grid, colours map[float32]color.RGBA) *image.RGBA {
+	chosen := make(map[float32]color.RGBA)
+	var uncoloured []float32
+	for row := 0; row < grid.Nrows(); row++ {
+		for col := 0; col < grid.Ncols(); col++ {
+			if grid.IsNoData(row, col) {
+				continue
+			}
+			v := grid.Height(row, col)
+			if _, ok := chosen[v]; ok {
+				continue
+			}
+			c, ok := colours[v]
+			if !ok {
+				uncoloured = append(uncoloured, v)
+			}
+			chosen[v] = c
+		}
+	}
+	sort.Slice(uncoloured, func(i, j int) bool { return uncoloured[i] < uncoloured[j] })
+	for i, v := range uncoloured {
+		chosen[v] = Palette[i%len(Palette)]
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, grid.Ncols(), grid.Nrows()))
+	Rows(grid.Nrows(), func(row int) {
+		pix := RowPix(img, row)
+		for col := 0; col < grid.Ncols(); col++ {
+			if grid.IsNoData(row, col) {
+				continue
+			}
+			SetPixel(pix, col, chosen[grid.Height(row, col)])
+		}
+	})
+	return img
+}
@@ -0,0 +1,48 @@
+package render
+
+import (
+	"image"
+	"image/color"
+
+	"github.com/goblimey/tiler/esri"
+)
+
+// DiffImage draws a Grid of height differences with one pixel per cell -
+// white where there's no difference, shading to red as the difference rises
+// to limit and to blue as it falls to -limit.  Cells holding the No Data
+// value are left transparent.
+func DiffImage(grid *esri.Grid, limit float32) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, grid.Ncols(), grid.Nrows()))
+	Rows(grid.Nrows(), func(row int) {
+		pix := RowPix(img, row)
+		for col := 0; col < grid.Ncols(); col++ {
+			if grid.IsNoData(row, col) {
+				continue
+			}
+			SetPixel(pix, col, Diverging(grid.Height(row, col), limit))
+		}
+	})
+	return img
+}
+
+// Diverging returns the colour of the difference d in DiffImage.
+func Diverging(d, limit float32) color.RGBA {
+	t := float32(0)
+	if limit > 0 {
+		t = d / limit
+	}
+	if t > 1 {
+		t = 1
+	}
+	if t < -1 {
+		t = -1
+	}
+	if t >= 0 {
+		// White to red.
+		fade := uint8(255 * (1 - t))
+		return color.RGBA{255, fade, fade, 255}
+	}
+	// White to blue.
+	fade := uint8(255 * (1 + t))
+	return color.RGBA{fade, fade, 255, 255}
+}
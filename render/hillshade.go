@@ -0,0 +1,44 @@
+package render
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/goblimey/tiler/esri"
+	"github.com/goblimey/tiler/terrain"
+)
+
+// HillshadeImage draws a Grid with one pixel per cell lit by a sun at the
+// given azimuth (degrees clockwise from north) and altitude (degrees above
+// the horizon), using Horn's method for the slope.  Cells holding the No
+// Data value are left transparent, and cells next to them or to the edge use
+// their own height in place of the missing neighbours.
+func HillshadeImage(grid *esri.Grid, azimuth, altitude float64) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, grid.Ncols(), grid.Nrows()))
+	zenith := (90 - altitude) * math.Pi / 180
+	// Convert the compass bearing to a mathematical angle.
+	sun := (360 - azimuth + 90) * math.Pi / 180
+
+	Rows(grid.Nrows(), func(row int) {
+		pix := RowPix(img, row)
+		for col := 0; col < grid.Ncols(); col++ {
+			if grid.IsNoData(row, col) {
+				continue
+			}
+			dzdx, dzdy := terrain.Gradient(grid, row, col)
+			slope := math.Atan(math.Hypot(dzdx, dzdy))
+			// The aspect is the direction of steepest descent as a mathematical
+			// angle.
+			aspect := math.Atan2(-dzdy, -dzdx)
+			shade := math.Cos(zenith)*math.Cos(slope) +
+				math.Sin(zenith)*math.Sin(slope)*math.Cos(sun-aspect)
+			if shade < 0 {
+				shade = 0
+			}
+			g := uint8(255 * shade)
+			SetPixel(pix, col, color.RGBA{g, g, g, 255})
+		}
+	})
+	return img
+}
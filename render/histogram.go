@@ -0,0 +1,82 @@
+package render
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"github.com/goblimey/tiler/profile"
+)
+
+// barColour is the colour of the bars of a histogram.
+var barColour = color.RGBA{112, 128, 144, 255}
+
+// HistogramImage draws a bar chart, width by height pixels, of counts of
+// heights in bins of equal width running from low to high, as made by
+// esri.Stats.Histogram.  The heights are marked along the bottom and the
+// counts up the side.
+func HistogramImage(counts []int, low, high float64, width, height int) (*image.RGBA, error) {
+	if len(counts) == 0 {
+		return nil, fmt.Errorf("HistogramImage: no heights to draw")
+	}
+	most := 0
+	for _, n := range counts {
+		if n > most {
+			most = n
+		}
+	}
+	countTicks, countStep := profile.Ticks(0, float64(most), 4)
+	top := countTicks[len(countTicks)-1]
+	if high <= low {
+		high = low + 1
+	}
+	heightTicks, heightStep := profile.Ticks(low, high, 6)
+
+	// Margins for the labels.
+	const left, right, above, below = 70, 20, 10, 30
+	plotWidth := width - left - right
+	plotHeight := height - above - below
+	if plotWidth < len(counts) || plotHeight < 10 {
+		return nil, fmt.Errorf("HistogramImage: %d by %d is too small for %d bars", width, height, len(counts))
+	}
+	x := func(h float64) int { return left + int(math.Round((h-low)/(high-low)*float64(plotWidth))) }
+	y := func(n float64) int { return above + int(math.Round((top-n)/top*float64(plotHeight))) }
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+
+	for _, n := range countTicks {
+		horizontal(img, x(low), x(high), y(n), gridColour)
+		label := profile.TickLabel(n, countStep)
+		text(img, x(low)-6-textWidth(label), y(n)-glyphHeight/2, label, textColour)
+	}
+	for _, h := range heightTicks {
+		if h < low || h > high {
+			continue
+		}
+		vertical(img, x(h), y(top), y(0), gridColour)
+		label := profile.TickLabel(h, heightStep)
+		text(img, x(h)-textWidth(label)/2, y(0)+8, label, textColour)
+	}
+
+	binWidth := (high - low) / float64(len(counts))
+	for i, n := range counts {
+		if n == 0 {
+			continue
+		}
+		x0 := x(low + float64(i)*binWidth)
+		x1 := x(low+float64(i+1)*binWidth) - 1
+		if x1 < x0 {
+			x1 = x0
+		}
+		for px := x0; px <= x1; px++ {
+			vertical(img, px, y(float64(n)), y(0), barColour)
+		}
+	}
+
+	horizontal(img, x(low), x(high), y(0), textColour)
+	vertical(img, x(low), y(top), y(0), textColour)
+	return img, nil
+}
@@ -0,0 +1,37 @@
+package render
+
+import (
+	"image"
+	"image/color"
+
+	"github.com/goblimey/tiler/esri"
+	"github.com/goblimey/tiler/terrain"
+)
+
+// LandformColours gives the colour of each landform class drawn by
+// LandformImage - blues for valleys through greens to browns for ridges.
+var LandformColours = map[int]color.RGBA{
+	terrain.Valley:      {33, 102, 172, 255},
+	terrain.LowerSlope:  {103, 169, 207, 255},
+	terrain.Flat:        {230, 230, 200, 255},
+	terrain.MiddleSlope: {166, 217, 106, 255},
+	terrain.UpperSlope:  {223, 170, 100, 255},
+	terrain.Ridge:       {140, 81, 10, 255},
+}
+
+// LandformImage draws a Grid made by terrain.Landforms with one pixel per
+// cell in the colour of its class.  Cells holding the No Data value are
+// left transparent.
+func LandformImage(grid *esri.Grid) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, grid.Ncols(), grid.Nrows()))
+	Rows(grid.Nrows(), func(row int) {
+		pix := RowPix(img, row)
+		for col := 0; col < grid.Ncols(); col++ {
+			if grid.IsNoData(row, col) {
+				continue
+			}
+			SetPixel(pix, col, LandformColours[int(grid.Height(row, col))])
+		}
+	})
+	return img
+}
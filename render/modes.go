@@ -0,0 +1,45 @@
+package render
+
+import (
+	"fmt"
+	"image"
+	"strings"
+
+	"github.com/goblimey/tiler/esri"
+	"github.com/goblimey/tiler/terrain"
+)
+
+// Modes lists the modes that Derive accepts - what the tiler's -mode flag
+// can draw.
+var Modes = []string{"grey", "ruggedness", "tpi", "landform", "plan-curvature", "profile-curvature"}
+
+// Derive returns the Grid that the mode draws - the heights
+// themselves for "grey" or a Grid derived from them.  radius is the size of
+// the neighbourhood in map units for the modes that use one.
+func Derive(mode string, grid *esri.Grid, radius float64) (*esri.Grid, error) {
+	switch strings.ToLower(mode) {
+	case "", "grey":
+		return grid, nil
+	case "ruggedness":
+		return terrain.Ruggedness(grid), nil
+	case "tpi":
+		return terrain.PositionIndex(grid, radius), nil
+	case "landform":
+		return terrain.Landforms(grid, radius), nil
+	case "plan-curvature":
+		return terrain.PlanCurvature(grid), nil
+	case "profile-curvature":
+		return terrain.ProfileCurvature(grid), nil
+	}
+	return nil, fmt.Errorf("unknown mode %q - expected one of %s", mode, strings.Join(Modes, ", "))
+}
+
+// ModeImage draws a Grid made by Derive for the modes that draw classes in
+// colour rather than values in shades of grey.  It returns nil for the
+// other modes.
+func ModeImage(mode string, grid *esri.Grid) *image.RGBA {
+	if strings.ToLower(mode) == "landform" {
+		return LandformImage(grid)
+	}
+	return nil
+}
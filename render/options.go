@@ -0,0 +1,83 @@
+package render
+
+import (
+	"context"
+	"image/color"
+)
+
+// Option changes how HeightImage draws a grid, for example WithRange or
+// WithPalette.  New options can be added without changing the functions
+// that take them.
+type Option func(*config)
+
+// config is the result of applying the Options.
+type config struct {
+	ctx            context.Context
+	floor, ceiling float32
+	rangeSet       bool
+	palette        ColourRamp
+}
+
+// newConfig returns the configuration given by opts.
+func newConfig(opts []Option) *config {
+	c := &config{ctx: context.Background()}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// WithContext gives up drawing with ctx.Err() once ctx is cancelled or its
+// deadline passes.
+func WithContext(ctx context.Context) Option {
+	return func(c *config) {
+		c.ctx = ctx
+	}
+}
+
+// WithRange sets the heights drawn at either end of the palette.  Heights
+// outside the range are drawn in the colour of the nearer end.  The
+// default is from just below the lowest height of the grid to just above
+// the highest.
+func WithRange(floor, ceiling float32) Option {
+	return func(c *config) {
+		c.floor, c.ceiling = floor, ceiling
+		c.rangeSet = true
+	}
+}
+
+// WithPalette draws the heights in the colours of p.  The default is shades
+// of grey, white at the floor and black at the ceiling, as Grey gives.
+func WithPalette(p ColourRamp) Option {
+	return func(c *config) {
+		c.palette = p
+	}
+}
+
+// ColourRamp gives the colour of a height, as t, which is 0 at the floor and
+// 1 at the ceiling.
+type ColourRamp func(t float32) color.RGBA
+
+// Gradient returns a ColourRamp that blends between the given colours, spaced
+// evenly from the floor to the ceiling.
+func Gradient(stops ...color.RGBA) ColourRamp {
+	return func(t float32) color.RGBA {
+		if len(stops) == 1 || t <= 0 {
+			return stops[0]
+		}
+		if t >= 1 {
+			return stops[len(stops)-1]
+		}
+		pos := t * float32(len(stops)-1)
+		i := int(pos)
+		return blend(stops[i], stops[i+1], pos-float32(i))
+	}
+}
+
+// blend returns the colour f of the way from a to b.
+func blend(a, b color.RGBA, f float32) color.RGBA {
+	mix := func(x, y uint8) uint8 {
+		return uint8(float32(x) + (float32(y)-float32(x))*f + 0.5)
+	}
+	return color.RGBA{mix(a.R, b.R), mix(a.G, b.G), mix(a.B, b.B), mix(a.A, b.A)}
+}
@@ -0,0 +1,21 @@
+package render
+
+import (
+	"image"
+	"image/color"
+)
+
+// RowPix returns the bytes of row y of img's pixels, four to a pixel.
+// Writing to them with SetPixel avoids the bounds checks and colour
+// conversion that img.Set and img.SetRGBA make for every pixel.
+func RowPix(img *image.RGBA, y int) []byte {
+	b := img.Bounds()
+	start := img.PixOffset(b.Min.X, y)
+	return img.Pix[start : start+4*b.Dx()]
+}
+
+// SetPixel writes c into pixel x of a row given by RowPix.
+func SetPixel(pix []byte, x int, c color.RGBA) {
+	p := pix[4*x : 4*x+4 : 4*x+4]
+	p[0], p[1], p[2], p[3] = c.R, c.G, c.B, c.A
+}
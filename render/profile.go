@@ -0,0 +1,192 @@
+package render
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"github.com/goblimey/tiler/profile"
+)
+
+// MaxProfileHeight limits the height in pixels of the chart drawn by
+// ProfileImage, which a large vertical exaggeration could make huge.
+const MaxProfileHeight = 8000
+
+// The colours of the cross-section chart.
+var (
+	groundColour = color.RGBA{217, 200, 169, 255}
+	lineColour   = color.RGBA{139, 69, 19, 255}
+	gridColour   = color.RGBA{221, 221, 221, 255}
+	textColour   = color.RGBA{68, 68, 68, 255}
+)
+
+// ProfileImage draws a cross-section chart of the samples, width pixels
+// wide, with the distance along the profile across the picture and the
+// height up it, both marked in map units.  exaggeration is how many times
+// the heights are stretched compared with the distances - if it's zero, the
+// chart is a third as high as it is long, as described for
+// profile.AutoExaggeration.  The ground is shaded, with gaps where there is
+// no data.
+func ProfileImage(samples []profile.Sample, width int, exaggeration float64) (*image.RGBA, error) {
+	length, low, high, ok := profile.Extent(samples)
+	if !ok || length <= 0 {
+		return nil, fmt.Errorf("ProfileImage: no heights to draw")
+	}
+	if exaggeration <= 0 {
+		exaggeration = profile.AutoExaggeration(length, low, high)
+	}
+	heightTicks, heightStep := profile.Ticks(low, high, 5)
+	distanceTicks, distanceStep := profile.Ticks(0, length, 8)
+	bottom, top := heightTicks[0], heightTicks[len(heightTicks)-1]
+
+	// Margins for the labels.
+	const left, right, above, below = 70, 20, 10, 30
+	plotWidth := width - left - right
+	if plotWidth < 10 {
+		return nil, fmt.Errorf("ProfileImage: width %d is too small", width)
+	}
+	scale := float64(plotWidth) / length
+	plotHeight := int(math.Round((top - bottom) * scale * exaggeration))
+	if plotHeight+above+below > MaxProfileHeight {
+		return nil, fmt.Errorf("ProfileImage: exaggeration %g makes the chart %d pixels high - the limit is %d",
+			exaggeration, plotHeight+above+below, MaxProfileHeight)
+	}
+	x := func(distance float64) int { return left + int(math.Round(distance*scale)) }
+	y := func(h float64) int { return above + int(math.Round((top-h)*scale*exaggeration)) }
+
+	img := image.NewRGBA(image.Rect(0, 0, width, above+plotHeight+below))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+
+	for _, h := range heightTicks {
+		horizontal(img, x(0), x(length), y(h), gridColour)
+		label := profile.TickLabel(h, heightStep)
+		text(img, x(0)-6-textWidth(label), y(h)-glyphHeight/2, label, textColour)
+	}
+	for _, d := range distanceTicks {
+		if d > length {
+			continue
+		}
+		vertical(img, x(d), y(top), y(bottom), gridColour)
+		label := profile.TickLabel(d, distanceStep)
+		text(img, x(d)-textWidth(label)/2, y(bottom)+8, label, textColour)
+	}
+
+	// Shade under each step between samples with data, then draw the line.
+	for i := 1; i < len(samples); i++ {
+		a, b := samples[i-1], samples[i]
+		if !a.OK || !b.OK {
+			continue
+		}
+		x0, x1 := x(a.Distance), x(b.Distance)
+		for px := x0; px <= x1; px++ {
+			t := 0.0
+			if x1 > x0 {
+				t = float64(px-x0) / float64(x1-x0)
+			}
+			vertical(img, px, y(a.Height+t*(b.Height-a.Height)), y(bottom), groundColour)
+		}
+	}
+	for i := 1; i < len(samples); i++ {
+		a, b := samples[i-1], samples[i]
+		if a.OK && b.OK {
+			line(img, x(a.Distance), y(a.Height), x(b.Distance), y(b.Height), lineColour)
+		}
+	}
+
+	horizontal(img, x(0), x(length), y(top), textColour)
+	horizontal(img, x(0), x(length), y(bottom), textColour)
+	vertical(img, x(0), y(top), y(bottom), textColour)
+	vertical(img, x(length), y(top), y(bottom), textColour)
+	return img, nil
+}
+
+func horizontal(img *image.RGBA, x0, x1, y int, c color.RGBA) {
+	for x := x0; x <= x1; x++ {
+		img.SetRGBA(x, y, c)
+	}
+}
+
+func vertical(img *image.RGBA, x, y0, y1 int, c color.RGBA) {
+	for y := y0; y <= y1; y++ {
+		img.SetRGBA(x, y, c)
+	}
+}
+
+// line draws a line two pixels thick from (x0, y0) to (x1, y1).
+func line(img *image.RGBA, x0, y0, x1, y1 int, c color.RGBA) {
+	steps := x1 - x0
+	if steps < 0 {
+		steps = -steps
+	}
+	if dy := y1 - y0; dy > steps || -dy > steps {
+		steps = dy
+		if steps < 0 {
+			steps = -steps
+		}
+	}
+	if steps == 0 {
+		steps = 1
+	}
+	for i := 0; i <= steps; i++ {
+		t := float64(i) / float64(steps)
+		px := int(math.Round(float64(x0) + t*float64(x1-x0)))
+		py := int(math.Round(float64(y0) + t*float64(y1-y0)))
+		img.SetRGBA(px, py, c)
+		img.SetRGBA(px, py+1, c)
+	}
+}
+
+// glyphs are the shapes of the characters used in the chart labels, each
+// three dots wide and five high, drawn at glyphScale pixels a dot.
+var glyphs = map[rune][5]string{
+	'0': {"###", "#.#", "#.#", "#.#", "###"},
+	'1': {".#.", "##.", ".#.", ".#.", "###"},
+	'2': {"###", "..#", "###", "#..", "###"},
+	'3': {"###", "..#", "###", "..#", "###"},
+	'4': {"#.#", "#.#", "###", "..#", "..#"},
+	'5': {"###", "#..", "###", "..#", "###"},
+	'6': {"###", "#..", "###", "#.#", "###"},
+	'7': {"###", "..#", "..#", "..#", "..#"},
+	'8': {"###", "#.#", "###", "#.#", "###"},
+	'9': {"###", "#.#", "###", "..#", "###"},
+	'-': {"...", "...", "###", "...", "..."},
+	'.': {"...", "...", "...", "...", ".#."},
+}
+
+const (
+	glyphScale   = 2
+	glyphWidth   = 3 * glyphScale
+	glyphHeight  = 5 * glyphScale
+	glyphSpacing = glyphScale
+)
+
+// textWidth returns the width in pixels of s drawn by text.
+func textWidth(s string) int {
+	n := len([]rune(s))
+	if n == 0 {
+		return 0
+	}
+	return n*(glyphWidth+glyphSpacing) - glyphSpacing
+}
+
+// text draws s with its top left corner at (x, y).  Characters without a
+// glyph are left as spaces.
+func text(img *image.RGBA, x, y int, s string, c color.RGBA) {
+	for _, r := range s {
+		for row, dots := range glyphs[r] {
+			for col, dot := range dots {
+				if dot != '#' {
+					continue
+				}
+				for dy := 0; dy < glyphScale; dy++ {
+					for dx := 0; dx < glyphScale; dx++ {
+						img.SetRGBA(x+col*glyphScale+dx, y+row*glyphScale+dy, c)
+					}
+				}
+			}
+		}
+		x += glyphWidth + glyphSpacing
+	}
+}
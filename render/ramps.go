@@ -0,0 +1,155 @@
+package render
+
+import (
+	"bufio"
+	"embed"
+	"errors"
+	"fmt"
+	"image/color"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// rampFiles holds the built-in colour ramps, one file each in the form
+// that ReadRamp reads, so that the program needs no files of its own.
+//
+//go:embed ramps/*.txt
+var rampFiles embed.FS
+
+// Terrain is a ColourRamp running from green lowlands through yellow and brown
+// to white peaks.
+var Terrain = mustRamp("terrain")
+
+// rampStop is a colour at a place between the floor, 0, and the ceiling, 1.
+type rampStop struct {
+	at     float32
+	colour color.RGBA
+}
+
+// Ramps returns the names of the built-in colour ramps, in alphabetical
+// order.
+func Ramps() []string {
+	entries, err := rampFiles.ReadDir("ramps")
+	if err != nil {
+		return nil
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, strings.TrimSuffix(e.Name(), ".txt"))
+	}
+	return names
+}
+
+// Ramp returns the built-in colour ramp with the given name, one of those
+// listed by Ramps.
+func Ramp(name string) (ColourRamp, error) {
+	f, err := rampFiles.Open("ramps/" + name + ".txt")
+	if err != nil {
+		return nil, fmt.Errorf("no colour ramp %q - expected one of %s", name, strings.Join(Ramps(), ", "))
+	}
+	defer f.Close()
+	return ReadRamp(f)
+}
+
+// mustRamp returns the built-in colour ramp with the given name, which
+// must be there.
+func mustRamp(name string) ColourRamp {
+	r, err := Ramp(name)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// ReadRamp reads a ColourRamp in the percentage form of the colour files of
+// gdaldem color-relief.  Each line gives a place between the floor and the
+// ceiling and the red, green, blue and optionally alpha values of the
+// colour there, from 0 to 255:
+//
+//	0% 58 125 68
+//	100% 255 255 255
+//
+// The values can be separated by spaces, tabs, commas or colons.  Blank
+// lines, lines starting with # and the nv line for No Data are ignored - No
+// Data is always left transparent.  The colours between the places are
+// blended.
+func ReadRamp(r io.Reader) (ColourRamp, error) {
+	var stops []rampStop
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		fields := strings.FieldsFunc(line, func(c rune) bool {
+			return c == ' ' || c == '\t' || c == ',' || c == ':'
+		})
+		if strings.EqualFold(fields[0], "nv") {
+			continue
+		}
+		stop, err := parseStop(fields)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+		stops = append(stops, stop)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(stops) == 0 {
+		return nil, errors.New("no colours")
+	}
+	sort.SliceStable(stops, func(i, j int) bool { return stops[i].at < stops[j].at })
+	return stopRamp(stops), nil
+}
+
+// parseStop parses the fields of a line of a colour file.
+func parseStop(fields []string) (rampStop, error) {
+	var stop rampStop
+	if len(fields) != 4 && len(fields) != 5 {
+		return stop, fmt.Errorf("%d values - expected a percentage and 3 or 4 colour values", len(fields))
+	}
+	place := fields[0]
+	if !strings.HasSuffix(place, "%") {
+		return stop, fmt.Errorf("%q - expected a percentage such as 50%%", place)
+	}
+	p, err := strconv.ParseFloat(strings.TrimSuffix(place, "%"), 32)
+	if err != nil {
+		return stop, fmt.Errorf("%q - expected a percentage such as 50%%", place)
+	}
+	stop.at = float32(p / 100)
+	rgba := [4]uint8{0, 0, 0, 255}
+	for i, f := range fields[1:] {
+		v, err := strconv.ParseUint(f, 10, 8)
+		if err != nil {
+			return stop, fmt.Errorf("colour value %q - expected 0 to 255", f)
+		}
+		rgba[i] = uint8(v)
+	}
+	// color.RGBA holds colours multiplied by their alpha.
+	c := color.NRGBA{rgba[0], rgba[1], rgba[2], rgba[3]}
+	stop.colour = color.RGBAModel.Convert(c).(color.RGBA)
+	return stop, nil
+}
+
+// stopRamp returns a ColourRamp that blends between the given stops, which
+// are in order of place.
+func stopRamp(stops []rampStop) ColourRamp {
+	return func(t float32) color.RGBA {
+		if t <= stops[0].at {
+			return stops[0].colour
+		}
+		last := stops[len(stops)-1]
+		if t >= last.at {
+			return last.colour
+		}
+		// The first stop beyond t, which isn't the first stop.
+		i := sort.Search(len(stops), func(i int) bool { return stops[i].at > t })
+		a, b := stops[i-1], stops[i]
+		return blend(a.colour, b.colour, (t-a.at)/(b.at-a.at))
+	}
+}
@@ -0,0 +1,72 @@
+// Package render draws pictures of Grids.
+package render
+
+import (
+	"context"
+	"image"
+	"image/color"
+
+	"github.com/goblimey/tiler/esri"
+)
+
+// Grey returns the shade of grey representing height - white at the floor
+// and black at the ceiling.  Heights outside that range are clamped to it.
+func Grey(floor, ceiling, height float32) color.Gray {
+	// Get height and ceiling relative to the floor.
+	height = height - floor
+	ceiling = ceiling - floor
+	level := height * 256.0 / ceiling
+	if level < 0 {
+		level = 0
+	}
+	if level > 255 {
+		level = 255
+	}
+	return color.Gray{uint8(255 - uint8(level))}
+}
+
+// GreyImage draws a Grid with one pixel per cell in shades of grey, white at
+// the floor and black at the ceiling.  Cells holding the No Data value are
+// left transparent.
+func GreyImage(grid *esri.Grid, floor, ceiling float32) *image.RGBA {
+	img, _ := GreyImageContext(context.Background(), grid, floor, ceiling)
+	return img
+}
+
+// GreyImageContext draws a Grid like GreyImage, giving up with ctx.Err() if
+// ctx is cancelled or its deadline passes.  It's the same as HeightImage
+// with WithContext and WithRange.
+func GreyImageContext(ctx context.Context, grid *esri.Grid, floor, ceiling float32) (*image.RGBA, error) {
+	return HeightImage(grid, WithContext(ctx), WithRange(floor, ceiling))
+}
+
+// HeightImage draws a Grid with one pixel per cell, in the colours given by
+// the options, which are described with Option.  Cells holding the No
+// Data value are left transparent.
+func HeightImage(grid *esri.Grid, opts ...Option) (*image.RGBA, error) {
+	c := newConfig(opts)
+	floor, ceiling := c.floor, c.ceiling
+	if !c.rangeSet {
+		floor, ceiling = grid.MinHeight()-0.1, grid.MaxHeight()+0.1
+	}
+	img := image.NewRGBA(image.Rect(0, 0, grid.Ncols(), grid.Nrows()))
+	err := RowsContext(c.ctx, grid.Nrows(), func(row int) {
+		pix := RowPix(img, row)
+		for col := 0; col < grid.Ncols(); col++ {
+			if grid.IsNoData(row, col) {
+				continue
+			}
+			h := grid.Height(row, col)
+			if c.palette != nil {
+				SetPixel(pix, col, c.palette((h-floor)/(ceiling-floor)))
+				continue
+			}
+			g := Grey(floor, ceiling, h)
+			SetPixel(pix, col, color.RGBA{g.Y, g.Y, g.Y, 255})
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return img, nil
+}
@@ -0,0 +1,55 @@
+package render
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/goblimey/tiler/esri"
+)
+
+// Rows calls draw for each row from 0 to nrows-1, sharing the rows between
+// esri.Workers() goroutines, one for each CPU unless esri.SetWorkers says
+// otherwise.  The rows must be independent of each other -
+// draw is called for several rows at once and in no particular order.
+func Rows(nrows int, draw func(row int)) {
+	RowsContext(context.Background(), nrows, draw)
+}
+
+// RowsContext calls draw for each row like Rows, but stops taking new rows
+// once ctx is cancelled or its deadline passes, and then returns ctx.Err().
+// The rows already being drawn are finished first.
+func RowsContext(ctx context.Context, nrows int, draw func(row int)) error {
+	workers := esri.Workers()
+	if workers > nrows {
+		workers = nrows
+	}
+	if workers <= 1 {
+		for row := 0; row < nrows; row++ {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			draw(row)
+		}
+		return nil
+	}
+	// Each worker takes the next row not yet taken, so a slow row holds up
+	// only its own worker.
+	var next int64 = -1
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				row := int(atomic.AddInt64(&next, 1))
+				if row >= nrows {
+					return
+				}
+				draw(row)
+			}
+		}()
+	}
+	wg.Wait()
+	return ctx.Err()
+}
@@ -0,0 +1,58 @@
+package render
+
+import (
+	"image"
+	"image/color"
+
+	"github.com/goblimey/tiler/esri"
+)
+
+// SolarImage draws a Grid of sunlight energy, such as one made by
+// terrain.Insolation, with one pixel per cell - dark purple for the least
+// sunlight through red and orange to pale yellow for the most.  Cells
+// holding the No Data value are left transparent.
+func SolarImage(grid *esri.Grid) *image.RGBA {
+	low, high := grid.MinHeight(), grid.MaxHeight()
+	img := image.NewRGBA(image.Rect(0, 0, grid.Ncols(), grid.Nrows()))
+	Rows(grid.Nrows(), func(row int) {
+		pix := RowPix(img, row)
+		for col := 0; col < grid.Ncols(); col++ {
+			if grid.IsNoData(row, col) {
+				continue
+			}
+			t := float32(0.5)
+			if high > low {
+				t = (grid.Height(row, col) - low) / (high - low)
+			}
+			SetPixel(pix, col, sunshine(t))
+		}
+	})
+	return img
+}
+
+// sunshineStops are the colours of SolarImage, evenly spaced from the least
+// sunlight to the most.
+var sunshineStops = []color.RGBA{
+	{40, 11, 84, 255},
+	{150, 30, 90, 255},
+	{225, 80, 40, 255},
+	{250, 170, 30, 255},
+	{255, 250, 200, 255},
+}
+
+// sunshine returns the colour of SolarImage for t from 0 to 1.
+func sunshine(t float32) color.RGBA {
+	if t <= 0 {
+		return sunshineStops[0]
+	}
+	last := len(sunshineStops) - 1
+	if t >= 1 {
+		return sunshineStops[last]
+	}
+	position := t * float32(last)
+	i := int(position)
+	f := position - float32(i)
+	a, b := sunshineStops[i], sunshineStops[i+1]
+	mix := func(x, y uint8) uint8 { return uint8(float32(x) + f*(float32(y)-float32(x))) }
+	return color.RGBA{mix(a.R, b.R), mix(a.G, b.G), mix(a.B, b.B), 255}
+}
@@ -0,0 +1,32 @@
+package render
+
+import (
+	"image"
+	"image/color"
+
+	"github.com/goblimey/tiler/esri"
+	"github.com/goblimey/tiler/viewshed"
+)
+
+// ViewshedImage draws a Grid made by viewshed.Compute as an overlay with one
+// pixel per cell - translucent green where the cell can be seen and
+// translucent grey where it can't.  Cells that weren't looked at are left
+// transparent.
+func ViewshedImage(grid *esri.Grid) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, grid.Ncols(), grid.Nrows()))
+	Rows(grid.Nrows(), func(row int) {
+		pix := RowPix(img, row)
+		for col := 0; col < grid.Ncols(); col++ {
+			if grid.IsNoData(row, col) {
+				continue
+			}
+			if grid.Height(row, col) == viewshed.Visible {
+				// Premultiplied alpha.
+				SetPixel(pix, col, color.RGBA{0, 100, 0, 128})
+			} else {
+				SetPixel(pix, col, color.RGBA{32, 32, 32, 128})
+			}
+		}
+	})
+	return img
+}
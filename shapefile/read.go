@@ -0,0 +1,155 @@
+// Package shapefile reads and writes the parts of the ESRI shapefile format
+// that the tiler uses.  Only the main .shp file is involved in reading -
+// attributes in the .dbf file are ignored.  Writing produces the .shp, the
+// .shx index and a .dbf with one numeric attribute.
+//
+// As with GeoJSON, coordinates are passed through as they are, so they must
+// be in the same coordinate system as the grids they are used with.
+package shapefile
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+
+	"github.com/goblimey/tiler/geom"
+)
+
+// Shape types.
+const (
+	NullShape = 0
+	PolyLine  = 3
+	Polygon   = 5
+	PolyLineZ = 13
+	PolygonZ  = 15
+	PolyLineM = 23
+	PolygonM  = 25
+)
+
+const fileCode = 9994
+const headerLength = 100
+
+// ReadPolygonsFromFile reads a .shp file and returns the polygons that it
+// contains, one per record.  All of the rings of a record (outer boundaries
+// and holes) go into the same polygon.
+func ReadPolygonsFromFile(filename string) ([]geom.Polygon, error) {
+	in, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+
+	polygons, err := ReadPolygons(bufio.NewReader(in))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return polygons, nil
+}
+
+// ReadPolygons reads the contents of a .shp file and returns the polygons
+// that it contains, one per record.  A record longer than the rest of the
+// file, as the header gives its length, is an error.
+func ReadPolygons(r io.Reader) ([]geom.Polygon, error) {
+	header := make([]byte, headerLength)
+	_, err := io.ReadFull(r, header)
+	if err != nil {
+		return nil, fmt.Errorf("reading header - %w", err)
+	}
+	if binary.BigEndian.Uint32(header[0:4]) != fileCode {
+		return nil, fmt.Errorf("not a shapefile")
+	}
+	shapeType := binary.LittleEndian.Uint32(header[32:36])
+	switch shapeType {
+	case Polygon, PolygonZ, PolygonM:
+	default:
+		return nil, fmt.Errorf("shape type %d - expected polygons", shapeType)
+	}
+	// The file length is in 16 bit words.
+	left := int64(binary.BigEndian.Uint32(header[24:28]))*2 - headerLength
+
+	var polygons []geom.Polygon
+	recordHeader := make([]byte, 8)
+	for {
+		_, err := io.ReadFull(r, recordHeader)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading record header - %w", err)
+		}
+		recordNumber := binary.BigEndian.Uint32(recordHeader[0:4])
+		// The length is in 16 bit words.
+		length := int64(binary.BigEndian.Uint32(recordHeader[4:8])) * 2
+		left -= int64(len(recordHeader))
+		if length > left {
+			return nil, fmt.Errorf("record %d is %d bytes - more than the rest of the file", recordNumber, length)
+		}
+		left -= length
+		content := make([]byte, length)
+		_, err = io.ReadFull(r, content)
+		if err != nil {
+			return nil, fmt.Errorf("record %d - %w", recordNumber, err)
+		}
+
+		polygon, err := readPolygon(content)
+		if err != nil {
+			return nil, fmt.Errorf("record %d - %w", recordNumber, err)
+		}
+		if polygon != nil {
+			polygons = append(polygons, polygon)
+		}
+	}
+
+	if len(polygons) == 0 {
+		return nil, fmt.Errorf("no polygons found")
+	}
+	return polygons, nil
+}
+
+// readPolygon decodes the content of one record.  It returns nil for a null
+// shape.
+func readPolygon(content []byte) (geom.Polygon, error) {
+	if len(content) < 4 {
+		return nil, fmt.Errorf("record too short")
+	}
+	shapeType := binary.LittleEndian.Uint32(content[0:4])
+	if shapeType == NullShape {
+		return nil, nil
+	}
+	// Shape type, bounding box, number of parts, number of points.
+	const fixed = 4 + 32 + 4 + 4
+	if len(content) < fixed {
+		return nil, fmt.Errorf("record too short")
+	}
+	numParts := int(binary.LittleEndian.Uint32(content[36:40]))
+	numPoints := int(binary.LittleEndian.Uint32(content[40:44]))
+	if len(content) < fixed+4*numParts+16*numPoints {
+		return nil, fmt.Errorf("record too short for %d parts and %d points", numParts, numPoints)
+	}
+
+	parts := make([]int, numParts+1)
+	for i := 0; i < numParts; i++ {
+		parts[i] = int(binary.LittleEndian.Uint32(content[fixed+4*i:]))
+	}
+	parts[numParts] = numPoints
+
+	pointBase := fixed + 4*numParts
+	polygon := make(geom.Polygon, 0, numParts)
+	for i := 0; i < numParts; i++ {
+		if parts[i] > parts[i+1] || parts[i+1] > numPoints {
+			return nil, fmt.Errorf("part %d has bad start index %d", i, parts[i])
+		}
+		ring := make(geom.Ring, 0, parts[i+1]-parts[i])
+		for p := parts[i]; p < parts[i+1]; p++ {
+			offset := pointBase + 16*p
+			x := math.Float64frombits(binary.LittleEndian.Uint64(content[offset:]))
+			y := math.Float64frombits(binary.LittleEndian.Uint64(content[offset+8:]))
+			ring = append(ring, geom.Point{X: x, Y: y})
+		}
+		polygon = append(polygon, ring)
+	}
+	return polygon, nil
+}
@@ -0,0 +1,192 @@
+package shapefile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/goblimey/tiler/geom"
+)
+
+// The numeric attribute written by WritePolyLines is a dBase N field of this
+// width with this many decimal places.
+const (
+	fieldWidth    = 16
+	fieldDecimals = 3
+)
+
+// WritePolyLinesToFiles writes the lines as a PolyLine shapefile.  filename
+// names the .shp file; the .shx index and .dbf attribute files are written
+// alongside it.  Each line has a numeric attribute called field holding the
+// matching entry of values.
+func WritePolyLinesToFiles(filename string, lines []geom.Line, field string, values []float64) error {
+	base := strings.TrimSuffix(filename, filepath.Ext(filename))
+	var shp, shx, dbf bytes.Buffer
+	err := WritePolyLines(&shp, &shx, &dbf, lines, field, values)
+	if err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+	for _, f := range []struct {
+		name string
+		data []byte
+	}{{base + ".shp", shp.Bytes()}, {base + ".shx", shx.Bytes()}, {base + ".dbf", dbf.Bytes()}} {
+		err = os.WriteFile(f.name, f.data, 0644)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WritePolyLines writes the lines as the .shp, .shx and .dbf parts of a
+// PolyLine shapefile, one record per line.  Each record has a numeric
+// attribute called field, of up to ten characters, holding the matching
+// entry of values.
+func WritePolyLines(shp, shx, dbf io.Writer, lines []geom.Line, field string, values []float64) error {
+	if len(values) != len(lines) {
+		return fmt.Errorf("WritePolyLines: %d lines but %d values", len(lines), len(values))
+	}
+	if field == "" || len(field) > 10 {
+		return fmt.Errorf("WritePolyLines: field name %q must be 1 to 10 characters", field)
+	}
+
+	// Build the records first, since the header holds the file length and
+	// the overall bounding box.
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	records := make([][]byte, len(lines))
+	for i, line := range lines {
+		var x0, y0, x1, y1 float64
+		records[i], x0, y0, x1, y1 = polyLineRecord(line)
+		minX, minY = math.Min(minX, x0), math.Min(minY, y0)
+		maxX, maxY = math.Max(maxX, x1), math.Max(maxY, y1)
+	}
+	if len(lines) == 0 {
+		minX, minY, maxX, maxY = 0, 0, 0, 0
+	}
+
+	shpLength := headerLength
+	for _, r := range records {
+		shpLength += 8 + len(r)
+	}
+	_, err := shp.Write(header(shpLength, minX, minY, maxX, maxY))
+	if err != nil {
+		return err
+	}
+	_, err = shx.Write(header(headerLength+8*len(records), minX, minY, maxX, maxY))
+	if err != nil {
+		return err
+	}
+
+	offset := headerLength
+	recordHeader := make([]byte, 8)
+	for i, r := range records {
+		// Record numbers start at 1 and lengths are in 16 bit words.
+		binary.BigEndian.PutUint32(recordHeader[0:4], uint32(i+1))
+		binary.BigEndian.PutUint32(recordHeader[4:8], uint32(len(r)/2))
+		_, err = shp.Write(recordHeader)
+		if err != nil {
+			return err
+		}
+		_, err = shp.Write(r)
+		if err != nil {
+			return err
+		}
+		binary.BigEndian.PutUint32(recordHeader[0:4], uint32(offset/2))
+		_, err = shx.Write(recordHeader)
+		if err != nil {
+			return err
+		}
+		offset += 8 + len(r)
+	}
+
+	return writeDBF(dbf, field, values)
+}
+
+// header returns the 100 byte header of a .shp or .shx file of the given
+// length in bytes.
+func header(length int, minX, minY, maxX, maxY float64) []byte {
+	h := make([]byte, headerLength)
+	binary.BigEndian.PutUint32(h[0:4], fileCode)
+	binary.BigEndian.PutUint32(h[24:28], uint32(length/2))
+	binary.LittleEndian.PutUint32(h[28:32], 1000)
+	binary.LittleEndian.PutUint32(h[32:36], PolyLine)
+	for i, v := range []float64{minX, minY, maxX, maxY} {
+		binary.LittleEndian.PutUint64(h[36+8*i:], math.Float64bits(v))
+	}
+	return h
+}
+
+// polyLineRecord returns the content of a PolyLine record holding the line
+// as a single part, and the line's bounding box.
+func polyLineRecord(line geom.Line) (content []byte, minX, minY, maxX, maxY float64) {
+	minX, minY = math.Inf(1), math.Inf(1)
+	maxX, maxY = math.Inf(-1), math.Inf(-1)
+	for _, p := range line {
+		minX, minY = math.Min(minX, p.X), math.Min(minY, p.Y)
+		maxX, maxY = math.Max(maxX, p.X), math.Max(maxY, p.Y)
+	}
+	if len(line) == 0 {
+		minX, minY, maxX, maxY = 0, 0, 0, 0
+	}
+
+	// Shape type, bounding box, number of parts, number of points, the
+	// start of the one part and the points.
+	content = make([]byte, 4+32+4+4+4+16*len(line))
+	binary.LittleEndian.PutUint32(content[0:4], PolyLine)
+	for i, v := range []float64{minX, minY, maxX, maxY} {
+		binary.LittleEndian.PutUint64(content[4+8*i:], math.Float64bits(v))
+	}
+	binary.LittleEndian.PutUint32(content[36:40], 1)
+	binary.LittleEndian.PutUint32(content[40:44], uint32(len(line)))
+	binary.LittleEndian.PutUint32(content[44:48], 0)
+	for i, p := range line {
+		binary.LittleEndian.PutUint64(content[48+16*i:], math.Float64bits(p.X))
+		binary.LittleEndian.PutUint64(content[56+16*i:], math.Float64bits(p.Y))
+	}
+	return content, minX, minY, maxX, maxY
+}
+
+// dbfDate is the date of last update written into the dBase header.  It's
+// fixed rather than today's date so that the same lines always give the
+// same file.
+var dbfDate = time.Date(1970, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// writeDBF writes a dBase III attribute table with a single numeric field.
+func writeDBF(w io.Writer, field string, values []float64) error {
+	const headerSize = 32 + 32 + 1
+	h := make([]byte, headerSize)
+	h[0] = 3
+	h[1], h[2], h[3] = byte(dbfDate.Year()-1900), byte(dbfDate.Month()), byte(dbfDate.Day())
+	binary.LittleEndian.PutUint32(h[4:8], uint32(len(values)))
+	binary.LittleEndian.PutUint16(h[8:10], headerSize)
+	binary.LittleEndian.PutUint16(h[10:12], 1+fieldWidth)
+
+	// The field descriptor.
+	copy(h[32:43], strings.ToUpper(field))
+	h[43] = 'N'
+	h[48] = fieldWidth
+	h[49] = fieldDecimals
+	h[64] = 0x0D
+
+	var buf bytes.Buffer
+	buf.Write(h)
+	for _, v := range values {
+		text := fmt.Sprintf("%*.*f", fieldWidth, fieldDecimals, v)
+		if len(text) > fieldWidth {
+			return fmt.Errorf("value %f is too big for the attribute table", v)
+		}
+		// The first byte is the deletion flag.
+		buf.WriteByte(' ')
+		buf.WriteString(text)
+	}
+	buf.WriteByte(0x1A)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
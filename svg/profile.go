@@ -0,0 +1,132 @@
+package svg
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/goblimey/tiler/profile"
+)
+
+// ProfileOptions control the drawing of a cross-section.
+type ProfileOptions struct {
+	// Width is the width of the chart in millimetres - 200 if it's zero.
+	Width float64
+	// Exaggeration is how many times the heights are stretched compared
+	// with the distances.  If it's zero, the chart is a third as high as it
+	// is long, as described for profile.AutoExaggeration.
+	Exaggeration float64
+	// Title, if given, is written above the chart.
+	Title string
+}
+
+// WriteProfileToFile writes an SVG file as described for WriteProfile.
+func WriteProfileToFile(filename string, samples []profile.Sample, options ProfileOptions) error {
+	out, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	err = WriteProfile(out, samples, options)
+	if err != nil {
+		out.Close()
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+	return out.Close()
+}
+
+// WriteProfile draws a cross-section chart of the samples as an SVG
+// document, with the distance along the profile across the page and the
+// height up it, both marked in map units.  The ground is shaded, with gaps
+// where there is no data.
+func WriteProfile(w io.Writer, samples []profile.Sample, options ProfileOptions) error {
+	length, low, high, ok := profile.Extent(samples)
+	if !ok || length <= 0 {
+		return fmt.Errorf("WriteProfile: no heights to draw")
+	}
+	exaggeration := options.Exaggeration
+	if exaggeration <= 0 {
+		exaggeration = profile.AutoExaggeration(length, low, high)
+	}
+	width := options.Width
+	if width <= 0 {
+		width = 200
+	}
+	heightTicks, heightStep := profile.Ticks(low, high, 5)
+	distanceTicks, distanceStep := profile.Ticks(0, length, 8)
+	bottom, top := heightTicks[0], heightTicks[len(heightTicks)-1]
+
+	// The chart is drawn in millimetres, with margins for the labels.
+	const left, right, above, below = 18.0, 6.0, 10.0, 14.0
+	plotWidth := width - left - right
+	scale := plotWidth / length
+	plotHeight := (top - bottom) * scale * exaggeration
+	height := above + plotHeight + below
+	x := func(distance float64) float64 { return left + distance*scale }
+	y := func(h float64) float64 { return above + (top-h)*scale*exaggeration }
+
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, `<?xml version="1.0" encoding="UTF-8"?>
+<svg xmlns="http://www.w3.org/2000/svg" width="%gmm" height="%gmm" viewBox="0 0 %g %g" font-family="sans-serif" font-size="3">
+<rect width="%g" height="%g" fill="white"/>
+`, width, height, width, height, width, height)
+	if options.Title != "" {
+		fmt.Fprintf(out, "<text x=\"%g\" y=\"6\" text-anchor=\"middle\" font-size=\"4\">%s</text>\n",
+			width/2, html.EscapeString(options.Title))
+	}
+
+	// The grid lines and their labels.
+	fmt.Fprint(out, "<g stroke=\"#ddd\" stroke-width=\"0.2\">\n")
+	for _, h := range heightTicks {
+		fmt.Fprintf(out, "<line x1=\"%.3f\" y1=\"%.3f\" x2=\"%.3f\" y2=\"%.3f\"/>\n", x(0), y(h), x(length), y(h))
+	}
+	for _, d := range distanceTicks {
+		if d <= length {
+			fmt.Fprintf(out, "<line x1=\"%.3f\" y1=\"%.3f\" x2=\"%.3f\" y2=\"%.3f\"/>\n", x(d), y(bottom), x(d), y(top))
+		}
+	}
+	fmt.Fprint(out, "</g>\n<g fill=\"#444\" dominant-baseline=\"central\" text-anchor=\"end\">\n")
+	for _, h := range heightTicks {
+		fmt.Fprintf(out, "<text x=\"%.3f\" y=\"%.3f\">%s</text>\n", x(0)-1.5, y(h), profile.TickLabel(h, heightStep))
+	}
+	fmt.Fprint(out, "</g>\n<g fill=\"#444\" text-anchor=\"middle\">\n")
+	for _, d := range distanceTicks {
+		if d <= length {
+			fmt.Fprintf(out, "<text x=\"%.3f\" y=\"%.3f\">%s</text>\n", x(d), y(bottom)+5, profile.TickLabel(d, distanceStep))
+		}
+	}
+	fmt.Fprintf(out, "</g>\n<text x=\"%.3f\" y=\"%.3f\" fill=\"#444\" text-anchor=\"end\">vertical exaggeration x%.3g</text>\n",
+		x(length), height-2, exaggeration)
+
+	// The ground, one shape for each unbroken run of samples with data.
+	for start := 0; start < len(samples); {
+		if !samples[start].OK {
+			start++
+			continue
+		}
+		end := start
+		for end < len(samples) && samples[end].OK {
+			end++
+		}
+		var line strings.Builder
+		for i, s := range samples[start:end] {
+			command := "L"
+			if i == 0 {
+				command = "M"
+			}
+			fmt.Fprintf(&line, "%s%.3f %.3f", command, x(s.Distance), y(s.Height))
+		}
+		fmt.Fprintf(out, "<path fill=\"#d9c8a9\" d=\"%sL%.3f %.3fL%.3f %.3fZ\"/>\n", line.String(),
+			x(samples[end-1].Distance), y(bottom), x(samples[start].Distance), y(bottom))
+		fmt.Fprintf(out, "<path fill=\"none\" stroke=\"#8b4513\" stroke-width=\"0.4\" stroke-linejoin=\"round\" d=\"%s\"/>\n",
+			line.String())
+		start = end
+	}
+
+	fmt.Fprintf(out, "<rect x=\"%.3f\" y=\"%.3f\" width=\"%.3f\" height=\"%.3f\" fill=\"none\" stroke=\"#444\" stroke-width=\"0.3\"/>\n",
+		x(0), y(top), plotWidth, plotHeight)
+	fmt.Fprint(out, "</svg>\n")
+	return out.Flush()
+}
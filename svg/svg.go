@@ -0,0 +1,121 @@
+// Package svg draws contours as Scalable Vector Graphics for printing, or
+// for cutting or engraving layer by layer.
+package svg
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"math"
+	"os"
+
+	"github.com/goblimey/tiler/contour"
+)
+
+// Options control the drawing.
+type Options struct {
+	// Scale is the size of one map unit in the picture in millimetres.  If
+	// it's zero, the longer side of the picture is 200 mm.
+	Scale float64
+	// LabelSpacing is the distance in map units between the labels along
+	// the index contours, which are drawn thicker.  If it's zero, the index
+	// contours are not labelled.
+	LabelSpacing float64
+	// Background, if not nil, is drawn faintly under the contours.  It
+	// covers the whole area, with one pixel per grid cell.
+	Background image.Image
+}
+
+// WriteContoursToFile writes an SVG file as described for WriteContours.
+func WriteContoursToFile(filename string, contours []contour.Contour,
+	minX, minY, maxX, maxY float64, options Options) error {
+
+	out, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	err = WriteContours(out, contours, minX, minY, maxX, maxY, options)
+	if err != nil {
+		out.Close()
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+	return out.Close()
+}
+
+// WriteContours draws the contours within the area (minX, minY) to
+// (maxX, maxY), given in map coordinates, as an SVG document.  The drawing
+// keeps the map's units, so the picture can be scaled without losing
+// detail, and the strokes keep their width however it is scaled.
+func WriteContours(w io.Writer, contours []contour.Contour,
+	minX, minY, maxX, maxY float64, options Options) error {
+
+	if minX >= maxX || minY >= maxY {
+		return fmt.Errorf("WriteContours: empty area (%f,%f) (%f,%f)", minX, minY, maxX, maxY)
+	}
+	width, height := maxX-minX, maxY-minY
+	scale := options.Scale
+	if scale <= 0 {
+		scale = 200 / math.Max(width, height)
+	}
+	// Labels are a fiftieth of the shorter side.
+	fontSize := math.Min(width, height) / 50
+
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, `<?xml version="1.0" encoding="UTF-8"?>
+<svg xmlns="http://www.w3.org/2000/svg" width="%gmm" height="%gmm" viewBox="0 0 %g %g">
+`, width*scale, height*scale, width, height)
+
+	if options.Background != nil {
+		var buf bytes.Buffer
+		err := png.Encode(&buf, options.Background)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, `<image x="0" y="0" width="%g" height="%g" opacity="0.3" preserveAspectRatio="none" href="data:image/png;base64,%s"/>
+`, width, height, base64.StdEncoding.EncodeToString(buf.Bytes()))
+	}
+
+	fmt.Fprint(out, `<g fill="none" stroke="#8b4513" stroke-linejoin="round">
+`)
+	var labels []contour.Label
+	for _, c := range contours {
+		if len(c.Line) < 2 {
+			continue
+		}
+		strokeWidth := 0.5
+		if c.Index {
+			strokeWidth = 1.2
+			if options.LabelSpacing > 0 {
+				labels = append(labels, c.Labels(options.LabelSpacing, 4*fontSize)...)
+			}
+		}
+		fmt.Fprintf(out, `<path stroke-width="%g" vector-effect="non-scaling-stroke" data-elevation="%g" d="`,
+			strokeWidth, c.Level)
+		for i, p := range c.Line {
+			command := "L"
+			if i == 0 {
+				command = "M"
+			}
+			fmt.Fprintf(out, "%s%.3f %.3f", command, p.X-minX, maxY-p.Y)
+		}
+		fmt.Fprint(out, "\"/>\n")
+	}
+	fmt.Fprint(out, "</g>\n")
+
+	// The labels are turned to follow the contours, with a white halo so that
+	// they can be read over the lines.
+	fmt.Fprintf(out, `<g font-family="sans-serif" font-size="%g" fill="#8b4513" text-anchor="middle" dominant-baseline="central" stroke="white" stroke-width="%g" paint-order="stroke">
+`, fontSize, fontSize/5)
+	for _, label := range labels {
+		x, y := label.Point.X-minX, maxY-label.Point.Y
+		// SVG angles are clockwise since y is down the page.
+		fmt.Fprintf(out, `<text x="%.3f" y="%.3f" transform="rotate(%.1f %.3f %.3f)">%s</text>
+`, x, y, -label.Angle, x, y, label.Text)
+	}
+	fmt.Fprint(out, "</g>\n</svg>\n")
+	return out.Flush()
+}
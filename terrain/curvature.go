@@ -0,0 +1,59 @@
+package terrain
+
+import "github.com/goblimey/tiler/esri"
+
+// ProfileCurvature returns a Grid covering the same area as g that gives
+// the curvature of the ground along the direction of steepest slope at each
+// cell, in units of one over the map units.  Positive values are convex,
+// where the slope steepens downhill and water speeds up, such as the
+// shoulder of a hill.  Negative values are concave, where the slope eases
+// and water slows down, such as the foot of a hill.  Cells holding the No
+// Data value are No Data in the result, and flat cells are zero.
+func ProfileCurvature(g *esri.Grid) *esri.Grid {
+	return curvature(g, func(d, e, f, gx, hy float64) float64 {
+		return -2 * (d*gx*gx + e*hy*hy + f*gx*hy) / (gx*gx + hy*hy)
+	})
+}
+
+// PlanCurvature returns a Grid covering the same area as g that gives the
+// curvature of the ground across the direction of steepest slope at each
+// cell - the curvature of the contours - in units of one over the map units.
+// Positive values are convex, such as spurs, where water spreads out.
+// Negative values are concave, such as hollows and gullies, where it
+// gathers.  Cells holding the No Data value are No Data in the result, and
+// flat cells are zero.
+func PlanCurvature(g *esri.Grid) *esri.Grid {
+	return curvature(g, func(d, e, f, gx, hy float64) float64 {
+		return -2 * (d*hy*hy + e*gx*gx - f*gx*hy) / (gx*gx + hy*hy)
+	})
+}
+
+// curvature fits the surface of Zevenbergen and Thorne (1987) to the three
+// by three block of cells around each cell and returns a Grid of the values
+// that f gives from its coefficients - d and e are half the second
+// derivatives eastwards and northwards, f the mixed second derivative, and
+// gx and hy the first derivatives eastwards and northwards.
+func curvature(g *esri.Grid, f func(d, e, f, gx, hy float64) float64) *esri.Grid {
+	result := like(g)
+	l := float64(g.CellSize())
+	for row := 0; row < g.Nrows(); row++ {
+		for col := 0; col < g.Ncols(); col++ {
+			if g.IsNoData(row, col) {
+				result.SetHeight(row, col, float32(result.NoDataValue()))
+				continue
+			}
+			z := window(g, row, col)
+			d := ((z[1][0]+z[1][2])/2 - z[1][1]) / (l * l)
+			e := ((z[0][1]+z[2][1])/2 - z[1][1]) / (l * l)
+			fxy := (-z[0][0] + z[0][2] + z[2][0] - z[2][2]) / (4 * l * l)
+			gx := (z[1][2] - z[1][0]) / (2 * l)
+			hy := (z[0][1] - z[2][1]) / (2 * l)
+			if gx == 0 && hy == 0 {
+				result.SetHeight(row, col, 0)
+				continue
+			}
+			result.SetHeight(row, col, float32(f(d, e, fxy, gx, hy)))
+		}
+	}
+	return result
+}
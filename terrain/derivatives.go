@@ -0,0 +1,33 @@
+package terrain
+
+import "github.com/goblimey/tiler/esri"
+
+// window returns the heights of the three by three block of cells centred
+// on (row, col), indexed [row][col].  Missing cells, off the edge or holding
+// the No Data value, take the height of the centre cell.
+func window(g *esri.Grid, row, col int) (z [3][3]float64) {
+	centre := float64(g.Height(row, col))
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			r, c := row+i-1, col+j-1
+			if r < 0 || r >= g.Nrows() || c < 0 || c >= g.Ncols() || g.IsNoData(r, c) {
+				z[i][j] = centre
+			} else {
+				z[i][j] = float64(g.Height(r, c))
+			}
+		}
+	}
+	return z
+}
+
+// Gradient returns the rate of change of height eastwards and northwards at
+// cell (row, col) using Horn's method.  Missing neighbours take the height
+// of the cell itself.
+func Gradient(g *esri.Grid, row, col int) (dzdx, dzdy float64) {
+	z := window(g, row, col)
+	cellsize := float64(g.CellSize())
+	dzdx = ((z[0][2] + 2*z[1][2] + z[2][2]) - (z[0][0] + 2*z[1][0] + z[2][0])) / (8 * cellsize)
+	// Rows run southwards.
+	dzdy = ((z[0][0] + 2*z[0][1] + z[0][2]) - (z[2][0] + 2*z[2][1] + z[2][2])) / (8 * cellsize)
+	return dzdx, dzdy
+}
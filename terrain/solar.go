@@ -0,0 +1,229 @@
+package terrain
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/goblimey/tiler/esri"
+)
+
+// solarConstant is the power of the sunlight reaching the top of the
+// atmosphere at the Earth's mean distance from the Sun, in watts per square
+// metre.
+const solarConstant = 1367
+
+// SolarOptions control Insolation.
+type SolarOptions struct {
+	// Latitude is the latitude of the area in degrees, north positive.
+	Latitude float64
+	// Day is the first day of the period, counting 1 January as 1.
+	Day int
+	// Days is the length of the period in days - 1 if it's zero.
+	Days int
+	// Step is the time between the positions of the sun used, in minutes -
+	// 30 if it's zero.
+	Step float64
+	// Transmittance is the fraction of the sunlight that passes straight
+	// through the atmosphere when the sun is overhead - 0.7, a clear day,
+	// if it's zero.
+	Transmittance float64
+	// HorizonDistance is how far in map units to look for hills that hide
+	// the sun.  If it's zero, only the slope of the ground itself shades
+	// it.
+	HorizonDistance float64
+}
+
+// horizonSectors is the number of directions in which the horizon is found.
+const horizonSectors = 16
+
+// Insolation returns a Grid covering the same area as g that gives the
+// energy of the sunlight falling on each cell over the period described by
+// options, in kilowatt hours per square metre of ground, for a clear sky.
+// It allows for the slope and aspect of the ground, the height of the sun
+// through the day and, if options.HorizonDistance is given, the shadows of
+// hills.  The heights and the cell size must be in metres, as on the
+// National Grid.  Cells holding the No Data value are No Data in the
+// result.
+func Insolation(g *esri.Grid, options SolarOptions) (*esri.Grid, error) {
+	if options.Latitude < -90 || options.Latitude > 90 {
+		return nil, fmt.Errorf("Insolation: latitude %g is out of range", options.Latitude)
+	}
+	if options.Day < 1 || options.Day > 366 {
+		return nil, fmt.Errorf("Insolation: day %d is out of range 1 to 366", options.Day)
+	}
+	if options.Days <= 0 {
+		options.Days = 1
+	}
+	if options.Step <= 0 {
+		options.Step = 30
+	}
+	if options.Transmittance <= 0 {
+		options.Transmittance = 0.7
+	}
+	if options.Transmittance > 1 {
+		return nil, fmt.Errorf("Insolation: transmittance %g is more than 1", options.Transmittance)
+	}
+
+	// The slope and aspect of each cell.
+	nrows, ncols := g.Nrows(), g.Ncols()
+	data := make([]bool, nrows*ncols)
+	sinSlope := make([]float64, nrows*ncols)
+	cosSlope := make([]float64, nrows*ncols)
+	aspect := make([]float64, nrows*ncols)
+	for row := 0; row < nrows; row++ {
+		for col := 0; col < ncols; col++ {
+			if g.IsNoData(row, col) {
+				continue
+			}
+			dzdx, dzdy := Gradient(g, row, col)
+			slope := math.Atan(math.Hypot(dzdx, dzdy))
+			i := row*ncols + col
+			data[i] = true
+			sinSlope[i], cosSlope[i] = math.Sincos(slope)
+			// The direction the ground faces, downhill, clockwise from
+			// north.
+			aspect[i] = math.Atan2(-dzdx, -dzdy)
+		}
+	}
+	var horizon [][horizonSectors]float32
+	if options.HorizonDistance > 0 {
+		horizon = horizons(g, options.HorizonDistance)
+	}
+
+	energy := make([]float64, nrows*ncols)
+	phi := options.Latitude * math.Pi / 180
+	hours := options.Step / 60
+	for day := options.Day; day < options.Day+options.Days; day++ {
+		n := float64((day-1)%365 + 1)
+		declination := 23.45 * math.Pi / 180 * math.Sin(2*math.Pi*(284+n)/365)
+		// The sunlight above the atmosphere, allowing for the Earth's
+		// elliptical orbit.
+		above := solarConstant * (1 + 0.033*math.Cos(2*math.Pi*n/365))
+
+		// Step through the day by the hour angle, from midnight to
+		// midnight in solar time.
+		stepAngle := 2 * math.Pi * options.Step / (24 * 60)
+		for omega := -math.Pi + stepAngle/2; omega < math.Pi; omega += stepAngle {
+			sinAltitude := math.Sin(phi)*math.Sin(declination) +
+				math.Cos(phi)*math.Cos(declination)*math.Cos(omega)
+			if sinAltitude <= 0 {
+				continue
+			}
+			altitude := math.Asin(sinAltitude)
+			azimuth := sunAzimuth(phi, declination, omega, altitude)
+			tanAltitude := math.Tan(altitude)
+			sector := int(math.Round(azimuth/(2*math.Pi)*horizonSectors)) % horizonSectors
+
+			// Beam sunlight on a surface facing the sun, from a simple
+			// model of the air mass, and diffuse light from the sky on
+			// level ground (Liu and Jordan).
+			beamTransmitted := math.Pow(options.Transmittance, 1/sinAltitude)
+			beam := above * beamTransmitted
+			diffuse := above * sinAltitude * (0.271 - 0.294*beamTransmitted)
+			if diffuse < 0 {
+				diffuse = 0
+			}
+			cosAltitude := math.Cos(altitude)
+
+			for i := range energy {
+				if !data[i] {
+					continue
+				}
+				// Diffuse light from the part of the sky the slope faces.
+				watts := diffuse * (1 + cosSlope[i]) / 2
+				shaded := horizon != nil && float64(horizon[i][sector]) >= tanAltitude
+				if !shaded {
+					cosIncidence := cosSlope[i]*sinAltitude +
+						sinSlope[i]*cosAltitude*math.Cos(azimuth-aspect[i])
+					if cosIncidence > 0 {
+						watts += beam * cosIncidence
+					}
+				}
+				energy[i] += watts * hours
+			}
+		}
+	}
+
+	result := like(g)
+	if result.NoDataValue() >= 0 {
+		result.SetNoDataValue(-9999)
+	}
+	noData := float32(result.NoDataValue())
+	for row := 0; row < nrows; row++ {
+		for col := 0; col < ncols; col++ {
+			if g.IsNoData(row, col) {
+				result.SetHeight(row, col, noData)
+				continue
+			}
+			// Watt hours to kilowatt hours.
+			result.SetHeight(row, col, float32(energy[row*ncols+col]/1000))
+		}
+	}
+	return result, nil
+}
+
+// sunAzimuth returns the direction of the sun clockwise from north, in
+// radians, at latitude phi with the given declination, hour angle and
+// altitude.
+func sunAzimuth(phi, declination, omega, altitude float64) float64 {
+	denominator := math.Cos(altitude) * math.Cos(phi)
+	if denominator == 0 {
+		// At a pole or with the sun overhead, the azimuth is arbitrary.
+		return math.Pi
+	}
+	c := (math.Sin(declination) - math.Sin(altitude)*math.Sin(phi)) / denominator
+	if c > 1 {
+		c = 1
+	}
+	if c < -1 {
+		c = -1
+	}
+	azimuth := math.Acos(c)
+	if omega > 0 {
+		// Afternoon, with the sun in the west.
+		azimuth = 2*math.Pi - azimuth
+	}
+	return azimuth
+}
+
+// horizons returns, for each cell of g in row order, the tangent of the
+// angle up to the highest ground within maxDistance in each of
+// horizonSectors directions clockwise from north, or zero if nothing rises
+// above the cell.  The search takes longer steps further out, since distant
+// hills need to be bigger to matter.
+func horizons(g *esri.Grid, maxDistance float64) [][horizonSectors]float32 {
+	nrows, ncols := g.Nrows(), g.Ncols()
+	cellsize := float64(g.CellSize())
+	result := make([][horizonSectors]float32, nrows*ncols)
+	var east, north [horizonSectors]float64
+	for s := range east {
+		north[s], east[s] = math.Sincos(math.Pi/2 - 2*math.Pi*float64(s)/horizonSectors)
+	}
+	for row := 0; row < nrows; row++ {
+		for col := 0; col < ncols; col++ {
+			if g.IsNoData(row, col) {
+				continue
+			}
+			h := float64(g.Height(row, col))
+			for s := 0; s < horizonSectors; s++ {
+				highest := 0.0
+				for d := cellsize; d <= maxDistance; d += math.Max(cellsize, d*0.1) {
+					c := col + int(math.Round(d*east[s]/cellsize))
+					r := row - int(math.Round(d*north[s]/cellsize))
+					if r < 0 || r >= nrows || c < 0 || c >= ncols {
+						break
+					}
+					if g.IsNoData(r, c) {
+						continue
+					}
+					tangent := (float64(g.Height(r, c)) - h) / d
+					if tangent > highest {
+						highest = tangent
+					}
+				}
+				result[row*ncols+col][s] = float32(highest)
+			}
+		}
+	}
+	return result
+}
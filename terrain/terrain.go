@@ -0,0 +1,61 @@
+// Package terrain derives Grids describing the shape of the ground, such as
+// how rugged it is, from a Grid of heights.
+package terrain
+
+import (
+	"math"
+
+	"github.com/goblimey/tiler/esri"
+)
+
+// neighbours gives the row and column offsets of the eight cells around a
+// cell.
+var neighbours = [][2]int{
+	{-1, -1}, {-1, 0}, {-1, 1}, {0, -1}, {0, 1}, {1, -1}, {1, 0}, {1, 1},
+}
+
+// Ruggedness returns a Grid covering the same area as g that gives the
+// Terrain Ruggedness Index of each cell (Riley, DeGloria and Elliot, 1999) -
+// the square root of the sum of the squared differences in height between
+// the cell and its eight neighbours.  Flat ground scores zero.  Where
+// neighbours are missing, off the edge or holding the No Data value, the sum
+// is scaled up to allow for them.  Cells holding the No Data value are No
+// Data in the result.
+func Ruggedness(g *esri.Grid) *esri.Grid {
+	result := like(g)
+	for row := 0; row < g.Nrows(); row++ {
+		for col := 0; col < g.Ncols(); col++ {
+			if g.IsNoData(row, col) {
+				result.SetHeight(row, col, float32(result.NoDataValue()))
+				continue
+			}
+			h := float64(g.Height(row, col))
+			sum, n := 0.0, 0
+			for _, d := range neighbours {
+				r, c := row+d[0], col+d[1]
+				if r < 0 || r >= g.Nrows() || c < 0 || c >= g.Ncols() || g.IsNoData(r, c) {
+					continue
+				}
+				diff := float64(g.Height(r, c)) - h
+				sum += diff * diff
+				n++
+			}
+			if n > 0 {
+				sum *= float64(len(neighbours)) / float64(n)
+			}
+			result.SetHeight(row, col, float32(math.Sqrt(sum)))
+		}
+	}
+	return result
+}
+
+// like returns an empty Grid covering the same area as g with the same No
+// Data value.
+func like(g *esri.Grid) *esri.Grid {
+	result := esri.NewGrid(g.Ncols(), g.Nrows())
+	result.SetXllcorner(g.Xllcorner())
+	result.SetYllcorner(g.Yllcorner())
+	result.SetCellSize(g.CellSize())
+	result.SetNoDataValue(g.NoDataValue())
+	return result
+}
@@ -0,0 +1,159 @@
+package terrain
+
+import (
+	"math"
+
+	"github.com/goblimey/tiler/esri"
+)
+
+// The landform classes given by Landforms, after Weiss (2001).
+const (
+	Valley      = 1
+	LowerSlope  = 2
+	Flat        = 3
+	MiddleSlope = 4
+	UpperSlope  = 5
+	Ridge       = 6
+)
+
+// LandformNames gives the name of each landform class.
+var LandformNames = map[int]string{
+	Valley:      "valley",
+	LowerSlope:  "lower slope",
+	Flat:        "flat",
+	MiddleSlope: "middle slope",
+	UpperSlope:  "upper slope",
+	Ridge:       "ridge",
+}
+
+// flatSlope is the steepest slope in degrees that Landforms counts as flat.
+const flatSlope = 5
+
+// PositionIndex returns a Grid covering the same area as g that gives the
+// Topographic Position Index of each cell - its height less the mean height
+// of the cells within radius map units of it, in a square.  Positive values
+// are higher than their surroundings, such as ridges, and negative values
+// lower, such as valleys.  Cells holding the No Data value are left out of
+// the means, and are No Data in the result.
+func PositionIndex(g *esri.Grid, radius float64) *esri.Grid {
+	nrows, ncols := g.Nrows(), g.Ncols()
+	r := int(math.Round(radius / float64(g.CellSize())))
+	if r < 1 {
+		r = 1
+	}
+
+	// Summed area tables of the heights and of the number of cells with
+	// data, with an extra row and column of zeros at the top and left, so
+	// that the sum over any block takes four lookups.
+	sums := make([][]float64, nrows+1)
+	counts := make([][]int, nrows+1)
+	sums[0] = make([]float64, ncols+1)
+	counts[0] = make([]int, ncols+1)
+	for row := 0; row < nrows; row++ {
+		sums[row+1] = make([]float64, ncols+1)
+		counts[row+1] = make([]int, ncols+1)
+		for col := 0; col < ncols; col++ {
+			s, n := 0.0, 0
+			if !g.IsNoData(row, col) {
+				s, n = float64(g.Height(row, col)), 1
+			}
+			sums[row+1][col+1] = s + sums[row][col+1] + sums[row+1][col] - sums[row][col]
+			counts[row+1][col+1] = n + counts[row][col+1] + counts[row+1][col] - counts[row][col]
+		}
+	}
+
+	result := like(g)
+	for row := 0; row < nrows; row++ {
+		top, bottom := clamp(row-r, nrows), clamp(row+r+1, nrows)
+		for col := 0; col < ncols; col++ {
+			if g.IsNoData(row, col) {
+				result.SetHeight(row, col, float32(result.NoDataValue()))
+				continue
+			}
+			left, right := clamp(col-r, ncols), clamp(col+r+1, ncols)
+			h := float64(g.Height(row, col))
+			// Leave the cell itself out of its surroundings.
+			s := sums[bottom][right] - sums[top][right] - sums[bottom][left] + sums[top][left] - h
+			n := counts[bottom][right] - counts[top][right] - counts[bottom][left] + counts[top][left] - 1
+			if n == 0 {
+				result.SetHeight(row, col, 0)
+				continue
+			}
+			result.SetHeight(row, col, float32(h-s/float64(n)))
+		}
+	}
+	return result
+}
+
+// clamp limits i to the range 0 to n.
+func clamp(i, n int) int {
+	if i < 0 {
+		return 0
+	}
+	if i > n {
+		return n
+	}
+	return i
+}
+
+// Landforms returns a Grid covering the same area as g that classifies each
+// cell as one of the landforms Valley to Ridge, using its Topographic
+// Position Index over radius map units measured in standard deviations of
+// the index over the whole Grid, and its slope to tell flat ground from the
+// middle of slopes.  Cells holding the No Data value are No Data in the
+// result.
+func Landforms(g *esri.Grid, radius float64) *esri.Grid {
+	tpi := PositionIndex(g, radius)
+	sum, sumSquares, n := 0.0, 0.0, 0
+	for row := 0; row < tpi.Nrows(); row++ {
+		for col := 0; col < tpi.Ncols(); col++ {
+			if tpi.IsNoData(row, col) {
+				continue
+			}
+			v := float64(tpi.Height(row, col))
+			sum += v
+			sumSquares += v * v
+			n++
+		}
+	}
+	sd := 0.0
+	if n > 0 {
+		mean := sum / float64(n)
+		sd = math.Sqrt(math.Max(0, sumSquares/float64(n)-mean*mean))
+	}
+
+	result := like(g)
+	if result.NoDataValue() >= Valley && result.NoDataValue() <= Ridge {
+		result.SetNoDataValue(-9999)
+	}
+	for row := 0; row < g.Nrows(); row++ {
+		for col := 0; col < g.Ncols(); col++ {
+			if g.IsNoData(row, col) {
+				result.SetHeight(row, col, float32(result.NoDataValue()))
+				continue
+			}
+			v := 0.0
+			if sd > 0 {
+				v = float64(tpi.Height(row, col)) / sd
+			}
+			class := MiddleSlope
+			switch {
+			case v > 1:
+				class = Ridge
+			case v > 0.5:
+				class = UpperSlope
+			case v < -1:
+				class = Valley
+			case v < -0.5:
+				class = LowerSlope
+			default:
+				dzdx, dzdy := Gradient(g, row, col)
+				if math.Atan(math.Hypot(dzdx, dzdy))*180/math.Pi <= flatSlope {
+					class = Flat
+				}
+			}
+			result.SetHeight(row, col, float32(class))
+		}
+	}
+	return result
+}
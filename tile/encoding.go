@@ -0,0 +1,60 @@
+package tile
+
+import (
+	"image/color"
+	"math"
+)
+
+// Heights can be packed into the red, green and blue channels of a PNG so
+// that a web map can recover them.  Two encodings are in common use, both
+// understood by MapLibre GL as raster-dem sources.
+
+// EncodeMapbox packs a height in metres into a pixel using the Mapbox
+// Terrain-RGB encoding - height = -10000 + (R*65536 + G*256 + B) * 0.1.
+func EncodeMapbox(height float64) color.RGBA {
+	v := math.Round((height + 10000) * 10)
+	if v < 0 {
+		v = 0
+	}
+	if v > 0xffffff {
+		v = 0xffffff
+	}
+	n := uint32(v)
+	return color.RGBA{uint8(n >> 16), uint8(n >> 8), uint8(n), 255}
+}
+
+// DecodeMapbox recovers the height from a Terrain-RGB pixel.
+func DecodeMapbox(c color.RGBA) float64 {
+	return -10000 + float64(uint32(c.R)<<16|uint32(c.G)<<8|uint32(c.B))*0.1
+}
+
+// EncodeTerrarium packs a height in metres into a pixel using the Terrarium
+// encoding - height = R*256 + G + B/256 - 32768.
+func EncodeTerrarium(height float64) color.RGBA {
+	v := height + 32768
+	if v < 0 {
+		v = 0
+	}
+	if v >= 65536 {
+		v = 65536 - 1.0/256
+	}
+	whole := math.Floor(v)
+	n := uint32(whole)
+	return color.RGBA{uint8(n >> 8), uint8(n), uint8((v - whole) * 256), 255}
+}
+
+// DecodeTerrarium recovers the height from a Terrarium pixel.
+func DecodeTerrarium(c color.RGBA) float64 {
+	return float64(c.R)*256 + float64(c.G) + float64(c.B)/256 - 32768
+}
+
+// ZoomForResolution returns the lowest zoom level at which a pixel is no
+// larger than res Web Mercator metres.
+func ZoomForResolution(res float64) int {
+	for z := 0; z < MaxZoom; z++ {
+		if Resolution(z) <= res {
+			return z
+		}
+	}
+	return MaxZoom
+}
@@ -0,0 +1,151 @@
+package tile
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/goblimey/tiler/crs"
+	"github.com/goblimey/tiler/esri"
+	"github.com/goblimey/tiler/render"
+)
+
+// Renderer draws z/x/y tiles, and other areas, from the heights in a
+// TileSet in shades of grey, white at Floor and black at Ceiling.  It's
+// what the tiler's tile and serve commands draw with.
+type Renderer struct {
+	TileSet *esri.TileSet
+	// CRS is the coordinate reference system of the grids.
+	CRS     crs.CRS
+	Floor   float32
+	Ceiling float32
+	// The area covered by the TileSet in Web Mercator metres.
+	minX, minY, maxX, maxY float64
+}
+
+// NewRenderer is a factory method that creates a Renderer for the TileSet
+// ts, whose grids are in the coordinate reference system c.  The floor and
+// ceiling are set just below the lowest height and just above the highest.
+func NewRenderer(ts *esri.TileSet, c crs.CRS) *Renderer {
+	r := Renderer{TileSet: ts, CRS: c}
+	r.Floor = ts.MinHeight() - 0.1
+	r.Ceiling = ts.MaxHeight() + 0.1
+	r.minX, r.minY, r.maxX, r.maxY = MercatorBounds(ts, c)
+	return &r
+}
+
+// Bounds returns the area covered by the TileSet in Web Mercator metres.
+func (r *Renderer) Bounds() (minX, minY, maxX, maxY float64) {
+	return r.minX, r.minY, r.maxX, r.maxY
+}
+
+// WGS84Bounds returns the area covered by the TileSet as longitudes and
+// latitudes.
+func (r *Renderer) WGS84Bounds() (west, south, east, north float64) {
+	mercator := crs.WebMercator{}
+	west, south = mercator.ToWGS84(r.minX, r.minY)
+	east, north = mercator.ToWGS84(r.maxX, r.maxY)
+	return west, south, east, north
+}
+
+// Tile draws tile (z, x, y).  A tile that doesn't overlap the TileSet is
+// transparent.  It gives up with ctx.Err() if ctx is cancelled.
+func (r *Renderer) Tile(ctx context.Context, z, x, y int) (*image.RGBA, error) {
+	if !r.Covers(z, x, y) {
+		return image.NewRGBA(image.Rect(0, 0, Size, Size)), nil
+	}
+	minX, minY, maxX, maxY := Bounds(z, x, y)
+	return r.Area(ctx, crs.WebMercator{}, minX, minY, maxX, maxY, Size, Size)
+}
+
+// Area draws the area (minX, minY) to (maxX, maxY), given in the
+// coordinate reference system c, as a picture width by height pixels.
+// Pixels with no data are transparent.
+func (r *Renderer) Area(ctx context.Context, c crs.CRS, minX, minY, maxX, maxY float64, width, height int) (*image.RGBA, error) {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	err := r.Sample(ctx, c, minX, minY, maxX, maxY, width, height, func(px, py int, h float32) {
+		g := render.Grey(r.Floor, r.Ceiling, h)
+		img.SetRGBA(px, py, color.RGBA{g.Y, g.Y, g.Y, 255})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+// Sample divides the area (minX, minY) to (maxX, maxY), given in the
+// coordinate reference system c, into width by height pixels and calls f
+// with the height at the centre of each pixel that has data.  It gives up
+// with ctx.Err() if ctx is cancelled.
+func (r *Renderer) Sample(ctx context.Context, c crs.CRS, minX, minY, maxX, maxY float64, width, height int,
+	f func(px, py int, height float32)) error {
+
+	xRes := (maxX - minX) / float64(width)
+	yRes := (maxY - minY) / float64(height)
+	sameCRS := c.Code() == r.CRS.Code()
+	for py := 0; py < height; py++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		y := maxY - (float64(py)+0.5)*yRes
+		for px := 0; px < width; px++ {
+			x := minX + (float64(px)+0.5)*xRes
+			gx, gy := x, y
+			if !sameCRS {
+				gx, gy = r.CRS.FromWGS84(c.ToWGS84(x, y))
+			}
+			h, ok := r.TileSet.HeightAt(gx, gy)
+			if ok {
+				f(px, py, h)
+			}
+		}
+	}
+	return nil
+}
+
+// Covers returns true if tile (z, x, y) overlaps the TileSet.
+func (r *Renderer) Covers(z, x, y int) bool {
+	minX, minY, maxX, maxY := Bounds(z, x, y)
+	return maxX >= r.minX && minX <= r.maxX && maxY >= r.minY && minY <= r.maxY
+}
+
+// NativeZoom returns the zoom level at which a tile pixel is about the size
+// of the smallest grid cell.
+func (r *Renderer) NativeZoom() int {
+	cellsize := math.Inf(1)
+	for _, g := range r.TileSet.Grids() {
+		cellsize = math.Min(cellsize, float64(g.CellSize()))
+	}
+	if r.CRS.Code() == "EPSG:4326" {
+		// Degrees to metres at the equator.
+		cellsize *= 2 * crs.MercatorExtent / 360
+	}
+	return ZoomForResolution(cellsize)
+}
+
+// MercatorBounds returns the area covered by a TileSet, whose grids are in
+// the coordinate reference system c, in Web Mercator metres.  The edges are
+// sampled because they are not straight lines after reprojection.
+func MercatorBounds(ts *esri.TileSet, c crs.CRS) (minX, minY, maxX, maxY float64) {
+	x0, y0, x1, y1 := ts.Bounds()
+	minX, minY = math.Inf(1), math.Inf(1)
+	maxX, maxY = math.Inf(-1), math.Inf(-1)
+	const steps = 16
+	mercator := crs.WebMercator{}
+	for i := 0; i <= steps; i++ {
+		for j := 0; j <= steps; j++ {
+			if i != 0 && i != steps && j != 0 && j != steps {
+				continue
+			}
+			x := x0 + (x1-x0)*float64(i)/steps
+			y := y0 + (y1-y0)*float64(j)/steps
+			mx, my := mercator.FromWGS84(c.ToWGS84(x, y))
+			minX = math.Min(minX, mx)
+			minY = math.Min(minY, my)
+			maxX = math.Max(maxX, mx)
+			maxY = math.Max(maxY, my)
+		}
+	}
+	return minX, minY, maxX, maxY
+}
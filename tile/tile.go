@@ -0,0 +1,61 @@
+// Package tile handles the z/x/y tiling scheme used by web maps: the world is
+// projected with Web Mercator and, at zoom level z, divided into 2^z by 2^z
+// square tiles numbered from the top left.
+package tile
+
+import (
+	"math"
+
+	"github.com/goblimey/tiler/crs"
+)
+
+// Size is the width and height of a tile in pixels.
+const Size = 256
+
+// MaxZoom is the highest zoom level that will be served.
+const MaxZoom = 24
+
+// Valid returns true if (z, x, y) names a tile that exists.
+func Valid(z, x, y int) bool {
+	if z < 0 || z > MaxZoom {
+		return false
+	}
+	n := 1 << uint(z)
+	return x >= 0 && x < n && y >= 0 && y < n
+}
+
+// Bounds returns the extent of tile (z, x, y) in Web Mercator metres.
+func Bounds(z, x, y int) (minX, minY, maxX, maxY float64) {
+	size := 2 * crs.MercatorExtent / float64(int(1)<<uint(z))
+	minX = -crs.MercatorExtent + float64(x)*size
+	maxX = minX + size
+	maxY = crs.MercatorExtent - float64(y)*size
+	minY = maxY - size
+	return minX, minY, maxX, maxY
+}
+
+// Resolution returns the size of a pixel in Web Mercator metres at zoom z.
+func Resolution(z int) float64 {
+	return 2 * crs.MercatorExtent / float64(Size*(int(1)<<uint(z)))
+}
+
+// Containing returns the tile at zoom z that contains the given longitude and
+// latitude.
+func Containing(z int, lon, lat float64) (x, y int) {
+	mx, my := crs.WebMercator{}.FromWGS84(lon, lat)
+	n := float64(int(1) << uint(z))
+	x = int(math.Floor((mx + crs.MercatorExtent) / (2 * crs.MercatorExtent) * n))
+	y = int(math.Floor((crs.MercatorExtent - my) / (2 * crs.MercatorExtent) * n))
+	max := int(n) - 1
+	if x < 0 {
+		x = 0
+	} else if x > max {
+		x = max
+	}
+	if y < 0 {
+		y = 0
+	} else if y > max {
+		y = max
+	}
+	return x, y
+}
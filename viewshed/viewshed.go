@@ -0,0 +1,126 @@
+// Package viewshed works out which parts of a Grid can be seen from a point.
+package viewshed
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/goblimey/tiler/esri"
+)
+
+// Visible and Hidden are the values in the Grid returned by Compute.  Cells
+// that were not looked at hold the No Data value.
+const (
+	Visible = 1
+	Hidden  = 0
+)
+
+// Options control the viewshed.
+type Options struct {
+	// ObserverHeight is the height of the observer's eye above the ground.
+	ObserverHeight float64
+	// TargetHeight is the height above the ground of the things being looked
+	// for - zero for the ground itself.
+	TargetHeight float64
+	// Radius is the furthest distance looked at, in map units.  If it's zero,
+	// the whole Grid is looked at.
+	Radius float64
+}
+
+// Compute returns a Grid covering the same area as g that marks the cells
+// which can be seen from the map position (x, y).  A line of sight is traced
+// from the observer to each cell on the edge of the area, and the cells that
+// it crosses are visible if nothing nearer on the line rises above the line
+// to them.  Cells holding the No Data value don't block the view and are
+// left as No Data, as are the cells beyond the radius.
+func Compute(g *esri.Grid, x, y float64, options Options) (*esri.Grid, error) {
+	row0, col0, ok := g.Cell(x, y)
+	if !ok || g.IsNoData(row0, col0) {
+		return nil, fmt.Errorf("viewshed: observer (%f,%f) is not on the data", x, y)
+	}
+	nrows, ncols := g.Nrows(), g.Ncols()
+	cellsize := float64(g.CellSize())
+
+	result := esri.NewGrid(ncols, nrows)
+	result.SetXllcorner(g.Xllcorner())
+	result.SetYllcorner(g.Yllcorner())
+	result.SetCellSize(g.CellSize())
+	noData := g.NoDataValue()
+	if noData == Visible || noData == Hidden {
+		noData = -9999
+	}
+	result.SetNoDataValue(noData)
+	for row := 0; row < nrows; row++ {
+		for col := 0; col < ncols; col++ {
+			result.SetHeight(row, col, float32(noData))
+		}
+	}
+	result.SetHeight(row0, col0, Visible)
+
+	// The area looked at, in cells.
+	minRow, maxRow, minCol, maxCol := 0, nrows-1, 0, ncols-1
+	radius := math.Inf(1)
+	if options.Radius > 0 {
+		radius = options.Radius / cellsize
+		r := int(math.Ceil(radius))
+		if row0-r > minRow {
+			minRow = row0 - r
+		}
+		if row0+r < maxRow {
+			maxRow = row0 + r
+		}
+		if col0-r > minCol {
+			minCol = col0 - r
+		}
+		if col0+r < maxCol {
+			maxCol = col0 + r
+		}
+	}
+
+	eye := float64(g.Height(row0, col0)) + options.ObserverHeight
+	trace := func(row1, col1 int) {
+		dRow, dCol := row1-row0, col1-col0
+		steps := abs(dRow)
+		if abs(dCol) > steps {
+			steps = abs(dCol)
+		}
+		// The steepest slope so far along the line, in height per cell.
+		horizon := math.Inf(-1)
+		for i := 1; i <= steps; i++ {
+			fr := float64(dRow) * float64(i) / float64(steps)
+			fc := float64(dCol) * float64(i) / float64(steps)
+			distance := math.Hypot(fr, fc)
+			if distance > radius {
+				break
+			}
+			row := row0 + int(math.Round(fr))
+			col := col0 + int(math.Round(fc))
+			if g.IsNoData(row, col) {
+				continue
+			}
+			h := float64(g.Height(row, col))
+			if (h+options.TargetHeight-eye)/distance >= horizon {
+				result.SetHeight(row, col, Visible)
+			} else if result.Height(row, col) != Visible {
+				result.SetHeight(row, col, Hidden)
+			}
+			horizon = math.Max(horizon, (h-eye)/distance)
+		}
+	}
+	for col := minCol; col <= maxCol; col++ {
+		trace(minRow, col)
+		trace(maxRow, col)
+	}
+	for row := minRow + 1; row < maxRow; row++ {
+		trace(row, minCol)
+		trace(row, maxCol)
+	}
+	return result, nil
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,102 @@
+//go:build js && wasm
+
+// The wasm program exposes grid parsing and rendering to JavaScript so that
+// small grids can be drawn entirely in a web browser.  Build it with:
+//
+//	GOOS=js GOARCH=wasm go build -o tiler.wasm ./wasm
+//
+// It defines two global functions, normally used through tiler.js:
+//
+//	tilerParse(data)           - returns the grid's header and height range
+//	tilerRender(data, options) - returns a PNG as a Uint8Array
+//
+// data is the content of an ESRI grid file as a string or a Uint8Array.
+// options may set floor and ceiling.  On failure both return an object with
+// an error property.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image/png"
+	"io"
+	"strings"
+	"syscall/js"
+
+	"github.com/goblimey/tiler/esri"
+	"github.com/goblimey/tiler/render"
+)
+
+func main() {
+	js.Global().Set("tilerParse", js.FuncOf(parse))
+	js.Global().Set("tilerRender", js.FuncOf(draw))
+	// Keep running so that the functions stay available.
+	select {}
+}
+
+func parse(this js.Value, args []js.Value) interface{} {
+	grid, err := readArg(args)
+	if err != nil {
+		return errorResult(err)
+	}
+	return map[string]interface{}{
+		"ncols":     grid.Ncols(),
+		"nrows":     grid.Nrows(),
+		"xllcorner": grid.Xllcorner(),
+		"yllcorner": grid.Yllcorner(),
+		"cellsize":  grid.CellSize(),
+		"nodata":    grid.NoDataValue(),
+		"minHeight": grid.MinHeight(),
+		"maxHeight": grid.MaxHeight(),
+	}
+}
+
+func draw(this js.Value, args []js.Value) interface{} {
+	grid, err := readArg(args)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	floor := grid.MinHeight() - 0.1
+	ceiling := grid.MaxHeight() + 0.1
+	if len(args) > 1 && args[1].Type() == js.TypeObject {
+		if v := args[1].Get("floor"); v.Type() == js.TypeNumber {
+			floor = float32(v.Float())
+		}
+		if v := args[1].Get("ceiling"); v.Type() == js.TypeNumber {
+			ceiling = float32(v.Float())
+		}
+	}
+
+	var buf bytes.Buffer
+	err = png.Encode(&buf, render.GreyImage(grid, floor, ceiling))
+	if err != nil {
+		return errorResult(err)
+	}
+	result := js.Global().Get("Uint8Array").New(buf.Len())
+	js.CopyBytesToJS(result, buf.Bytes())
+	return result
+}
+
+// readArg parses the grid data given as the first argument.
+func readArg(args []js.Value) (*esri.Grid, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("no grid data given")
+	}
+	var in io.Reader
+	switch {
+	case args[0].Type() == js.TypeString:
+		in = strings.NewReader(args[0].String())
+	case args[0].InstanceOf(js.Global().Get("Uint8Array")):
+		data := make([]byte, args[0].Length())
+		js.CopyBytesToGo(data, args[0])
+		in = bytes.NewReader(data)
+	default:
+		return nil, fmt.Errorf("grid data must be a string or a Uint8Array")
+	}
+	return esri.ReadGrid(in)
+}
+
+func errorResult(err error) map[string]interface{} {
+	return map[string]interface{}{"error": err.Error()}
+}
@@ -0,0 +1,26 @@
+// tiler.js loads tiler.wasm and wraps the functions that it defines.
+// wasm_exec.js from the Go distribution must be loaded first.
+//
+//   const tiler = await loadTiler("tiler.wasm");
+//   const info = tiler.parse(text);            // header and height range
+//   const png = tiler.render(text, {floor: 30}); // Uint8Array
+//
+// Both functions take the grid file as a string or a Uint8Array and throw an
+// Error if it can't be read.
+async function loadTiler(url) {
+  const go = new Go();
+  const result = await WebAssembly.instantiateStreaming(fetch(url), go.importObject);
+  go.run(result.instance);
+
+  function check(value) {
+    if (value && value.error !== undefined) {
+      throw new Error(value.error);
+    }
+    return value;
+  }
+
+  return {
+    parse: data => check(tilerParse(data)),
+    render: (data, options) => check(tilerRender(data, options || {})),
+  };
+}